@@ -2,39 +2,126 @@ package dapper
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	ErrNoTableName  = errors.New("dapper: no table name specified")
 	ErrNoPrimaryKey = errors.New("dapper: no primary key column specified")
+	ErrStaleObject  = errors.New("dapper: entity has been modified or deleted concurrently")
+	ErrReadOnly     = errors.New("dapper: view is read-only")
+	ErrSQLTooLong   = errors.New("dapper: statement exceeds maximum SQL length")
+	ErrUnscopedSQL  = errors.New("dapper: SQL of a scoped session must be built with Session.Q")
+
+	// ErrOneToOneNotPointer is returned when loading a oneToOne
+	// association into a field that is not a pointer.
+	ErrOneToOneNotPointer = errors.New("dapper: a field marked with oneToOne must be a pointer")
+	// ErrOneToManyNotSlice is returned when loading a oneToMany
+	// association into a field that is not a slice.
+	ErrOneToManyNotSlice = errors.New("dapper: a field marked with oneToMany must be a slice")
+
+	// reSelectStar matches the projection of a query that selects all
+	// columns, see finder.Select.
+	reSelectStar = regexp.MustCompile(`(?i)^\s*SELECT\s+\*`)
 )
 
+const (
+	// DefaultMaxInClauseSize is the default number of values in a single
+	// IN (...) clause when loading associations.
+	DefaultMaxInClauseSize = 1000
+)
+
+// Logger is the interface for logging SQL statements if debugging is
+// enabled. It is implemented by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
 // Session represents an interface to a database.
 type Session struct {
-	db      *sql.DB
-	dialect Dialect
-	debug   bool
+	db              *sql.DB
+	dialect         Dialect
+	debug           bool
+	logger          Logger
+	maxInClauseSize int
+	maxSQLLength    int
+	rewriteSQL      func(string) string
+	paramsByColumn  bool
+	utc             bool
+	scopeColumn     string
+	scopeValue      interface{}
+	stmtsMu         *sync.Mutex    // guards stmts and ownsStmts
+	stmts           *stmtCache     // prepared statements, see CacheStatements
+	ownsStmts       bool           // stmts has been created by this session, not by the one it was copied from
+	args            *[]interface{} // collects bound values, see withArgs
+
+	snapshotsMu *sync.Mutex                            // guards snapshots
+	snapshots   map[identityKey]map[string]interface{} // column values of tracked entities
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 // Finder is a type for querying the database.
 type finder struct {
 	session  *Session
-	db       *sql.DB
+	db       queryer
 	sqlQuery string
+	query    *Query // the query sqlQuery was rendered from, see FindQuery
 	param    interface{}
 	debug    bool
 	includes []string
+	visited  identityMap
+
+	withDeleted bool
+	assoc       *Session        // loads associations, if not session
+	err         error           // returned on execution, e.g. from Related
+	tops        map[string]topN // limits of oneToMany associations, see IncludeTop
+	selected    []string        // columns to select, see Select
+}
+
+// topN limits a oneToMany association to the first n children per
+// parent in the given order.
+type topN struct {
+	n       int
+	orderBy string
 }
 
-// New creates a Session from a database connection.
+// New creates a Session from a database connection. The dialect is
+// detected from the driver of db (see DetectDialect), and defaults to
+// MySQL if the driver is unknown. Use Dialect to set it explicitly.
 func New(db *sql.DB) *Session {
-	return &Session{db: db, dialect: MySQL, debug: false}
+	dialect, err := DetectDialect(db)
+	if err != nil {
+		dialect = MySQL
+	}
+	return &Session{
+		db:              db,
+		dialect:         dialect,
+		debug:           false,
+		maxInClauseSize: DefaultMaxInClauseSize,
+		stmtsMu:         &sync.Mutex{},
+		snapshotsMu:     &sync.Mutex{},
+		snapshots:       make(map[identityKey]map[string]interface{}),
+	}
 }
 
 // Dialect allows for specific SQL dialects.
@@ -44,6 +131,23 @@ func (s *Session) Dialect(dialect Dialect) *Session {
 	} else {
 		s.dialect = MySQL
 	}
+	if s.utc {
+		s.UTC(true)
+	}
+	return s
+}
+
+// UTC makes the session convert times to UTC before writing them, e.g.
+// for columns without timezone, both as SQL literals and as bound
+// parameters (see CacheStatements). It only applies to this session:
+// the session gets its own copy of the dialect (see UTCDialect), so
+// e.g. the package-level MySQL dialect is left unchanged. Dialects that
+// don't implement UTCDialect only convert bound parameters.
+func (s *Session) UTC(utc bool) *Session {
+	s.utc = utc
+	if d, ok := s.dialect.(UTCDialect); ok {
+		s.dialect = d.WithUTC(utc)
+	}
 	return s
 }
 
@@ -58,19 +162,321 @@ func (s *Session) Debug(debug bool) *Session {
 	return s
 }
 
-// Q starts a query in the session's dialect.
+// SetLogger sets the logger for the output of SQL statements if debugging
+// is enabled. If logger is nil, the standard log package is used.
+func (s *Session) SetLogger(logger Logger) *Session {
+	s.logger = logger
+	return s
+}
+
+// logf writes to the logger of the session.
+func (s *Session) logf(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
+}
+
+// MaxInClauseSize sets the maximum number of values in a single IN (...)
+// clause used to load associations. If there are more ids to load, the
+// ids are split into several queries. A value <= 0 disables batching.
+func (s *Session) MaxInClauseSize(size int) *Session {
+	s.maxInClauseSize = size
+	return s
+}
+
+// MaxSQLLength sets the maximum length of a statement in bytes. Executing
+// a longer statement fails with ErrSQLTooLong before it is sent to the
+// database, e.g. to catch runaway IN (...) lists. A value <= 0 disables
+// the check, which is the default.
+func (s *Session) MaxSQLLength(n int) *Session {
+	s.maxSQLLength = n
+	return s
+}
+
+// RewriteSQL registers fn to rewrite every statement right before it is
+// executed, e.g. to prepend a /* request_id=... */ comment for slow-query
+// attribution or to force index hints. Passing nil removes the rewriter.
+func (s *Session) RewriteSQL(fn func(sql string) string) *Session {
+	s.rewriteSQL = fn
+	return s
+}
+
+// rewrite returns query as rewritten by the function set via RewriteSQL.
+func (s *Session) rewrite(query string) string {
+	if s.rewriteSQL == nil {
+		return query
+	}
+	return s.rewriteSQL(query)
+}
+
+// CacheStatements makes Insert, Update, Delete, and HardDelete pass
+// values as bound parameters and reuse prepared statements, keeping the
+// size most recently used ones. Repeated statements for the same type
+// are then parsed by the database only once. A size <= 0 disables the
+// cache, which is the default. Use Close to release the statements.
+//
+// Notice that values are passed to the driver as-is, e.g. time.Time,
+// so the driver must support them (e.g. parseTime=true for MySQL).
+//
+// Copies of the session, e.g. from Scope or Unscoped, share its cache.
+// Calling CacheStatements on a copy gives the copy a cache of its own
+// and leaves the cache of the original session alone.
+func (s *Session) CacheStatements(size int) *Session {
+	s.stmtsMu.Lock()
+	defer s.stmtsMu.Unlock()
+	if s.stmts != nil && s.ownsStmts {
+		s.stmts.close()
+	}
+	s.stmts, s.ownsStmts = nil, false
+	if size > 0 {
+		s.stmts, s.ownsStmts = newStmtCache(size), true
+	}
+	return s
+}
+
+// Close releases the prepared statements cached by the session (see
+// CacheStatements). It does not close the database. Closing a copy of
+// the session, e.g. from Scope or Unscoped, doesn't release the cache
+// it shares with the original session. Close can be called repeatedly.
+func (s *Session) Close() error {
+	s.stmtsMu.Lock()
+	defer s.stmtsMu.Unlock()
+	if s.stmts != nil && s.ownsStmts {
+		s.stmts.close()
+	}
+	return nil
+}
+
+// stmtCache returns the cache of prepared statements of the session,
+// or nil if statement caching is disabled.
+func (s *Session) stmtCache() *stmtCache {
+	s.stmtsMu.Lock()
+	defer s.stmtsMu.Unlock()
+	return s.stmts
+}
+
+// copy returns a shallow copy of the session, sharing its cache of
+// prepared statements.
+func (s *Session) copy() *Session {
+	s.stmtsMu.Lock()
+	defer s.stmtsMu.Unlock()
+	c := *s
+	c.ownsStmts = false
+	return &c
+}
+
+// StmtCacheStats returns the number of prepared statements cached by the
+// session (see CacheStatements), and how many statements have been
+// served from the cache (hits) or had to be prepared (misses) so far.
+// All are 0 if statement caching is disabled.
+func (s *Session) StmtCacheStats() (size, hits, misses int) {
+	stmts := s.stmtCache()
+	if stmts == nil {
+		return 0, 0, 0
+	}
+	return stmts.stats()
+}
+
+// ClearStmtCache closes and removes all prepared statements cached by
+// the session, e.g. after a schema change, including those of copies
+// sharing the cache (see CacheStatements). Statements in use are closed
+// after their last use. Caching stays enabled, and the counters of
+// StmtCacheStats are kept.
+func (s *Session) ClearStmtCache() {
+	if stmts := s.stmtCache(); stmts != nil {
+		stmts.close()
+	}
+}
+
+// withArgs returns the SQL generated by gen. If statement caching is
+// enabled, gen gets a copy of the session that renders values as bound
+// parameters, which are returned as args. Otherwise, gen gets the
+// session itself, values are rendered as SQL literals, and args is nil.
+func (s *Session) withArgs(gen func(s *Session) (string, error)) (string, []interface{}, error) {
+	if s.stmtCache() == nil {
+		sql, err := gen(s)
+		return sql, nil, err
+	}
+	args := make([]interface{}, 0)
+	b := s.copy()
+	b.args = &args
+	sql, err := gen(b)
+	return sql, args, err
+}
+
+// bind returns value as an SQL literal, or as a placeholder of the
+// dialect if the session collects bound parameters (see withArgs).
+func (s *Session) bind(value interface{}) (string, error) {
+	if s.args == nil {
+		return QuoteValue(s.dialect, value)
+	}
+	value, err := bindValue(value)
+	if err != nil {
+		return "", err
+	}
+	if s.utc {
+		value = toUTC(value)
+	}
+	*s.args = append(*s.args, value)
+	return placeholder(s.dialect, len(*s.args)), nil
+}
+
+// toUTC returns value converted to UTC if it is a time.Time or a non-nil
+// *time.Time, and value itself otherwise.
+func toUTC(value interface{}) interface{} {
+	switch t := value.(type) {
+	case time.Time:
+		return t.UTC()
+	case *time.Time:
+		if t != nil {
+			return t.UTC()
+		}
+	}
+	return value
+}
+
+// checkSQL returns ErrSQLTooLong if query exceeds the maximum SQL length.
+func (s *Session) checkSQL(query string) error {
+	if s.maxSQLLength > 0 && len(query) > s.maxSQLLength {
+		return ErrSQLTooLong
+	}
+	return nil
+}
+
+// prepareSQL returns query as it is sent to the database, i.e. rewritten
+// by the function set via RewriteSQL, and checked with checkSQL. If debug
+// is true, the rewritten query is logged with its bound values args.
+func (s *Session) prepareSQL(query string, args []interface{}, debug bool) (string, error) {
+	query = s.rewrite(query)
+	if err := s.checkSQL(query); err != nil {
+		return "", err
+	}
+	if debug {
+		s.logArgs(query, args)
+	}
+	return query, nil
+}
+
+// ParamsByColumn allows the parameters of Find to be referenced by column
+// name as well, e.g. as :user_id for a field UserId if the naming strategy
+// is SnakeCaseNaming (see SetNamingStrategy) or the field is tagged with
+// `dapper:"user_id"`. This is consistent with the column names used when
+// building queries with Q. Referencing parameters by field name, e.g. as
+// :UserId, still works.
+func (s *Session) ParamsByColumn(enabled bool) *Session {
+	s.paramsByColumn = enabled
+	return s
+}
+
+// Scope returns a copy of the session that restricts all statements to
+// rows where column equals value, e.g. for row-level multi-tenancy. This
+// applies to queries built with Q, to Get, to loading associations, and
+// to the WHERE clause of Update and Delete. SQL passed to Find or Count
+// as a string cannot be scoped, so it fails with ErrUnscopedSQL; build
+// it with Q and use FindQuery or CountQuery instead. Use Unscoped to
+// bypass the scope.
+func (s *Session) Scope(column string, value interface{}) *Session {
+	c := s.copy()
+	c.scopeColumn = column
+	c.scopeValue = value
+	return c
+}
+
+// Unscoped returns a copy of the session without the scope set via Scope.
+// The copy shares the database connection, the cache of prepared
+// statements, and tracked entities with s.
+func (s *Session) Unscoped() *Session {
+	return s.Scope("", nil)
+}
+
+// Q starts a query in the session's dialect. If the session is scoped,
+// the scope is added to the WHERE clause, qualified with the alias of
+// the table if it has one (see Query.Alias).
 func (s *Session) Q(table string) *Query {
-	return Q(s.dialect, table)
+	q := Q(s.dialect, table)
+	if s.scopeColumn != "" {
+		q.Where().eqQualified(s.scopeColumn, s.scopeValue)
+		q.scoped = true
+	}
+	return q
+}
+
+// scopeSql returns the condition to add to the WHERE clause of UPDATE
+// and DELETE statements if the session is scoped, or an empty string.
+func (s *Session) scopeSql() (string, error) {
+	if s.scopeColumn == "" {
+		return "", nil
+	}
+	quoted, err := QuoteValue(s.dialect, s.scopeValue)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(" AND %s=%s", s.dialect.EscapeColumnName(s.scopeColumn), quoted), nil
 }
 
 // Find opens up the query interface of a Session.
 // Parameters in sql start with a colon and will be substituted by the
 // corresponding field in the param object. If there are no substitutions,
-// pass nil as param.
+// pass nil as param. If the session is scoped, the query fails with
+// ErrUnscopedSQL (see FindQuery).
 func (s *Session) Find(sql string, param interface{}) *finder {
+	return s.findSQL(s.db, sql, param)
+}
+
+// FindTx opens up the query interface of a Session, but runs all queries
+// in a transaction, so they can see uncommitted changes of tx.
+// See Find for details.
+func (s *Session) FindTx(tx *sql.Tx, sql string, param interface{}) *finder {
+	return s.findSQL(tx, sql, param)
+}
+
+// FindQuery opens up the query interface of a Session for the query q.
+// If the session is scoped, q must have been built with Q, so that it
+// is scoped as well; otherwise the query fails with ErrUnscopedSQL.
+//
+// Example:
+// var tweets []tweet
+// err := session.FindQuery(session.Q("tweets").Where().Eq("retweets", 0).Query()).All(&tweets)
+func (s *Session) FindQuery(q *Query) *finder {
+	f := s.findQuery(s.db, q, q.Sql())
+	f.query = q
+	return f
+}
+
+// FindQueryTx is like FindQuery, but runs all queries in a transaction.
+func (s *Session) FindQueryTx(tx *sql.Tx, q *Query) *finder {
+	f := s.findQuery(tx, q, q.Sql())
+	f.query = q
+	return f
+}
+
+// findSQL is find for SQL passed as a string, which cannot be scoped.
+func (s *Session) findSQL(db queryer, sql string, param interface{}) *finder {
+	f := s.find(db, sql, param)
+	if s.scopeColumn != "" {
+		f.err = ErrUnscopedSQL
+	}
+	return f
+}
+
+// findQuery is find for sql, rendered from q. It fails if the session is
+// scoped, but q or one of the queries in its unions is not.
+func (s *Session) findQuery(db queryer, q *Query, sql string) *finder {
+	f := s.find(db, sql, nil)
+	if s.scopeColumn != "" && !q.isScoped() {
+		f.err = ErrUnscopedSQL
+	}
+	return f
+}
+
+// find opens up the query interface of a Session and runs all queries,
+// including the ones to load associations, via db.
+func (s *Session) find(db queryer, sql string, param interface{}) *finder {
 	return &finder{
 		session:  s,
-		db:       s.db,
+		db:       db,
 		sqlQuery: sql,
 		param:    param,
 		debug:    s.debug,
@@ -90,36 +496,176 @@ func (f *finder) Debug(debug bool) *finder {
 // `dapper:"oneToOne=<table_name>.<foreign_key>"`
 // in the table setup.
 // The <table_name> can be omitted if it is unambigious.
+//
+// Associations of associations can be loaded with a dot-separated path,
+// e.g. Include("Items.Order") loads the items and the order of each item.
+// Every level strips one segment of the path, so cyclic associations
+// (Order→Items→Order) only get loaded as deep as the path goes.
 func (f *finder) Include(associations ...string) *finder {
 	f.includes = append(f.includes, associations...)
 	return f
 }
 
+// IncludeTop adds the oneToMany association assocName, but only loads the
+// first n children of each parent, ordered by orderBy, e.g. "created DESC"
+// to load the most recent ones. Dialects that support window functions
+// (see WindowFunctionDialect) load them with a single query
+// using ROW_NUMBER(), others with a query per parent.
+//
+// IncludeTop only applies to associations of the results, not to
+// dot-separated paths.
+func (f *finder) IncludeTop(assocName string, n int, orderBy string) *finder {
+	if f.tops == nil {
+		f.tops = make(map[string]topN)
+	}
+	f.tops[assocName] = topN{n: n, orderBy: orderBy}
+	return f.Include(assocName)
+}
+
+// IncludeWith loads the associations (see Include) via the session s
+// instead, e.g. to send the queries for child records to a read replica.
+// The nested associations of those records are loaded via s, too.
+func (f *finder) IncludeWith(s *Session) *finder {
+	f.assoc = s
+	return f
+}
+
+// associations returns the session and connection to load associations.
+func (f *finder) associations() (*Session, queryer) {
+	if f.assoc != nil {
+		return f.assoc, f.assoc.db
+	}
+	return f.session, f.db
+}
+
+// Select restricts the results to columns, e.g. to load only the id and
+// name of users into a full user struct. The other fields of the results
+// are left untouched. Select replaces the * of a query starting with
+// SELECT *, as with Find("select * from users", nil) or FindBy. The
+// columns must be mapped by the result type of Single or All.
+//
+// Notice that associations can only be loaded if the columns they
+// refer to, e.g. the primary key, are selected.
+func (f *finder) Select(columns ...string) *finder {
+	loc := reSelectStar.FindStringIndex(f.sqlQuery)
+	if loc == nil {
+		if f.err == nil {
+			f.err = errors.New("dapper: Select requires a query starting with SELECT *")
+		}
+		return f
+	}
+	f.selected = columns
+	f.sqlQuery = f.selectSql(f.sqlQuery)
+	return f
+}
+
+// selectSql replaces the SELECT * of sql with the columns passed to
+// Select, e.g. after rendering the query of the finder again.
+func (f *finder) selectSql(sql string) string {
+	loc := reSelectStar.FindStringIndex(sql)
+	if loc == nil || len(f.selected) == 0 {
+		return sql
+	}
+	escaped := make([]string, len(f.selected))
+	for i, column := range f.selected {
+		escaped[i] = f.session.dialect.EscapeColumnName(column)
+	}
+	return sql[:loc[0]] + "SELECT " + strings.Join(escaped, ",") + sql[loc[1]:]
+}
+
+// checkSelected returns an error if a column passed to Select is not
+// mapped by ti.
+func (f *finder) checkSelected(ti *typeInfo) error {
+	for _, column := range f.selected {
+		if _, found := ti.ColumnInfos[column]; !found {
+			return fmt.Errorf("dapper: type %s has no column %s", ti.Type, column)
+		}
+	}
+	return nil
+}
+
+// WithDeleted includes soft-deleted entities in the results. By default,
+// entities whose soft delete column is set are skipped. Notice that they
+// are skipped after being loaded, so exclude them in the SQL if you
+// need e.g. a LIMIT to be exact.
+func (f *finder) WithDeleted() *finder {
+	f.withDeleted = true
+	return f
+}
+
 // ---- Get ------------------------------------------------------------------
 
-// Get loads an entity by its primary key.
+// Get loads an entity by its primary key. For composite primary keys,
+// pass the values in the order of the primary key fields in the struct.
 //
 // Example:
 // var out Order
 // err := session.Get(1).Do(&out)
-func (s *Session) Get(pk interface{}) *getRequest {
+// var role UserRole
+// err := session.Get(userId, roleId).Do(&role)
+func (s *Session) Get(pks ...interface{}) *getRequest {
 	return &getRequest{
 		s:        s,
 		db:       s.db,
-		pk:       pk,
+		pks:      pks,
 		debug:    s.debug,
 		includes: make([]string, 0),
 	}
 }
 
+// checkPrimaryKeyValue returns an error if value cannot be the value of
+// the primary key field pk of gotype, e.g. a string for an int64 field.
+// Integers of different sizes are accepted, and so are values that
+// implement driver.Valuer, as their kind says nothing about the value.
+func checkPrimaryKeyValue(gotype reflect.Type, pk *fieldInfo, value interface{}) error {
+	if value == nil {
+		return fmt.Errorf("dapper: value of primary key %s of type %s is nil", pk.FieldName, gotype)
+	}
+	if _, ok := value.(driver.Valuer); ok {
+		return nil
+	}
+	want, got := kindClass(pk.Type), kindClass(reflect.TypeOf(value))
+	if want != "" && got != want {
+		return fmt.Errorf("dapper: value %v of type %T does not match primary key %s of type %s in %s",
+			value, value, pk.FieldName, pk.Type, gotype)
+	}
+	return nil
+}
+
+// kindClass returns the class of the kind of t, following pointers, i.e.
+// "integer", "float", "string", or "bool", or an empty string for any
+// other kind.
+func kindClass(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	}
+	return ""
+}
+
 // getRequest encapsulates a request for an entity by its primary key
 // via the Get method.
 type getRequest struct {
 	s        *Session
-	db       *sql.DB
-	pk       interface{}
+	db       queryer
+	pks      []interface{}
 	debug    bool
 	includes []string
+	alias    string
+
+	withDeleted bool
+	assoc       *Session        // loads associations, if not s
+	tops        map[string]topN // limits of oneToMany associations, see IncludeTop
 }
 
 // Debug enables or disables output of the SQL statements to the logger.
@@ -133,11 +679,45 @@ func (r *getRequest) Debug(debug bool) *getRequest {
 // `dapper:"oneToMany=<table_name>.<foreign_key>"` or
 // `dapper:"oneToOne=<table_name>.<foreign_key>"`
 // in the table setup.
+//
+// Use a dot-separated path like "Items.Order" to load nested associations.
 func (r *getRequest) Include(associations ...string) *getRequest {
 	r.includes = append(r.includes, associations...)
 	return r
 }
 
+// IncludeTop adds the oneToMany association assocName, but only loads
+// the first n children ordered by orderBy. See finder.IncludeTop.
+func (r *getRequest) IncludeTop(assocName string, n int, orderBy string) *getRequest {
+	if r.tops == nil {
+		r.tops = make(map[string]topN)
+	}
+	r.tops[assocName] = topN{n: n, orderBy: orderBy}
+	return r.Include(assocName)
+}
+
+// IncludeWith loads the associations (see Include) via the session s
+// instead, e.g. to send the queries for child records to a read replica.
+func (r *getRequest) IncludeWith(s *Session) *getRequest {
+	r.assoc = s
+	return r
+}
+
+// Alias selects from the table under the given alias, e.g. to reference
+// the table in a RewriteSQL function or in an index hint. The columns of
+// the WHERE clause are qualified with the alias.
+func (r *getRequest) Alias(alias string) *getRequest {
+	r.alias = alias
+	return r
+}
+
+// WithDeleted loads the entity even if it has been soft-deleted.
+// By default, Get returns sql.ErrNoRows for soft-deleted entities.
+func (r *getRequest) WithDeleted() *getRequest {
+	r.withDeleted = true
+	return r
+}
+
 // Do executes the getRequest and returns the loaded entity in the result.
 // If everything is okay, nil is returned. If the entity cannot be found,
 // sql.ErrNoRows is returned.
@@ -157,15 +737,34 @@ func (r *getRequest) Do(result interface{}) error {
 	}
 
 	tableName := resultInfo.TableName
-	pkCol, found := resultInfo.GetPrimaryKey()
-	if !found {
+	pkCols := resultInfo.GetPrimaryKeys()
+	if len(pkCols) == 0 {
 		return ErrNoPrimaryKey
 	}
+	if len(pkCols) != len(r.pks) {
+		return fmt.Errorf("dapper: type %s has %d primary key columns, got %d values", gotype, len(pkCols), len(r.pks))
+	}
+	for i, pkCol := range pkCols {
+		if err := checkPrimaryKeyValue(gotype, pkCol, r.pks[i]); err != nil {
+			return err
+		}
+	}
 
-	sqlQuery := r.s.Q(tableName).Where().Eq(pkCol.ColumnName, r.pk).Sql()
-
-	if r.debug {
-		log.Println(sqlQuery)
+	d := r.s.dialect
+	q := r.s.Q(d.EscapeTableName(tableName))
+	if r.alias != "" {
+		q.Alias(r.alias)
+	}
+	where := q.Where()
+	for i, pkCol := range pkCols {
+		where = where.Eq(q.Qualify(d.EscapeColumnName(pkCol.ColumnName)), r.pks[i])
+	}
+	if sd, found := resultInfo.GetSoftDelete(); found && !r.withDeleted {
+		where = where.Eq(q.Qualify(d.EscapeColumnName(sd.ColumnName)), nil)
+	}
+	sqlQuery, err := r.s.prepareSQL(where.Sql(), nil, r.debug)
+	if err != nil {
+		return err
 	}
 
 	// We use Query instead of QueryRow, because row does not contain
@@ -187,8 +786,8 @@ func (r *getRequest) Do(result interface{}) error {
 		for _, dbColName := range dbColumnNames {
 			fi, found := resultInfo.ColumnInfos[dbColName]
 			if found {
-				field := resultValue.Elem().FieldByName(fi.FieldName)
-				resultFields = append(resultFields, field.Addr().Interface())
+				field := resultValue.Elem().FieldByIndex(fi.Index)
+				resultFields = append(resultFields, scanTarget(fi, field))
 			} else {
 				// Ignore missing columns
 				resultFields = append(resultFields, &placeholder)
@@ -207,12 +806,21 @@ func (r *getRequest) Do(result interface{}) error {
 		}
 
 		// Load associations
-		err = r.s.loadAssociations(gotype, resultInfo, resultValue, r.includes)
+		visited := make(identityMap)
+		visited.add(resultInfo, resultValue)
+		assocSession, assocDB := r.s, r.db
+		if r.assoc != nil {
+			assocSession, assocDB = r.assoc, r.assoc.db
+		}
+		err = assocSession.loadAssociations(assocDB, visited, gotype, resultInfo, resultValue, r.includes, r.tops)
 		if err != nil {
 			return err
 		}
 
 	} else {
+		if err := rows.Err(); err != nil {
+			return err
+		}
 		// If there's no row, we should return sql.ErrNoRows
 		return sql.ErrNoRows
 	}
@@ -244,34 +852,18 @@ func (q *finder) Single(result interface{}) error {
 	if err != nil {
 		return err
 	}
+	if err := q.checkSelected(resultInfo); err != nil {
+		return err
+	}
 
-	// Get information about param
-	sqlQuery := q.sqlQuery
-	if q.param != nil {
-		paramValue := reflect.ValueOf(q.param)
-		if paramValue.Kind() == reflect.Ptr {
-			paramValue = paramValue.Elem()
-		}
-		paramInfo, err := AddType(paramValue.Type())
-		if err != nil {
-			return err
-		}
-
-		// Substitute parameters in SQL statement
-		for paramName, fi := range paramInfo.FieldInfos {
-			if fi.IsTransient {
-				continue
-			}
-			// Get value of field in param
-			field := paramValue.FieldByName(paramName)
-			value := field.Interface()
-			quoted := Quote(q.session.dialect, value)
-			sqlQuery = strings.Replace(sqlQuery, ":"+paramName, quoted, -1)
-		}
+	sqlQuery, err := q.substituteParams()
+	if err != nil {
+		return err
 	}
 
-	if q.debug {
-		log.Println(sqlQuery)
+	sqlQuery, err = q.session.prepareSQL(sqlQuery, nil, q.debug)
+	if err != nil {
+		return err
 	}
 
 	// We use Query instead of QueryRow, because row does not contain Column information
@@ -283,7 +875,7 @@ func (q *finder) Single(result interface{}) error {
 
 	// Scan fills all fields in dst here
 	var placeholder interface{}
-	if rows.Next() {
+	for rows.Next() {
 		resultFields := make([]interface{}, 0)
 		dbColumnNames, err := rows.Columns()
 		if err != nil {
@@ -292,8 +884,8 @@ func (q *finder) Single(result interface{}) error {
 		for _, dbColName := range dbColumnNames {
 			fi, found := resultInfo.ColumnInfos[dbColName]
 			if found {
-				field := resultValue.Elem().FieldByName(fi.FieldName)
-				resultFields = append(resultFields, field.Addr().Interface())
+				field := resultValue.Elem().FieldByIndex(fi.Index)
+				resultFields = append(resultFields, scanTarget(fi, field))
 			} else {
 				// Ignore missing columns
 				resultFields = append(resultFields, &placeholder)
@@ -311,17 +903,149 @@ func (q *finder) Single(result interface{}) error {
 			return err
 		}
 
+		// Skip soft-deleted entities
+		if !q.withDeleted && resultInfo.isSoftDeleted(resultValue) {
+			continue
+		}
+
 		// Load associations
-		err = q.session.loadAssociations(gotype, resultInfo, resultValue, q.includes)
+		visited := q.visited
+		if visited == nil {
+			visited = make(identityMap)
+		}
+		visited.add(resultInfo, resultValue)
+		assocSession, assocDB := q.associations()
+		return assocSession.loadAssociations(assocDB, visited, gotype, resultInfo, resultValue, q.includes, q.tops)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// If there's no row, we should return sql.ErrNoRows
+	return sql.ErrNoRows
+}
+
+// ---- First and Last ------------------------------------------------------
+
+// First is like Single, but orders the results by the primary key of
+// result in ascending order and only fetches the first row. The SQL
+// query must not have an ORDER BY or LIMIT clause of its own.
+// If there is no row, sql.ErrNoRows is returned.
+//
+// Unless WithDeleted is set, soft-deleted entities of the result type
+// are skipped. For queries built with Q (see FindQuery), they are
+// filtered in the database; for SQL strings, the rows are read until
+// the first entity that is not deleted.
+//
+// Example:
+// var u User
+// err := session.Find("select * from users where karma > 10", nil).First(&u)
+func (q *finder) First(result interface{}) error {
+	return q.firstOrLast(result, "ASC")
+}
+
+// Last is like First, but returns the row with the highest primary key.
+func (q *finder) Last(result interface{}) error {
+	return q.firstOrLast(result, "DESC")
+}
+
+func (q *finder) firstOrLast(result interface{}, dir string) error {
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr {
+		return errors.New("result must be a pointer to a struct")
+	}
+	ti, err := AddType(resultv.Elem().Type())
+	if err != nil {
+		return err
+	}
+	pk, found := ti.GetPrimaryKey()
+	if !found {
+		return ErrNoPrimaryKey
+	}
+
+	sqlQuery := q.sqlQuery
+	limit := 1
+	if sd, found := ti.GetSoftDelete(); found && !q.withDeleted {
+		if q.query != nil {
+			// Filter soft-deleted entities in the database
+			sqlQuery = q.selectSql(q.query.sqlWithIsNull(q.session.dialect.EscapeColumnName(sd.ColumnName)))
+		} else {
+			// SQL strings cannot be changed, so Single skips them
+			limit = -1
+		}
+	}
+	sqlQuery = fmt.Sprintf("%s ORDER BY %s %s",
+		strings.TrimRight(sqlQuery, "; \t\r\n"),
+		q.session.dialect.EscapeColumnName(pk.ColumnName),
+		dir)
+
+	f := *q
+	f.sqlQuery = q.session.dialect.GetLimitString(sqlQuery, -1, limit)
+	return f.Single(result)
+}
+
+// ---- Page ----------------------------------------------------------------
+
+// Page returns page (starting at 1) of size results of the SQL query in
+// result, together with the total number of results of the query. It
+// runs a COUNT query for the total and the SQL query limited by the
+// dialect for the page. The result parameter must be a pointer to a
+// slice. The SQL query must not have a LIMIT clause of its own, and it
+// should have an ORDER BY clause so that the pages are stable.
+//
+// Unless WithDeleted is set, soft-deleted entities of the result type
+// are skipped. For queries built with Q (see FindQuery), they are
+// filtered in the database, so they are neither counted nor returned,
+// and pages stay full. SQL strings cannot be changed, so their results
+// are filtered after loading as in All; add the condition to the SQL to
+// keep pages full.
+//
+// Example:
+// var tweets []Tweet
+// total, err := session.Find("select * from tweets where user_id=:UserId order by id",
+//     param).Page(2, 20, &tweets)
+func (q *finder) Page(page, size int, result interface{}) (int64, error) {
+	if page < 1 {
+		return 0, fmt.Errorf("dapper: invalid page %d, pages start at 1", page)
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("dapper: invalid page size %d, must be positive", size)
+	}
+	sqlQuery := strings.TrimRight(q.sqlQuery, "; \t\r\n")
+
+	// Filter soft-deleted entities in the database, so pages stay full
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		return 0, errors.New("result must be a pointer to a slice")
+	}
+	elemt := resultv.Elem().Type().Elem()
+	if elemt.Kind() == reflect.Ptr {
+		elemt = elemt.Elem()
+	}
+	if elemt.Kind() == reflect.Struct && !q.withDeleted && q.query != nil {
+		ti, err := AddType(elemt)
 		if err != nil {
-			return err
+			return 0, err
+		}
+		if sd, found := ti.GetSoftDelete(); found {
+			sqlQuery = q.selectSql(q.query.sqlWithIsNull(q.session.dialect.EscapeColumnName(sd.ColumnName)))
 		}
-	} else {
-		// If there's no row, we should return sql.ErrNoRows
-		return sql.ErrNoRows
 	}
 
-	return nil
+	var total int64
+	count := *q
+	count.includes = nil
+	count.sqlQuery = "SELECT COUNT(*) FROM (" + sqlQuery + ") dapper_page"
+	if err := count.Scalar(&total); err != nil {
+		return 0, err
+	}
+
+	f := *q
+	f.sqlQuery = q.session.dialect.GetLimitString(sqlQuery, (page-1)*size, size)
+	if err := f.All(result); err != nil {
+		return 0, err
+	}
+	return total, nil
 }
 
 // ---- All -----------------------------------------------------------------
@@ -358,67 +1082,59 @@ func (q *finder) All(result interface{}) error {
 	if err != nil {
 		return err
 	}
-
-	// Get information about param
-	sqlQuery := q.sqlQuery
-	if q.param != nil {
-		paramValue := reflect.ValueOf(q.param)
-		if paramValue.Kind() == reflect.Ptr {
-			paramValue = paramValue.Elem()
-		}
-		paramInfo, err := AddType(paramValue.Type())
-		if err != nil {
-			return err
-		}
-
-		// Substitute parameters in SQL statement
-		for paramName, fi := range paramInfo.FieldInfos {
-			if fi.IsTransient {
-				continue
-			}
-			// Get value of field in param
-			field := paramValue.FieldByName(paramName)
-			value := field.Interface()
-			quoted := Quote(q.session.dialect, value)
-			sqlQuery = strings.Replace(sqlQuery, ":"+paramName, quoted, -1)
-		}
+	if err := q.checkSelected(resultInfo); err != nil {
+		return err
 	}
 
-	if q.debug {
-		log.Println(sqlQuery)
+	sqlQuery, err := q.substituteParams()
+	if err != nil {
+		return err
 	}
 
+	sqlQuery, err = q.session.prepareSQL(sqlQuery, nil, q.debug)
+	if err != nil {
+		return err
+	}
 	rows, err := q.db.Query(sqlQuery)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
+	// Entities already loaded while resolving associations are
+	// re-used by reference instead of being loaded twice. The results
+	// of the query itself are returned as scanned, even with duplicate
+	// primary keys, e.g. from a join, and only registered for their
+	// associations to reference them.
+	visited := q.visited
+	resolving := visited != nil
+	if !resolving {
+		visited = make(identityMap)
+	}
+	reused := make(map[int]bool)
+
+	// Resolve the columns to fields once, not for every row
+	dbColumnNames, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	columns := resolveColumnFields(resultInfo, dbColumnNames)
+
 	i := 0
 	var placeholder interface{}
 	for rows.Next() {
 		// Prepare destination fields for Scan
 		singleResult := reflect.New(gotype)
 
-		resultFields := make([]interface{}, 0)
-		dbColumnNames, err := rows.Columns()
-		if err != nil {
-			return err
-		}
-		for _, dbColName := range dbColumnNames {
-			fi, found := resultInfo.ColumnInfos[dbColName]
-			if found {
-				field := singleResult.Elem().FieldByName(fi.FieldName)
-				resultFields = append(resultFields, field.Addr().Interface())
-			} else {
+		resultFields := make([]interface{}, len(columns))
+		for k, fi := range columns {
+			if fi == nil {
 				// Ignore missing columns
-				resultFields = append(resultFields, &placeholder)
-				/*
-					return nil, errors.New(
-						fmt.Sprintf("type %s: found no corresponding mapping "+
-							"for column %s in result", gotype, dbColName))
-					//*/
+				resultFields[k] = &placeholder
+				continue
 			}
+			field := singleResult.Elem().FieldByIndex(fi.Index)
+			resultFields[k] = scanTarget(fi, field)
 		}
 
 		// Scan fills all fields in singleResult here
@@ -427,158 +1143,278 @@ func (q *finder) All(result interface{}) error {
 			return err
 		}
 
+		// Skip soft-deleted entities
+		if !q.withDeleted && resultInfo.isSoftDeleted(singleResult) {
+			continue
+		}
+
 		// Add resultFields to slice
 		if elemIsPtr {
-			slicev = reflect.Append(slicev, singleResult.Elem().Addr())
+			if existing, added := visited.add(resultInfo, singleResult); !added && resolving {
+				slicev = reflect.Append(slicev, existing)
+				reused[i] = true
+			} else {
+				slicev = reflect.Append(slicev, singleResult.Elem().Addr())
+			}
 		} else {
 			slicev = reflect.Append(slicev, singleResult.Elem())
 		}
 
 		i++
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
 	resultv.Elem().Set(slicev.Slice(0, i))
 
 	// -- Load associations ---
 
 	if len(q.includes) > 0 {
-		// Load associations by creating a IN query on the child tables
-		type QueryByIds struct {
-			Query      *Query
-			Includes   []string
-			IdMap      map[interface{}]bool
-			Ids        []interface{}
-			ColumnName string
-			//Typ        reflect.Type
-			TypeInfo  *typeInfo
-			OneToOne  *oneToOneInfo
-			OneToMany *oneToManyInfo
-			Records   []reflect.Value
-		}
-		oneToOneQueries := make(map[string]QueryByIds)
-		oneToManyQueries := make(map[string]QueryByIds)
-
-		// Loop through all elements of the resultset and collect
-		// the table name, column name, and ids of the entities
-		// to load.
-		for k := 0; k < i; k++ {
-			assocNames, assocNamesNextLevel := split(q.includes, ".")
-
-			// Gather information about a single entity
-			recordv := resultv.Elem().Index(k)
-			ti, err := AddType(recordv.Elem().Type())
+		assocSession, assocDB := q.associations()
+		return assocSession.loadSliceAssociations(assocDB, visited, resultv.Elem(), reused, q.includes, q.tops)
+	}
+
+	return nil
+}
+
+// resolveColumnFields maps the columns of a result to the fields of
+// ti, in order. The field is nil if there is no field for a column.
+func resolveColumnFields(ti *typeInfo, columns []string) []*fieldInfo {
+	fields := make([]*fieldInfo, len(columns))
+	for i, column := range columns {
+		fields[i] = ti.ColumnInfos[column]
+	}
+	return fields
+}
+
+// loadSliceAssociations loads the associations in includes of the
+// entities in recordsv, a slice of structs or pointers to structs, with
+// one IN query per associated table. Entities with an index in reused
+// have been loaded before, so associations already set are kept.
+// Self-referencing associations, e.g. a parent_id pointing into the same
+// table, are loaded with the table aliased (see assocQuery).
+func (s *Session) loadSliceAssociations(db queryer, visited identityMap, recordsv reflect.Value, reused map[int]bool, includes []string, tops map[string]topN) error {
+	// Load associations by creating a IN query on the child tables
+	type QueryByIds struct {
+		TableName  string
+		Includes   []string
+		IdMap      map[interface{}]bool
+		Ids        []interface{}
+		ColumnName string
+		//Typ        reflect.Type
+		TypeInfo  *typeInfo
+		OneToOne  *oneToOneInfo
+		OneToMany *oneToManyInfo
+		Records   []reflect.Value
+		Top       topN
+	}
+	oneToOneQueries := make(map[string]QueryByIds)
+	oneToManyQueries := make(map[string]QueryByIds)
+
+	// Loop through all elements of the resultset and collect
+	// the table name, column name, and ids of the entities
+	// to load.
+	assocNames, assocNamesNextLevel := split(includes, ".")
+
+	for k := 0; k < recordsv.Len(); k++ {
+		// Gather information about a single entity
+		recordv := recordsv.Index(k)
+		if recordv.Kind() != reflect.Ptr {
+			recordv = recordv.Addr()
+		}
+		ti, err := AddType(recordv.Elem().Type())
+		if err != nil {
+			return err
+		}
+
+		// Get its primary key
+		pk, found := ti.GetPrimaryKey()
+		if !found {
+			return ErrNoPrimaryKey
+		}
+		primaryKey := recordv.Elem().FieldByName(pk.FieldName).Interface()
+
+		// OneToOne
+		for _, assocName := range assocNames {
+			assoc, found := ti.OneToOneInfos[assocName]
+			if !found {
+				continue
+			}
+			if err := assoc.check(ti.Type); err != nil {
+				return err
+			}
+
+			// Retrieve table name and column name of the references table
+			assocTableName, err := assoc.GetTableName()
+			if err != nil {
+				return err
+			}
+			assocColumnName, err := assoc.GetColumnName()
 			if err != nil {
 				return err
 			}
 
-			// Get its primary key
-			pk, found := ti.GetPrimaryKey()
+			// Add oneToOne information so that they can be loaded later
+			targetField := recordv.Elem().FieldByName(assoc.FieldName)
+			if reused[k] && !targetField.IsNil() {
+				// Already loaded
+				continue
+			}
+			fkField := recordv.Elem().FieldByName(assoc.ForeignKeyField)
+			if fkField.Kind() == reflect.Ptr && fkField.IsNil() {
+				// No need to load
+				continue
+			}
+			if existing, found := visited.lookup(assoc.TargetType, indirectInterface(fkField)); found {
+				// Wire up the already loaded entity
+				targetField.Set(existing)
+				continue
+			}
+			idQ, found := oneToOneQueries[assocTableName]
 			if !found {
-				return ErrNoPrimaryKey
+				idQ = QueryByIds{
+					TableName:  assocTableName,
+					Includes:   assocNamesNextLevel[assocName],
+					IdMap:      make(map[interface{}]bool),
+					Ids:        make([]interface{}, 0),
+					ColumnName: assocColumnName,
+					TypeInfo:   ti,
+					OneToOne:   assoc,
+					Records:    make([]reflect.Value, 0),
+				}
 			}
-			primaryKey := recordv.Elem().FieldByName(pk.FieldName).Interface()
+			fk := indirectInterface(fkField)
+			if _, idFound := idQ.IdMap[fk]; !idFound {
+				idQ.IdMap[fk] = true
+				idQ.Ids = append(idQ.Ids, fk)
+			}
+			idQ.Records = append(idQ.Records, recordv)
+			oneToOneQueries[assocTableName] = idQ
+		}
 
-			// OneToOne
-			for _, assocName := range assocNames {
-				assoc, found := ti.OneToOneInfos[assocName]
-				if !found {
-					continue
-				}
+		// OneToMany
+		for _, assocName := range assocNames {
+			assoc, found := ti.OneToManyInfos[assocName]
+			if !found {
+				continue
+			}
+			if err := assoc.check(ti.Type); err != nil {
+				return err
+			}
 
-				// Retrieve table name and column name of the references table
-				assocTableName, err := assoc.GetTableName()
-				if err != nil {
-					return err
-				}
-				assocColumnName, err := assoc.GetColumnName()
-				if err != nil {
-					return err
-				}
+			// Retrieve table name and column name of the references table
+			assocTableName, err := assoc.GetTableName()
+			if err != nil {
+				return err
+			}
+			assocColumnName, err := assoc.GetColumnName()
+			if err != nil {
+				return err
+			}
 
-				// Add oneToOne information so that they can be loaded later
-				targetField := recordv.Elem().FieldByName(assoc.FieldName)
-				if targetField.Kind() != reflect.Ptr {
-					return errors.New("dapper: a field marked with oneToOne must be a pointer")
-				}
-				idQ, found := oneToOneQueries[assocTableName]
-				if !found {
-					idQ = QueryByIds{
-						Query:      q.session.Q(assocTableName),
-						Includes:   assocNamesNextLevel,
-						IdMap:      make(map[interface{}]bool),
-						Ids:        make([]interface{}, 0),
-						ColumnName: assocColumnName,
-						TypeInfo:   ti,
-						OneToOne:   assoc,
-						Records:    make([]reflect.Value, 0),
-					}
-				}
-				fk := recordv.Elem().FieldByName(assoc.ForeignKeyField).Interface()
-				if _, idFound := idQ.IdMap[fk]; !idFound {
-					idQ.IdMap[fk] = true
-					idQ.Ids = append(idQ.Ids, fk)
+			// Add oneToMany information so that they can be loaded later
+			if reused[k] && !recordv.Elem().FieldByName(assoc.FieldName).IsNil() {
+				// Already loaded
+				continue
+			}
+			idQ, found := oneToManyQueries[assocTableName]
+			if !found {
+				idQ = QueryByIds{
+					TableName:  assocTableName,
+					Includes:   assocNamesNextLevel[assocName],
+					IdMap:      make(map[interface{}]bool),
+					Ids:        make([]interface{}, 0),
+					ColumnName: assocColumnName,
+					TypeInfo:   ti,
+					OneToMany:  assoc,
+					Records:    make([]reflect.Value, 0),
+					Top:        tops[assocName],
 				}
-				idQ.Records = append(idQ.Records, recordv)
-				oneToOneQueries[assocTableName] = idQ
 			}
+			if _, idFound := idQ.IdMap[primaryKey]; !idFound {
+				idQ.IdMap[primaryKey] = true
+				idQ.Ids = append(idQ.Ids, primaryKey)
+			}
+			idQ.Records = append(idQ.Records, recordv)
+			oneToManyQueries[assocTableName] = idQ
+		}
+	}
 
-			// OneToMany
-			for _, assocName := range assocNames {
-				assoc, found := ti.OneToManyInfos[assocName]
-				if !found {
-					continue
-				}
+	// Now all entities to load are gathered and we'll trigger SQL queries
+	for _, idQ := range oneToManyQueries {
+		// Load all children
+		var childrenv reflect.Value
+		var err error
+		if idQ.Top.n > 0 {
+			childrenv, err = s.loadTopByIds(db, visited, idQ.TypeInfo.TableName, idQ.TableName, idQ.ColumnName, idQ.Ids, idQ.Includes, idQ.OneToMany.SliceType, idQ.Top)
+		} else {
+			childrenv, err = s.loadByIds(db, visited, idQ.TypeInfo.TableName, idQ.TableName, idQ.ColumnName, idQ.Ids, idQ.Includes, idQ.OneToMany.SliceType)
+		}
+		if err != nil {
+			return err
+		}
 
-				// Retrieve table name and column name of the references table
-				assocTableName, err := assoc.GetTableName()
-				if err != nil {
-					return err
-				}
-				assocColumnName, err := assoc.GetColumnName()
-				if err != nil {
-					return err
-				}
+		// Iterate through children, find the parent, and assign the children
+		for _, parentv := range idQ.Records {
+			parentIdFieldInfo, _ := idQ.TypeInfo.GetPrimaryKey()
+			parentIdField := parentv.Elem().FieldByName(parentIdFieldInfo.FieldName)
+			var parentId interface{}
+			if parentIdField.Kind() != reflect.Ptr {
+				parentId = parentIdField.Interface()
+			} else if parentIdField.Elem().IsValid() {
+				parentId = parentIdField.Elem().Interface()
+			}
+
+			// Create a slice for the children
+			itemsv := reflect.MakeSlice(reflect.SliceOf(idQ.OneToMany.ElemType), 0, 0) // reflect.SliceOf(idQ.Typ)
 
-				// Add oneToMany information so that they can be loaded later
-				idQ, found := oneToManyQueries[assocTableName]
-				if !found {
-					idQ = QueryByIds{
-						Query:      q.session.Q(assocTableName),
-						Includes:   assocNamesNextLevel,
-						IdMap:      make(map[interface{}]bool),
-						Ids:        make([]interface{}, 0),
-						ColumnName: assocColumnName,
-						TypeInfo:   ti,
-						OneToMany:  assoc,
-						Records:    make([]reflect.Value, 0),
-					}
+			// Iterate through all children in the sub-query
+			for k := 0; k < childrenv.Elem().Len(); k++ {
+				childv := childrenv.Elem().Index(k)
+
+				fkInResult := childv.Elem().FieldByName(idQ.OneToMany.ForeignKeyField)
+				var fk interface{}
+				if fkInResult.Kind() != reflect.Ptr {
+					fk = fkInResult.Interface()
+				} else if fkInResult.Elem().IsValid() {
+					fk = fkInResult.Elem().Interface()
 				}
-				if _, idFound := idQ.IdMap[primaryKey]; !idFound {
-					idQ.IdMap[primaryKey] = true
-					idQ.Ids = append(idQ.Ids, primaryKey)
+
+				if parentId == fk {
+					// we have a matching result in the sub-query
+					itemsv = reflect.Append(itemsv, childv.Elem().Addr())
 				}
-				idQ.Records = append(idQ.Records, recordv)
-				oneToManyQueries[assocTableName] = idQ
 			}
+
+			targetField := parentv.Elem().FieldByName(idQ.OneToMany.FieldName)
+			targetField.Set(itemsv)
 		}
+	}
 
-		// Now all entities to load are gathered and we'll trigger SQL queries
-		// TODO slice queries up into batches of limited size?!
-		for _, idQ := range oneToManyQueries {
-			query := idQ.Query.Where().In(idQ.ColumnName, idQ.Ids)
+	// One-to-One queries
+	for _, idQ := range oneToOneQueries {
+		// results will contain all the child records
+		childrenv, err := s.loadByIds(db, visited, idQ.TypeInfo.TableName, idQ.TableName, idQ.ColumnName, idQ.Ids, idQ.Includes, reflect.SliceOf(idQ.OneToOne.TargetType))
+		if err != nil {
+			return err
+		}
 
-			// Load all children
-			childrenv := reflect.New(idQ.OneToMany.SliceType)
-			children := childrenv.Interface()
-			err := q.session.Find(query.Sql(), nil).Include(idQ.Includes...).All(children)
-			if err != nil {
-				return err
+		// Iterate through entities and assign the matching child
+		for k := 0; k < childrenv.Elem().Len(); k++ {
+			childv := childrenv.Elem().Index(k)
+
+			childIdFieldInfo, _ := idQ.TypeInfo.GetPrimaryKey()
+			childIdField := childv.Elem().FieldByName(childIdFieldInfo.FieldName)
+			var childId interface{}
+			if childIdField.Kind() != reflect.Ptr {
+				childId = childIdField.Interface()
+			} else if childIdField.Elem().IsValid() {
+				childId = childIdField.Elem().Interface()
 			}
 
-			// Iterate through children, find the parent, and assign the children
 			for _, parentv := range idQ.Records {
-				parentIdFieldInfo, _ := idQ.TypeInfo.GetPrimaryKey()
-				parentIdField := parentv.Elem().FieldByName(parentIdFieldInfo.FieldName)
+				parentIdField := parentv.Elem().FieldByName(idQ.OneToOne.ForeignKeyField)
 				var parentId interface{}
 				if parentIdField.Kind() != reflect.Ptr {
 					parentId = parentIdField.Interface()
@@ -586,78 +1422,15 @@ func (q *finder) All(result interface{}) error {
 					parentId = parentIdField.Elem().Interface()
 				}
 
-				// Create a slice for the children
-				itemsv := reflect.MakeSlice(reflect.SliceOf(idQ.OneToMany.ElemType), 0, 0) // reflect.SliceOf(idQ.Typ)
-
-				// Iterate through all children in the sub-query
-				for k := 0; k < childrenv.Elem().Len(); k++ {
-					childv := childrenv.Elem().Index(k)
-
-					fkInResult := childv.Elem().FieldByName(idQ.OneToMany.ForeignKeyField)
-					var fk interface{}
-					if fkInResult.Kind() != reflect.Ptr {
-						fk = fkInResult.Interface()
-					} else if fkInResult.Elem().IsValid() {
-						fk = fkInResult.Elem().Interface()
-					}
-
-					if parentId == fk {
-						// we have a matching result in the sub-query
-						itemsv = reflect.Append(itemsv, childv.Elem().Addr())
-					}
-				}
-
-				targetField := parentv.Elem().FieldByName(idQ.OneToMany.FieldName)
-				targetField.Set(itemsv)
-			}
-		}
-
-		// One-to-One queries
-		for _, idQ := range oneToOneQueries {
-			query := idQ.Query.Where().In(idQ.ColumnName, idQ.Ids)
-
-			// results will contain all the child records
-			childrenv := reflect.New(reflect.SliceOf(idQ.OneToOne.TargetType))
-			children := childrenv.Interface()
-			err := q.session.Find(query.Sql(), nil).Include(idQ.Includes...).All(children)
-			if err != nil {
-				return err
-			}
-
-			// Iterate through entities and assign the matching child
-			for k := 0; k < childrenv.Elem().Len(); k++ {
-				childv := childrenv.Elem().Index(k)
-
-				childIdFieldInfo, _ := idQ.TypeInfo.GetPrimaryKey()
-				childIdField := childv.Elem().FieldByName(childIdFieldInfo.FieldName)
-				var childId interface{}
-				if childIdField.Kind() != reflect.Ptr {
-					childId = childIdField.Interface()
-				} else if childIdField.Elem().IsValid() {
-					childId = childIdField.Elem().Interface()
-				}
-
-				for _, parentv := range idQ.Records {
-					parentIdField := parentv.Elem().FieldByName(idQ.OneToOne.ForeignKeyField)
-					var parentId interface{}
-					if parentIdField.Kind() != reflect.Ptr {
-						parentId = parentIdField.Interface()
-					} else if parentIdField.Elem().IsValid() {
-						parentId = parentIdField.Elem().Interface()
-					}
-
-					if childId == parentId {
-						// Got a match
-						targetField := parentv.Elem().FieldByName(idQ.OneToOne.FieldName)
-						targetField.Set(childv.Elem().Addr())
-					}
+				if childId == parentId {
+					// Got a match
+					targetField := parentv.Elem().FieldByName(idQ.OneToOne.FieldName)
+					targetField.Set(childv.Elem().Addr())
 				}
 			}
 		}
 	}
 
-	// -- end: Load associations ---
-
 	return nil
 }
 
@@ -679,41 +1452,20 @@ func (q *finder) Scalar(result interface{}) error {
 		return errors.New("result must be a pointer")
 	}
 
-	sqlQuery := q.sqlQuery
-
-	// Get information about param
-	if q.param != nil {
-		paramValue := reflect.ValueOf(q.param)
-		if paramValue.Kind() == reflect.Ptr {
-			paramValue = paramValue.Elem()
-		}
-		paramInfo, err := AddType(paramValue.Type())
-		if err != nil {
-			return err
-		}
-
-		// Substitute parameters in SQL statement
-		for paramName, fi := range paramInfo.FieldInfos {
-			if fi.IsTransient {
-				continue
-			}
-			// Get value of field in param
-			field := paramValue.FieldByName(paramName)
-			value := field.Interface()
-			quoted := Quote(q.session.dialect, value)
-			sqlQuery = strings.Replace(sqlQuery, ":"+paramName, quoted, -1)
-		}
+	sqlQuery, err := q.substituteParams()
+	if err != nil {
+		return err
 	}
 
-	if q.debug {
-		log.Println(sqlQuery)
+	sqlQuery, err = q.session.prepareSQL(sqlQuery, nil, q.debug)
+	if err != nil {
+		return err
 	}
-
 	row := q.db.QueryRow(sqlQuery)
 
 	elemt := resultv.Type().Elem()
 	value := reflect.New(elemt)
-	err := row.Scan(value.Interface())
+	err = row.Scan(value.Interface())
 	if err != nil {
 		return err
 	}
@@ -723,355 +1475,2763 @@ func (q *finder) Scalar(result interface{}) error {
 	return nil
 }
 
-// ---- Count ---------------------------------------------------------------
-
-// Count returns the count of the query as an int64.
-// If the result is not an int64, it returns ErrWrongType.
+// ScalarSlice returns the values of the single column of all rows of the
+// SQL query in result, which must be a pointer to a slice of a scannable
+// type, e.g. *[]int64 or *[]string. The query must return exactly one
+// column. If no rows are found, result is set to an empty slice.
 //
 // Example:
-// count, err := session.Count("select count(*) from users", nil)
-func (s *Session) Count(sqlQuery string, param interface{}) (int64, error) {
-	var count int64
-	err := s.Find(sqlQuery, param).Scalar(&count)
-	if err != nil {
-		return 0, err
+// var ids []int64
+// err := session.Find("select id from users", nil).ScalarSlice(&ids)
+func (q *finder) ScalarSlice(result interface{}) error {
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		return errors.New("result must be a pointer to a slice")
 	}
-	return count, nil
-}
-
-// ---- Insert --------------------------------------------------------------
-
-// Insert adds the entity to the database.
-func (s *Session) Insert(entity interface{}) error {
-	return s.insert(entity, nil)
-}
-
-// InsertTx adds the entity to the database.
-func (s *Session) InsertTx(tx *sql.Tx, entity interface{}) error {
-	return s.insert(entity, tx)
-}
-
-// Insert adds the entity to the database.
-func (s *Session) insert(entity interface{}, tx *sql.Tx) error {
-	// Get information about the entity
-	entityv := reflect.ValueOf(entity)
-	if entityv.Kind() != reflect.Ptr {
-		return errors.New("entity must be a pointer to a struct")
+	elemt := resultv.Elem().Type().Elem()
+	if !isScalarType(elemt) {
+		return fmt.Errorf("dapper: cannot scan a single column into %v, use All for structs", elemt)
 	}
 
-	indirectValue := reflect.Indirect(entityv)
-	gotype := indirectValue.Type()
-
-	ti, err := AddType(gotype)
+	sqlQuery, err := q.substituteParams()
 	if err != nil {
 		return err
 	}
 
-	// Generate SQL query for insert
-	sql, err := s.generateInsertSql(ti, entity)
+	sqlQuery, err = q.session.prepareSQL(sqlQuery, nil, q.debug)
 	if err != nil {
 		return err
 	}
-
-	if s.debug {
-		log.Println(sql)
+	rows, err := q.db.Query(sqlQuery)
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
 
-	// Set last insert id if the type has an autoincrement column
-	if autoIncrField, hasAutoIncrField := ti.GetAutoIncrement(); hasAutoIncrField {
-		// We have an auto_increment field which we'll fill via
-		// AUTO_INCREMENT (MySQL), AUTOINCREMENT (Sqlite3), or a sequence (psql)
-		var newId int64
-		if s.dialect.SupportsLastInsertId() {
-			// We get the newId later via LastInsertId()
-			res, err := s.exec(tx, sql)
-			if err != nil {
-				return err
-			}
-			if newId, err = res.LastInsertId(); err != nil {
-				return err
-			}
-		} else {
-			if tx != nil {
-				// Query and get RETURNING value in a transaction
-				if err := tx.QueryRow(sql).Scan(&newId); err != nil {
-					return err
-				}
-			} else {
-				// Query and get RETURNING value without a transaction
-				if err := s.db.QueryRow(sql).Scan(&newId); err != nil {
-					return err
-				}
-			}
-		}
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if len(columns) != 1 {
+		return fmt.Errorf("dapper: ScalarSlice expects a single column, got %d", len(columns))
+	}
 
-		// Set autoincrement column to newly generated Id
-		field := entityv.Elem().FieldByName(autoIncrField.FieldName)
-		field.Set(reflect.ValueOf(newId))
-	} else {
-		// We don't have to care about auto-increment
-		if _, err = s.exec(tx, sql); err != nil {
+	slicev := reflect.MakeSlice(resultv.Elem().Type(), 0, 0)
+	for rows.Next() {
+		value := reflect.New(elemt)
+		if err := rows.Scan(value.Interface()); err != nil {
 			return err
 		}
+		slicev = reflect.Append(slicev, value.Elem())
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
+	resultv.Elem().Set(slicev)
 	return nil
 }
 
-func (s *Session) exec(tx *sql.Tx, sql string) (sql.Result, error) {
-	if tx == nil {
-		return s.db.Exec(sql)
+// isScalarType returns true if a single column can be scanned into a
+// value of type t, i.e. t is not a struct unless it is a time.Time or
+// implements sql.Scanner.
+func isScalarType(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem()) {
+		return true
 	}
-	return tx.Exec(sql)
+	switch t.Kind() {
+	case reflect.Struct:
+		return t == reflect.TypeOf(time.Time{})
+	case reflect.Ptr:
+		return isScalarType(t.Elem())
+	case reflect.Chan, reflect.Func, reflect.Map, reflect.UnsafePointer:
+		return false
+	}
+	return true
 }
 
-func (s *Session) generateInsertSql(ti *typeInfo, entity interface{}) (string, error) {
-	if ti.TableName == "" {
-		return "", ErrNoTableName
+// ---- SingleMulti / AllMulti ----------------------------------------------
+
+// SingleMulti fills several structs from the first row of the SQL query,
+// e.g. a user and a tweet from a join. Each result must be a pointer to
+// a struct. The columns are consumed in order: a column goes to the
+// current result unless it doesn't map it or has already got it; then
+// the next result that maps the column takes over. So the SELECT must
+// list the columns in the order of the results, e.g. "SELECT u.*, t.*".
+// Associations are not loaded.
+//
+// If no rows are found, sql.ErrNoRows is returned.
+//
+// Example:
+// var u User
+// var t Tweet
+// err := session.Find("select u.*, t.* from users u join tweets t on u.id=t.user_id", nil).SingleMulti(&u, &t)
+func (q *finder) SingleMulti(results ...interface{}) error {
+	infos := make([]*typeInfo, len(results))
+	for i, result := range results {
+		resultv := reflect.ValueOf(result)
+		if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Struct {
+			return errors.New("results must be pointers to structs")
+		}
+		ti, err := AddType(resultv.Elem().Type())
+		if err != nil {
+			return err
+		}
+		infos[i] = ti
 	}
 
-	entityv := reflect.ValueOf(entity)
+	sqlQuery, err := q.substituteParams()
+	if err != nil {
+		return err
+	}
 
-	cnames := make([]string, 0)
-	cvals := make([]string, 0)
+	sqlQuery, err = q.session.prepareSQL(sqlQuery, nil, q.debug)
+	if err != nil {
+		return err
+	}
+	rows, err := q.db.Query(sqlQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	targets := make([]reflect.Value, len(results))
+	for i, result := range results {
+		targets[i] = reflect.ValueOf(result).Elem()
+	}
+	return rows.Scan(multiScanFields(columns, infos, targets)...)
+}
+
+// AllMulti is like SingleMulti, but for all rows of the SQL query.
+// Each result must be a pointer to a slice of structs or of pointers to
+// structs. After AllMulti, all slices have one element per row.
+//
+// Example:
+// var users []User
+// var tweets []Tweet
+// err := session.Find("select u.*, t.* from users u join tweets t on u.id=t.user_id", nil).AllMulti(&users, &tweets)
+func (q *finder) AllMulti(results ...interface{}) error {
+	infos := make([]*typeInfo, len(results))
+	slices := make([]reflect.Value, len(results))
+	for i, result := range results {
+		resultv := reflect.ValueOf(result)
+		if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+			return errors.New("results must be pointers to slices")
+		}
+		gotype := resultv.Elem().Type().Elem()
+		if gotype.Kind() == reflect.Ptr {
+			gotype = gotype.Elem()
+		}
+		ti, err := AddType(gotype)
+		if err != nil {
+			return err
+		}
+		infos[i] = ti
+		slices[i] = resultv.Elem().Slice(0, 0)
+	}
+
+	sqlQuery, err := q.substituteParams()
+	if err != nil {
+		return err
+	}
+
+	sqlQuery, err = q.session.prepareSQL(sqlQuery, nil, q.debug)
+	if err != nil {
+		return err
+	}
+	rows, err := q.db.Query(sqlQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		targets := make([]reflect.Value, len(results))
+		for i, ti := range infos {
+			targets[i] = reflect.New(ti.Type).Elem()
+		}
+		if err := rows.Scan(multiScanFields(columns, infos, targets)...); err != nil {
+			return err
+		}
+		for i, target := range targets {
+			if slices[i].Type().Elem().Kind() == reflect.Ptr {
+				target = target.Addr()
+			}
+			slices[i] = reflect.Append(slices[i], target)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		reflect.ValueOf(result).Elem().Set(slices[i])
+	}
+	return nil
+}
+
+// multiScanFields returns the destinations for rows.Scan to fill the
+// structs in targets, of types infos, from columns. See SingleMulti.
+func multiScanFields(columns []string, infos []*typeInfo, targets []reflect.Value) []interface{} {
+	fields := make([]interface{}, len(columns))
+	assigned := make([]map[string]bool, len(infos))
+	for i := range assigned {
+		assigned[i] = make(map[string]bool)
+	}
+
+	k := 0
+	for i, column := range columns {
+		// Move on to the next target that maps the column
+		target := -1
+		for j := k; j < len(infos); j++ {
+			if _, found := infos[j].ColumnInfos[column]; found && !assigned[j][column] {
+				target = j
+				break
+			}
+		}
+		if target < 0 {
+			// Ignore missing columns
+			var placeholder interface{}
+			fields[i] = &placeholder
+			continue
+		}
+		k = target
+		assigned[k][column] = true
+		fi := infos[k].ColumnInfos[column]
+		fields[i] = scanTarget(fi, targets[k].FieldByIndex(fi.Index))
+	}
+	return fields
+}
+
+// scanTarget returns the destination for rows.Scan to fill field.
+// Fields of kind string, bool, int, uint, and float, and fields of type
+// time.Time, are scanned via a fieldScanner, unless they implement
+// sql.Scanner themselves. Pointer fields are scanned as usual. Fields
+// tagged with json are scanned via a jsonScanner.
+func scanTarget(fi *fieldInfo, field reflect.Value) interface{} {
+	if fi.IsJSON {
+		return &jsonScanner{fi: fi, field: field}
+	}
+	dest := field.Addr().Interface()
+	if _, ok := dest.(sql.Scanner); ok {
+		return dest
+	}
+	switch field.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return &fieldScanner{fi: fi, field: field}
+	case reflect.Struct:
+		if field.Type() == reflect.TypeOf(time.Time{}) {
+			return &fieldScanner{fi: fi, field: field}
+		}
+	case reflect.Ptr:
+		switch field.Type() {
+		case reflect.TypeOf((*big.Rat)(nil)), reflect.TypeOf((*big.Float)(nil)):
+			return &bigScanner{fi: fi, field: field}
+		}
+	}
+	return dest
+}
+
+// fieldScanner scans a column into a non-pointer field. It leaves the
+// field at its zero value if the column is NULL, and returns a descriptive
+// error if an integer or float does not fit into the field.
+type fieldScanner struct {
+	fi    *fieldInfo
+	field reflect.Value
+}
+
+func (fs *fieldScanner) Scan(src interface{}) error {
+	if src == nil {
+		fs.field.Set(reflect.Zero(fs.field.Type()))
+		return nil
+	}
+	switch fs.field.Kind() {
+	case reflect.String:
+		var s sql.NullString
+		if err := s.Scan(src); err != nil {
+			return fs.convertError(src, err)
+		}
+		fs.field.SetString(s.String)
+	case reflect.Bool:
+		var b sql.NullBool
+		if err := b.Scan(src); err != nil {
+			return fs.convertError(src, err)
+		}
+		fs.field.SetBool(b.Bool)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n sql.NullInt64
+		if err := n.Scan(src); err != nil {
+			return fs.convertError(src, err)
+		}
+		if fs.field.OverflowInt(n.Int64) {
+			return fs.overflowError(src)
+		}
+		fs.field.SetInt(n.Int64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var s sql.NullString
+		if err := s.Scan(src); err != nil {
+			return fs.convertError(src, err)
+		}
+		u, err := strconv.ParseUint(s.String, 10, 64)
+		if err != nil {
+			return fs.convertError(src, err)
+		}
+		if fs.field.OverflowUint(u) {
+			return fs.overflowError(src)
+		}
+		fs.field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var f sql.NullFloat64
+		if err := f.Scan(src); err != nil {
+			return fs.convertError(src, err)
+		}
+		if fs.field.OverflowFloat(f.Float64) {
+			return fs.overflowError(src)
+		}
+		fs.field.SetFloat(f.Float64)
+	default:
+		// time.Time
+		var t sql.NullTime
+		if err := t.Scan(src); err != nil {
+			return fs.convertError(src, err)
+		}
+		fs.field.Set(reflect.ValueOf(t.Time))
+	}
+	return nil
+}
+
+func (fs *fieldScanner) overflowError(src interface{}) error {
+	return fmt.Errorf("dapper: value %s of column %s overflows field %s of type %s",
+		formatScanValue(src), fs.fi.ColumnName, fs.fi.FieldName, fs.field.Type())
+}
+
+func (fs *fieldScanner) convertError(src interface{}, err error) error {
+	return fmt.Errorf("dapper: cannot convert value %s of column %s into field %s of type %s: %v",
+		formatScanValue(src), fs.fi.ColumnName, fs.fi.FieldName, fs.field.Type(), err)
+}
+
+// bigScanner scans a NUMERIC column into a *big.Rat or *big.Float field
+// from its decimal representation, so no precision is lost on the way.
+// The field is set to nil if the column is NULL.
+type bigScanner struct {
+	fi    *fieldInfo
+	field reflect.Value
+}
+
+func (bs *bigScanner) Scan(src interface{}) error {
+	if src == nil {
+		bs.field.Set(reflect.Zero(bs.field.Type()))
+		return nil
+	}
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		// e.g. Sqlite3 returns REAL; use the shortest representation
+		// to get 9.33 instead of its binary approximation
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Errorf("dapper: cannot convert value %s of column %s into field %s of type %s",
+			formatScanValue(src), bs.fi.ColumnName, bs.fi.FieldName, bs.field.Type())
+	}
+	var value interface{}
+	ok := true
+	if bs.field.Type() == reflect.TypeOf((*big.Rat)(nil)) {
+		value, ok = new(big.Rat).SetString(s)
+	} else {
+		var err error
+		value, _, err = big.ParseFloat(s, 10, 0, big.ToNearestEven)
+		ok = err == nil
+	}
+	if !ok {
+		return fmt.Errorf("dapper: cannot convert value %s of column %s into field %s of type %s",
+			s, bs.fi.ColumnName, bs.fi.FieldName, bs.field.Type())
+	}
+	bs.field.Set(reflect.ValueOf(value))
+	return nil
+}
+
+// jsonScanner scans a column with a JSON document into a field tagged
+// with json, e.g. a map or a struct. A NULL column sets the field to
+// its zero value.
+type jsonScanner struct {
+	fi    *fieldInfo
+	field reflect.Value
+}
+
+func (js *jsonScanner) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		js.field.Set(reflect.Zero(js.field.Type()))
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("dapper: cannot convert value %s of column %s into field %s of type %s",
+			formatScanValue(src), js.fi.ColumnName, js.fi.FieldName, js.field.Type())
+	}
+	value := reflect.New(js.field.Type())
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return fmt.Errorf("dapper: cannot unmarshal JSON of column %s into field %s: %v",
+			js.fi.ColumnName, js.fi.FieldName, err)
+	}
+	js.field.Set(value.Elem())
+	return nil
+}
+
+// formatScanValue formats a value as returned by a driver for errors.
+func formatScanValue(src interface{}) string {
+	if b, ok := src.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(src)
+}
+
+// ---- Rows ----------------------------------------------------------------
+
+// Rows is an iterator over the results of a query, returned by
+// finder.Rows. Always call Close when done, e.g. via defer, so that
+// the underlying *sql.Rows are released, even on early termination.
+type Rows struct {
+	rows    *sql.Rows
+	columns []string
+}
+
+// Rows runs the SQL query with ctx and returns an iterator over its
+// results. Cancelling ctx stops the iteration; Err then returns the
+// cause. Associations are not loaded (see Include).
+//
+// Example:
+// rows, err := session.Find("select * from users", nil).Rows(ctx)
+// if err != nil { ... }
+// defer rows.Close()
+// for rows.Next() { var u User; err := rows.Scan(&u) ... }
+// if err := rows.Err(); err != nil { ... }
+func (q *finder) Rows(ctx context.Context) (*Rows, error) {
+	sqlQuery, err := q.substituteParams()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlQuery, err = q.session.prepareSQL(sqlQuery, nil, q.debug)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return &Rows{rows: rows, columns: columns}, nil
+}
+
+// Next prepares the next row for Scan. It returns false if there are
+// no more rows or an error occurred; check Err to tell these apart.
+func (r *Rows) Next() bool {
+	return r.rows.Next()
+}
+
+// Scan copies the columns of the current row into the fields of result,
+// which must be a pointer to a struct. Columns without a corresponding
+// field are ignored.
+func (r *Rows) Scan(result interface{}) error {
+	resultValue := reflect.ValueOf(result)
+	if resultValue.Kind() != reflect.Ptr || resultValue.Elem().Kind() != reflect.Struct {
+		return errors.New("result must be a pointer to a struct")
+	}
+	resultInfo, err := AddType(resultValue.Elem().Type())
+	if err != nil {
+		return err
+	}
+
+	var placeholder interface{}
+	resultFields := make([]interface{}, 0, len(r.columns))
+	for _, dbColName := range r.columns {
+		if fi, found := resultInfo.ColumnInfos[dbColName]; found {
+			field := resultValue.Elem().FieldByIndex(fi.Index)
+			resultFields = append(resultFields, scanTarget(fi, field))
+		} else {
+			// Ignore missing columns
+			resultFields = append(resultFields, &placeholder)
+		}
+	}
+	return r.rows.Scan(resultFields...)
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (r *Rows) Err() error {
+	return r.rows.Err()
+}
+
+// Close releases the underlying *sql.Rows. It is safe to call Close
+// more than once.
+func (r *Rows) Close() error {
+	return r.rows.Close()
+}
+
+// ---- Each ----------------------------------------------------------------
+
+// Each runs the SQL query and calls fn for every result, one at a time,
+// without keeping all results in memory like All. The result parameter
+// must be a pointer to a struct and is the template: fn gets a pointer
+// to a new struct of the same type for every row. If fn returns an
+// error, the iteration stops and Each returns that error. Soft-deleted
+// entities are skipped unless WithDeleted is set.
+//
+// Associations are not loaded (see Include), as most drivers don't allow
+// further queries while the results are being read. Use LoadAssociations
+// after Each instead.
+//
+// Example:
+// err := session.Find("select * from users", nil).Each(&User{}, func(result interface{}) error {
+//     u := result.(*User)
+//     ...
+//     return nil
+// })
+func (q *finder) Each(result interface{}, fn func(result interface{}) error) error {
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Struct {
+		return errors.New("result must be a pointer to a struct")
+	}
+	gotype := resultv.Elem().Type()
+	resultInfo, err := AddType(gotype)
+	if err != nil {
+		return err
+	}
+	if err := q.checkSelected(resultInfo); err != nil {
+		return err
+	}
+
+	rows, err := q.Rows(context.Background())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		recordv := reflect.New(gotype)
+		if err := rows.Scan(recordv.Interface()); err != nil {
+			return err
+		}
+
+		// Skip soft-deleted entities
+		if !q.withDeleted && resultInfo.isSoftDeleted(recordv) {
+			continue
+		}
+
+		if err := fn(recordv.Interface()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ---- AllRows -------------------------------------------------------------
+
+// AllRows returns all rows of the SQL query, each as a slice of column
+// values in column order. It is meant for fully dynamic queries, e.g.
+// to export a table as CSV. Text values are returned as string instead
+// of []byte, binary columns are left alone.
+//
+// Example:
+// rows, err := session.Find("select * from users", nil).AllRows()
+func (q *finder) AllRows() ([][]interface{}, error) {
+	sqlQuery, err := q.substituteParams()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlQuery, err = q.session.prepareSQL(sqlQuery, nil, q.debug)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.db.Query(sqlQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]interface{}, 0)
+	for rows.Next() {
+		values := make([]interface{}, len(columnTypes))
+		dest := make([]interface{}, len(columnTypes))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			if b, ok := value.([]byte); ok && !isBinaryColumn(columnTypes[i]) {
+				values[i] = string(b)
+			}
+		}
+		results = append(results, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ---- MapRow / MapRows ----------------------------------------------------
+
+// MapRow runs the SQL query and scans the first row into a map from
+// column name to value. It is meant for queries whose columns don't
+// match a struct, e.g. dynamic projections. Text values are returned as
+// string, integers as int64, floats as float64, and booleans as bool,
+// as indicated by the column types. DECIMAL values are returned as string
+// to keep their precision, and NULL as nil.
+//
+// If no rows are found, sql.ErrNoRows is returned.
+//
+// Example:
+// var m map[string]interface{}
+// err := session.Find("select name, count(*) as n from users group by name", nil).MapRow(&m)
+func (q *finder) MapRow(dst *map[string]interface{}) error {
+	results, err := q.mapRows(1)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return sql.ErrNoRows
+	}
+	*dst = results[0]
+	return nil
+}
+
+// MapRows runs the SQL query and scans all rows into maps from column
+// name to value. See MapRow for details.
+func (q *finder) MapRows(dst *[]map[string]interface{}) error {
+	results, err := q.mapRows(-1)
+	if err != nil {
+		return err
+	}
+	*dst = results
+	return nil
+}
+
+// mapRows scans up to max rows (all if max < 0) into maps.
+func (q *finder) mapRows(max int) ([]map[string]interface{}, error) {
+	sqlQuery, err := q.substituteParams()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlQuery, err = q.session.prepareSQL(sqlQuery, nil, q.debug)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.db.Query(sqlQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]map[string]interface{}, 0)
+	for (max < 0 || len(results) < max) && rows.Next() {
+		values := make([]interface{}, len(columnTypes))
+		dest := make([]interface{}, len(columnTypes))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, len(columnTypes))
+		for i, ct := range columnTypes {
+			m[ct.Name()] = convertColumnValue(ct, values[i])
+		}
+		results = append(results, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// convertColumnValue converts a value returned by the driver as []byte,
+// e.g. by MySQL for all columns, to a Go type matching the column type.
+func convertColumnValue(ct *sql.ColumnType, value interface{}) interface{} {
+	b, ok := value.([]byte)
+	if !ok || isBinaryColumn(ct) {
+		return value
+	}
+	s := string(b)
+	switch strings.TrimPrefix(strings.ToUpper(ct.DatabaseTypeName()), "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT",
+		"INT2", "INT4", "INT8", "SERIAL", "BIGSERIAL", "YEAR":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case "FLOAT", "DOUBLE", "REAL", "FLOAT4", "FLOAT8":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case "BOOL", "BOOLEAN":
+		if v, err := strconv.ParseBool(s); err == nil {
+			return v
+		}
+	}
+	return s
+}
+
+// isBinaryColumn returns true if the database type of the column
+// holds binary data, e.g. BLOB or BYTEA.
+func isBinaryColumn(ct *sql.ColumnType) bool {
+	name := strings.ToUpper(ct.DatabaseTypeName())
+	return strings.Contains(name, "BLOB") ||
+		strings.Contains(name, "BINARY") ||
+		name == "BYTEA"
+}
+
+// substituteParams returns the SQL query of the finder with all
+// parameters substituted by the corresponding fields of param.
+func (q *finder) substituteParams() (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+	sqlQuery := q.sqlQuery
+	if q.param == nil {
+		return sqlQuery, nil
+	}
+	paramValue := reflect.ValueOf(q.param)
+	if paramValue.Kind() == reflect.Ptr {
+		paramValue = paramValue.Elem()
+	}
+	paramInfo, err := AddType(paramValue.Type())
+	if err != nil {
+		return "", err
+	}
+	params := make(map[string]string)
+	for paramName, fi := range paramInfo.FieldInfos {
+		if fi.IsTransient {
+			continue
+		}
+		value := paramValue.FieldByName(paramName).Interface()
+		quoted, err := QuoteValue(q.session.dialect, value)
+		if err != nil {
+			return "", err
+		}
+		params[paramName] = quoted
+		if q.session.paramsByColumn {
+			if _, found := params[fi.ColumnName]; !found {
+				params[fi.ColumnName] = quoted
+			}
+		}
+	}
+	// Replace longer names first, so :UserId is not replaced by :User
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		sqlQuery = strings.Replace(sqlQuery, ":"+name, params[name], -1)
+	}
+	return sqlQuery, nil
+}
+
+// ---- Count ---------------------------------------------------------------
+
+// Count returns the count of the query as an int64.
+// If the result is not an int64, it returns ErrWrongType.
+// If the session is scoped, use CountQuery instead.
+//
+// Example:
+// count, err := session.Count("select count(*) from users", nil)
+func (s *Session) Count(sqlQuery string, param interface{}) (int64, error) {
+	var count int64
+	err := s.Find(sqlQuery, param).Scalar(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// CountQuery returns the number of rows of the query q. If the session
+// is scoped, q must have been built with Q (see FindQuery).
+//
+// Example:
+// count, err := session.CountQuery(session.Q("users").Where().Eq("suspended", true).Query())
+func (s *Session) CountQuery(q *Query) (int64, error) {
+	var count int64
+	sqlQuery := "SELECT COUNT(*) FROM (" + q.Sql() + ") dapper_count"
+	err := s.findQuery(s.db, q, sqlQuery).Scalar(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// CountAs runs the count query like Count, but stores the result in dest,
+// which must be a pointer to a signed or unsigned integer type. It returns
+// an error if the count does not fit into dest.
+//
+// Example:
+// var count int
+// err := session.CountAs("select count(*) from users", nil, &count)
+func (s *Session) CountAs(sqlQuery string, param interface{}, dest interface{}) error {
+	destv := reflect.ValueOf(dest)
+	if destv.Kind() != reflect.Ptr || destv.IsNil() {
+		return errors.New("dapper: dest must be a pointer to an integer")
+	}
+	destv = destv.Elem()
+	switch destv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return errors.New("dapper: dest must be a pointer to an integer")
+	}
+
+	count, err := s.Count(sqlQuery, param)
+	if err != nil {
+		return err
+	}
+	switch destv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if count < 0 || destv.OverflowUint(uint64(count)) {
+			return fmt.Errorf("dapper: count %d overflows %s", count, destv.Type())
+		}
+		destv.SetUint(uint64(count))
+	default:
+		if destv.OverflowInt(count) {
+			return fmt.Errorf("dapper: count %d overflows %s", count, destv.Type())
+		}
+		destv.SetInt(count)
+	}
+	return nil
+}
+
+// ---- Aggregates ----------------------------------------------------------
+
+// Sum returns the result of a SUM query as a float64. If the sum is NULL,
+// e.g. because no rows match, or the query returns no rows, Sum returns 0.
+//
+// Example:
+// total, err := session.Sum("select sum(price*qty) from order_items where order_id=:Id", param)
+func (s *Session) Sum(sqlQuery string, param interface{}) (float64, error) {
+	return s.aggregate(sqlQuery, param)
+}
+
+// Avg returns the result of an AVG query as a float64. See Sum for
+// details on NULL results.
+func (s *Session) Avg(sqlQuery string, param interface{}) (float64, error) {
+	return s.aggregate(sqlQuery, param)
+}
+
+// Min returns the result of a MIN query as a float64. See Sum for
+// details on NULL results.
+func (s *Session) Min(sqlQuery string, param interface{}) (float64, error) {
+	return s.aggregate(sqlQuery, param)
+}
+
+// Max returns the result of a MAX query as a float64. See Sum for
+// details on NULL results.
+func (s *Session) Max(sqlQuery string, param interface{}) (float64, error) {
+	return s.aggregate(sqlQuery, param)
+}
+
+// aggregate runs the scalar query and returns its result as a float64,
+// or 0 if it is NULL or there are no rows.
+func (s *Session) aggregate(sqlQuery string, param interface{}) (float64, error) {
+	var value sql.NullFloat64
+	err := s.Find(sqlQuery, param).Scalar(&value)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return value.Float64, nil
+}
+
+// ---- Exists --------------------------------------------------------------
+
+// ExistsQuery returns true if the query returns at least one row.
+// It uses Query.ExistsSql, so the database stops at the first match.
+//
+// Example:
+// found, err := session.ExistsQuery(session.Q("users").Where().Eq("name", "Oliver").Query())
+func (s *Session) ExistsQuery(q *Query) (bool, error) {
+	var exists bool
+	err := s.findQuery(s.db, q, q.ExistsSql()).Scalar(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// ---- Seek ----------------------------------------------------------------
+
+// Seek loads the page of at most n results of q after last into result,
+// ordered by column (see Query.Seek). The result parameter must be a
+// pointer to a slice. Seek returns the value of column of the last result
+// as the cursor to pass as last for the next page, or nil if there are
+// no more pages. Pass a nil last to load the first page. Seek adds its
+// conditions to q, so pass a new query for every page.
+//
+// Example:
+// var last interface{}
+// for {
+//     var users []User
+//     next, err := session.Seek(session.Q("users"), "id", last, 100, &users)
+//     ...
+//     if next == nil {
+//         break
+//     }
+//     last = next
+// }
+func (s *Session) Seek(q *Query, column string, last interface{}, n int, result interface{}) (interface{}, error) {
+	return s.seek(s.db, q, column, last, n, result)
+}
+
+// SeekTx is like Seek, but runs the query in the transaction tx.
+func (s *Session) SeekTx(tx *sql.Tx, q *Query, column string, last interface{}, n int, result interface{}) (interface{}, error) {
+	return s.seek(tx, q, column, last, n, result)
+}
+
+func (s *Session) seek(db queryer, q *Query, column string, last interface{}, n int, result interface{}) (interface{}, error) {
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		return nil, errors.New("result must be a pointer to a slice")
+	}
+	if n <= 0 {
+		return nil, errors.New("dapper: page size must be positive")
+	}
+	elemType := resultv.Elem().Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	ti, err := AddType(elemType)
+	if err != nil {
+		return nil, err
+	}
+	fi, found := ti.ColumnInfos[column]
+	if !found {
+		return nil, fmt.Errorf("dapper: unknown column %s in %v", column, elemType)
+	}
+
+	// Filter soft-deleted entities in the database, so pages stay full
+	if sd, found := ti.GetSoftDelete(); found {
+		q.Where().IsNull(s.dialect.EscapeColumnName(sd.ColumnName))
+	}
+	sqlQuery := q.Seek(s.dialect.EscapeColumnName(column), last, n).Sql()
+	if err := s.findQuery(db, q, sqlQuery).All(result); err != nil {
+		return nil, err
+	}
+
+	// A short page is the last page
+	slicev := resultv.Elem()
+	if slicev.Len() < n {
+		return nil, nil
+	}
+	lastv := reflect.Indirect(slicev.Index(slicev.Len() - 1))
+	return indirectInterface(lastv.FieldByName(fi.FieldName)), nil
+}
+
+// ---- Insert --------------------------------------------------------------
+
+// Insert adds the entity to the database. If the type has an
+// autoincrement column, it is set to the generated id. Other primary
+// keys, e.g. client-generated UUIDs, are inserted as they are.
+func (s *Session) Insert(entity interface{}) error {
+	return s.insert(entity, nil)
+}
+
+// InsertTx adds the entity to the database.
+func (s *Session) InsertTx(tx *sql.Tx, entity interface{}) error {
+	return s.insert(entity, tx)
+}
+
+// Insert adds the entity to the database.
+func (s *Session) insert(entity interface{}, tx *sql.Tx) error {
+	// Get information about the entity
+	entityv := reflect.ValueOf(entity)
+	if entityv.Kind() != reflect.Ptr {
+		return errors.New("entity must be a pointer to a struct")
+	}
+
+	indirectValue := reflect.Indirect(entityv)
+	gotype := indirectValue.Type()
+
+	ti, err := AddType(gotype)
+	if err != nil {
+		return err
+	}
+	if err := beforeInsert(entity); err != nil {
+		return err
+	}
+	ti.touchCreated(entityv, time.Now())
+
+	// Generate SQL query for insert
+	sql, args, err := s.withArgs(func(b *Session) (string, error) {
+		return b.generateInsertSql(ti, entity)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Set last insert id if the type has an autoincrement column
+	if autoIncrField, hasAutoIncrField := ti.GetAutoIncrement(); hasAutoIncrField {
+		// We have an auto_increment field which we'll fill via
+		// AUTO_INCREMENT (MySQL), AUTOINCREMENT (Sqlite3), or a sequence (psql)
+		var newId int64
+		if s.dialect.SupportsLastInsertId() {
+			// We get the newId later via LastInsertId()
+			res, err := s.execArgs(tx, sql, args)
+			if err != nil {
+				return err
+			}
+			if newId, err = res.LastInsertId(); err != nil {
+				return err
+			}
+		} else if _, ok := s.dialect.(ReturningIntoDialect); ok {
+			// Get RETURNING ... INTO value via an output parameter
+			if err := s.execReturningInto(tx, sql, args, &newId); err != nil {
+				return err
+			}
+		} else {
+			// Query and get RETURNING value
+			if err := s.queryRowArgs(tx, sql, args, &newId); err != nil {
+				return err
+			}
+		}
+
+		// Set autoincrement column to newly generated Id
+		field := entityv.Elem().FieldByName(autoIncrField.FieldName)
+		setAutoIncrement(field, newId)
+	} else {
+		// We don't have to care about auto-increment
+		if _, err = s.execArgs(tx, sql, args); err != nil {
+			return err
+		}
+	}
+
+	return afterInsert(entity)
+}
+
+// InsertReturningAll adds the entity to the database and scans the
+// complete row back into it, so that database defaults (see the
+// default tag element), generated ids, and computed columns are set.
+//
+// It uses INSERT ... RETURNING * on dialects that support it, e.g.
+// PostgreSQL. On other dialects, it falls back to Insert followed by
+// Get, which requires a primary key.
+func (s *Session) InsertReturningAll(entity interface{}) error {
+	return s.insertReturningAll(entity, nil)
+}
+
+// InsertReturningAllTx adds the entity to the database and scans the
+// complete row back into it. See InsertReturningAll for details.
+func (s *Session) InsertReturningAllTx(tx *sql.Tx, entity interface{}) error {
+	return s.insertReturningAll(entity, tx)
+}
+
+func (s *Session) insertReturningAll(entity interface{}, tx *sql.Tx) error {
+	entityv := reflect.ValueOf(entity)
+	if entityv.Kind() != reflect.Ptr {
+		return errors.New("entity must be a pointer to a struct")
+	}
+
+	ti, err := AddType(reflect.Indirect(entityv).Type())
+	if err != nil {
+		return err
+	}
+
+	var db queryer = s.db
+	if tx != nil {
+		db = tx
+	}
+
+	if !s.supportsReturning() {
+		// Insert, then reload the entity by its primary key
+		pkCols := ti.GetPrimaryKeys()
+		if len(pkCols) == 0 {
+			return ErrNoPrimaryKey
+		}
+		if err := s.insert(entity, tx); err != nil {
+			return err
+		}
+		pks := make([]interface{}, len(pkCols))
+		for i, pkCol := range pkCols {
+			pks[i] = entityv.Elem().FieldByName(pkCol.FieldName).Interface()
+		}
+		r := s.Get(pks...).WithDeleted()
+		r.db = db
+		return r.Do(entity)
+	}
+
+	if err := beforeInsert(entity); err != nil {
+		return err
+	}
+	ti.touchCreated(entityv, time.Now())
+
+	sqlQuery, err := s.generateInsertValuesSql(ti, []reflect.Value{entityv.Elem()}, true)
+	if err != nil {
+		return err
+	}
+	if err := s.find(db, sqlQuery, nil).WithDeleted().Single(entity); err != nil {
+		return err
+	}
+
+	return afterInsert(entity)
+}
+
+// supportsReturning returns true if the dialect returns generated values
+// with a RETURNING clause that yields a result set, e.g. PostgreSQL.
+func (s *Session) supportsReturning() bool {
+	if s.dialect.SupportsLastInsertId() {
+		return false
+	}
+	_, ok := s.dialect.(ReturningIntoDialect)
+	return !ok
+}
+
+// exec executes sql in tx, or without a transaction if tx is nil. The
+// statement is rewritten, checked, and logged by prepareSQL first.
+func (s *Session) exec(tx *sql.Tx, sql string) (sql.Result, error) {
+	sql, err := s.prepareSQL(sql, nil, s.debug)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return s.db.Exec(sql)
+	}
+	return tx.Exec(sql)
+}
+
+// execArgs is like exec, but passes the bound values args (see
+// withArgs). If statement caching is enabled, it runs a cached
+// prepared statement.
+func (s *Session) execArgs(tx *sql.Tx, query string, args []interface{}) (sql.Result, error) {
+	query, err := s.prepareSQL(query, args, s.debug)
+	if err != nil {
+		return nil, err
+	}
+	return s.execPrepared(tx, query, args)
+}
+
+// execPrepared is like execArgs, but expects query to be prepared with
+// prepareSQL already.
+func (s *Session) execPrepared(tx *sql.Tx, query string, args []interface{}) (sql.Result, error) {
+	if stmts := s.stmtCache(); stmts != nil {
+		var res sql.Result
+		err := s.prepared(tx, stmts, query, func(stmt *sql.Stmt) (err error) {
+			res, err = stmt.Exec(args...)
+			return err
+		})
+		return res, err
+	}
+	if tx == nil {
+		return s.db.Exec(query, args...)
+	}
+	return tx.Exec(query, args...)
+}
+
+// queryRowArgs runs query with the bound values args and scans the
+// single resulting row into dest. See execArgs for details.
+func (s *Session) queryRowArgs(tx *sql.Tx, query string, args []interface{}, dest ...interface{}) error {
+	query, err := s.prepareSQL(query, args, s.debug)
+	if err != nil {
+		return err
+	}
+	if stmts := s.stmtCache(); stmts != nil {
+		return s.prepared(tx, stmts, query, func(stmt *sql.Stmt) error {
+			return stmt.QueryRow(args...).Scan(dest...)
+		})
+	}
+	if tx == nil {
+		return s.db.QueryRow(query, args...).Scan(dest...)
+	}
+	return tx.QueryRow(query, args...).Scan(dest...)
+}
+
+// prepared calls fn with the prepared statement for query from stmts,
+// which runs in tx unless tx is nil.
+func (s *Session) prepared(tx *sql.Tx, stmts *stmtCache, query string, fn func(stmt *sql.Stmt) error) error {
+	e, err := stmts.get(s.db, query)
+	if err != nil {
+		return err
+	}
+	defer stmts.release(e)
+	stmt := e.stmt
+	if tx != nil {
+		stmt = tx.Stmt(stmt)
+		defer stmt.Close()
+	}
+	return fn(stmt)
+}
+
+// execReturningInto executes query, which returns a generated id into
+// the output parameter dest, for dialects implementing ReturningIntoDialect.
+// The output parameter follows the bound values args.
+func (s *Session) execReturningInto(tx *sql.Tx, query string, args []interface{}, dest *int64) error {
+	query, err := s.prepareSQL(query, args, s.debug)
+	if err != nil {
+		return err
+	}
+	args = append(args[:len(args):len(args)], sql.Out{Dest: dest})
+	_, err = s.execPrepared(tx, query, args)
+	return err
+}
+
+// logArgs writes query and its bound values args to the logger.
+func (s *Session) logArgs(query string, args []interface{}) {
+	if len(args) == 0 {
+		s.logf("%s", query)
+	} else {
+		s.logf("%s (%v)", query, args)
+	}
+}
+
+func (s *Session) generateInsertSql(ti *typeInfo, entity interface{}) (string, error) {
+	entityv := reflect.ValueOf(entity)
+	return s.generateInsertAllSql(ti, []reflect.Value{entityv.Elem()})
+}
+
+// generateInsertAllSql generates a single INSERT statement for all
+// entities, which must be structs of type ti.
+func (s *Session) generateInsertAllSql(ti *typeInfo, entities []reflect.Value) (string, error) {
+	return s.generateInsertValuesSql(ti, entities, false)
+}
+
+// generateInsertValuesSql generates a single INSERT statement for all
+// entities. If returningAll is true, the statement returns all columns
+// of the inserted rows.
+func (s *Session) generateInsertValuesSql(ti *typeInfo, entities []reflect.Value, returningAll bool) (string, error) {
+	if ti.TableName == "" {
+		return "", ErrNoTableName
+	}
+	if ti.ReadOnly {
+		return "", ErrReadOnly
+	}
+
+	cnames := make([]string, 0)
+	fields := make([]*fieldInfo, 0)
+
+	var autoIncrField *fieldInfo
+
+	for _, cname := range ti.ColumnNames {
+		if fi, found := ti.ColumnInfos[cname]; found {
+			if fi.IsReadOnly {
+				// Managed by the database
+				continue
+			}
+			if fi.IsDefault && allZero(fi, entities) {
+				// Leave it to the database default
+				continue
+			}
+			if !fi.IsAutoIncrement || fi.IsTransient {
+				cnames = append(cnames, s.dialect.EscapeColumnName(cname))
+				fields = append(fields, fi)
+			} else if fi.IsAutoIncrement {
+				autoIncrField = fi
+			}
+		}
+	}
+
+	rows := make([]string, 0, len(entities))
+	for _, entityv := range entities {
+		cvals := make([]string, 0, len(fields))
+		for _, fi := range fields {
+			field := entityv.FieldByName(fi.FieldName)
+			quoted, err := s.quoteField(fi, field)
+			if err != nil {
+				return "", err
+			}
+			cvals = append(cvals, quoted)
+		}
+		rows = append(rows, fmt.Sprintf("(%s)", strings.Join(cvals, ", ")))
+	}
+
+	var sql bytes.Buffer
+	sql.WriteString(fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+		s.dialect.EscapeTableName(ti.TableName),
+		strings.Join(cnames, ", "),
+		strings.Join(rows, ",")))
+
+	if returningAll {
+		// Return the complete row, e.g. for PostgreSQL
+		sql.WriteString(" RETURNING *")
+	} else if autoIncrField != nil && !s.dialect.SupportsLastInsertId() {
+		if rd, ok := s.dialect.(ReturningIntoDialect); ok {
+			// Return the generated id in an output parameter, e.g. for Oracle
+			if len(entities) > 1 {
+				return "", fmt.Errorf("dapper: %v cannot return the generated ids of multiple rows", s.dialect)
+			}
+			// The output parameter follows the bound values, if any
+			n := 1
+			if s.args != nil {
+				n = len(*s.args) + 1
+			}
+			sql.WriteString(rd.GetReturningIntoSQL(autoIncrField.ColumnName, n))
+		} else {
+			// Return the generated id, e.g. for PostgreSQL
+			sql.WriteString(fmt.Sprintf(" RETURNING %s",
+				s.dialect.EscapeColumnName(autoIncrField.ColumnName)))
+		}
+	}
+
+	return sql.String(), nil
+}
+
+// allZero returns true if the field described by fi has its zero value
+// in all entities.
+func allZero(fi *fieldInfo, entities []reflect.Value) bool {
+	for _, entityv := range entities {
+		if !entityv.FieldByName(fi.FieldName).IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteField returns the value of field, described by fi, as an SQL literal
+// or a bound parameter (see bind). Zero values of fields marked with
+// nullzero are written as NULL. Fields tagged with json are written as
+// JSON documents, or as NULL if nil. Fields of type SafeSqlString are
+// written verbatim, e.g. to set a column to NOW(), or as NULL if empty.
+func (s *Session) quoteField(fi *fieldInfo, field reflect.Value) (string, error) {
+	if fi.IsNullZero && field.IsZero() {
+		return "NULL", nil
+	}
+	value := field.Interface()
+	if expr, ok := value.(SafeSqlString); ok {
+		if expr == "" {
+			return "NULL", nil
+		}
+		return string(expr), nil
+	}
+	if fi.IsJSON {
+		doc, err := marshalJSON(field)
+		if err != nil {
+			return "", fmt.Errorf("dapper: field %s: %v", fi.FieldName, err)
+		}
+		if doc == nil {
+			return "NULL", nil
+		}
+		value = *doc
+	}
+	quoted, err := s.bind(value)
+	if err != nil {
+		return "", fmt.Errorf("dapper: field %s: %v", fi.FieldName, err)
+	}
+	return quoted, nil
+}
+
+// marshalJSON returns the JSON document of field, or nil if field is a
+// nil map, slice, pointer, or interface.
+func marshalJSON(field reflect.Value) (*string, error) {
+	switch field.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		if field.IsNil() {
+			return nil, nil
+		}
+	}
+	data, err := json.Marshal(field.Interface())
+	if err != nil {
+		return nil, err
+	}
+	doc := string(data)
+	return &doc, nil
+}
+
+// ---- InsertAll -----------------------------------------------------------
+
+// InsertAll adds all entities to the database with a single INSERT
+// statement. The entities parameter must be a slice of structs or of
+// pointers to structs, all of the same type.
+//
+// Every entity is validated and its insert hooks are called as in
+// Insert. If one is invalid or its BeforeInsert fails, nothing is
+// inserted.
+//
+// InsertAll returns the number of rows inserted, as reported by the
+// driver via RowsAffected. Notice that with e.g. INSERT IGNORE or
+// ON DUPLICATE KEY UPDATE in MySQL, that number can differ from the
+// number of entities. An empty slice is a no-op.
+//
+// If the type has an autoincrement column, the generated ids are set on
+// the entities, in order. For dialects with LastInsertId, the ids are
+// derived from it (see FirstInsertIdDialect), which assumes that the
+// rows get consecutive ids; for MySQL, this requires
+// innodb_autoinc_lock_mode 0 or 1 and an auto_increment_increment of 1.
+// The ids are left unset if the dialect cannot derive them, or if the
+// number of rows affected differs from the number of entities.
+func (s *Session) InsertAll(entities interface{}) (int64, error) {
+	return s.insertAll(entities, nil)
+}
+
+// InsertAllTx adds all entities to the database, but runs in a
+// transaction. See InsertAll for details.
+func (s *Session) InsertAllTx(tx *sql.Tx, entities interface{}) (int64, error) {
+	return s.insertAll(entities, tx)
+}
+
+func (s *Session) insertAll(entities interface{}, tx *sql.Tx) (int64, error) {
+	slicev := reflect.ValueOf(entities)
+	if slicev.Kind() == reflect.Ptr {
+		slicev = slicev.Elem()
+	}
+	if slicev.Kind() != reflect.Slice {
+		return 0, errors.New("entities must be a slice")
+	}
+	n := slicev.Len()
+	if n == 0 {
+		return 0, nil
+	}
+
+	ti, err := AddType(slicev.Type().Elem())
+	if err != nil {
+		return 0, err
+	}
+
+	// Collect the structs
+	now := time.Now()
+	structs := make([]reflect.Value, n)
+	for i := 0; i < n; i++ {
+		entityv := reflect.Indirect(slicev.Index(i))
+		if entityv.Kind() != reflect.Struct {
+			return 0, errors.New("entities must be a slice of structs or pointers to structs")
+		}
+		if err := beforeInsert(entityv.Addr().Interface()); err != nil {
+			return 0, err
+		}
+		ti.touchCreated(entityv, now)
+		structs[i] = entityv
+	}
+
+	// Generate SQL query for insert
+	sqlQuery, err := s.generateInsertAllSql(ti, structs)
+	if err != nil {
+		return 0, err
+	}
+
+	autoIncrField, hasAutoIncrField := ti.GetAutoIncrement()
+	if _, ok := s.dialect.(ReturningIntoDialect); ok && hasAutoIncrField && !s.dialect.SupportsLastInsertId() {
+		// Get RETURNING ... INTO value of the single entity
+		var newId int64
+		if err := s.execReturningInto(tx, sqlQuery, nil, &newId); err != nil {
+			return 0, err
+		}
+		setAutoIncrement(structs[0].FieldByName(autoIncrField.FieldName), newId)
+		return 1, afterInsertAll(structs)
+	}
+	if hasAutoIncrField && !s.dialect.SupportsLastInsertId() {
+		// Query and get RETURNING values, one row per entity
+		sqlQuery, err := s.prepareSQL(sqlQuery, nil, s.debug)
+		if err != nil {
+			return 0, err
+		}
+		var rows *sql.Rows
+		if tx != nil {
+			rows, err = tx.Query(sqlQuery)
+		} else {
+			rows, err = s.db.Query(sqlQuery)
+		}
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+
+		var count int64
+		for rows.Next() {
+			var newId int64
+			if err := rows.Scan(&newId); err != nil {
+				return count, err
+			}
+			if count < int64(n) {
+				setAutoIncrement(structs[count].FieldByName(autoIncrField.FieldName), newId)
+			}
+			count++
+		}
+		if err := rows.Err(); err != nil {
+			return count, err
+		}
+		return count, afterInsertAll(structs)
+	}
+
+	res, err := s.exec(tx, sqlQuery)
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if hasAutoIncrField && count == int64(n) {
+		lastId, err := res.LastInsertId()
+		if err != nil {
+			return count, err
+		}
+		if firstId, ok := firstInsertId(s.dialect, lastId, n); ok {
+			for i, entityv := range structs {
+				setAutoIncrement(entityv.FieldByName(autoIncrField.FieldName), firstId+int64(i))
+			}
+		}
+	}
+
+	return count, afterInsertAll(structs)
+}
+
+// afterInsertAll calls the AfterInsert hook of all inserted entities.
+func afterInsertAll(structs []reflect.Value) error {
+	for _, entityv := range structs {
+		if err := afterInsert(entityv.Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAutoIncrement sets the autoincrement field to the generated id.
+func setAutoIncrement(field reflect.Value, id int64) {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		field.SetUint(uint64(id))
+	default:
+		field.Set(reflect.ValueOf(id))
+	}
+}
+
+// ---- Upsert --------------------------------------------------------------
+
+// Upsert inserts the entity or, if an entity with the same primary key
+// already exists, updates all of its non-primary key columns. The SQL is
+// specific to the dialect, e.g. INSERT ... ON DUPLICATE KEY UPDATE for
+// MySQL and INSERT ... ON CONFLICT DO UPDATE for Sqlite3 and PostgreSQL.
+//
+// If the primary key is an autoincrement column and not set yet,
+// Upsert is the same as Insert. As it cannot tell in advance whether the
+// entity exists, Upsert validates it and calls its insert hooks (see
+// BeforeInserter and AfterInserter) in either case.
+func (s *Session) Upsert(entity interface{}) error {
+	return s.upsert(entity, nil)
+}
+
+// UpsertTx inserts or updates the entity, but runs in a transaction.
+// See Upsert for details.
+func (s *Session) UpsertTx(tx *sql.Tx, entity interface{}) error {
+	return s.upsert(entity, tx)
+}
+
+func (s *Session) upsert(entity interface{}, tx *sql.Tx) error {
+	// Get information about the entity
+	entityv := reflect.ValueOf(entity)
+	if entityv.Kind() != reflect.Ptr {
+		return errors.New("entity must be a pointer to a struct")
+	}
+
+	ti, err := AddType(entityv.Elem().Type())
+	if err != nil {
+		return err
+	}
+
+	pk, found := ti.GetPrimaryKey()
+	if !found {
+		return ErrNoPrimaryKey
+	}
+	if pk.IsAutoIncrement {
+		pkField := entityv.Elem().FieldByName(pk.FieldName)
+		if pkField.IsZero() {
+			// No primary key yet, so it's a new entity
+			return s.insert(entity, tx)
+		}
+	}
+
+	if err := beforeInsert(entity); err != nil {
+		return err
+	}
+	now := time.Now()
+	ti.touchCreated(entityv, now)
+	ti.touchUpdated(entityv, now)
+
+	// Generate SQL query for upsert
+	sql, err := s.generateUpsertSql(ti, entity)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.exec(tx, sql); err != nil {
+		return err
+	}
+
+	return afterInsert(entity)
+}
+
+func (s *Session) generateUpsertSql(ti *typeInfo, entity interface{}) (string, error) {
+	if ti.TableName == "" {
+		return "", ErrNoTableName
+	}
+	if ti.ReadOnly {
+		return "", ErrReadOnly
+	}
+
+	entityv := reflect.Indirect(reflect.ValueOf(entity))
+
+	pk, found := ti.GetPrimaryKey()
+	if !found {
+		return "", ErrNoPrimaryKey
+	}
+
+	cnames := make([]string, 0)
+	cvals := make([]string, 0)
+	updates := make([]string, 0)
+
+	for _, cname := range ti.ColumnNames {
+		if fi, found := ti.ColumnInfos[cname]; found {
+			if fi.IsReadOnly {
+				// Managed by the database
+				continue
+			}
+			cnames = append(cnames, cname)
+
+			field := entityv.FieldByName(fi.FieldName)
+			quoted, err := s.quoteField(fi, field)
+			if err != nil {
+				return "", err
+			}
+			cvals = append(cvals, quoted)
+
+			if !fi.IsPrimaryKey {
+				updates = append(updates, cname)
+			}
+		}
+	}
+
+	return upsertSQL(s.dialect, ti.TableName, cnames, cvals, pk.ColumnName, updates)
+}
+
+// ---- Update --------------------------------------------------------------
+
+// Update changes an already existing entity in the database.
+func (s *Session) Update(entity interface{}) error {
+	return s.update(entity, nil, nil)
+}
+
+// UpdateTx changes an already existing entity in the database, but runs
+// in a transaction.
+func (s *Session) UpdateTx(tx *sql.Tx, entity interface{}) error {
+	return s.update(entity, nil, tx)
+}
+
+// UpdateColumns changes an already existing entity in the database, but
+// only updates the given columns. Columns can be specified by column name
+// or by field name. It returns an error if a column does not exist or
+// is the primary key.
+func (s *Session) UpdateColumns(entity interface{}, columns ...string) error {
+	return s.updateColumns(entity, columns, nil)
+}
+
+// UpdateColumnsTx changes the given columns of an already existing entity
+// in the database, but runs in a transaction. See UpdateColumns for details.
+func (s *Session) UpdateColumnsTx(tx *sql.Tx, entity interface{}, columns ...string) error {
+	return s.updateColumns(entity, columns, tx)
+}
+
+func (s *Session) updateColumns(entity interface{}, columns []string, tx *sql.Tx) error {
+	if len(columns) == 0 {
+		return errors.New("dapper: no columns to update specified")
+	}
+	ti, err := AddType(reflect.TypeOf(entity))
+	if err != nil {
+		return err
+	}
+	cnames, err := ti.resolveColumnNames(columns)
+	if err != nil {
+		return err
+	}
+	return s.update(entity, cnames, tx)
+}
+
+// Update changes an already existing entity in the database.
+// If columns is nil, all columns are updated.
+func (s *Session) update(entity interface{}, columns []string, tx *sql.Tx) error {
+	// Get information about the entity
+	entityv := reflect.ValueOf(entity)
+	entityIsPtr := entityv.Kind() == reflect.Ptr
+
+	gotype := entityv.Type()
+	if entityIsPtr {
+		gotype = entityv.Type().Elem()
+	}
+
+	ti, err := AddType(gotype)
+	if err != nil {
+		return err
+	}
+	if err := beforeUpdate(entity); err != nil {
+		return err
+	}
+
+	// Refresh autoupdatetime fields and make sure they are written
+	touched := ti.touchUpdated(entityv, time.Now())
+	if columns != nil {
+		columns = appendMissing(columns, touched)
+	}
+
+	// Generate SQL query for update
+	sql, args, err := s.withArgs(func(b *Session) (string, error) {
+		return b.generateUpdateSql(ti, entity, columns)
+	})
+	if err != nil {
+		return err
+	}
 
-	var autoIncrField *fieldInfo
+	// Execute SQL query and check for concurrent modifications
+	res, err := s.execArgs(tx, sql, args)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(ti, entityv, res); err != nil {
+		return err
+	}
+	return afterUpdate(entity)
+}
 
-	for _, cname := range ti.ColumnNames {
+// checkVersion returns ErrStaleObject if the UPDATE with result res
+// didn't affect any rows because the version column of the entity is
+// outdated. Otherwise it increments the version column of the entity,
+// if settable, to match the database.
+func checkVersion(ti *typeInfo, entityv reflect.Value, res sql.Result) error {
+	fi, found := ti.GetVersion()
+	if !found {
+		return nil
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrStaleObject
+	}
+	field := reflect.Indirect(entityv).FieldByName(fi.FieldName)
+	if field.CanSet() {
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			field.SetInt(field.Int() + 1)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			field.SetUint(field.Uint() + 1)
+		}
+	}
+	return nil
+}
+
+// generateUpdateSql generates the UPDATE statement for entity. If columns
+// is nil, all columns are updated; otherwise only the given columns.
+// If the entity has a version column, it is always incremented and
+// its current value is added to the WHERE clause.
+func (s *Session) generateUpdateSql(ti *typeInfo, entity interface{}, columns []string) (string, error) {
+	if ti.TableName == "" {
+		return "", ErrNoTableName
+	}
+	if ti.ReadOnly {
+		return "", ErrReadOnly
+	}
+
+	entityv := reflect.ValueOf(entity)
+	if entityv.Kind() == reflect.Ptr {
+		entityv = entityv.Elem()
+	}
+
+	pairs := make([]string, 0)
+
+	if columns == nil {
+		columns = ti.ColumnNames
+	}
+	for _, cname := range columns {
 		if fi, found := ti.ColumnInfos[cname]; found {
-			if !fi.IsAutoIncrement || fi.IsTransient {
-				cnames = append(cnames, s.dialect.EscapeColumnName(cname))
+			if (!fi.IsPrimaryKey || fi.IsTransient) && !fi.IsVersion && !fi.IsReadOnly {
+				field := entityv.FieldByName(fi.FieldName)
+				quoted, err := s.quoteField(fi, field)
+				if err != nil {
+					return "", err
+				}
+				pair := fmt.Sprintf("%s=%s", s.dialect.EscapeColumnName(cname), quoted)
+				pairs = append(pairs, pair)
+			}
+		}
+	}
 
-				field := entityv.Elem().FieldByName(fi.FieldName)
-				value := field.Interface()
-				quoted := Quote(s.dialect, value)
-				cvals = append(cvals, quoted)
-			} else if fi.IsAutoIncrement {
-				autoIncrField = fi
+	// Bound parameters of the WHERE clause come after the ones of SET
+	where, err := s.primaryKeySql(ti, entityv)
+	if err != nil {
+		return "", err
+	}
+	if fi, found := ti.GetVersion(); found {
+		vcol := s.dialect.EscapeColumnName(fi.ColumnName)
+		pairs = append(pairs, fmt.Sprintf("%s=%s+1", vcol, vcol))
+		quoted, err := s.quoteField(fi, entityv.FieldByName(fi.FieldName))
+		if err != nil {
+			return "", err
+		}
+		where += fmt.Sprintf(" AND %s=%s", vcol, quoted)
+	}
+	scope, err := s.scopeSql()
+	if err != nil {
+		return "", err
+	}
+	where += scope
+
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		s.dialect.EscapeTableName(ti.TableName),
+		strings.Join(pairs, ", "),
+		where), nil
+}
+
+// ---- Dirty tracking ------------------------------------------------------
+
+// Track takes a snapshot of the column values of entity, e.g. right after
+// it has been loaded. A subsequent UpdateChanged will only update the
+// columns that have changed since. Calling Track again replaces the
+// snapshot, and Untrack drops it. The entity must have a primary key.
+func (s *Session) Track(entity interface{}) error {
+	entityv := reflect.Indirect(reflect.ValueOf(entity))
+	ti, err := AddType(entityv.Type())
+	if err != nil {
+		return err
+	}
+	key, err := snapshotKey(ti, entityv)
+	if err != nil {
+		return err
+	}
+
+	snapshot := make(map[string]interface{})
+	for _, cname := range ti.ColumnNames {
+		fi := ti.ColumnInfos[cname]
+		snapshot[cname] = snapshotValue(fi, entityv.FieldByName(fi.FieldName))
+	}
+
+	s.snapshotsMu.Lock()
+	s.snapshots[key] = snapshot
+	s.snapshotsMu.Unlock()
+	return nil
+}
+
+// Untrack drops the snapshot of entity taken by Track, e.g. when the
+// entity is no longer used. A subsequent UpdateChanged updates all
+// columns again. Delete and HardDelete drop the snapshot as well.
+func (s *Session) Untrack(entity interface{}) error {
+	entityv := reflect.Indirect(reflect.ValueOf(entity))
+	ti, err := AddType(entityv.Type())
+	if err != nil {
+		return err
+	}
+	return s.untrack(ti, entityv)
+}
+
+// untrack drops the snapshot of entityv, if any.
+func (s *Session) untrack(ti *typeInfo, entityv reflect.Value) error {
+	key, err := snapshotKey(ti, entityv)
+	if err != nil {
+		return err
+	}
+	s.snapshotsMu.Lock()
+	delete(s.snapshots, key)
+	s.snapshotsMu.Unlock()
+	return nil
+}
+
+// UpdateChanged changes an already existing entity in the database, but
+// only updates the columns that have changed since the entity has been
+// tracked with Track. If nothing has changed, no SQL is executed. If the
+// entity is not tracked, all columns are updated (see Update).
+// After a successful update, the snapshot is refreshed.
+func (s *Session) UpdateChanged(entity interface{}) error {
+	return s.updateChanged(entity, nil)
+}
+
+// UpdateChangedTx is like UpdateChanged, but runs in a transaction.
+func (s *Session) UpdateChangedTx(tx *sql.Tx, entity interface{}) error {
+	return s.updateChanged(entity, tx)
+}
+
+func (s *Session) updateChanged(entity interface{}, tx *sql.Tx) error {
+	entityv := reflect.Indirect(reflect.ValueOf(entity))
+	ti, err := AddType(entityv.Type())
+	if err != nil {
+		return err
+	}
+	if err := beforeUpdate(entity); err != nil {
+		return err
+	}
+
+	// Generate SQL query for update
+	sql, err := s.generateUpdateChangedSql(ti, entity)
+	if err != nil {
+		return err
+	}
+	if sql == "" {
+		// Nothing changed
+		return nil
+	}
+
+	res, err := s.exec(tx, sql)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(ti, entityv, res); err != nil {
+		return err
+	}
+	if err := afterUpdate(entity); err != nil {
+		return err
+	}
+
+	return s.Track(entity)
+}
+
+// generateUpdateChangedSql generates an UPDATE statement for the columns
+// of entity that differ from its snapshot. It returns an empty string
+// if nothing has changed. Otherwise, it refreshes the autoupdatetime
+// fields of entity and includes them in the statement.
+func (s *Session) generateUpdateChangedSql(ti *typeInfo, entity interface{}) (string, error) {
+	entityv := reflect.Indirect(reflect.ValueOf(entity))
+	key, err := snapshotKey(ti, entityv)
+	if err != nil {
+		return "", err
+	}
+
+	s.snapshotsMu.Lock()
+	snapshot, found := s.snapshots[key]
+	s.snapshotsMu.Unlock()
+	if !found {
+		// Not tracked, so update all columns
+		ti.touchUpdated(entityv, time.Now())
+		return s.generateUpdateSql(ti, entity, nil)
+	}
+
+	changed := make([]string, 0)
+	for _, cname := range ti.ColumnNames {
+		fi := ti.ColumnInfos[cname]
+		if fi.IsPrimaryKey || fi.IsVersion || fi.IsAutoUpdateTime || fi.IsReadOnly {
+			continue
+		}
+		value := snapshotValue(fi, entityv.FieldByName(fi.FieldName))
+		if !reflect.DeepEqual(snapshot[cname], value) {
+			changed = append(changed, cname)
+		}
+	}
+	if len(changed) == 0 {
+		return "", nil
+	}
+	changed = appendMissing(changed, ti.touchUpdated(entityv, time.Now()))
+	return s.generateUpdateSql(ti, entity, changed)
+}
+
+// snapshotValue returns the value of field, described by fi, to compare
+// with a snapshot. Fields tagged with json are compared by their JSON
+// documents, as maps and slices are shared with the entity. Byte slices
+// are copied for the same reason, so changes in place are detected.
+func snapshotValue(fi *fieldInfo, field reflect.Value) interface{} {
+	if fi.IsJSON {
+		doc, err := marshalJSON(field)
+		if err != nil || doc == nil {
+			return nil
+		}
+		return *doc
+	}
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8 && !field.IsNil() {
+		copied := reflect.MakeSlice(field.Type(), field.Len(), field.Len())
+		reflect.Copy(copied, field)
+		return copied.Interface()
+	}
+	return indirectInterface(field)
+}
+
+// appendMissing appends those values to slice that are not in it yet.
+func appendMissing(slice []string, values []string) []string {
+	for _, value := range values {
+		found := false
+		for _, s := range slice {
+			if s == value {
+				found = true
+				break
 			}
 		}
+		if !found {
+			slice = append(slice, value)
+		}
 	}
+	return slice
+}
 
-	var sql bytes.Buffer
-	sql.WriteString(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+// snapshotKey returns the key of the snapshot of entityv.
+func snapshotKey(ti *typeInfo, entityv reflect.Value) (identityKey, error) {
+	pks := ti.GetPrimaryKeys()
+	if len(pks) == 0 {
+		return identityKey{}, ErrNoPrimaryKey
+	}
+	if len(pks) == 1 {
+		pk := indirectInterface(entityv.FieldByName(pks[0].FieldName))
+		if pk != nil && !reflect.TypeOf(pk).Comparable() {
+			// e.g. a []byte primary key, which cannot be a map key
+			return identityKey{Type: ti.Type, Pk: fmt.Sprintf("%#v", pk)}, nil
+		}
+		return identityKey{Type: ti.Type, Pk: pk}, nil
+	}
+	values := make([]interface{}, len(pks))
+	for i, pk := range pks {
+		values[i] = indirectInterface(entityv.FieldByName(pk.FieldName))
+	}
+	return identityKey{Type: ti.Type, Pk: fmt.Sprintf("%#v", values)}, nil
+}
+
+// ---- Delete --------------------------------------------------------------
+
+// Delete removes the entity from the database.
+//
+// If the type has a column marked with `dapper:"deleted_at,softdelete"`,
+// the entity is soft-deleted instead: Delete sets that column to the
+// current time, and the entity is excluded by Find and Get from then on.
+// The field should be a *time.Time so that it can be scanned from NULL.
+// Use HardDelete to remove such an entity from the database.
+func (s *Session) Delete(entity interface{}) error {
+	return s.delete(entity, false, nil)
+}
+
+// DeleteTx removes the entity from the database, but runs in a transaction.
+// See Delete for details.
+func (s *Session) DeleteTx(tx *sql.Tx, entity interface{}) error {
+	return s.delete(entity, false, tx)
+}
+
+// HardDelete removes the entity from the database, even if its type
+// supports soft deletes.
+func (s *Session) HardDelete(entity interface{}) error {
+	return s.delete(entity, true, nil)
+}
+
+// HardDeleteTx removes the entity from the database, even if its type
+// supports soft deletes, but runs in a transaction.
+func (s *Session) HardDeleteTx(tx *sql.Tx, entity interface{}) error {
+	return s.delete(entity, true, tx)
+}
+
+// Delete removes the entity from the database. Unless hard is true,
+// entities that support soft deletes are marked as deleted instead.
+func (s *Session) delete(entity interface{}, hard bool, tx *sql.Tx) error {
+	// Get information about the entity
+	entityv := reflect.ValueOf(entity)
+	entityIsPtr := entityv.Kind() == reflect.Ptr
+
+	gotype := entityv.Type()
+	if entityIsPtr {
+		gotype = entityv.Type().Elem()
+	}
+
+	ti, err := AddType(gotype)
+	if err != nil {
+		return err
+	}
+	if err := beforeDelete(entity); err != nil {
+		return err
+	}
+
+	sd, softDelete := ti.GetSoftDelete()
+	if softDelete && !hard {
+		if err := s.softDelete(ti, sd, entityv, tx); err != nil {
+			return err
+		}
+		if err := s.untrack(ti, reflect.Indirect(entityv)); err != nil {
+			return err
+		}
+		return afterDelete(entity)
+	}
+
+	// Generate SQL query for delete
+	sql, args, err := s.withArgs(func(b *Session) (string, error) {
+		return b.generateDeleteSql(ti, entity)
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.execArgs(tx, sql, args); err != nil {
+		return err
+	}
+	if err := s.untrack(ti, reflect.Indirect(entityv)); err != nil {
+		return err
+	}
+
+	return afterDelete(entity)
+}
+
+// softDelete sets the soft delete column sd of entityv to the current
+// time, both in the database and, if settable, in entityv.
+func (s *Session) softDelete(ti *typeInfo, sd *fieldInfo, entityv reflect.Value, tx *sql.Tx) error {
+	now := time.Now()
+	sql, err := s.generateSoftDeleteSql(ti, entityv.Interface(), now)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.exec(tx, sql); err != nil {
+		return err
+	}
+
+	setTime(reflect.Indirect(entityv).FieldByName(sd.FieldName), now)
+	return nil
+}
+
+func (s *Session) generateSoftDeleteSql(ti *typeInfo, entity interface{}, now time.Time) (string, error) {
+	if ti.TableName == "" {
+		return "", ErrNoTableName
+	}
+	if ti.ReadOnly {
+		return "", ErrReadOnly
+	}
+
+	entityv := reflect.Indirect(reflect.ValueOf(entity))
+
+	where, err := s.primaryKeySql(ti, entityv)
+	if err != nil {
+		return "", err
+	}
+	scope, err := s.scopeSql()
+	if err != nil {
+		return "", err
+	}
+	sd, found := ti.GetSoftDelete()
+	if !found {
+		return "", fmt.Errorf("dapper: type %s has no soft delete column", ti.Type)
+	}
+
+	return fmt.Sprintf("UPDATE %s SET %s=%s WHERE %s%s",
 		s.dialect.EscapeTableName(ti.TableName),
-		strings.Join(cnames, ", "),
-		strings.Join(cvals, ", ")))
+		s.dialect.EscapeColumnName(sd.ColumnName),
+		Quote(s.dialect, now),
+		where,
+		scope), nil
+}
+
+func (s *Session) generateDeleteSql(ti *typeInfo, entity interface{}) (string, error) {
+	if ti.TableName == "" {
+		return "", ErrNoTableName
+	}
+	if ti.ReadOnly {
+		return "", ErrReadOnly
+	}
+
+	entityv := reflect.ValueOf(entity)
+	if entityv.Kind() == reflect.Ptr {
+		entityv = entityv.Elem()
+	}
+
+	where, err := s.primaryKeySql(ti, entityv)
+	if err != nil {
+		return "", err
+	}
+	scope, err := s.scopeSql()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("DELETE FROM %s WHERE %s%s",
+		s.dialect.EscapeTableName(ti.TableName),
+		where,
+		scope), nil
+}
+
+// primaryKeySql returns the condition that identifies entityv by its
+// primary key, e.g. `id`=1 or, for composite keys, `a`=1 AND `b`=2.
+func (s *Session) primaryKeySql(ti *typeInfo, entityv reflect.Value) (string, error) {
+	pks := ti.GetPrimaryKeys()
+	if len(pks) == 0 {
+		return "", ErrNoPrimaryKey
+	}
+	conds := make([]string, len(pks))
+	for i, pk := range pks {
+		quoted, err := s.bind(entityv.FieldByName(pk.FieldName).Interface())
+		if err != nil {
+			return "", err
+		}
+		conds[i] = fmt.Sprintf("%s=%s", s.dialect.EscapeColumnName(pk.ColumnName), quoted)
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+// ---- DeleteWhere / UpdateWhere -------------------------------------------
+
+// DeleteWhere deletes all rows of the table of model that match where in
+// a single statement, without loading them, and returns the number of
+// affected rows. If model has a soft delete column, the rows are soft
+// deleted instead (see Delete). Hooks are not called.
+//
+// Example:
+// where := Q(MySQL, "users").Where().Eq("suspended", true)
+// n, err := session.DeleteWhere(user{}, where)
+func (s *Session) DeleteWhere(model interface{}, where *whereClause) (int64, error) {
+	return s.deleteWhere(model, where, nil)
+}
+
+// DeleteWhereTx is like DeleteWhere, but runs in a transaction.
+func (s *Session) DeleteWhereTx(tx *sql.Tx, model interface{}, where *whereClause) (int64, error) {
+	return s.deleteWhere(model, where, tx)
+}
+
+func (s *Session) deleteWhere(model interface{}, where *whereClause, tx *sql.Tx) (int64, error) {
+	ti, err := AddType(reflect.Indirect(reflect.ValueOf(model)).Type())
+	if err != nil {
+		return 0, err
+	}
+	sql, err := s.generateDeleteWhereSql(ti, where, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return s.execAffected(tx, sql)
+}
 
-	if !s.dialect.SupportsLastInsertId() {
-		sql.WriteString(fmt.Sprintf(" RETURNING %s",
-			s.dialect.EscapeColumnName(autoIncrField.ColumnName)))
+func (s *Session) generateDeleteWhereSql(ti *typeInfo, where *whereClause, now time.Time) (string, error) {
+	cond, err := s.whereSql(ti, where)
+	if err != nil {
+		return "", err
 	}
-
-	return sql.String(), nil
+	if sd, found := ti.GetSoftDelete(); found {
+		// Keep the time of rows that are already deleted
+		sdcol := s.dialect.EscapeColumnName(sd.ColumnName)
+		return fmt.Sprintf("UPDATE %s SET %s=%s WHERE %s AND %s IS NULL",
+			s.dialect.EscapeTableName(ti.TableName),
+			sdcol,
+			Quote(s.dialect, now),
+			cond,
+			sdcol), nil
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s",
+		s.dialect.EscapeTableName(ti.TableName),
+		cond), nil
 }
 
-// ---- Update --------------------------------------------------------------
-
-// Update changes an already existing entity in the database.
-func (s *Session) Update(entity interface{}) error {
-	return s.update(entity, nil)
+// UpdateWhere sets the columns in set to their values for all rows of the
+// table of model that match where in a single statement, without loading
+// them, and returns the number of affected rows. Columns can be specified
+// by column name or by field name. Hooks are not called.
+//
+// Example:
+// where := Q(MySQL, "users").Where().Lt("karma", 0)
+// n, err := session.UpdateWhere(user{}, map[string]interface{}{"suspended": true}, where)
+func (s *Session) UpdateWhere(model interface{}, set map[string]interface{}, where *whereClause) (int64, error) {
+	return s.updateWhere(model, set, where, nil)
 }
 
-// UpdateTx changes an already existing entity in the database, but runs
-// in a transaction.
-func (s *Session) UpdateTx(tx *sql.Tx, entity interface{}) error {
-	return s.update(entity, tx)
+// UpdateWhereTx is like UpdateWhere, but runs in a transaction.
+func (s *Session) UpdateWhereTx(tx *sql.Tx, model interface{}, set map[string]interface{}, where *whereClause) (int64, error) {
+	return s.updateWhere(model, set, where, tx)
 }
 
-// Update changes an already existing entity in the database.
-func (s *Session) update(entity interface{}, tx *sql.Tx) error {
-	// Get information about the entity
-	entityv := reflect.ValueOf(entity)
-	entityIsPtr := entityv.Kind() == reflect.Ptr
-
-	gotype := entityv.Type()
-	if entityIsPtr {
-		gotype = entityv.Type().Elem()
+func (s *Session) updateWhere(model interface{}, set map[string]interface{}, where *whereClause, tx *sql.Tx) (int64, error) {
+	ti, err := AddType(reflect.Indirect(reflect.ValueOf(model)).Type())
+	if err != nil {
+		return 0, err
 	}
-
-	ti, err := AddType(gotype)
+	sql, err := s.generateUpdateWhereSql(ti, set, where)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return s.execAffected(tx, sql)
+}
 
-	// Generate SQL query for update
-	sql, err := s.generateUpdateSql(ti, entity)
+func (s *Session) generateUpdateWhereSql(ti *typeInfo, set map[string]interface{}, where *whereClause) (string, error) {
+	if len(set) == 0 {
+		return "", errors.New("dapper: no columns to update specified")
+	}
+	cond, err := s.whereSql(ti, where)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	if s.debug {
-		log.Println(sql)
+	// Sort by name to render the same SQL every time
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cnames, err := ti.resolveColumnNames(names)
+	if err != nil {
+		return "", err
 	}
 
-	if tx == nil {
-		// Execute SQL query and return its result
-		_, err = s.db.Exec(sql)
-		if err != nil {
-			return err
-		}
-	} else {
-		// Execute SQL query and return its result
-		_, err = tx.Exec(sql)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		quoted, err := QuoteValue(s.dialect, set[name])
 		if err != nil {
-			return err
+			return "", err
 		}
+		pairs[i] = fmt.Sprintf("%s=%s", s.dialect.EscapeColumnName(cnames[i]), quoted)
 	}
 
-	return nil
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		s.dialect.EscapeTableName(ti.TableName),
+		strings.Join(pairs, ", "),
+		cond), nil
 }
 
-func (s *Session) generateUpdateSql(ti *typeInfo, entity interface{}) (string, error) {
+// whereSql returns the condition of a bulk statement on the table of ti,
+// including the scope of the session. To protect against accidentally
+// changing all rows, where must not be empty.
+func (s *Session) whereSql(ti *typeInfo, where *whereClause) (string, error) {
 	if ti.TableName == "" {
 		return "", ErrNoTableName
 	}
+	if ti.ReadOnly {
+		return "", ErrReadOnly
+	}
+	if where == nil || len(where.nodes) == 0 {
+		return "", errors.New("dapper: no condition specified")
+	}
+	scope, err := s.scopeSql()
+	if err != nil {
+		return "", err
+	}
+	// Parenthesize, so an OR in where cannot escape the scope
+	// or the soft delete condition
+	return "(" + where.SubSql() + ")" + scope, nil
+}
 
-	entityv := reflect.ValueOf(entity)
-	if entityv.Kind() == reflect.Ptr {
-		entityv = entityv.Elem()
+// execAffected executes sql and returns the number of affected rows.
+func (s *Session) execAffected(tx *sql.Tx, sql string) (int64, error) {
+	res, err := s.exec(tx, sql)
+	if err != nil {
+		return 0, err
 	}
+	return res.RowsAffected()
+}
 
-	pk, found := ti.GetPrimaryKey()
-	if !found {
-		return "", ErrNoPrimaryKey
+// ---- Load associations ----------------------------------------------------
+
+// LoadAssociations loads the associations with the given names onto
+// parents, a slice of entities loaded before, or a pointer to it. It uses
+// the same batched IN queries as Include in All, so associations can be
+// loaded separately from the parents. Nested associations are specified
+// as in Include, e.g. "Items.Images".
+//
+// Example:
+// err := session.LoadAssociations(orders, "Items", "Extensions")
+func (s *Session) LoadAssociations(parents interface{}, assocNames ...string) error {
+	return s.loadAssociationsOf(parents, assocNames, nil)
+}
+
+// LoadAssociationsTx loads associations onto parents, but runs in a
+// transaction. See LoadAssociations for details.
+func (s *Session) LoadAssociationsTx(tx *sql.Tx, parents interface{}, assocNames ...string) error {
+	return s.loadAssociationsOf(parents, assocNames, tx)
+}
+
+func (s *Session) loadAssociationsOf(parents interface{}, assocNames []string, tx *sql.Tx) error {
+	parentsv := reflect.Indirect(reflect.ValueOf(parents))
+	if parentsv.Kind() != reflect.Slice {
+		return errors.New("dapper: parents must be a slice or a pointer to a slice")
+	}
+	if len(assocNames) == 0 || parentsv.Len() == 0 {
+		return nil
 	}
-	field := entityv.FieldByName(pk.FieldName)
-	pkval := field.Interface()
+	var db queryer = s.db
+	if tx != nil {
+		db = tx
+	}
+	return s.loadSliceAssociations(db, make(identityMap), parentsv, nil, assocNames, nil)
+}
 
-	pairs := make([]string, 0)
+// Related returns a finder for the entities of the association assocName
+// of parent, i.e. the query that Include would run to load it. Use it to
+// load associations lazily. Execute it with All for a oneToMany and with
+// Single for a oneToOne association.
+//
+// Example:
+// var items []*OrderItem
+// err := session.Related(order, "Items").All(&items)
+func (s *Session) Related(parent interface{}, assocName string) *finder {
+	return s.related(s.db, parent, assocName)
+}
 
-	for _, cname := range ti.ColumnNames {
-		if fi, found := ti.ColumnInfos[cname]; found {
-			if !fi.IsPrimaryKey || fi.IsTransient {
-				field = entityv.FieldByName(fi.FieldName)
-				value := field.Interface()
-				quoted := Quote(s.dialect, value)
-				pair := fmt.Sprintf("%s=%s", s.dialect.EscapeColumnName(cname), quoted)
-				pairs = append(pairs, pair)
-			}
+// RelatedTx returns a finder for the entities of the association assocName
+// of parent that runs in a transaction. See Related for details.
+func (s *Session) RelatedTx(tx *sql.Tx, parent interface{}, assocName string) *finder {
+	return s.related(tx, parent, assocName)
+}
+
+func (s *Session) related(db queryer, parent interface{}, assocName string) *finder {
+	sqlQuery, err := s.relatedSql(parent, assocName)
+	f := s.find(db, sqlQuery, nil)
+	f.err = err
+	return f
+}
+
+// relatedSql returns the query for the association assocName of parent.
+func (s *Session) relatedSql(parent interface{}, assocName string) (string, error) {
+	parentv := reflect.Indirect(reflect.ValueOf(parent))
+	if parentv.Kind() != reflect.Struct {
+		return "", errors.New("dapper: parent must be a struct or a pointer to a struct")
+	}
+	ti, err := AddType(parentv.Type())
+	if err != nil {
+		return "", err
+	}
+
+	var tableName, columnName string
+	var value interface{}
+	if assoc, found := ti.OneToOneInfos[assocName]; found {
+		if err := assoc.check(ti.Type); err != nil {
+			return "", err
+		}
+		if tableName, err = assoc.GetTableName(); err != nil {
+			return "", err
+		}
+		if columnName, err = assoc.GetColumnName(); err != nil {
+			return "", err
+		}
+		fkField := parentv.FieldByName(assoc.ForeignKeyField)
+		if !fkField.IsValid() {
+			return "", fmt.Errorf("dapper: field %s.%s has a oneToOne association with field %s which is invalid", parentv.Type(), assoc.FieldName, assoc.ForeignKeyField)
+		}
+		value = indirectInterface(fkField)
+	} else if assoc, found := ti.OneToManyInfos[assocName]; found {
+		if err := assoc.check(ti.Type); err != nil {
+			return "", err
+		}
+		if tableName, err = assoc.GetTableName(); err != nil {
+			return "", err
+		}
+		if columnName, err = assoc.GetColumnName(); err != nil {
+			return "", err
+		}
+		pk, found := ti.GetPrimaryKey()
+		if !found {
+			return "", ErrNoPrimaryKey
 		}
+		value = parentv.FieldByName(pk.FieldName).Interface()
+	} else {
+		return "", fmt.Errorf("dapper: type %s has no association %s", parentv.Type(), assocName)
 	}
 
-	return fmt.Sprintf("UPDATE %s SET %s WHERE %s=%s",
-		s.dialect.EscapeTableName(ti.TableName),
-		strings.Join(pairs, ", "),
-		s.dialect.EscapeColumnName(pk.ColumnName),
-		Quote(s.dialect, pkval)), nil
+	return s.Q(s.dialect.EscapeTableName(tableName)).Where().Eq(s.dialect.EscapeColumnName(columnName), value).Sql(), nil
 }
 
-// ---- Delete --------------------------------------------------------------
+// ---- FindBy --------------------------------------------------------------
 
-// Delete removes the entity from the database.
-func (s *Session) Delete(entity interface{}) error {
-	return s.delete(entity, nil)
+// FindBy returns a finder for the entities that match example, i.e. a
+// SELECT from the table of example with a WHERE clause comparing every
+// column with a non-zero value in example for equality. Zero values are
+// ignored, but pointers to a zero value are not, so use a pointer field
+// to look for e.g. a karma of 0. Fields tagged with json are ignored.
+//
+// Example:
+// var users []user
+// err := session.FindBy(user{Name: "Oliver"}).All(&users)
+func (s *Session) FindBy(example interface{}) *finder {
+	return s.findBy(s.db, example)
 }
 
-// DeleteTx removes the entity from the database, but runs in a transaction.
-func (s *Session) DeleteTx(tx *sql.Tx, entity interface{}) error {
-	return s.delete(entity, tx)
+// FindByTx returns a finder for the entities that match example that
+// runs in a transaction. See FindBy for details.
+func (s *Session) FindByTx(tx *sql.Tx, example interface{}) *finder {
+	return s.findBy(tx, example)
 }
 
-// Delete removes the entity from the database.
-func (s *Session) delete(entity interface{}, tx *sql.Tx) error {
-	// Get information about the entity
-	entityv := reflect.ValueOf(entity)
-	entityIsPtr := entityv.Kind() == reflect.Ptr
+func (s *Session) findBy(db queryer, example interface{}) *finder {
+	sqlQuery, err := s.findBySql(example)
+	f := s.find(db, sqlQuery, nil)
+	f.err = err
+	return f
+}
 
-	gotype := entityv.Type()
-	if entityIsPtr {
-		gotype = entityv.Type().Elem()
+// findBySql returns the query for the entities that match example.
+func (s *Session) findBySql(example interface{}) (string, error) {
+	examplev := reflect.Indirect(reflect.ValueOf(example))
+	if examplev.Kind() != reflect.Struct {
+		return "", errors.New("dapper: example must be a struct or a pointer to a struct")
 	}
-
-	ti, err := AddType(gotype)
+	ti, err := AddType(examplev.Type())
 	if err != nil {
-		return err
+		return "", err
 	}
-
-	// Generate SQL query for delete
-	sql, err := s.generateDeleteSql(ti, entity)
-	if err != nil {
-		return err
+	if ti.TableName == "" {
+		return "", ErrNoTableName
 	}
 
-	if s.debug {
-		log.Println(sql)
+	q := s.Q(s.dialect.EscapeTableName(ti.TableName))
+	for _, cname := range ti.ColumnNames {
+		fi := ti.ColumnInfos[cname]
+		field := examplev.FieldByName(fi.FieldName)
+		if field.IsZero() || fi.IsJSON {
+			continue
+		}
+		q.Where().Eq(s.dialect.EscapeColumnName(cname), indirectInterface(field))
 	}
+	return q.Sql(), nil
+}
 
-	if tx == nil {
-		// Execute SQL query and return its result
-		_, err = s.db.Exec(sql)
-		if err != nil {
-			return err
+// split takes a slice of include paths and splits each of them on sep.
+// It returns the association names of the current level and, for each of
+// those names, the remaining paths to be loaded on the next level.
+// It makes sure that duplicates on both levels are ignored.
+// Example:
+//
+//	[]string{"Items", "Items.Order", "Items.Images.Item", "Extensions"}
+//	=> []string{"Items", "Extensions"},
+//	   map[string][]string{"Items": {"Order", "Images.Item"}}
+func split(includes []string, sep string) ([]string, map[string][]string) {
+	current := make([]string, 0)
+	currentDups := make(map[string]bool)
+	remaining := make(map[string][]string)
+	remainingDups := make(map[string]bool)
+	for _, include := range includes {
+		str := strings.SplitN(include, sep, 2)
+		if str[0] == "" {
+			continue
 		}
-	} else {
-		// Execute SQL query n transaction and return its result
-		_, err = tx.Exec(sql)
-		if err != nil {
-			return err
+		if _, found := currentDups[str[0]]; !found {
+			current = append(current, str[0])
+			currentDups[str[0]] = true
+		}
+		if len(str) > 1 && str[1] != "" {
+			if _, found := remainingDups[include]; !found {
+				remaining[str[0]] = append(remaining[str[0]], str[1])
+				remainingDups[include] = true
+			}
 		}
 	}
+	return current, remaining
+}
 
-	return nil
+// identityMap keeps track of the entities loaded while resolving
+// associations, indexed by type and primary key. It makes sure that
+// every entity is loaded only once, and that cyclic associations
+// (Order→Items→Order) reference the already loaded entities.
+type identityMap map[identityKey]reflect.Value
+
+// identityKey identifies an entity by type and primary key.
+type identityKey struct {
+	Type reflect.Type
+	Pk   interface{}
 }
 
-func (s *Session) generateDeleteSql(ti *typeInfo, entity interface{}) (string, error) {
-	if ti.TableName == "" {
-		return "", ErrNoTableName
+// lookup returns the already loaded entity of type gotype with primary
+// key pk. The entity is returned as a pointer to a struct.
+func (m identityMap) lookup(gotype reflect.Type, pk interface{}) (reflect.Value, bool) {
+	for gotype.Kind() == reflect.Ptr {
+		gotype = gotype.Elem()
+	}
+	if pk == nil || !reflect.TypeOf(pk).Comparable() {
+		return reflect.Value{}, false
 	}
+	entity, found := m[identityKey{Type: gotype, Pk: pk}]
+	return entity, found
+}
 
-	entityv := reflect.ValueOf(entity)
-	if entityv.Kind() == reflect.Ptr {
-		entityv = entityv.Elem()
+// add registers entity, a pointer to a struct of type ti. If there is
+// already an entity with the same primary key, add returns that entity
+// and false. Entities without a primary key or with a composite primary
+// key are never registered.
+func (m identityMap) add(ti *typeInfo, entity reflect.Value) (reflect.Value, bool) {
+	pks := ti.GetPrimaryKeys()
+	if len(pks) != 1 {
+		// No or composite primary key
+		return entity, true
+	}
+	pkInfo := pks[0]
+	pk := indirectInterface(entity.Elem().FieldByName(pkInfo.FieldName))
+	if existing, found := m.lookup(ti.Type, pk); found {
+		return existing, false
+	}
+	if pk != nil && reflect.TypeOf(pk).Comparable() {
+		m[identityKey{Type: ti.Type, Pk: pk}] = entity
 	}
+	return entity, true
+}
 
-	pk, found := ti.GetPrimaryKey()
-	if !found {
-		return "", ErrNoPrimaryKey
+// indirectInterface returns the value of v, following a pointer.
+// It returns nil for a nil pointer.
+func indirectInterface(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
 	}
-	field := entityv.FieldByName(pk.FieldName)
-	pkval := field.Interface()
+	return v.Interface()
+}
 
-	return fmt.Sprintf("DELETE FROM %s WHERE %s=%s",
-		s.dialect.EscapeTableName(ti.TableName),
-		s.dialect.EscapeColumnName(pk.ColumnName),
-		Quote(s.dialect, pkval)), nil
+// childTableAlias is the alias of the associated table of a
+// self-referencing association. See assocQuery.
+const childTableAlias = "dapper_child"
+
+// assocQuery starts a query on tableName to load the associations of
+// entities in parentTableName. If both are the same table, i.e. the
+// association is self-referencing, the table is aliased, so that its
+// columns can be told apart from those of the parent, e.g. by a
+// RewriteSQL function that joins the parent.
+func (s *Session) assocQuery(parentTableName, tableName string) *Query {
+	q := s.Q(s.dialect.EscapeTableName(tableName))
+	if tableName == parentTableName {
+		q.Alias(childTableAlias)
+	}
+	return q
 }
 
-// ---- Load associations ----------------------------------------------------
+// loadByIds loads all records of tableName where columnName is in ids,
+// for the parents in parentTableName (see assocQuery). The results are
+// returned as a pointer to a slice of sliceType. If there are more ids
+// than the session's MaxInClauseSize, the ids are split into batches and
+// the results of all batches are merged.
+func (s *Session) loadByIds(db queryer, visited identityMap, parentTableName, tableName, columnName string, ids []interface{}, includes []string, sliceType reflect.Type) (reflect.Value, error) {
+	resultsv := reflect.New(sliceType)
+	if len(ids) == 0 {
+		// Nothing to load
+		return resultsv, nil
+	}
+	for _, batch := range chunk(ids, s.maxInClauseSize) {
+		q := s.assocQuery(parentTableName, tableName)
+		query := q.Where().In(q.Qualify(s.dialect.EscapeColumnName(columnName)), batch)
+
+		batchv := reflect.New(sliceType)
+		f := s.find(db, query.Sql(), nil).Include(includes...)
+		f.visited = visited
+		err := f.All(batchv.Interface())
+		if err != nil {
+			return resultsv, err
+		}
+		resultsv.Elem().Set(reflect.AppendSlice(resultsv.Elem(), batchv.Elem()))
+	}
+	return resultsv, nil
+}
 
-// split takes a slice and splits it on sep and returns both parts.
-// It makes sure that duplicates on both parts are ignored.
-// Example:
-//     []string{"Order", "Order.Items", "Order.Items.Images"}
-///    => []string{"Order"}, []string{"Items", "Items.Images"}
-func split(includes []string, sep string) ([]string, []string) {
-	current := make([]string, 0)
-	currentDups := make(map[string]bool)
-	remaining := make([]string, 0)
-	remainingDups := make(map[string]bool)
-	if len(includes) == 0 {
-		return current, remaining
+// loadTopByIds loads the first top.n records of tableName per value of
+// columnName in ids, ordered by top.orderBy, for the parents in
+// parentTableName (see assocQuery). The results are returned as a
+// pointer to a slice of sliceType, ordered per id.
+func (s *Session) loadTopByIds(db queryer, visited identityMap, parentTableName, tableName, columnName string, ids []interface{}, includes []string, sliceType reflect.Type, top topN) (reflect.Value, error) {
+	resultsv := reflect.New(sliceType)
+	if len(ids) == 0 {
+		// Nothing to load
+		return resultsv, nil
 	}
-	for _, include := range includes {
-		str := strings.SplitN(include, sep, 2)
-		if len(str) > 0 {
-			if _, found := currentDups[str[0]]; !found {
-				current = append(current, str[0])
-				currentDups[str[0]] = true
+	table, column := s.dialect.EscapeTableName(tableName), s.dialect.EscapeColumnName(columnName)
+
+	// Soft-deleted records must not take the place of the first n
+	softDelete, err := s.softDeleteColumn(sliceType)
+	if err != nil {
+		return resultsv, err
+	}
+
+	queries := make([]string, 0)
+	if supportsWindowFunctions(s.dialect) {
+		// One query per batch, numbering the records of each id
+		for _, batch := range chunk(ids, s.maxInClauseSize) {
+			where := s.Q(table).Project(
+				SafeSqlString("t.*"),
+				SafeSqlString(fmt.Sprintf("ROW_NUMBER() OVER (PARTITION BY t.%s ORDER BY %s) dapper_rn", column, top.orderBy)),
+			).Alias("t").Where().In("t."+column, batch)
+			if softDelete != "" {
+				where.IsNull("t." + softDelete)
 			}
+			queries = append(queries, fmt.Sprintf("SELECT * FROM (%s) x WHERE dapper_rn<=%d ORDER BY %s,dapper_rn", where.Sql(), top.n, column))
 		}
-		if len(str) > 1 {
-			if _, found := remainingDups[str[0]]; !found {
-				remaining = append(remaining, str[1])
-				remainingDups[str[1]] = true
+	} else {
+		// One query per id
+		for _, id := range ids {
+			q := s.assocQuery(parentTableName, tableName)
+			q.Where().Eq(q.Qualify(column), id)
+			if softDelete != "" {
+				q.Where().IsNull(q.Qualify(softDelete))
 			}
+			queries = append(queries, q.orderBy(top.orderBy).Take(top.n).Sql())
 		}
 	}
-	return current, remaining
+
+	for _, query := range queries {
+		batchv := reflect.New(sliceType)
+		f := s.find(db, query, nil).Include(includes...)
+		f.visited = visited
+		if err := f.All(batchv.Interface()); err != nil {
+			return resultsv, err
+		}
+		resultsv.Elem().Set(reflect.AppendSlice(resultsv.Elem(), batchv.Elem()))
+	}
+	return resultsv, nil
+}
+
+// softDeleteColumn returns the escaped soft delete column of the
+// elements of sliceType, or an empty string if they have none.
+func (s *Session) softDeleteColumn(sliceType reflect.Type) (string, error) {
+	elemType := sliceType.Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	ti, err := AddType(elemType)
+	if err != nil {
+		return "", err
+	}
+	if sd, found := ti.GetSoftDelete(); found {
+		return s.dialect.EscapeColumnName(sd.ColumnName), nil
+	}
+	return "", nil
+}
+
+// chunk splits values into slices of at most size elements.
+// If size <= 0, all values are returned in a single slice.
+func chunk(values []interface{}, size int) [][]interface{} {
+	if size <= 0 || len(values) <= size {
+		return [][]interface{}{values}
+	}
+	chunks := make([][]interface{}, 0, (len(values)+size-1)/size)
+	for len(values) > size {
+		chunks = append(chunks, values[:size])
+		values = values[size:]
+	}
+	return append(chunks, values)
 }
 
-func (s *Session) loadAssociations(gotype reflect.Type, resultInfo *typeInfo, resultValue reflect.Value, includes []string) error {
+func (s *Session) loadAssociations(db queryer, visited identityMap, gotype reflect.Type, resultInfo *typeInfo, resultValue reflect.Value, includes []string, tops map[string]topN) error {
 	if len(includes) == 0 {
 		return nil
 	}
@@ -1093,6 +4253,9 @@ func (s *Session) loadAssociations(gotype reflect.Type, resultInfo *typeInfo, re
 		if !found {
 			continue
 		}
+		if err := assoc.check(gotype); err != nil {
+			return err
+		}
 
 		// Retrieve table name and column name of the references table
 		assocTableName, err := assoc.GetTableName()
@@ -1107,11 +4270,6 @@ func (s *Session) loadAssociations(gotype reflect.Type, resultInfo *typeInfo, re
 		// Field where results are to be stored
 		targetField := resultValue.Elem().FieldByName(assoc.FieldName)
 
-		// Load oneToOne association
-		if targetField.Kind() != reflect.Ptr {
-			return errors.New("dapper: a field marked with oneToOne must be a pointer")
-		}
-
 		// oneToOne=<table>.<column>.<field>
 		fkField := resultValue.Elem().FieldByName(assoc.ForeignKeyField)
 		if !fkField.IsValid() {
@@ -1121,27 +4279,42 @@ func (s *Session) loadAssociations(gotype reflect.Type, resultInfo *typeInfo, re
 			// No need to load
 			continue
 		}
+		if existing, found := visited.lookup(assoc.TargetType, indirectInterface(fkField)); found {
+			// Wire up the already loaded entity
+			targetField.Set(existing)
+			continue
+		}
 		fk := fkField.Interface()
 		fkTableName := assocTableName
 		fkColName := assocColumnName
 
-		subQuery := s.Q(fkTableName).Where().Eq(fkColName, fk).Sql()
+		q := s.assocQuery(resultInfo.TableName, fkTableName)
+		subQuery := q.Where().Eq(q.Qualify(s.dialect.EscapeColumnName(fkColName)), fk).Sql()
 
 		result := reflect.New(targetField.Type().Elem())
 		targetField.Set(result)
-		err = s.Find(subQuery, nil).Include(assocNamesNextLevel...).Single(targetField.Interface())
+		f := s.find(db, subQuery, nil).Include(assocNamesNextLevel[assocName]...)
+		f.visited = visited
+		err = f.Single(targetField.Interface())
+		if err == sql.ErrNoRows {
+			// The referenced row is missing, e.g. it has been deleted
+			targetField.Set(reflect.Zero(targetField.Type()))
+			continue
+		}
 		if err != nil {
 			return err
 		}
 	}
 
 	// Load 1:n associations
-	// TODO(oe) slice into batches of limited size?!
 	for _, assocName := range assocNames {
 		assoc, found := resultInfo.OneToManyInfos[assocName]
 		if !found {
 			continue
 		}
+		if err := assoc.check(gotype); err != nil {
+			return err
+		}
 
 		// Retrieve table name and column name of the references table
 		assocTableName, err := assoc.GetTableName()
@@ -1159,10 +4332,25 @@ func (s *Session) loadAssociations(gotype reflect.Type, resultInfo *typeInfo, re
 		// Load oneToMany association
 		fkTableName := assocTableName
 		fkColName := assocColumnName
-		subQuery := s.Q(fkTableName).Where().Eq(fkColName, primaryKey).Sql()
+		q := s.assocQuery(resultInfo.TableName, fkTableName)
+		q.Where().Eq(q.Qualify(s.dialect.EscapeColumnName(fkColName)), primaryKey)
+		if top, found := tops[assocName]; found && top.n > 0 {
+			// Soft-deleted records must not take the place of the first n
+			softDelete, err := s.softDeleteColumn(targetField.Type())
+			if err != nil {
+				return err
+			}
+			if softDelete != "" {
+				q.Where().IsNull(q.Qualify(softDelete))
+			}
+			q.orderBy(top.orderBy).Take(top.n)
+		}
+		subQuery := q.Sql()
 
 		subResults := targetField.Addr().Interface()
-		err = s.Find(subQuery, nil).Include(assocNamesNextLevel...).All(subResults)
+		f := s.find(db, subQuery, nil).Include(assocNamesNextLevel[assocName]...)
+		f.visited = visited
+		err = f.All(subResults)
 		if err != nil {
 			return err
 		}
@@ -1177,8 +4365,9 @@ func (s *Session) loadAssociations(gotype reflect.Type, resultInfo *typeInfo, re
 // It can be used in the same sense as sql.Exec, however the statement
 // is logged if debugging is enabled.
 func (s *Session) Exec(query string, args ...interface{}) (sql.Result, error) {
-	if s.debug {
-		log.Printf("%s (%v)", query, args)
+	query, err := s.prepareSQL(query, args, s.debug)
+	if err != nil {
+		return nil, err
 	}
 	return s.db.Exec(query, args...)
 }
@@ -1187,19 +4376,50 @@ func (s *Session) Exec(query string, args ...interface{}) (sql.Result, error) {
 // It can be used in the same sense as sql.Exec, however the statement
 // is logged if debugging is enabled.
 func (s *Session) ExecTx(tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
-	if s.debug {
-		log.Printf("%s (%v)", query, args)
+	query, err := s.prepareSQL(query, args, s.debug)
+	if err != nil {
+		return nil, err
 	}
 	return tx.Exec(query, args...)
 }
 
+// ExecNamed executes an SQL statement, e.g. a bulk UPDATE, with the
+// parameters of param substituted like in Find, i.e. :Name is replaced
+// by the quoted value of the field Name of param. It returns the result
+// of the driver, e.g. to check RowsAffected. As SQL strings cannot be
+// scoped, it fails with ErrUnscopedSQL if the session is scoped.
+//
+// Example:
+// param := struct{ MinKarma float64 }{MinKarma: 50}
+// res, err := session.ExecNamed("update users set suspended=1 where karma > :MinKarma", param)
+func (s *Session) ExecNamed(query string, param interface{}) (sql.Result, error) {
+	return s.execNamed(nil, query, param)
+}
+
+// ExecNamedTx is like ExecNamed, but runs in a transaction.
+func (s *Session) ExecNamedTx(tx *sql.Tx, query string, param interface{}) (sql.Result, error) {
+	return s.execNamed(tx, query, param)
+}
+
+func (s *Session) execNamed(tx *sql.Tx, query string, param interface{}) (sql.Result, error) {
+	f := s.findSQL(nil, query, param)
+	if f.err != nil {
+		return nil, f.err
+	}
+	query, err := f.substituteParams()
+	if err != nil {
+		return nil, err
+	}
+	return s.exec(tx, query)
+}
+
 // ---- Transactions ------------------------------------------------------
 
 // Begin starts a new transaction and can be used as a placeholder to sql.Begin.
 // However, the statement is logged if debugging is enabled.
 func (s *Session) Begin() (*sql.Tx, error) {
 	if s.debug {
-		log.Println("BEGIN TRANSACTION")
+		s.logf("BEGIN TRANSACTION")
 	}
 	return s.db.Begin()
 }
@@ -1208,7 +4428,7 @@ func (s *Session) Begin() (*sql.Tx, error) {
 // However, the statement is logged if debugging is enabled.
 func (s *Session) Rollback(tx *sql.Tx) error {
 	if s.debug {
-		log.Println("ROLLBACK")
+		s.logf("ROLLBACK")
 	}
 	return tx.Rollback()
 }
@@ -1217,7 +4437,75 @@ func (s *Session) Rollback(tx *sql.Tx) error {
 // However, the statement is logged if debugging is enabled.
 func (s *Session) Commit(tx *sql.Tx) error {
 	if s.debug {
-		log.Println("COMMIT")
+		s.logf("COMMIT")
 	}
 	return tx.Commit()
 }
+
+// Transaction runs fn in a database transaction. If fn returns nil, the
+// transaction is committed. If fn returns an error or panics, the
+// transaction is rolled back; a panic is passed on after the rollback.
+//
+// Example:
+// err := session.Transaction(func(tx *dapper.Tx) error { return tx.Insert(&user) })
+func (s *Session) Transaction(fn func(tx *Tx) error) error {
+	sqltx, err := s.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			s.Rollback(sqltx)
+			panic(p)
+		}
+	}()
+	if err := fn(&Tx{s: s, tx: sqltx}); err != nil {
+		s.Rollback(sqltx)
+		return err
+	}
+	return s.Commit(sqltx)
+}
+
+// Tx is a database transaction started via Session.Transaction.
+type Tx struct {
+	s  *Session
+	tx *sql.Tx
+}
+
+// Tx returns the underlying *sql.Tx.
+func (t *Tx) Tx() *sql.Tx {
+	return t.tx
+}
+
+// Find opens up the query interface, running all queries
+// in the transaction. See Session.Find for details.
+func (t *Tx) Find(sql string, param interface{}) *finder {
+	return t.s.findSQL(t.tx, sql, param)
+}
+
+// Insert adds the entity to the database in the transaction.
+func (t *Tx) Insert(entity interface{}) error {
+	return t.s.insert(entity, t.tx)
+}
+
+// Update changes an already existing entity in the database
+// in the transaction.
+func (t *Tx) Update(entity interface{}) error {
+	return t.s.update(entity, nil, t.tx)
+}
+
+// Delete removes the entity from the database in the transaction.
+func (t *Tx) Delete(entity interface{}) error {
+	return t.s.delete(entity, false, t.tx)
+}
+
+// Exec executes an SQL statement and parameters in the transaction.
+func (t *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.s.ExecTx(t.tx, query, args...)
+}
+
+// ExecNamed executes an SQL statement with named parameters in the
+// transaction. See Session.ExecNamed for details.
+func (t *Tx) ExecNamed(query string, param interface{}) (sql.Result, error) {
+	return t.s.ExecNamedTx(t.tx, query, param)
+}
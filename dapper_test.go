@@ -1,10 +1,17 @@
 package dapper
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -181,7 +188,7 @@ func (ext OrderExtension) String() string {
 
 // -- Setup -----------------------------------------------------------------
 
-func setupWithSession(driver string, t *testing.T) (db *sql.DB, session *Session) {
+func setupWithSession(driver string, t testing.TB) (db *sql.DB, session *Session) {
 	db = setup(driver, t)
 	if db == nil {
 		return nil, nil
@@ -202,7 +209,7 @@ func setupWithSession(driver string, t *testing.T) (db *sql.DB, session *Session
 	return db, session
 }
 
-func setup(driver string, t *testing.T) (db *sql.DB) {
+func setup(driver string, t testing.TB) (db *sql.DB) {
 	var err error
 	switch driver {
 	case "mymysql":
@@ -234,7 +241,7 @@ func setup(driver string, t *testing.T) (db *sql.DB) {
 	return seed(driver, t, db)
 }
 
-func seed(driver string, t *testing.T, db *sql.DB) *sql.DB {
+func seed(driver string, t testing.TB, db *sql.DB) *sql.DB {
 	// Drop tables
 	suffix := ""
 	switch driver {
@@ -468,7 +475,7 @@ func TestSessionDefaults(t *testing.T) {
 	defer db.Close()
 	session := New(db)
 
-	// Will use MySQL dialect as default
+	// Will detect MySQL dialect from the driver
 	if session.dialect != MySQL {
 		t.Errorf("expected MySQL dialect as default, got: %v", session.dialect)
 	}
@@ -483,6 +490,11 @@ func TestSessionDefaults(t *testing.T) {
 	if session.debug {
 		t.Errorf("expected no debugging by default, got: %v", session.debug)
 	}
+
+	// Batch IN clauses by default
+	if session.maxInClauseSize != DefaultMaxInClauseSize {
+		t.Errorf("expected max IN clause size of %d, got: %d", DefaultMaxInClauseSize, session.maxInClauseSize)
+	}
 }
 
 func TestSessionDebuggingEnable(t *testing.T) {
@@ -590,6 +602,54 @@ func TestTypeCache(t *testing.T) {
 	}
 }
 
+// methodNamedUser has no table tag, but a TableName method.
+type methodNamedUser struct {
+	Id   int64  `dapper:"id,primarykey,autoincrement"`
+	Name string `dapper:"name"`
+}
+
+func (methodNamedUser) TableName() string { return "users" }
+
+// overriddenUser has both, and the TableName method wins.
+type overriddenUser struct {
+	Id   int64  `dapper:"id,primarykey,autoincrement,table=people"`
+	Name string `dapper:"name"`
+}
+
+func (*overriddenUser) TableName() string { return "users" }
+
+func TestTableNameMethod(t *testing.T) {
+	for _, typ := range []reflect.Type{reflect.TypeOf(methodNamedUser{}), reflect.TypeOf(overriddenUser{})} {
+		ti, err := AddType(typ)
+		if err != nil {
+			t.Fatalf("error adding type %v: %v", typ, err)
+		}
+		if ti.TableName != "users" {
+			t.Errorf("%v: expected table name %q, got %q", typ, "users", ti.TableName)
+		}
+	}
+
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var u methodNamedUser
+		if err := session.Get(1).Do(&u); err != nil {
+			t.Fatalf("driver %s: error on Get: %v", driver, err)
+		}
+		if u.Name != "Oliver" {
+			t.Errorf("driver %s: expected %v, got %v", driver, "Oliver", u.Name)
+		}
+		var o overriddenUser
+		if err := session.Get(2).Do(&o); err != nil {
+			t.Fatalf("driver %s: error on Get: %v", driver, err)
+		}
+		if o.Name != "Sandra" {
+			t.Errorf("driver %s: expected %v, got %v", driver, "Sandra", o.Name)
+		}
+	}
+}
+
 func TestTypeCacheOneToMany(t *testing.T) {
 	for _, driver := range drivers {
 		db := setup(driver, t)
@@ -886,6 +946,47 @@ func TestSingle(t *testing.T) {
 	}
 }
 
+func TestFirstAndLast(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var maxId int64
+		if err := session.Find("select max(id) from users", nil).Scalar(&maxId); err != nil {
+			t.Fatalf("error on Scalar: %v", err)
+		}
+
+		var first user
+		if err := session.Find("select * from users", nil).First(&first); err != nil {
+			t.Fatalf("error on First: %v", err)
+		}
+		if first.Id != 1 {
+			t.Errorf("expected user.Id == %d, got %d", 1, first.Id)
+		}
+		if first.Name != "Oliver" {
+			t.Errorf("expected user.Name == %s, got %s", "Oliver", first.Name)
+		}
+
+		var last user
+		if err := session.Find("select * from users", nil).Last(&last); err != nil {
+			t.Fatalf("error on Last: %v", err)
+		}
+		if last.Id != maxId {
+			t.Errorf("expected user.Id == %d, got %d", maxId, last.Id)
+		}
+
+		var none user
+		err := session.Find("select * from users where id=:Id", user{Id: -1}).First(&none)
+		if err != sql.ErrNoRows {
+			t.Errorf("expected %v, got %v", sql.ErrNoRows, err)
+		}
+		err = session.Find("select * from users where id=:Id", user{Id: -1}).Last(&none)
+		if err != sql.ErrNoRows {
+			t.Errorf("expected %v, got %v", sql.ErrNoRows, err)
+		}
+	}
+}
+
 func TestSingleWithParamPtr(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
@@ -1153,6 +1254,18 @@ func TestSingleWithIncludeChainsOnOneToMany(t *testing.T) {
 	}
 }
 
+func TestSplitIncludes(t *testing.T) {
+	current, remaining := split([]string{"Items", "Items.Order", "Items.Images.Item", "Extensions", "Items.Order"}, ".")
+	expected := []string{"Items", "Extensions"}
+	if !reflect.DeepEqual(current, expected) {
+		t.Errorf("expected %v, got %v", expected, current)
+	}
+	expectedRemaining := map[string][]string{"Items": {"Order", "Images.Item"}}
+	if !reflect.DeepEqual(remaining, expectedRemaining) {
+		t.Errorf("expected %v, got %v", expectedRemaining, remaining)
+	}
+}
+
 func TestSingleWillErrOnNonPtrResult(t *testing.T) {
 	db := setup("mysql", t)
 	defer db.Close()
@@ -1195,6 +1308,92 @@ func TestAll(t *testing.T) {
 	}
 }
 
+func BenchmarkAll(b *testing.B) {
+	for _, driver := range drivers {
+		b.Run(driver, func(b *testing.B) {
+			db, session := setupWithSession(driver, b)
+			defer db.Close()
+
+			tx, err := db.Begin()
+			if err != nil {
+				b.Fatalf("error starting transaction: %v", err)
+			}
+			for i := 0; i < 1000; i++ {
+				_, err := tx.Exec(fmt.Sprintf("INSERT INTO tweets (id,user_id,message,retweets) VALUES (%d, 1, 'Tweet %d', %d)", i+100, i, i))
+				if err != nil {
+					tx.Rollback()
+					b.Fatalf("error inserting tweet: %v", err)
+				}
+			}
+			if err := tx.Commit(); err != nil {
+				b.Fatalf("error committing transaction: %v", err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var tweets []tweet
+				if err := session.Find("select * from tweets", nil).All(&tweets); err != nil {
+					b.Fatalf("error on All: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkScanWideRows(b *testing.B) {
+	for _, driver := range drivers {
+		b.Run(driver, func(b *testing.B) {
+			db, session := setupWithSession(driver, b)
+			defer db.Close()
+
+			now := time.Now().Truncate(time.Second)
+			rows := make([]cruddy, 1000)
+			for i := range rows {
+				rows[i] = cruddy{
+					Int:         i,
+					Int32:       int32(i),
+					Int64:       int64(i),
+					Uint:        uint(i),
+					Uint32:      uint32(i),
+					Uint64:      uint64(i),
+					Float32:     float32(i),
+					Float64:     float64(i),
+					Decimal:     float64(i),
+					DateTime:    now,
+					DateTimePtr: &now,
+					Timestamp:   &now,
+					Bool:        i%2 == 0,
+					Char:        "A C",
+					Varchar:     fmt.Sprintf("Row %d", i),
+					Text:        "Very long text",
+				}
+			}
+			if _, err := session.InsertAll(rows); err != nil {
+				b.Fatalf("error on InsertAll: %v", err)
+			}
+
+			b.Run("All", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					var out []cruddy
+					if err := session.Find("select * from cruddy", nil).All(&out); err != nil {
+						b.Fatalf("error on All: %v", err)
+					}
+				}
+			})
+			b.Run("Each", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					err := session.Find("select * from cruddy", nil).Each(&cruddy{}, func(interface{}) error {
+						return nil
+					})
+					if err != nil {
+						b.Fatalf("error on Each: %v", err)
+					}
+				}
+			})
+		})
+	}
+}
+
 func TestAllWithParams(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
@@ -1403,6 +1602,74 @@ func TestAllWithOneToOneIncludes(t *testing.T) {
 	}
 }
 
+func TestAllWithIncludesInBatches(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		// 4 items reference 2 orders; 3 orders reference 4 items
+		session = session.MaxInClauseSize(1)
+
+		var items []*OrderItem
+		err := session.
+			Find("select * from order_items order by id", nil).
+			Include("Order").
+			All(&items)
+		if err != nil {
+			t.Fatalf("error on Query: %v", err)
+		}
+		if len(items) != 4 {
+			t.Fatalf("expected len(items) == %d, got %d", 4, len(items))
+		}
+		for _, item := range items {
+			if item.Order == nil {
+				t.Fatalf("expected item.Order to be != nil")
+			}
+			if item.OrderId != item.Order.Id {
+				t.Errorf("expected item.OrderId == item.Order.Id, got %d != %d", item.OrderId, item.Order.Id)
+			}
+		}
+
+		var orders []*Order
+		err = session.
+			Find("select * from orders order by id", nil).
+			Include("Items").
+			All(&orders)
+		if err != nil {
+			t.Fatalf("error on Query: %v", err)
+		}
+		if len(orders) != 3 {
+			t.Fatalf("expected len(orders) == %d, got %d", 3, len(orders))
+		}
+		expected := []int{2, 2, 0}
+		for i, order := range orders {
+			if len(order.Items) != expected[i] {
+				t.Errorf("expected len(order.Items) == %d, got %d", expected[i], len(order.Items))
+			}
+		}
+	}
+}
+
+func TestChunk(t *testing.T) {
+	ids := []interface{}{1, 2, 3, 4, 5}
+	tests := []struct {
+		Size     int
+		Expected [][]interface{}
+	}{
+		{0, [][]interface{}{{1, 2, 3, 4, 5}}},
+		{1, [][]interface{}{{1}, {2}, {3}, {4}, {5}}},
+		{2, [][]interface{}{{1, 2}, {3, 4}, {5}}},
+		{5, [][]interface{}{{1, 2, 3, 4, 5}}},
+		{10, [][]interface{}{{1, 2, 3, 4, 5}}},
+	}
+	for _, test := range tests {
+		got := chunk(ids, test.Size)
+		if !reflect.DeepEqual(got, test.Expected) {
+			t.Errorf("size %d: expected %v, got %v", test.Size, test.Expected, got)
+		}
+	}
+}
+
 func TestAllWithOneToOneIncludesWithNullableForeignKey(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
@@ -1594,6 +1861,69 @@ func TestScalarWithoutDataReturnsErrNoRows(t *testing.T) {
 	}
 }
 
+func TestScalarSliceWithInt64(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var ids []int64
+		err := session.Find("select id from users order by id", nil).ScalarSlice(&ids)
+		if err != nil {
+			t.Fatalf("error on ScalarSlice: %v", err)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint([]int64{1, 2}) {
+			t.Errorf("expected %v, got %v", []int64{1, 2}, ids)
+		}
+
+		err = session.Find("select id from users where id=42", nil).ScalarSlice(&ids)
+		if err != nil {
+			t.Fatalf("error on ScalarSlice: %v", err)
+		}
+		if ids == nil || len(ids) != 0 {
+			t.Errorf("expected empty slice, got %v", ids)
+		}
+	}
+}
+
+func TestScalarSliceWithString(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var names []string
+		err := session.Find("select name from users order by name desc", nil).ScalarSlice(&names)
+		if err != nil {
+			t.Fatalf("error on ScalarSlice: %v", err)
+		}
+		if fmt.Sprint(names) != fmt.Sprint([]string{"Sandra", "Oliver"}) {
+			t.Errorf("expected %v, got %v", []string{"Sandra", "Oliver"}, names)
+		}
+	}
+}
+
+func TestScalarSliceErrors(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var ids []int64
+		if err := session.Find("select id, name from users", nil).ScalarSlice(&ids); err == nil {
+			t.Errorf("expected error on multiple columns")
+		}
+		if err := session.Find("select id from users", nil).ScalarSlice(ids); err == nil {
+			t.Errorf("expected error on non-pointer result")
+		}
+		var users []user
+		if err := session.Find("select id from users", nil).ScalarSlice(&users); err == nil {
+			t.Errorf("expected error on slice of structs")
+		}
+		var karmas []int64
+		if err := session.Find("select name from users", nil).ScalarSlice(&karmas); err == nil {
+			t.Errorf("expected error on mismatching element type")
+		}
+	}
+}
+
 // ---- Count ---------------------------------------------------------------
 
 func TestCount(t *testing.T) {
@@ -1611,6 +1941,40 @@ func TestCount(t *testing.T) {
 	}
 }
 
+func TestCountAs(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var n int
+		if err := session.CountAs("select count(*) from users", nil, &n); err != nil {
+			t.Fatalf("driver %s: error on CountAs: %v", driver, err)
+		}
+		if n != 2 {
+			t.Errorf("driver %s: expected count of users == %d, got %d", driver, 2, n)
+		}
+
+		var u uint64
+		qbe := struct{ Id int64 }{1}
+		if err := session.CountAs("select count(*) from users where id=:Id", qbe, &u); err != nil {
+			t.Fatalf("driver %s: error on CountAs: %v", driver, err)
+		}
+		if u != 1 {
+			t.Errorf("driver %s: expected count of users == %d, got %d", driver, 1, u)
+		}
+
+		var i8 int8
+		if err := session.CountAs("select 1000", nil, &i8); err == nil {
+			t.Errorf("driver %s: expected overflow error, got %d", driver, i8)
+		}
+
+		var s string
+		if err := session.CountAs("select count(*) from users", nil, &s); err == nil {
+			t.Errorf("driver %s: expected error for a non-integer dest", driver)
+		}
+	}
+}
+
 func TestCountWithQueryParams(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
@@ -1640,6 +2004,71 @@ func TestCountWithWrongType(t *testing.T) {
 	}
 }
 
+// ---- Exists --------------------------------------------------------------
+
+func TestExistsQuery(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		found, err := session.ExistsQuery(session.Q("users").Where().Eq("name", "Oliver").Query())
+		if err != nil {
+			t.Fatalf("driver %s: error on ExistsQuery: %v", driver, err)
+		}
+		if !found {
+			t.Errorf("driver %s: expected user to exist", driver)
+		}
+
+		found, err = session.ExistsQuery(session.Q("users").Where().Eq("name", "Nobody").Query())
+		if err != nil {
+			t.Fatalf("driver %s: error on ExistsQuery: %v", driver, err)
+		}
+		if found {
+			t.Errorf("driver %s: expected user to not exist", driver)
+		}
+	}
+}
+
+// ---- Seek ----------------------------------------------------------------
+
+func TestSeek(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var last interface{}
+		names := make([]string, 0)
+		for pages := 0; pages < 10; pages++ {
+			var users []user
+			next, err := session.Seek(session.Q("users"), "id", last, 1, &users)
+			if err != nil {
+				t.Fatalf("driver %s: error on Seek: %v", driver, err)
+			}
+			for _, u := range users {
+				names = append(names, u.Name)
+			}
+			if next == nil {
+				break
+			}
+			if len(users) != 1 {
+				t.Fatalf("driver %s: expected %d user, got %d", driver, 1, len(users))
+			}
+			if id, ok := next.(int64); !ok || id != users[0].Id {
+				t.Errorf("driver %s: expected cursor %d, got %v", driver, users[0].Id, next)
+			}
+			last = next
+		}
+		if len(names) != 2 || names[0] != "Oliver" || names[1] != "Sandra" {
+			t.Errorf("driver %s: expected users %v, got %v", driver, []string{"Oliver", "Sandra"}, names)
+		}
+
+		var users []user
+		if _, err := session.Seek(session.Q("users"), "no_such_column", nil, 1, &users); err == nil {
+			t.Errorf("driver %s: expected error on unknown column", driver)
+		}
+	}
+}
+
 // ---- Get -----------------------------------------------------------------
 
 func TestGet(t *testing.T) {
@@ -1726,123 +2155,172 @@ func TestGetWithIncludeOfOneToOne(t *testing.T) {
 	}
 }
 
-func TestGetWillErrOnNonPtrResult(t *testing.T) {
-	db := setup("mysql", t)
-	defer db.Close()
-	session := New(db)
-
-	var result user
-	err := session.Get(1).Do(result)
-	if err == nil {
-		t.Fatalf("expected error when using non-ptr as target, got: %v", err)
-	}
-}
-
-// ---- Insert --------------------------------------------------------------
-
-func TestInsert(t *testing.T) {
+func TestGetWithNestedIncludes(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		var oldCount int64
-		row := db.QueryRow("select count(*) from users")
-		row.Scan(&oldCount)
-
-		k := float64(42.3)
-		u := &user{
-			Name:      "George",
-			Karma:     &k,
-			Suspended: false,
-		}
-
-		err := session.Insert(u)
+		var out Order
+		err := session.Get(1).Include("Items.Order", "Extensions").Do(&out)
 		if err != nil {
-			t.Fatalf("%s: error on Insert: %v", driver, err)
+			t.Fatalf("error on Get: %v", err)
 		}
-		if u.Id <= 0 {
-			t.Errorf("%s: expected Id to be > 0, got %d", driver, u.Id)
+		if len(out.Items) != 2 {
+			t.Fatalf("expected order to load 2 items, got %d items", len(out.Items))
 		}
-
-		var newCount int64
-		row = db.QueryRow("select count(*) from users")
-		row.Scan(&newCount)
-
-		if newCount != oldCount+1 {
-			t.Errorf("%s: expected users count to be %d, got %d", driver, oldCount+1, newCount)
+		for _, item := range out.Items {
+			if item.Order == nil {
+				t.Fatalf("expected item.Order != nil")
+			}
+			if item.Order.Id != out.Id {
+				t.Errorf("expected item.Order.Id == %d, got %d", out.Id, item.Order.Id)
+			}
+		}
+		if len(out.Extensions) != 1 {
+			t.Fatalf("expected order to load 1 extension, got %d extensions", len(out.Extensions))
+		}
+		if out.Extensions[0].Order != nil {
+			t.Errorf("expected ext.Order to not be loaded, got %v", out.Extensions[0].Order)
 		}
 	}
 }
 
-func TestInsertWithoutTableNameTagFails(t *testing.T) {
+func TestGetWithCyclicIncludes(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		k := float64(42.3)
-		u := &userWithoutTableNameTag{
-			Name:      "George",
-			Karma:     &k,
-			Suspended: false,
-		}
-
-		err := session.Insert(u)
-		if err != ErrNoTableName {
-			t.Fatalf("expected dapper.ErrNoTableName, got: %v", err)
+		var out Order
+		err := session.Get(1).Include("Items.Order.Items").Do(&out)
+		if err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if len(out.Items) != 2 {
+			t.Fatalf("expected order to load 2 items, got %d items", len(out.Items))
+		}
+		for _, item := range out.Items {
+			if item.Order != &out {
+				t.Fatalf("expected item.Order to reference the loaded order, got %v", item.Order)
+			}
+			if len(item.Order.Items) != 2 || item.Order.Items[0] != out.Items[0] {
+				t.Errorf("expected item.Order.Items to reference the loaded items, got %v", item.Order.Items)
+			}
 		}
 	}
 }
 
-func TestInsertTx(t *testing.T) {
+func TestAllWithCyclicIncludes(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		var oldCount int64
-		row := db.QueryRow("select count(*) from users")
-		row.Scan(&oldCount)
-
-		k := float64(42.3)
-		u := &user{
-			Name:      "George",
-			Karma:     &k,
-			Suspended: false,
-		}
-
-		// Begin transaction
-		tx, err := db.Begin()
+		var orders []*Order
+		err := session.
+			Find("select * from orders order by id", nil).
+			Include("Items.Order.Items").
+			All(&orders)
 		if err != nil {
-			t.Fatalf("error on db.Begin(): %v", err)
+			t.Fatalf("error on Query: %v", err)
 		}
-
-		// Insert
-		err = session.InsertTx(tx, u)
-		if err != nil {
-			tx.Rollback()
-			t.Fatalf("error on InsertTx: %v", err)
+		if len(orders) != 3 {
+			t.Fatalf("expected len(orders) == %d, got %d", 3, len(orders))
 		}
-		if u.Id <= 0 {
-			tx.Rollback()
-			t.Errorf("expected Id to be > 0, got %d", u.Id)
+		for _, order := range orders {
+			for _, item := range order.Items {
+				if item.Order != order {
+					t.Fatalf("expected item.Order to reference the loaded order, got %v", item.Order)
+				}
+				if len(item.Order.Items) != len(order.Items) || item.Order.Items[0] != order.Items[0] {
+					t.Errorf("expected item.Order.Items to reference the loaded items, got %v", item.Order.Items)
+				}
+			}
 		}
+	}
+}
 
-		// Commit transaction
-		err = tx.Commit()
+func TestAllWithDuplicatePrimaryKeys(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		// Oliver has two tweets, so the join returns him twice
+		var users []*user
+		err := session.
+			Find("select u.* from users u join tweets t on u.id=t.user_id where u.id=1 order by t.id", nil).
+			All(&users)
 		if err != nil {
-			t.Fatalf("error on Commit: %v", err)
+			t.Fatalf("error on All: %v", err)
 		}
+		if len(users) != 2 {
+			t.Fatalf("expected len(users) == %d, got %d", 2, len(users))
+		}
+		if users[0] == users[1] {
+			t.Errorf("expected every row to be scanned into its own entity")
+		}
+		for _, u := range users {
+			if u.Id != 1 || u.Name != "Oliver" {
+				t.Errorf("expected user 1 named Oliver, got %v", u)
+			}
+		}
+	}
+}
 
-		var newCount int64
-		row = db.QueryRow("select count(*) from users")
-		row.Scan(&newCount)
+func TestGetWillErrOnNonPtrResult(t *testing.T) {
+	db := setup("mysql", t)
+	defer db.Close()
+	session := New(db)
 
-		if newCount != oldCount+1 {
-			t.Errorf("expected users count to be %d, got %d", oldCount+1, newCount)
+	var result user
+	err := session.Get(1).Do(result)
+	if err == nil {
+		t.Fatalf("expected error when using non-ptr as target, got: %v", err)
+	}
+}
+
+func TestGetWithMismatchingPrimaryKeyType(t *testing.T) {
+	// Fails before hitting the database
+	session := New(nil).Dialect(Sqlite3)
+
+	var u user
+	err := session.Get("1").Do(&u)
+	if err == nil {
+		t.Fatalf("expected error on string primary key value")
+	}
+	if !strings.Contains(err.Error(), "does not match primary key Id of type int64") {
+		t.Errorf("expected descriptive error, got %v", err)
+	}
+	if err := session.Get(1.5).Do(&u); err == nil {
+		t.Errorf("expected error on float primary key value")
+	}
+	if err := session.Get(nil).Do(&u); err == nil {
+		t.Errorf("expected error on nil primary key value")
+	}
+	var role userRole
+	if err := session.Get(int64(1), "admin").Do(&role); err == nil {
+		t.Errorf("expected error on mismatching composite primary key value")
+	}
+
+	// Integers of other sizes and pointers are fine
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		id := uint8(1)
+		for _, pk := range []interface{}{int32(1), &id} {
+			var u user
+			if err := session.Get(pk).Do(&u); err != nil {
+				t.Fatalf("driver %s: error on Get(%T): %v", driver, pk, err)
+			}
+			if u.Id != 1 {
+				t.Errorf("driver %s: expected user %d, got %d", driver, 1, u.Id)
+			}
 		}
 	}
 }
 
-func TestInsertTxWithRollback(t *testing.T) {
+// ---- Insert --------------------------------------------------------------
+
+func TestInsert(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
@@ -1858,417 +2336,4728 @@ func TestInsertTxWithRollback(t *testing.T) {
 			Suspended: false,
 		}
 
-		// Begin transaction
-		tx, err := db.Begin()
-		if err != nil {
-			t.Fatalf("error on db.Begin(): %v", err)
-		}
-
-		// Insert
-		err = session.InsertTx(tx, u)
+		err := session.Insert(u)
 		if err != nil {
-			tx.Rollback()
-			t.Fatalf("error on InsertTx: %v", err)
+			t.Fatalf("%s: error on Insert: %v", driver, err)
 		}
 		if u.Id <= 0 {
-			tx.Rollback()
-			t.Errorf("expected Id to be > 0, got %d", u.Id)
-		}
-
-		// Rollback transaction
-		err = tx.Rollback()
-		if err != nil {
-			t.Fatalf("error on Rollback: %v", err)
+			t.Errorf("%s: expected Id to be > 0, got %d", driver, u.Id)
 		}
 
 		var newCount int64
 		row = db.QueryRow("select count(*) from users")
 		row.Scan(&newCount)
 
-		if newCount != oldCount {
-			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		if newCount != oldCount+1 {
+			t.Errorf("%s: expected users count to be %d, got %d", driver, oldCount+1, newCount)
 		}
 	}
 }
 
-// ---- Update --------------------------------------------------------------
+func BenchmarkInsert(b *testing.B) {
+	for _, driver := range drivers {
+		b.Run(driver, func(b *testing.B) {
+			db, session := setupWithSession(driver, b)
+			defer db.Close()
+
+			insert := func(b *testing.B, session *Session) {
+				for i := 0; i < b.N; i++ {
+					k := float64(i)
+					if err := session.Insert(&user{Name: "George", Karma: &k}); err != nil {
+						b.Fatalf("error on Insert: %v", err)
+					}
+				}
+			}
+			b.Run("Literal", func(b *testing.B) {
+				insert(b, session)
+			})
+			b.Run("CachedStatements", func(b *testing.B) {
+				cached := New(db).Dialect(session.GetDialect()).CacheStatements(10)
+				defer cached.Close()
+				insert(b, cached)
+			})
+		})
+	}
+}
+
+type uuidThing struct {
+	Id   string `dapper:"id,primarykey,table=uuid_things"`
+	Name string `dapper:"name"`
+}
+
+func TestInsertWithClientAssignedPrimaryKey(t *testing.T) {
+	// No RETURNING for the generated id, as there is none
+	ti, err := AddType(reflect.TypeOf(uuidThing{}))
+	if err != nil {
+		t.Fatalf("error adding type uuidThing: %v", err)
+	}
+	got, err := New(nil).Dialect(PostgreSQL).generateInsertSql(ti, &uuidThing{Id: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Name: "Thing"})
+	if err != nil {
+		t.Fatalf("error on generateInsertSql: %v", err)
+	}
+	expected := `INSERT INTO "uuid_things" ("id", "name") VALUES ('6ba7b810-9dad-11d1-80b4-00c04fd430c8', 'Thing')`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
 
-func TestUpdate(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		// Count users
-		var oldCount int64
-		row := db.QueryRow("select count(*) from users")
-		row.Scan(&oldCount)
-
-		// Retrieve user
-		var u user
-		err := session.Find("select * from users where id=1", nil).Single(&u)
+		db.Exec("DROP TABLE IF EXISTS uuid_things")
+		_, err := db.Exec("CREATE TABLE uuid_things (id varchar(36) not null primary key, name varchar(100))")
 		if err != nil {
-			t.Fatalf("error on find single: %v", err)
+			t.Fatalf("error creating table uuid_things: %v", err)
 		}
+		defer db.Exec("DROP TABLE uuid_things")
 
-		// Change user
-		u.Name = "Olli"
-
-		// Update user
-		err = session.Update(u)
-		if err != nil {
-			t.Fatalf("error on Update: %v", err)
+		in := &uuidThing{Id: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Name: "Thing"}
+		if err := session.Insert(in); err != nil {
+			t.Fatalf("driver %s: error on Insert: %v", driver, err)
 		}
-
-		// Reload user
-		var u2 user
-		session.Find("select * from users where id=1", nil).Single(&u2)
-		if u2.Name != u.Name {
-			t.Errorf("expected user name to be %s, got %s", u.Name, u2.Name)
+		if in.Id != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" {
+			t.Errorf("driver %s: expected key to be kept, got %q", driver, in.Id)
 		}
 
-		// Check count again
-		var newCount int64
-		row = db.QueryRow("select count(*) from users")
-		row.Scan(&newCount)
+		var out uuidThing
+		if err := session.Get(in.Id).Do(&out); err != nil {
+			t.Fatalf("driver %s: error on Get: %v", driver, err)
+		}
+		if out != *in {
+			t.Errorf("driver %s: expected %v, got %v", driver, *in, out)
+		}
 
-		if newCount != oldCount {
-			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		// The key is unique
+		if err := session.Insert(&uuidThing{Id: in.Id, Name: "Other"}); err == nil {
+			t.Errorf("driver %s: expected error on duplicate key", driver)
 		}
 	}
 }
 
-func TestUpdateWithPtrType(t *testing.T) {
+func TestInsertReturnsIdOnPostgreSQL(t *testing.T) {
 	for _, driver := range drivers {
+		if driver != "postgres" {
+			continue
+		}
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		// Count users
-		var oldCount int64
-		row := db.QueryRow("select count(*) from users")
-		row.Scan(&oldCount)
-
-		// Retrieve user
-		var u user
-		err := session.Find("select * from users where id=1", nil).Single(&u)
+		u := &user{Name: "George"}
+		err := session.Insert(u)
 		if err != nil {
-			t.Fatalf("error on find single: %v", err)
+			t.Fatalf("error on Insert: %v", err)
 		}
+		if u.Id <= 0 {
+			t.Errorf("expected Id to be > 0, got %d", u.Id)
+		}
+	}
+}
 
-		// Change user
-		u.Name = "Olli"
+func TestGenerateInsertSqlWithReturning(t *testing.T) {
+	session := New(nil).Dialect(PostgreSQL)
 
-		// Update user
-		err = session.Update(&u)
-		if err != nil {
-			t.Fatalf("error on Update: %v", err)
-		}
+	ti, err := AddType(reflect.TypeOf(user{}))
+	if err != nil {
+		t.Fatalf("error adding type user: %v", err)
+	}
+	got, err := session.generateInsertSql(ti, &user{Name: "George"})
+	if err != nil {
+		t.Fatalf("error on generateInsertSql: %v", err)
+	}
+	expected := `INSERT INTO "users" ("name", "karma", "suspended") VALUES ('George', NULL, 0) RETURNING "id"`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
 
-		// Reload user
-		var u2 user
-		session.Find("select * from users where id=1", nil).Single(&u2)
-		if u2.Name != u.Name {
-			t.Errorf("expected user name to be %s, got %s", u.Name, u2.Name)
-		}
+	// No autoincrement column, so nothing to return
+	type tag struct {
+		Name string `dapper:"name,primarykey,table=tags"`
+	}
+	ti, err = AddType(reflect.TypeOf(tag{}))
+	if err != nil {
+		t.Fatalf("error adding type tag: %v", err)
+	}
+	got, err = session.generateInsertSql(ti, &tag{Name: "go"})
+	if err != nil {
+		t.Fatalf("error on generateInsertSql: %v", err)
+	}
+	expected = `INSERT INTO "tags" ("name") VALUES ('go')`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
 
-		// Check count again
-		var newCount int64
-		row = db.QueryRow("select count(*) from users")
-		row.Scan(&newCount)
+type defaultedUser struct {
+	Id        int64  `dapper:"id,primarykey,autoincrement,table=defaulted_users"`
+	Name      string `dapper:"name"`
+	Status    string `dapper:"status,default"`
+	Suspended bool   `dapper:"suspended,default"`
+}
 
-		if newCount != oldCount {
-			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
-		}
+func TestGenerateInsertSqlReturningAll(t *testing.T) {
+	session := New(nil).Dialect(PostgreSQL)
+
+	ti, err := AddType(reflect.TypeOf(defaultedUser{}))
+	if err != nil {
+		t.Fatalf("error adding type defaultedUser: %v", err)
+	}
+	got, err := session.generateInsertValuesSql(ti, []reflect.Value{reflect.ValueOf(defaultedUser{Name: "George"})}, true)
+	if err != nil {
+		t.Fatalf("error on generateInsertValuesSql: %v", err)
+	}
+	expected := `INSERT INTO "defaulted_users" ("name") VALUES ('George') RETURNING *`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// Non-zero values of default columns are written
+	got, err = session.generateInsertSql(ti, &defaultedUser{Name: "George", Status: "new"})
+	if err != nil {
+		t.Fatalf("error on generateInsertSql: %v", err)
+	}
+	expected = `INSERT INTO "defaulted_users" ("name", "status") VALUES ('George', 'new') RETURNING "id"`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
 	}
 }
 
-func TestUpdateWithoutPrimaryKeyTagFails(t *testing.T) {
+type stampedUser struct {
+	Id      int64         `dapper:"id,primarykey,autoincrement,table=stamped_users"`
+	Name    string        `dapper:"name"`
+	Created SafeSqlString `dapper:"created"`
+}
+
+func TestGenerateSqlWithSafeSqlString(t *testing.T) {
+	session := New(nil).Dialect(PostgreSQL)
+
+	ti, err := AddType(reflect.TypeOf(stampedUser{}))
+	if err != nil {
+		t.Fatalf("error adding type stampedUser: %v", err)
+	}
+
+	got, err := session.generateInsertSql(ti, &stampedUser{Name: "George", Created: "NOW()"})
+	if err != nil {
+		t.Fatalf("error on generateInsertSql: %v", err)
+	}
+	expected := `INSERT INTO "stamped_users" ("name", "created") VALUES ('George', NOW()) RETURNING "id"`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	got, err = session.generateUpdateSql(ti, &stampedUser{Id: 1, Name: "George"}, nil)
+	if err != nil {
+		t.Fatalf("error on generateUpdateSql: %v", err)
+	}
+	expected = `UPDATE "stamped_users" SET "name"='George', "created"=NULL WHERE "id"=1`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestInsertWithSafeSqlString(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		// Retrieve user
-		var u userWithoutPrimaryKeyTag
-		err := session.Find("select * from users where id=1", nil).Single(&u)
+		var pkCol, dateTimeType string
+		switch driver {
+		case "sqlite3":
+			pkCol = "integer not null primary key AUTOINCREMENT"
+			dateTimeType = "datetime"
+		case "mysql", "mymysql":
+			pkCol = "int(11) not null primary key AUTO_INCREMENT"
+			dateTimeType = "datetime"
+		case "postgres":
+			pkCol = "serial not null primary key"
+			dateTimeType = "timestamp"
+		}
+		db.Exec("DROP TABLE IF EXISTS stamped_users")
+		_, err := db.Exec("CREATE TABLE stamped_users (id " + pkCol + ", name varchar(100), created " + dateTimeType + " null)")
+		if err != nil {
+			t.Fatalf("error creating table stamped_users: %v", err)
+		}
+		defer db.Exec("DROP TABLE stamped_users")
+
+		u := &stampedUser{Name: "George", Created: "CURRENT_TIMESTAMP"}
+		if err := session.Insert(u); err != nil {
+			t.Fatalf("driver %s: error on Insert: %v", driver, err)
+		}
+
+		var set bool
+		err = session.Find("select created is not null from stamped_users where id=:Id", u).Scalar(&set)
+		if err != nil {
+			t.Fatalf("driver %s: error on Scalar: %v", driver, err)
+		}
+		if !set {
+			t.Errorf("driver %s: expected created to be set by the database", driver)
+		}
+	}
+}
+
+type readOnlyFieldUser struct {
+	Id        int64  `dapper:"id,primarykey,autoincrement,table=users"`
+	Name      string `dapper:"name"`
+	NameUpper string `dapper:"name_upper,readonly"`
+}
+
+func TestGenerateSqlOmitsReadOnlyFields(t *testing.T) {
+	session := New(nil).Dialect(PostgreSQL)
+
+	ti, err := AddType(reflect.TypeOf(readOnlyFieldUser{}))
+	if err != nil {
+		t.Fatalf("error adding type readOnlyFieldUser: %v", err)
+	}
+	if ti.ReadOnly {
+		t.Errorf("expected type not to be read-only")
+	}
+
+	got, err := session.generateInsertSql(ti, &readOnlyFieldUser{Name: "George", NameUpper: "GEORGE"})
+	if err != nil {
+		t.Fatalf("error on generateInsertSql: %v", err)
+	}
+	expected := `INSERT INTO "users" ("name") VALUES ('George') RETURNING "id"`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	got, err = session.generateUpdateSql(ti, &readOnlyFieldUser{Id: 1, Name: "George", NameUpper: "GEORGE"}, nil)
+	if err != nil {
+		t.Fatalf("error on generateUpdateSql: %v", err)
+	}
+	expected = `UPDATE "users" SET "name"='George' WHERE "id"=1`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if _, err := ti.resolveColumnNames([]string{"NameUpper"}); err == nil {
+		t.Errorf("expected error when updating a read-only column")
+	}
+
+	// Next to the table name, readonly applies to the whole type
+	ti, err = AddType(reflect.TypeOf(readOnlyTableUser{}))
+	if err != nil {
+		t.Fatalf("error adding type readOnlyTableUser: %v", err)
+	}
+	if !ti.ReadOnly {
+		t.Errorf("expected type to be read-only")
+	}
+	if fi := ti.FieldInfos["NameUpper"]; fi.IsReadOnly {
+		t.Errorf("expected field NameUpper not to be read-only")
+	}
+
+	// view is an alias of readonly next to the table name
+	ti, err = AddType(reflect.TypeOf(viewUser{}))
+	if err != nil {
+		t.Fatalf("error adding type viewUser: %v", err)
+	}
+	if !ti.ReadOnly {
+		t.Errorf("expected type to be read-only")
+	}
+}
+
+type viewUser struct {
+	Id   int64  `dapper:"id,primarykey,table=users,view"`
+	Name string `dapper:"name"`
+}
+
+type readOnlyTableUser struct {
+	NameUpper string `dapper:"name_upper,readonly,table=users"`
+	Id        int64  `dapper:"id,primarykey,autoincrement"`
+	Name      string `dapper:"name"`
+}
+
+func TestGenerateInsertSqlWithReturningInto(t *testing.T) {
+	session := New(nil).Dialect(Oracle)
+
+	ti, err := AddType(reflect.TypeOf(user{}))
+	if err != nil {
+		t.Fatalf("error adding type user: %v", err)
+	}
+	got, err := session.generateInsertSql(ti, &user{Name: "George"})
+	if err != nil {
+		t.Fatalf("error on generateInsertSql: %v", err)
+	}
+	expected := `INSERT INTO "users" ("name", "karma", "suspended") VALUES ('George', NULL, 0) RETURNING "id" INTO :1`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// With bound values, the output parameter follows them
+	prepared := New(nil).Dialect(Oracle).CacheStatements(10)
+	defer prepared.Close()
+	got, args, err := prepared.withArgs(func(b *Session) (string, error) {
+		return b.generateInsertSql(ti, &user{Name: "George"})
+	})
+	if err != nil {
+		t.Fatalf("error on generateInsertSql: %v", err)
+	}
+	expected = `INSERT INTO "users" ("name", "karma", "suspended") VALUES (:1, :2, :3) RETURNING "id" INTO :4`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if len(args) != 3 {
+		t.Errorf("expected %d bound values, got %d", 3, len(args))
+	}
+
+	// Only a single id can be returned into an output parameter
+	_, err = session.generateInsertAllSql(ti, []reflect.Value{
+		reflect.ValueOf(user{Name: "George"}),
+		reflect.ValueOf(user{Name: "Paul"}),
+	})
+	if err == nil {
+		t.Errorf("expected error for multiple rows")
+	}
+}
+
+func TestInsertAndUpdateWithNullZero(t *testing.T) {
+	type event struct {
+		Id      int64     `dapper:"id,primarykey,autoincrement,table=events"`
+		Created time.Time `dapper:"created"`
+		Closed  time.Time `dapper:"closed,nullzero"`
+	}
+
+	session := New(nil)
+	ti, err := AddType(reflect.TypeOf(event{}))
+	if err != nil {
+		t.Fatalf("error adding type event: %v", err)
+	}
+	if fi := ti.FieldInfos["Closed"]; !fi.IsNullZero {
+		t.Errorf("expected field Closed to be nullzero")
+	}
+
+	e := &event{Id: 1}
+	got, err := session.generateInsertSql(ti, e)
+	if err != nil {
+		t.Fatalf("error on generateInsertSql: %v", err)
+	}
+	expected := "INSERT INTO `events` (`created`, `closed`) VALUES ('0001-01-01 00:00:00', NULL)"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	e.Closed, _ = time.Parse("2006-01-02 15:04:05", "2013-01-24 18:14:15")
+	got, err = session.generateUpdateSql(ti, e, nil)
+	if err != nil {
+		t.Fatalf("error on generateUpdateSql: %v", err)
+	}
+	expected = "UPDATE `events` SET `created`='0001-01-01 00:00:00', `closed`='2013-01-24 18:14:15' WHERE `id`=1"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestInsertWithoutTableNameTagFails(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		k := float64(42.3)
+		u := &userWithoutTableNameTag{
+			Name:      "George",
+			Karma:     &k,
+			Suspended: false,
+		}
+
+		err := session.Insert(u)
+		if err != ErrNoTableName {
+			t.Fatalf("expected dapper.ErrNoTableName, got: %v", err)
+		}
+	}
+}
+
+func TestInsertTx(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		k := float64(42.3)
+		u := &user{
+			Name:      "George",
+			Karma:     &k,
+			Suspended: false,
+		}
+
+		// Begin transaction
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("error on db.Begin(): %v", err)
+		}
+
+		// Insert
+		err = session.InsertTx(tx, u)
+		if err != nil {
+			tx.Rollback()
+			t.Fatalf("error on InsertTx: %v", err)
+		}
+		if u.Id <= 0 {
+			tx.Rollback()
+			t.Errorf("expected Id to be > 0, got %d", u.Id)
+		}
+
+		// Commit transaction
+		err = tx.Commit()
+		if err != nil {
+			t.Fatalf("error on Commit: %v", err)
+		}
+
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount+1 {
+			t.Errorf("expected users count to be %d, got %d", oldCount+1, newCount)
+		}
+	}
+}
+
+func TestInsertTxWithRollback(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		k := float64(42.3)
+		u := &user{
+			Name:      "George",
+			Karma:     &k,
+			Suspended: false,
+		}
+
+		// Begin transaction
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("error on db.Begin(): %v", err)
+		}
+
+		// Insert
+		err = session.InsertTx(tx, u)
+		if err != nil {
+			tx.Rollback()
+			t.Fatalf("error on InsertTx: %v", err)
+		}
+		if u.Id <= 0 {
+			tx.Rollback()
+			t.Errorf("expected Id to be > 0, got %d", u.Id)
+		}
+
+		// Rollback transaction
+		err = tx.Rollback()
+		if err != nil {
+			t.Fatalf("error on Rollback: %v", err)
+		}
+
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount {
+			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		}
+	}
+}
+
+func TestFindTxSeesUncommittedRows(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("error on db.Begin(): %v", err)
+		}
+		defer tx.Rollback()
+
+		u := &user{Name: "George"}
+		err = session.InsertTx(tx, u)
+		if err != nil {
+			t.Fatalf("error on InsertTx: %v", err)
+		}
+
+		var reload user
+		err = session.FindTx(tx, "select * from users where id=:Id", u).Single(&reload)
+		if err != nil {
+			t.Fatalf("error on FindTx: %v", err)
+		}
+		if reload.Id != u.Id {
+			t.Errorf("expected user.Id == %d, got %d", u.Id, reload.Id)
+		}
+		if reload.Name != "George" {
+			t.Errorf("expected user.Name == %s, got %s", "George", reload.Name)
+		}
+
+		var count int64
+		err = session.FindTx(tx, "select count(*) from users where id=:Id", u).Scalar(&count)
+		if err != nil {
+			t.Fatalf("error on FindTx: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("expected count == %d, got %d", 1, count)
+		}
+	}
+}
+
+// ---- InsertAll -----------------------------------------------------------
+
+func TestInsertAll(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		users := []*user{
+			{Name: "George"},
+			{Name: "Paul"},
+			{Name: "John"},
+		}
+		count, err := session.InsertAll(users)
+		if err != nil {
+			t.Fatalf("error on InsertAll: %v", err)
+		}
+		if count != int64(len(users)) {
+			t.Errorf("expected %d rows inserted, got %d", len(users), count)
+		}
+
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount+int64(len(users)) {
+			t.Errorf("expected users count to be %d, got %d", oldCount+int64(len(users)), newCount)
+		}
+
+		// Ids must be assigned in order
+		for _, u := range users {
+			var reload user
+			err = session.Get(u.Id).Do(&reload)
+			if err != nil {
+				t.Fatalf("error on Get: %v", err)
+			}
+			if reload.Name != u.Name {
+				t.Errorf("expected user %d to be %s, got %s", u.Id, u.Name, reload.Name)
+			}
+		}
+	}
+}
+
+// wrappedSqlite3 embeds a dialect, e.g. to override some of its methods.
+type wrappedSqlite3 struct {
+	*Sqlite3Dialect
+}
+
+func TestInsertAllWithWrappedDialect(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+	session.Dialect(wrappedSqlite3{Sqlite3})
+
+	users := []*user{
+		{Name: "George"},
+		{Name: "Paul"},
+	}
+	if _, err := session.InsertAll(users); err != nil {
+		t.Fatalf("error on InsertAll: %v", err)
+	}
+	for _, u := range users {
+		var reload user
+		if err := session.Get(u.Id).Do(&reload); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if reload.Name != u.Name {
+			t.Errorf("expected user %d to be named %s, got %s", u.Id, u.Name, reload.Name)
+		}
+	}
+}
+
+func TestInsertAllWithEmptySlice(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		count, err := session.InsertAll([]*user{})
+		if err != nil {
+			t.Fatalf("error on InsertAll: %v", err)
+		}
+		if count != 0 {
+			t.Errorf("expected %d rows inserted, got %d", 0, count)
+		}
+	}
+}
+
+func TestInsertAllTx(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("error on db.Begin(): %v", err)
+		}
+		count, err := session.InsertAllTx(tx, []user{{Name: "George"}, {Name: "Paul"}})
+		if err != nil {
+			tx.Rollback()
+			t.Fatalf("error on InsertAllTx: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("expected %d rows inserted, got %d", 2, count)
+		}
+		err = tx.Rollback()
+		if err != nil {
+			t.Fatalf("error on Rollback: %v", err)
+		}
+
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount {
+			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		}
+	}
+}
+
+func TestGenerateInsertAllSql(t *testing.T) {
+	session := New(nil)
+
+	ti, err := AddType(reflect.TypeOf(user{}))
+	if err != nil {
+		t.Fatalf("error adding type user: %v", err)
+	}
+	got, err := session.generateInsertAllSql(ti, []reflect.Value{
+		reflect.ValueOf(user{Name: "George"}),
+		reflect.ValueOf(user{Name: "Paul", Suspended: true}),
+	})
+	if err != nil {
+		t.Fatalf("error on generateInsertAllSql: %v", err)
+	}
+	expected := "INSERT INTO `users` (`name`, `karma`, `suspended`) VALUES ('George', NULL, 0),('Paul', NULL, 1)"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+// ---- Upsert --------------------------------------------------------------
+
+func TestUpsert(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		// Update path: user 1 exists
+		u := &user{Id: 1, Name: "Olli", Suspended: true}
+		err := session.Upsert(u)
+		if err != nil {
+			t.Fatalf("error on Upsert: %v", err)
+		}
+
+		var reload user
+		err = session.Get(1).Do(&reload)
+		if err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if reload.Name != "Olli" {
+			t.Errorf("expected user name to be %s, got %s", "Olli", reload.Name)
+		}
+		if !reload.Suspended {
+			t.Errorf("expected user to be suspended")
+		}
+
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+		if newCount != oldCount {
+			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		}
+
+		// Insert path: user 100 doesn't exist
+		u = &user{Id: 100, Name: "George"}
+		err = session.Upsert(u)
+		if err != nil {
+			t.Fatalf("error on Upsert: %v", err)
+		}
+		err = session.Get(100).Do(&reload)
+		if err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if reload.Name != "George" {
+			t.Errorf("expected user name to be %s, got %s", "George", reload.Name)
+		}
+
+		// Insert path: no primary key yet
+		u = &user{Name: "Paul"}
+		err = session.Upsert(u)
+		if err != nil {
+			t.Fatalf("error on Upsert: %v", err)
+		}
+		if u.Id <= 0 {
+			t.Errorf("expected Id to be > 0, got %d", u.Id)
+		}
+
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+		if newCount != oldCount+2 {
+			t.Errorf("expected users count to be %d, got %d", oldCount+2, newCount)
+		}
+	}
+}
+
+// ---- Update --------------------------------------------------------------
+
+func TestUpdate(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		// Count users
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		// Retrieve user
+		var u user
+		err := session.Find("select * from users where id=1", nil).Single(&u)
+		if err != nil {
+			t.Fatalf("error on find single: %v", err)
+		}
+
+		// Change user
+		u.Name = "Olli"
+
+		// Update user
+		err = session.Update(u)
+		if err != nil {
+			t.Fatalf("error on Update: %v", err)
+		}
+
+		// Reload user
+		var u2 user
+		session.Find("select * from users where id=1", nil).Single(&u2)
+		if u2.Name != u.Name {
+			t.Errorf("expected user name to be %s, got %s", u.Name, u2.Name)
+		}
+
+		// Check count again
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount {
+			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		}
+	}
+}
+
+func TestUpdateWithPtrType(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		// Count users
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		// Retrieve user
+		var u user
+		err := session.Find("select * from users where id=1", nil).Single(&u)
+		if err != nil {
+			t.Fatalf("error on find single: %v", err)
+		}
+
+		// Change user
+		u.Name = "Olli"
+
+		// Update user
+		err = session.Update(&u)
+		if err != nil {
+			t.Fatalf("error on Update: %v", err)
+		}
+
+		// Reload user
+		var u2 user
+		session.Find("select * from users where id=1", nil).Single(&u2)
+		if u2.Name != u.Name {
+			t.Errorf("expected user name to be %s, got %s", u.Name, u2.Name)
+		}
+
+		// Check count again
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount {
+			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		}
+	}
+}
+
+func TestUpdateChanged(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var u user
+		err := session.Get(2).Do(&u)
+		if err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		err = session.Track(&u)
+		if err != nil {
+			t.Fatalf("error on Track: %v", err)
+		}
+
+		// Change the row behind our back: UpdateChanged must not overwrite it
+		_, err = db.Exec("UPDATE users SET suspended=0 WHERE id=2")
+		if err != nil {
+			t.Fatalf("error on Exec: %v", err)
+		}
+
+		u.Name = "Sandy"
+		err = session.UpdateChanged(&u)
+		if err != nil {
+			t.Fatalf("error on UpdateChanged: %v", err)
+		}
+
+		var reload user
+		err = session.Get(2).Do(&reload)
+		if err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if reload.Name != "Sandy" {
+			t.Errorf("expected user name to be %s, got %s", "Sandy", reload.Name)
+		}
+		if reload.Suspended {
+			t.Errorf("expected unchanged column suspended to not be updated")
+		}
+
+		// The snapshot is refreshed after the update
+		ti, err := AddType(reflect.TypeOf(u))
+		if err != nil {
+			t.Fatalf("error adding type user: %v", err)
+		}
+		got, err := session.generateUpdateChangedSql(ti, &u)
+		if err != nil {
+			t.Fatalf("error on generateUpdateChangedSql: %v", err)
+		}
+		if got != "" {
+			t.Errorf("expected no SQL after UpdateChanged, got %v", got)
+		}
+
+		// Deleting drops the snapshot
+		if err := session.Delete(&u); err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+		if n := len(session.snapshots); n != 0 {
+			t.Errorf("expected %d snapshots after Delete, got %d", 0, n)
+		}
+	}
+}
+
+func TestGenerateUpdateChangedSql(t *testing.T) {
+	session := New(nil)
+
+	ti, err := AddType(reflect.TypeOf(user{}))
+	if err != nil {
+		t.Fatalf("error adding type user: %v", err)
+	}
+
+	karma := 42.0
+	u := &user{Id: 1, Name: "Oliver", Karma: &karma}
+
+	// Untracked entities update all columns
+	got, err := session.generateUpdateChangedSql(ti, u)
+	if err != nil {
+		t.Fatalf("error on generateUpdateChangedSql: %v", err)
+	}
+	expected := "UPDATE `users` SET `name`='Oliver', `karma`=42, `suspended`=0 WHERE `id`=1"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	err = session.Track(u)
+	if err != nil {
+		t.Fatalf("error on Track: %v", err)
+	}
+
+	// Nothing changed
+	got, err = session.generateUpdateChangedSql(ti, u)
+	if err != nil {
+		t.Fatalf("error on generateUpdateChangedSql: %v", err)
+	}
+	if got != "" {
+		t.Errorf("expected no SQL, got %v", got)
+	}
+
+	// Change one field only
+	u.Name = "Sandra"
+	got, err = session.generateUpdateChangedSql(ti, u)
+	if err != nil {
+		t.Fatalf("error on generateUpdateChangedSql: %v", err)
+	}
+	expected = "UPDATE `users` SET `name`='Sandra' WHERE `id`=1"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// Changing the value behind a pointer is detected as well
+	u.Name = "Oliver"
+	*u.Karma = 43.0
+	got, err = session.generateUpdateChangedSql(ti, u)
+	if err != nil {
+		t.Fatalf("error on generateUpdateChangedSql: %v", err)
+	}
+	expected = "UPDATE `users` SET `karma`=43 WHERE `id`=1"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// Untracked entities update all columns again
+	err = session.Untrack(u)
+	if err != nil {
+		t.Fatalf("error on Untrack: %v", err)
+	}
+	got, err = session.generateUpdateChangedSql(ti, u)
+	if err != nil {
+		t.Fatalf("error on generateUpdateChangedSql: %v", err)
+	}
+	expected = "UPDATE `users` SET `name`='Oliver', `karma`=43, `suspended`=0 WHERE `id`=1"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestTrackDetectsChangesOfByteSlicesInPlace(t *testing.T) {
+	session := New(nil).Dialect(Sqlite3)
+
+	ti, err := AddType(reflect.TypeOf(attachment{}))
+	if err != nil {
+		t.Fatalf("error adding type attachment: %v", err)
+	}
+
+	a := &attachment{Id: 1, Data: []byte{0x01, 0x02}}
+	err = session.Track(a)
+	if err != nil {
+		t.Fatalf("error on Track: %v", err)
+	}
+
+	a.Data[0] = 0x03
+	got, err := session.generateUpdateChangedSql(ti, a)
+	if err != nil {
+		t.Fatalf("error on generateUpdateChangedSql: %v", err)
+	}
+	if got == "" {
+		t.Errorf("expected the change of data to be detected")
+	}
+}
+
+type blob struct {
+	Hash []byte `dapper:"hash,primarykey,table=blobs"`
+	Size int64  `dapper:"size"`
+}
+
+func TestTrackWithByteSlicePrimaryKey(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+
+	db.Exec("DROP TABLE IF EXISTS blobs")
+	if _, err := db.Exec("CREATE TABLE blobs (hash blob not null primary key, size integer)"); err != nil {
+		t.Fatalf("error creating table blobs: %v", err)
+	}
+	defer db.Exec("DROP TABLE blobs")
+
+	b := &blob{Hash: []byte{0xca, 0xfe}, Size: 1}
+	if err := session.Insert(b); err != nil {
+		t.Fatalf("error on Insert: %v", err)
+	}
+	if err := session.Track(b); err != nil {
+		t.Fatalf("error on Track: %v", err)
+	}
+	b.Size = 2
+	if err := session.UpdateChanged(b); err != nil {
+		t.Fatalf("error on UpdateChanged: %v", err)
+	}
+	var size int64
+	db.QueryRow("select size from blobs").Scan(&size)
+	if size != 2 {
+		t.Errorf("expected size %d, got %d", 2, size)
+	}
+	if err := session.Delete(b); err != nil {
+		t.Fatalf("error on Delete: %v", err)
+	}
+	if n := len(session.snapshots); n != 0 {
+		t.Errorf("expected %d snapshots, got %d", 0, n)
+	}
+}
+
+func TestUpdateColumns(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var u user
+		err := session.Get(2).Do(&u)
+		if err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+
+		u.Name = "Sandy"
+		u.Suspended = false
+		err = session.UpdateColumns(&u, "name")
+		if err != nil {
+			t.Fatalf("error on UpdateColumns: %v", err)
+		}
+
+		var reload user
+		err = session.Get(2).Do(&reload)
+		if err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if reload.Name != "Sandy" {
+			t.Errorf("expected user name to be %s, got %s", "Sandy", reload.Name)
+		}
+		if !reload.Suspended {
+			t.Errorf("expected column suspended to not be updated")
+		}
+
+		// Use field names
+		err = session.UpdateColumns(&u, "Suspended")
+		if err != nil {
+			t.Fatalf("error on UpdateColumns: %v", err)
+		}
+		err = session.Get(2).Do(&reload)
+		if err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if reload.Suspended {
+			t.Errorf("expected column suspended to be updated")
+		}
+	}
+}
+
+func TestUpdateColumnsWithInvalidColumns(t *testing.T) {
+	session := New(nil)
+	u := &user{Id: 1, Name: "Oliver"}
+
+	if err := session.UpdateColumns(u); err == nil {
+		t.Errorf("expected error without columns")
+	}
+	if err := session.UpdateColumns(u, "no_such_column"); err == nil {
+		t.Errorf("expected error on unknown column")
+	}
+	if err := session.UpdateColumns(u, "id"); err == nil {
+		t.Errorf("expected error on primary key column")
+	}
+}
+
+func TestUpdateWithoutPrimaryKeyTagFails(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		// Retrieve user
+		var u userWithoutPrimaryKeyTag
+		err := session.Find("select * from users where id=1", nil).Single(&u)
+
+		u.Name = "Olli"
+
+		err = session.Update(u)
+		if err != ErrNoPrimaryKey {
+			t.Fatalf("expected dapper.ErrNoPrimaryKey, got: %v", err)
+		}
+	}
+}
+
+func TestUpdateTx(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		// Count users
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		// Retrieve user
+		var u user
+		err := session.Find("select * from users where id=1", nil).Single(&u)
+		if err != nil {
+			t.Fatalf("error on find single: %v", err)
+		}
+
+		// Change user
+		u.Name = "Olli"
+
+		// Start transaction
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("error on db.Begin(): %v", err)
+		}
+
+		// Update user
+		err = session.UpdateTx(tx, u)
+		if err != nil {
+			t.Fatalf("error on UpdateTx: %v", err)
+		}
+
+		// Commit
+		err = tx.Commit()
+		if err != nil {
+			t.Fatalf("error on db.Commit(): %v", err)
+		}
+
+		// Reload user
+		var u2 user
+		session.Find("select * from users where id=1", nil).Single(&u2)
+		if u2.Name != u.Name {
+			t.Errorf("expected user name to be %s, got %s", u.Name, u2.Name)
+		}
+
+		// Check count again
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount {
+			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		}
+	}
+}
+
+func TestUpdateTxRollback(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		// Count users
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		// Retrieve user
+		var u user
+		err := session.Find("select * from users where id=1", nil).Single(&u)
+		if err != nil {
+			t.Fatalf("error on find single: %v", err)
+		}
+
+		// Start transaction
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("error on db.Begin(): %v", err)
+		}
+
+		// Change user
+		u.Name = "Olli"
+
+		// Update user
+		err = session.UpdateTx(tx, u)
+		if err != nil {
+			t.Fatalf("error on UpdateTx: %v", err)
+		}
+
+		// Rollback transaction
+		err = tx.Rollback()
+		if err != nil {
+			t.Fatalf("error on Rollback: %v", err)
+		}
+
+		// Reload user
+		var u2 user
+		session.Find("select * from users where id=1", nil).Single(&u2)
+		if u2.Name == u.Name {
+			t.Errorf("expected user name to be %s, got %s", u.Name, u2.Name)
+		}
+
+		// Check count again
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount {
+			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		}
+	}
+}
+
+// ---- Delete --------------------------------------------------------------
+
+func TestDelete(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		// Count users
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		// Retrieve user
+		var u user
+		err := session.Find("select * from users where id=1", nil).Single(&u)
+		if err != nil {
+			t.Fatalf("error on find single: %v", err)
+		}
+
+		// Delete user
+		err = session.Delete(u)
+		if err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+
+		// Check count
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount-1 {
+			t.Errorf("expected users count to be %d, got %d", oldCount-1, newCount)
+		}
+	}
+}
+
+func TestDeleteWithPtrType(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		// Count users
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		// Retrieve user
+		var u user
+		err := session.Find("select * from users where id=1", nil).Single(&u)
+		if err != nil {
+			t.Fatalf("error on find single: %v", err)
+		}
+
+		// Delete user
+		err = session.Delete(&u)
+		if err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+
+		// Check count
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount-1 {
+			t.Errorf("expected users count to be %d, got %d", oldCount-1, newCount)
+		}
+	}
+}
+
+func TestDeleteTx(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		// Count users
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		// Retrieve user
+		var u user
+		err := session.Find("select * from users where id=1", nil).Single(&u)
+		if err != nil {
+			t.Fatalf("error on find single: %v", err)
+		}
+
+		// Get a transaction
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("error on db.Begin(): %v", err)
+		}
+
+		// Delete user
+		err = session.DeleteTx(tx, u)
+		if err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+
+		// Commit
+		err = tx.Commit()
+		if err != nil {
+			t.Fatalf("error on db.Commit(): %v", err)
+		}
+
+		// Check count
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount-1 {
+			t.Errorf("expected users count to be %d, got %d", oldCount-1, newCount)
+		}
+	}
+}
+
+func TestDeleteTxRollback(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		// Count users
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		// Retrieve user
+		var u user
+		err := session.Find("select * from users where id=1", nil).Single(&u)
+		if err != nil {
+			t.Fatalf("error on find single: %v", err)
+		}
+
+		// Get a transaction
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("error on db.Begin(): %v", err)
+		}
+
+		// Delete user
+		err = session.DeleteTx(tx, u)
+		if err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+
+		// Rollback
+		err = tx.Rollback()
+		if err != nil {
+			t.Fatalf("error on db.Rollback(): %v", err)
+		}
+
+		// Check count
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount {
+			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		}
+	}
+}
+
+// ---- Exec ----------------------------------------------------------------
+
+func TestExecNamed(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		param := struct {
+			MinKarma float64
+			Name     string
+		}{MinKarma: 40, Name: "O'Reilly"}
+		res, err := session.ExecNamed("update users set suspended=1 where karma > :MinKarma", param)
+		if err != nil {
+			t.Fatalf("driver %s: error on ExecNamed: %v", driver, err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			t.Fatalf("driver %s: error on RowsAffected: %v", driver, err)
+		}
+		if affected != 2 {
+			t.Errorf("driver %s: expected %d rows affected, got %d", driver, 2, affected)
+		}
+
+		// Values are quoted, also in a transaction
+		err = session.Transaction(func(tx *Tx) error {
+			res, err := tx.ExecNamed("update users set name=:Name where id=1", param)
+			if err != nil {
+				return err
+			}
+			affected, err = res.RowsAffected()
+			return err
+		})
+		if err != nil {
+			t.Fatalf("driver %s: error on Transaction: %v", driver, err)
+		}
+		if affected != 1 {
+			t.Errorf("driver %s: expected %d row affected, got %d", driver, 1, affected)
+		}
+		var name string
+		if err := session.Find("select name from users where id=1", nil).Scalar(&name); err != nil {
+			t.Fatalf("driver %s: error on Scalar: %v", driver, err)
+		}
+		if name != "O'Reilly" {
+			t.Errorf("driver %s: expected %v, got %v", driver, "O'Reilly", name)
+		}
+
+		// SQL strings cannot be scoped
+		_, err = session.Scope("id", 1).ExecNamed("update users set suspended=0 where karma > :MinKarma", param)
+		if err != ErrUnscopedSQL {
+			t.Errorf("driver %s: expected ErrUnscopedSQL, got %v", driver, err)
+		}
+	}
+}
+
+// ---- Transaction ---------------------------------------------------------
+
+func TestTransactionCommits(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		u := &user{Name: "George"}
+		err := session.Transaction(func(tx *Tx) error {
+			if err := tx.Insert(u); err != nil {
+				return err
+			}
+			u.Name = "George Jr."
+			return tx.Update(u)
+		})
+		if err != nil {
+			t.Fatalf("error on Transaction: %v", err)
+		}
+
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount+1 {
+			t.Errorf("expected users count to be %d, got %d", oldCount+1, newCount)
+		}
+
+		var reload user
+		err = session.Find("select * from users where id=:Id", u).Single(&reload)
+		if err != nil {
+			t.Fatalf("error on Single: %v", err)
+		}
+		if reload.Name != "George Jr." {
+			t.Errorf("expected user name to be %s, got %s", "George Jr.", reload.Name)
+		}
+	}
+}
+
+func TestTransactionRollsBackOnError(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		failure := fmt.Errorf("failure")
+		err := session.Transaction(func(tx *Tx) error {
+			if err := tx.Insert(&user{Name: "George"}); err != nil {
+				return err
+			}
+			return failure
+		})
+		if err != failure {
+			t.Fatalf("expected error %v, got %v", failure, err)
+		}
+
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount {
+			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		}
+	}
+}
+
+func TestTransactionRollsBackOnPanic(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var oldCount int64
+		row := db.QueryRow("select count(*) from users")
+		row.Scan(&oldCount)
+
+		func() {
+			defer func() {
+				if p := recover(); p != "boom" {
+					t.Errorf("expected panic %v, got %v", "boom", p)
+				}
+			}()
+			session.Transaction(func(tx *Tx) error {
+				if err := tx.Insert(&user{Name: "George"}); err != nil {
+					return err
+				}
+				panic("boom")
+			})
+		}()
+
+		var newCount int64
+		row = db.QueryRow("select count(*) from users")
+		row.Scan(&newCount)
+
+		if newCount != oldCount {
+			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		}
+	}
+}
+
+type document struct {
+	Id      int64  `dapper:"id,primarykey,table=documents"`
+	Title   string `dapper:"title"`
+	Version int64  `dapper:"version,version"`
+}
+
+func TestGenerateUpdateSqlWithVersion(t *testing.T) {
+	session := New(nil)
+	ti, err := AddType(reflect.TypeOf(document{}))
+	if err != nil {
+		t.Fatalf("error adding type document: %v", err)
+	}
+	if fi := ti.FieldInfos["Version"]; !fi.IsVersion {
+		t.Errorf("expected field Version to be the version column")
+	}
+
+	got, err := session.generateUpdateSql(ti, &document{Id: 1, Title: "Draft", Version: 3}, nil)
+	if err != nil {
+		t.Fatalf("error on generateUpdateSql: %v", err)
+	}
+	expected := "UPDATE `documents` SET `title`='Draft', `version`=`version`+1 WHERE `id`=1 AND `version`=3"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestUpdateWithStaleVersionFails(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP TABLE IF EXISTS documents")
+		_, err := db.Exec("CREATE TABLE documents (id integer primary key, title varchar(100), version integer)")
+		if err != nil {
+			t.Fatalf("error creating table documents: %v", err)
+		}
+		defer db.Exec("DROP TABLE documents")
+
+		err = session.Insert(&document{Id: 1, Title: "Draft", Version: 1})
+		if err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+
+		var first, second document
+		if err := session.Get(1).Do(&first); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if err := session.Get(1).Do(&second); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+
+		first.Title = "Final"
+		if err := session.Update(&first); err != nil {
+			t.Fatalf("error on Update: %v", err)
+		}
+		if first.Version != 2 {
+			t.Errorf("expected version to be %d, got %d", 2, first.Version)
+		}
+
+		second.Title = "Outdated"
+		if err := session.Update(&second); err != ErrStaleObject {
+			t.Fatalf("expected dapper.ErrStaleObject, got: %v", err)
+		}
+
+		var reload document
+		if err := session.Get(1).Do(&reload); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if reload.Title != "Final" || reload.Version != 2 {
+			t.Errorf("expected document %q in version %d, got %q in version %d", "Final", 2, reload.Title, reload.Version)
+		}
+	}
+}
+
+func TestScope(t *testing.T) {
+	base := New(nil)
+	session := base.Scope("tenant_id", 42)
+
+	got := session.Q("users").Where().Eq("name", "Oliver").Sql()
+	expected := "SELECT * FROM users WHERE tenant_id=42 AND name='Oliver'"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// Scoping returns a copy, so sessions of other tenants are unaffected
+	other := base.Scope("tenant_id", 43)
+	got = other.Q("users").Sql()
+	expected = "SELECT * FROM users WHERE tenant_id=43"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	got = base.Q("users").Sql()
+	expected = "SELECT * FROM users"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	got = session.Unscoped().Q("users").Sql()
+	expected = "SELECT * FROM users"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	ti, err := AddType(reflect.TypeOf(tweet{}))
+	if err != nil {
+		t.Fatalf("error adding type tweet: %v", err)
+	}
+	tw := &tweet{Id: 1, UserId: 1, Message: "Hi", Retweets: 7}
+	got, err = session.generateUpdateSql(ti, tw, []string{"message"})
+	if err != nil {
+		t.Fatalf("error on generateUpdateSql: %v", err)
+	}
+	expected = "UPDATE `tweets` SET `message`='Hi' WHERE `id`=1 AND `tenant_id`=42"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	got, err = session.generateDeleteSql(ti, tw)
+	if err != nil {
+		t.Fatalf("error on generateDeleteSql: %v", err)
+	}
+	expected = "DELETE FROM `tweets` WHERE `id`=1 AND `tenant_id`=42"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestScopeIsEnforced(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		session = session.Scope("user_id", 1)
+
+		// Tweet 3 belongs to user 2
+		var tw tweet
+		if err := session.Get(1).Do(&tw); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if err := session.Get(3).Do(&tw); err != sql.ErrNoRows {
+			t.Fatalf("expected sql.ErrNoRows, got: %v", err)
+		}
+
+		var tweets []tweet
+		if err := session.FindQuery(session.Q("tweets")).All(&tweets); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(tweets) != 2 {
+			t.Errorf("expected %d tweets, got %d", 2, len(tweets))
+		}
+		count, err := session.CountQuery(session.Q("tweets"))
+		if err != nil {
+			t.Fatalf("error on CountQuery: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("expected %d tweets, got %d", 2, count)
+		}
+
+		// The scope is qualified with the alias of the table, e.g. in self joins
+		q := session.Q("tweets").Alias("a").
+			Join("tweets").Alias("b").On("a.id", "b.id").
+			Project(SafeSqlString("a.*")).
+			Query()
+		if err := session.FindQuery(q).All(&tweets); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(tweets) != 2 {
+			t.Errorf("expected %d tweets, got %d", 2, len(tweets))
+		}
+		if err := session.Get(3).Alias("a").Do(&tw); err != sql.ErrNoRows {
+			t.Fatalf("expected sql.ErrNoRows, got: %v", err)
+		}
+
+		// All queries of a union must be scoped
+		q = session.Q("tweets").Union(Q(session.dialect, "tweets"))
+		if err := session.FindQuery(q).All(&tweets); err != ErrUnscopedSQL {
+			t.Errorf("expected ErrUnscopedSQL for an unscoped union, got: %v", err)
+		}
+		var union []tweet
+		q = session.Q("tweets").Where().Eq("id", 1).Union(session.Q("tweets").Where().Eq("id", 3).Query())
+		if err := session.FindQuery(q).All(&union); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(union) != 1 || union[0].Id != 1 {
+			t.Errorf("expected tweet %d only, got %v", 1, union)
+		}
+
+		// Raw fragments with OR cannot escape the scope
+		var raw []tweet
+		q = session.Q("tweets").Where().Raw("id=1 OR id=3").Query()
+		if err := session.FindQuery(q).All(&raw); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(raw) != 1 || raw[0].Id != 1 {
+			t.Errorf("expected tweet %d only, got %v", 1, raw)
+		}
+
+		// SQL that cannot be scoped is rejected
+		if err := session.Find("select * from tweets", nil).All(&tweets); err != ErrUnscopedSQL {
+			t.Errorf("expected ErrUnscopedSQL, got: %v", err)
+		}
+		if _, err := session.Count("select count(*) from tweets", nil); err != ErrUnscopedSQL {
+			t.Errorf("expected ErrUnscopedSQL, got: %v", err)
+		}
+		if err := session.FindQuery(Q(session.GetDialect(), "tweets")).All(&tweets); err != ErrUnscopedSQL {
+			t.Errorf("expected ErrUnscopedSQL, got: %v", err)
+		}
+
+		// Updates and deletes outside of the scope don't affect any rows
+		other := &tweet{Id: 3, UserId: 2, Message: "Hacked"}
+		if err := session.Update(other); err != nil {
+			t.Fatalf("error on Update: %v", err)
+		}
+		if err := session.Delete(other); err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+		if err := session.Unscoped().Get(3).Do(&tw); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if tw.Message != "Holidays! Yay!" {
+			t.Errorf("expected tweet to be unchanged, got %q", tw.Message)
+		}
+
+		count, err = session.Unscoped().Count("select count(*) from tweets", nil)
+		if err != nil {
+			t.Fatalf("error on Count: %v", err)
+		}
+		if count != 3 {
+			t.Errorf("expected %d tweets, got %d", 3, count)
+		}
+	}
+}
+
+type note struct {
+	Id        int64      `dapper:"id,primarykey,table=notes"`
+	Title     string     `dapper:"title"`
+	DeletedAt *time.Time `dapper:"deleted_at,softdelete"`
+}
+
+func TestGenerateSoftDeleteSql(t *testing.T) {
+	session := New(nil)
+	ti, err := AddType(reflect.TypeOf(note{}))
+	if err != nil {
+		t.Fatalf("error adding type note: %v", err)
+	}
+	if fi := ti.FieldInfos["DeletedAt"]; !fi.IsSoftDelete {
+		t.Errorf("expected field DeletedAt to be the soft delete column")
+	}
+
+	now, _ := time.Parse("2006-01-02 15:04:05", "2013-01-24 18:14:15")
+	got, err := session.generateSoftDeleteSql(ti, &note{Id: 1}, now)
+	if err != nil {
+		t.Fatalf("error on generateSoftDeleteSql: %v", err)
+	}
+	expected := "UPDATE `notes` SET `deleted_at`='2013-01-24 18:14:15' WHERE `id`=1"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP TABLE IF EXISTS notes")
+		_, err := db.Exec("CREATE TABLE notes (id integer primary key, title varchar(100), deleted_at timestamp null)")
+		if err != nil {
+			t.Fatalf("error creating table notes: %v", err)
+		}
+		defer db.Exec("DROP TABLE notes")
+
+		for i, title := range []string{"Keep", "Remove"} {
+			if err := session.Insert(&note{Id: int64(i + 1), Title: title}); err != nil {
+				t.Fatalf("error on Insert: %v", err)
+			}
+		}
+
+		n := &note{Id: 2, Title: "Remove"}
+		if err := session.Delete(n); err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+		if n.DeletedAt == nil {
+			t.Errorf("expected DeletedAt to be set")
+		}
+
+		// The row is still there
+		count, err := session.Count("select count(*) from notes", nil)
+		if err != nil {
+			t.Fatalf("error on Count: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("expected %d notes, got %d", 2, count)
+		}
+
+		// ... but excluded by default
+		var reload note
+		if err := session.Get(2).Do(&reload); err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows, got: %v", err)
+		}
+		if err := session.Find("select * from notes where id=2", nil).Single(&reload); err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows, got: %v", err)
+		}
+		var notes []note
+		if err := session.Find("select * from notes order by id", nil).All(&notes); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(notes) != 1 || notes[0].Title != "Keep" {
+			t.Errorf("expected only note %q, got %v", "Keep", notes)
+		}
+
+		// ... unless asked for
+		if err := session.Get(2).WithDeleted().Do(&reload); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if reload.DeletedAt == nil {
+			t.Errorf("expected DeletedAt to be loaded")
+		}
+		if err := session.Find("select * from notes order by id", nil).WithDeleted().All(&notes); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(notes) != 2 {
+			t.Errorf("expected %d notes, got %d", 2, len(notes))
+		}
+
+		// HardDelete removes the row
+		if err := session.HardDelete(n); err != nil {
+			t.Fatalf("error on HardDelete: %v", err)
+		}
+		count, err = session.Count("select count(*) from notes", nil)
+		if err != nil {
+			t.Fatalf("error on Count: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("expected %d notes, got %d", 1, count)
+		}
+	}
+}
+
+type article struct {
+	Id      int64      `dapper:"id,primarykey,table=articles"`
+	Title   string     `dapper:"title"`
+	Created time.Time  `dapper:"created_at,autocreatetime"`
+	Updated *time.Time `dapper:"updated_at,autoupdatetime"`
+}
+
+func TestAutoTimestamps(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP TABLE IF EXISTS articles")
+		_, err := db.Exec("CREATE TABLE articles (id integer primary key, title varchar(100), created_at timestamp null, updated_at timestamp null)")
+		if err != nil {
+			t.Fatalf("error creating table articles: %v", err)
+		}
+		defer db.Exec("DROP TABLE articles")
+
+		a := &article{Id: 1, Title: "Hello"}
+		if err := session.Insert(a); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		if a.Created.IsZero() {
+			t.Errorf("expected Created to be set on insert")
+		}
+		if a.Updated == nil {
+			t.Fatalf("expected Updated to be set on insert")
+		}
+
+		var reload article
+		if err := session.Get(a.Id).Do(&reload); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if reload.Created.IsZero() || reload.Updated == nil {
+			t.Errorf("expected timestamps to be written, got %v and %v", reload.Created, reload.Updated)
+		}
+
+		// A given creation time is kept
+		created := time.Date(2013, 1, 24, 18, 14, 15, 0, time.UTC)
+		b := &article{Id: 2, Title: "Old", Created: created}
+		if err := session.Insert(b); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		if !b.Created.Equal(created) {
+			t.Errorf("expected Created to be %v, got %v", created, b.Created)
+		}
+
+		// Update refreshes Updated, but keeps Created
+		old := time.Date(2013, 1, 24, 18, 14, 15, 0, time.UTC)
+		b.Updated = &old
+		b.Title = "New"
+		if err := session.UpdateColumns(b, "title"); err != nil {
+			t.Fatalf("error on UpdateColumns: %v", err)
+		}
+		if !b.Updated.After(old) {
+			t.Errorf("expected Updated to be refreshed on update, got %v", b.Updated)
+		}
+		if !b.Created.Equal(created) {
+			t.Errorf("expected Created to be %v, got %v", created, b.Created)
+		}
+		if err := session.Get(b.Id).Do(&reload); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if reload.Updated == nil || !reload.Updated.After(old) {
+			t.Errorf("expected updated_at to be written on update, got %v", reload.Updated)
+		}
+	}
+}
+
+type userByName struct {
+	Name string
+}
+
+func TestAllRows(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		rows, err := session.Find("select id, name, karma from users order by id", nil).AllRows()
+		if err != nil {
+			t.Fatalf("error on AllRows: %v", err)
+		}
+		if len(rows) != 2 {
+			t.Fatalf("expected %d rows, got %d", 2, len(rows))
+		}
+		for i, name := range []string{"Oliver", "Sandra"} {
+			if len(rows[i]) != 3 {
+				t.Fatalf("expected %d columns, got %d", 3, len(rows[i]))
+			}
+			if got := fmt.Sprint(rows[i][0]); got != fmt.Sprint(i+1) {
+				t.Errorf("expected id %d, got %v", i+1, got)
+			}
+			if got, ok := rows[i][1].(string); !ok || got != name {
+				t.Errorf("expected name %q, got %#v", name, rows[i][1])
+			}
+		}
+
+		rows, err = session.Find("select name from users where name=:Name", userByName{"Sandra"}).AllRows()
+		if err != nil {
+			t.Fatalf("error on AllRows: %v", err)
+		}
+		if len(rows) != 1 || rows[0][0] != "Sandra" {
+			t.Errorf("expected a single row with %q, got %v", "Sandra", rows)
+		}
+	}
+}
+
+// failingUsersSql selects the users, but fails with an integer overflow
+// in Sqlite3 when stepping to the second row.
+const failingUsersSql = "select id, case when id=2 then abs(-9223372036854775808) else name end as name from users order by id"
+
+func TestAllReturnsRowsErr(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+
+	var users []user
+	err := session.Find(failingUsersSql, nil).All(&users)
+	if err == nil {
+		t.Fatalf("expected error on All, got %d users", len(users))
+	}
+}
+
+func TestSingleReturnsRowsErr(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+
+	// Fails when stepping to the first row, which must not be
+	// mistaken for an empty result
+	var u user
+	err := session.Find(failingUsersSql+" limit 1 offset 1", nil).Single(&u)
+	if err == nil || err == sql.ErrNoRows {
+		t.Fatalf("expected driver error on Single, got %v", err)
+	}
+}
+
+func TestRows(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+
+	rows, err := session.Find("select * from users order by id", nil).Rows(context.Background())
+	if err != nil {
+		t.Fatalf("error on Rows: %v", err)
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var u user
+		if err := rows.Scan(&u); err != nil {
+			t.Fatalf("error on Scan: %v", err)
+		}
+		names = append(names, u.Name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("error on Err: %v", err)
+	}
+	if len(names) != 2 || names[0] != "Oliver" || names[1] != "Sandra" {
+		t.Errorf("expected users %v, got %v", []string{"Oliver", "Sandra"}, names)
+	}
+
+	// A driver error during iteration is returned by Err
+	rows, err = session.Find(failingUsersSql, nil).Rows(context.Background())
+	if err != nil {
+		t.Fatalf("error on Rows: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	if err := rows.Err(); err == nil {
+		t.Errorf("expected error on Err")
+	}
+
+	// A cancelled context stops the query
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := session.Find("select * from users", nil).Rows(ctx); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestPage(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		tests := []struct {
+			Page     int
+			Expected []int64
+		}{
+			{1, []int64{1, 2}},
+			{2, []int64{3}},
+			{3, []int64{}},
+		}
+		for _, test := range tests {
+			var tweets []tweet
+			total, err := session.Find("select * from tweets order by id", nil).Page(test.Page, 2, &tweets)
+			if err != nil {
+				t.Fatalf("driver %s: error on Page(%d): %v", driver, test.Page, err)
+			}
+			if total != 3 {
+				t.Errorf("driver %s: expected total %d, got %d", driver, 3, total)
+			}
+			ids := make([]int64, 0)
+			for _, tw := range tweets {
+				ids = append(ids, tw.Id)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(test.Expected) {
+				t.Errorf("driver %s: expected tweets %v on page %d, got %v", driver, test.Expected, test.Page, ids)
+			}
+		}
+
+		// Parameters apply to the count and the page
+		var tweets []tweet
+		total, err := session.Find("select * from tweets where user_id=:UserId order by id", tweetByUserId{UserId: 1}).Page(2, 1, &tweets)
+		if err != nil {
+			t.Fatalf("driver %s: error on Page: %v", driver, err)
+		}
+		if total != 2 {
+			t.Errorf("driver %s: expected total %d, got %d", driver, 2, total)
+		}
+		if len(tweets) != 1 || tweets[0].Id != 2 {
+			t.Errorf("driver %s: expected tweet %d, got %v", driver, 2, tweets)
+		}
+
+		if _, err := session.Find("select * from tweets", nil).Page(0, 2, &tweets); err == nil {
+			t.Errorf("driver %s: expected error on page 0", driver)
+		}
+		if _, err := session.Find("select * from tweets", nil).Page(1, 0, &tweets); err == nil {
+			t.Errorf("driver %s: expected error on page size 0", driver)
+		}
+	}
+}
+
+func TestPageFiltersSoftDeleted(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP TABLE IF EXISTS notes")
+		_, err := db.Exec("CREATE TABLE notes (id integer primary key, title varchar(100), deleted_at timestamp null)")
+		if err != nil {
+			t.Fatalf("error creating table notes: %v", err)
+		}
+		defer db.Exec("DROP TABLE notes")
+
+		for i, title := range []string{"Removed", "Kept", "Also kept"} {
+			if err := session.Insert(&note{Id: int64(i + 1), Title: title}); err != nil {
+				t.Fatalf("error on Insert: %v", err)
+			}
+		}
+		if err := session.Delete(&note{Id: 1}); err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+
+		// Soft-deleted notes are neither counted nor returned
+		q := session.Q("notes").Order().Asc("id").Query()
+		var notes []note
+		total, err := session.FindQuery(q).Page(1, 1, &notes)
+		if err != nil {
+			t.Fatalf("driver %s: error on Page: %v", driver, err)
+		}
+		if total != 2 {
+			t.Errorf("driver %s: expected total %d, got %d", driver, 2, total)
+		}
+		if len(notes) != 1 || notes[0].Id != 2 {
+			t.Errorf("driver %s: expected note %d, got %v", driver, 2, notes)
+		}
+
+		// SQL strings are filtered after loading
+		var raw []note
+		total, err = session.Find("select * from notes order by id", nil).Page(1, 1, &raw)
+		if err != nil {
+			t.Fatalf("driver %s: error on Page: %v", driver, err)
+		}
+		if total != 3 {
+			t.Errorf("driver %s: expected total %d, got %d", driver, 3, total)
+		}
+		if len(raw) != 0 {
+			t.Errorf("driver %s: expected no notes, got %v", driver, raw)
+		}
+
+		var all []note
+		total, err = session.FindQuery(q).WithDeleted().Page(1, 1, &all)
+		if err != nil {
+			t.Fatalf("driver %s: error on Page: %v", driver, err)
+		}
+		if total != 3 {
+			t.Errorf("driver %s: expected total %d, got %d", driver, 3, total)
+		}
+		if len(all) != 1 || all[0].Id != 1 {
+			t.Errorf("driver %s: expected note %d, got %v", driver, 1, all)
+		}
+	}
+}
+
+func TestFirstSkipsSoftDeleted(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP TABLE IF EXISTS notes")
+		_, err := db.Exec("CREATE TABLE notes (id integer primary key, title varchar(100), deleted_at timestamp null)")
+		if err != nil {
+			t.Fatalf("error creating table notes: %v", err)
+		}
+		defer db.Exec("DROP TABLE notes")
+
+		for i, title := range []string{"Removed", "Kept"} {
+			if err := session.Insert(&note{Id: int64(i + 1), Title: title}); err != nil {
+				t.Fatalf("error on Insert: %v", err)
+			}
+		}
+		if err := session.Delete(&note{Id: 1}); err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+
+		// Filtered in the database, without changing the query
+		q := session.Q("notes")
+		sql := q.Sql()
+		var first note
+		if err := session.FindQuery(q).First(&first); err != nil {
+			t.Fatalf("driver %s: error on First: %v", driver, err)
+		}
+		if first.Id != 2 {
+			t.Errorf("driver %s: expected note %d, got %d", driver, 2, first.Id)
+		}
+		if got := q.Sql(); got != sql {
+			t.Errorf("driver %s: expected query %v, got %v", driver, sql, got)
+		}
+
+		// Skipped while reading the rows of an SQL string
+		first = note{}
+		if err := session.Find("select * from notes", nil).First(&first); err != nil {
+			t.Fatalf("driver %s: error on First: %v", driver, err)
+		}
+		if first.Id != 2 {
+			t.Errorf("driver %s: expected note %d, got %d", driver, 2, first.Id)
+		}
+
+		first = note{}
+		if err := session.FindQuery(q).WithDeleted().First(&first); err != nil {
+			t.Fatalf("driver %s: error on First: %v", driver, err)
+		}
+		if first.Id != 1 {
+			t.Errorf("driver %s: expected note %d, got %d", driver, 1, first.Id)
+		}
+	}
+}
+
+func TestEach(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		names := make([]string, 0)
+		err := session.Find("select * from users order by id", nil).Each(&user{}, func(result interface{}) error {
+			u, ok := result.(*user)
+			if !ok {
+				t.Fatalf("expected *user, got %T", result)
+			}
+			names = append(names, u.Name)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("error on Each: %v", err)
+		}
+		if len(names) != 2 || names[0] != "Oliver" || names[1] != "Sandra" {
+			t.Errorf("expected users %v, got %v", []string{"Oliver", "Sandra"}, names)
+		}
+
+		// Returning an error stops the iteration early
+		errStop := errors.New("stop")
+		calls := 0
+		err = session.Find("select * from users order by id", nil).Each(&user{}, func(result interface{}) error {
+			calls++
+			return errStop
+		})
+		if err != errStop {
+			t.Errorf("expected %v, got %v", errStop, err)
+		}
+		if calls != 1 {
+			t.Errorf("expected %d calls, got %d", 1, calls)
+		}
+
+		// Errors of the query are returned, too
+		err = session.Find("select * from no_such_table", nil).Each(&user{}, func(result interface{}) error {
+			t.Errorf("expected no call")
+			return nil
+		})
+		if err == nil {
+			t.Errorf("expected error on Each")
+		}
+		if err := session.Find("select * from users", nil).Each(user{}, nil); err == nil {
+			t.Errorf("expected error for non-pointer result")
+		}
+	}
+}
+
+type userRole struct {
+	UserId int64  `dapper:"user_id,primarykey,table=user_roles"`
+	RoleId int64  `dapper:"role_id,primarykey"`
+	Note   string `dapper:"note"`
+}
+
+func TestGenerateSqlWithCompositePrimaryKey(t *testing.T) {
+	session := New(nil)
+	ti, err := AddType(reflect.TypeOf(userRole{}))
+	if err != nil {
+		t.Fatalf("error adding type userRole: %v", err)
+	}
+	pks := ti.GetPrimaryKeys()
+	if len(pks) != 2 || pks[0].ColumnName != "user_id" || pks[1].ColumnName != "role_id" {
+		t.Fatalf("expected primary keys user_id and role_id, got %v", pks)
+	}
+
+	r := &userRole{UserId: 1, RoleId: 2, Note: "admin"}
+	got, err := session.generateUpdateSql(ti, r, nil)
+	if err != nil {
+		t.Fatalf("error on generateUpdateSql: %v", err)
+	}
+	expected := "UPDATE `user_roles` SET `note`='admin' WHERE `user_id`=1 AND `role_id`=2"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	got, err = session.generateDeleteSql(ti, r)
+	if err != nil {
+		t.Fatalf("error on generateDeleteSql: %v", err)
+	}
+	expected = "DELETE FROM `user_roles` WHERE `user_id`=1 AND `role_id`=2"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestCRUDWithCompositePrimaryKey(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP TABLE IF EXISTS user_roles")
+		_, err := db.Exec("CREATE TABLE user_roles (user_id integer, role_id integer, note varchar(100), primary key (user_id, role_id))")
+		if err != nil {
+			t.Fatalf("error creating table user_roles: %v", err)
+		}
+		defer db.Exec("DROP TABLE user_roles")
+
+		roles := []*userRole{
+			{UserId: 1, RoleId: 1, Note: "user"},
+			{UserId: 1, RoleId: 2, Note: "admin"},
+			{UserId: 2, RoleId: 1, Note: "user"},
+		}
+		for _, r := range roles {
+			if err := session.Insert(r); err != nil {
+				t.Fatalf("error on Insert: %v", err)
+			}
+		}
+
+		// Entities sharing a part of the primary key are distinct
+		var all []*userRole
+		if err := session.Find("select * from user_roles order by user_id, role_id", nil).All(&all); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(all) != 3 || all[0] == all[1] {
+			t.Fatalf("expected %d distinct roles, got %v", 3, all)
+		}
+
+		var r userRole
+		if err := session.Get(1, 2).Do(&r); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if r.Note != "admin" {
+			t.Errorf("expected note %q, got %q", "admin", r.Note)
+		}
+		if err := session.Get(1).Do(&r); err == nil {
+			t.Errorf("expected error on Get with too few values")
+		}
+
+		r.Note = "owner"
+		if err := session.Update(&r); err != nil {
+			t.Fatalf("error on Update: %v", err)
+		}
+		if err := session.Get(1, 1).Do(&r); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if r.Note != "user" {
+			t.Errorf("expected note %q, got %q", "user", r.Note)
+		}
+
+		if err := session.Delete(roles[1]); err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+		count, err := session.Count("select count(*) from user_roles", nil)
+		if err != nil {
+			t.Fatalf("error on Count: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("expected %d roles, got %d", 2, count)
+		}
+	}
+}
+
+// color is a custom column type, stored as its name.
+type color int
+
+const (
+	red color = iota + 1
+	green
+)
+
+var colorNames = map[color]string{red: "red", green: "green"}
+
+func (c color) Value() (driver.Value, error) {
+	name, found := colorNames[c]
+	if !found {
+		return nil, fmt.Errorf("invalid color %d", c)
+	}
+	return name, nil
+}
+
+func (c *color) Scan(src interface{}) error {
+	var name string
+	switch v := src.(type) {
+	case string:
+		name = v
+	case []byte:
+		name = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into color", src)
+	}
+	for k, v := range colorNames {
+		if v == name {
+			*c = k
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid color %q", name)
+}
+
+type paint struct {
+	Id    int64  `dapper:"id,primarykey,table=paints"`
+	Color color  `dapper:"color"`
+	Alt   *color `dapper:"alt"`
+}
+
+func TestInsertAndSingleWithValuerAndScanner(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP TABLE IF EXISTS paints")
+		_, err := db.Exec("CREATE TABLE paints (id integer primary key, color varchar(20), alt varchar(20) null)")
+		if err != nil {
+			t.Fatalf("error creating table paints: %v", err)
+		}
+		defer db.Exec("DROP TABLE paints")
+
+		alt := red
+		if err := session.Insert(&paint{Id: 1, Color: green, Alt: &alt}); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		if err := session.Insert(&paint{Id: 2, Color: red}); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+
+		var name string
+		if err := session.Find("select color from paints where id=1", nil).Scalar(&name); err != nil {
+			t.Fatalf("error on Scalar: %v", err)
+		}
+		if name != "green" {
+			t.Errorf("expected column to be %q, got %q", "green", name)
+		}
+
+		var p paint
+		if err := session.Find("select * from paints where id=1", nil).Single(&p); err != nil {
+			t.Fatalf("error on Single: %v", err)
+		}
+		if p.Color != green || p.Alt == nil || *p.Alt != red {
+			t.Errorf("expected colors %v and %v, got %v and %v", green, red, p.Color, p.Alt)
+		}
+
+		var q paint
+		if err := session.Get(2).Do(&q); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if q.Color != red || q.Alt != nil {
+			t.Errorf("expected colors %v and nil, got %v and %v", red, q.Color, q.Alt)
+		}
+	}
+}
+
+type attachment struct {
+	Id   int64  `dapper:"id,primarykey,table=attachments"`
+	Data []byte `dapper:"data"`
+}
+
+func TestInsertAndGetWithBlob(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		blobType := "blob"
+		if driver == "postgres" {
+			blobType = "bytea"
+		}
+		db.Exec("DROP TABLE IF EXISTS attachments")
+		_, err := db.Exec("CREATE TABLE attachments (id integer primary key, data " + blobType + " null)")
+		if err != nil {
+			t.Fatalf("error creating table attachments: %v", err)
+		}
+		defer db.Exec("DROP TABLE attachments")
+
+		data := []byte{0x00, 0x01, 0x27, 0x5c, 0x80, 0xff}
+		if err := session.Insert(&attachment{Id: 1, Data: data}); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		if err := session.Insert(&attachment{Id: 2}); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+
+		var a attachment
+		if err := session.Get(1).Do(&a); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if !bytes.Equal(a.Data, data) {
+			t.Errorf("expected data %x, got %x", data, a.Data)
+		}
+
+		var all []attachment
+		if err := session.Find("select * from attachments order by id", nil).All(&all); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(all) != 2 || !bytes.Equal(all[0].Data, data) || all[1].Data != nil {
+			t.Errorf("expected data %x and nil, got %v", data, all)
+		}
+	}
+}
+
+type userName struct {
+	Id   int64  `dapper:"id,primarykey,table=user_names,readonly"`
+	Name string `dapper:"name"`
+}
+
+func TestReadOnlyView(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP VIEW IF EXISTS user_names")
+		_, err := db.Exec("CREATE VIEW user_names AS SELECT id, name FROM users")
+		if err != nil {
+			t.Fatalf("error creating view user_names: %v", err)
+		}
+		defer db.Exec("DROP VIEW user_names")
+
+		var u userName
+		if err := session.Get(2).Do(&u); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if u.Name != "Sandra" {
+			t.Errorf("expected name %q, got %q", "Sandra", u.Name)
+		}
+
+		if err := session.Insert(&userName{Id: 3, Name: "George"}); err != ErrReadOnly {
+			t.Errorf("expected dapper.ErrReadOnly on Insert, got: %v", err)
+		}
+		u.Name = "Sandy"
+		if err := session.Update(&u); err != ErrReadOnly {
+			t.Errorf("expected dapper.ErrReadOnly on Update, got: %v", err)
+		}
+		if err := session.Upsert(&u); err != ErrReadOnly {
+			t.Errorf("expected dapper.ErrReadOnly on Upsert, got: %v", err)
+		}
+		if err := session.Delete(&u); err != ErrReadOnly {
+			t.Errorf("expected dapper.ErrReadOnly on Delete, got: %v", err)
+		}
+	}
+}
+
+func TestSingleMultiAndAllMulti(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		const sqlQuery = "select u.*, t.* from users u join tweets t on u.id=t.user_id"
+
+		var u user
+		var tw tweet
+		err := session.Find(sqlQuery+" where t.id=3", nil).SingleMulti(&u, &tw)
+		if err != nil {
+			t.Fatalf("error on SingleMulti: %v", err)
+		}
+		if u.Id != 2 || u.Name != "Sandra" {
+			t.Errorf("expected user %d %q, got %d %q", 2, "Sandra", u.Id, u.Name)
+		}
+		if tw.Id != 3 || tw.UserId != 2 || tw.Message != "Holidays! Yay!" {
+			t.Errorf("expected tweet %d of user %d, got %v", 3, 2, tw)
+		}
+
+		err = session.Find(sqlQuery+" where t.id=42", nil).SingleMulti(&u, &tw)
+		if err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows, got: %v", err)
+		}
+
+		var users []*user
+		var tweets []tweet
+		err = session.Find(sqlQuery+" order by t.id", nil).AllMulti(&users, &tweets)
+		if err != nil {
+			t.Fatalf("error on AllMulti: %v", err)
+		}
+		if len(users) != 3 || len(tweets) != 3 {
+			t.Fatalf("expected %d users and tweets, got %d and %d", 3, len(users), len(tweets))
+		}
+		for i, tw := range tweets {
+			if tw.Id != int64(i+1) {
+				t.Errorf("expected tweet %d, got %d", i+1, tw.Id)
+			}
+			if users[i].Id != tw.UserId {
+				t.Errorf("expected user %d for tweet %d, got %d", tw.UserId, tw.Id, users[i].Id)
+			}
+		}
+	}
+}
+
+func TestUnsupportedTypeReturnsError(t *testing.T) {
+	type gadget struct {
+		Id    int64     `dapper:"id,primarykey,table=gadgets"`
+		Parts []float64 `dapper:"parts"`
+	}
+	type gadgetQuery struct {
+		Parts []float64
+	}
+
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+
+	if err := session.Insert(&gadget{Id: 1}); err == nil {
+		t.Errorf("expected error on Insert")
+	}
+	if err := session.Update(&gadget{Id: 1}); err == nil {
+		t.Errorf("expected error on Update")
+	}
+	var users []user
+	err := session.Find("select * from users where karma in (:Parts)", gadgetQuery{}).All(&users)
+	if err == nil {
+		t.Errorf("expected error on Find")
+	}
+}
+
+func TestTimeRoundTripWithLocationAndMilliseconds(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+
+	db.Exec("DROP TABLE IF EXISTS events")
+	_, err := db.Exec("CREATE TABLE events (id integer primary key, created timestamp, closed timestamp null)")
+	if err != nil {
+		t.Fatalf("error creating table events: %v", err)
+	}
+	defer db.Exec("DROP TABLE events")
+
+	type event struct {
+		Id      int64      `dapper:"id,primarykey,table=events"`
+		Created time.Time  `dapper:"created"`
+		Closed  *time.Time `dapper:"closed"`
+	}
+
+	cet := time.FixedZone("CET", 3600)
+	created := time.Date(2013, 1, 24, 18, 14, 15, 123000000, cet)
+	closed := created.Add(1500 * time.Millisecond)
+	if err := session.Insert(&event{Id: 1, Created: created, Closed: &closed}); err != nil {
+		t.Fatalf("error on Insert: %v", err)
+	}
+
+	var e event
+	if err := session.Get(1).Do(&e); err != nil {
+		t.Fatalf("error on Get: %v", err)
+	}
+	if !e.Created.Equal(created) {
+		t.Errorf("expected created %v, got %v", created, e.Created)
+	}
+	if e.Closed == nil || !e.Closed.Equal(closed) {
+		t.Errorf("expected closed %v, got %v", closed, e.Closed)
+	}
+}
+
+func TestSessionUTC(t *testing.T) {
+	cet := time.FixedZone("CET", 3600)
+	created := time.Date(2013, 1, 24, 18, 14, 15, 123000000, cet)
+
+	session := New(nil).Dialect(MySQL).UTC(true)
+	got := session.Q("events").Where().Eq("created", created).Sql()
+	expected := "SELECT * FROM events WHERE created='2013-01-24 17:14:15.123'"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// Other sessions and the package-level dialect are unaffected
+	if MySQL.UTC {
+		t.Errorf("expected MySQL.UTC to be unchanged")
+	}
+	got = New(nil).Dialect(MySQL).Q("events").Where().Eq("created", created).Sql()
+	expected = "SELECT * FROM events WHERE created='2013-01-24 18:14:15.123'"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// The setting survives a change of the dialect
+	session.Dialect(Sqlite3)
+	got = session.Q("events").Where().Eq("created", created).Sql()
+	expected = "SELECT * FROM events WHERE created='2013-01-24 17:14:15.123+00:00'"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// Bound parameters are converted as well
+	_, args, err := session.CacheStatements(1).withArgs(func(b *Session) (string, error) {
+		return b.bind(&created)
+	})
+	if err != nil {
+		t.Fatalf("error on bind: %v", err)
+	}
+	if len(args) != 1 || args[0] != created.UTC() {
+		t.Errorf("expected %v, got %v", created.UTC(), args)
+	}
+}
+
+func TestSnakeCaseNaming(t *testing.T) {
+	tests := []struct {
+		Input, Output string
+	}{
+		{"Id", "id"},
+		{"ID", "id"},
+		{"UserId", "user_id"},
+		{"UserID", "user_id"},
+		{"HTTPServer", "http_server"},
+		{"Address2Line", "address2_line"},
+		{"name", "name"},
+	}
+	for _, test := range tests {
+		if got := SnakeCaseNaming(test.Input); got != test.Output {
+			t.Errorf("%s: expected %v, got %v", test.Input, test.Output, got)
+		}
+	}
+}
+
+func TestSetNamingStrategy(t *testing.T) {
+	type account struct {
+		Id        int64  `dapper:",primarykey,table=accounts"`
+		OwnerName string `dapper:"owner"`
+		CreatedAt time.Time
+	}
+
+	SetNamingStrategy(SnakeCaseNaming)
+	defer SetNamingStrategy(nil)
+
+	ti, err := AddType(reflect.TypeOf(account{}))
+	if err != nil {
+		t.Fatalf("error adding type account: %v", err)
+	}
+	expected := []string{"id", "owner", "created_at"}
+	if !reflect.DeepEqual(ti.ColumnNames, expected) {
+		t.Errorf("expected columns %v, got %v", expected, ti.ColumnNames)
+	}
+
+	// Restoring the default strategy drops the cached type
+	SetNamingStrategy(nil)
+	ti, err = AddType(reflect.TypeOf(account{}))
+	if err != nil {
+		t.Fatalf("error adding type account: %v", err)
+	}
+	expected = []string{"Id", "owner", "CreatedAt"}
+	if !reflect.DeepEqual(ti.ColumnNames, expected) {
+		t.Errorf("expected columns %v, got %v", expected, ti.ColumnNames)
+	}
+}
+
+func TestIncludeWithReplicaSession(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+
+	// The replica only has a single, different item for order 1
+	os.Remove("./" + testDBName + "_replica.db")
+	defer os.Remove("./" + testDBName + "_replica.db")
+	replicaDB, err := sql.Open("sqlite3", "./"+testDBName+"_replica.db")
+	if err != nil {
+		t.Fatalf("error opening replica: %v", err)
+	}
+	defer replicaDB.Close()
+	_, err = replicaDB.Exec("CREATE TABLE order_items (id integer primary key, order_id integer, name varchar(100), price float, qty float)")
+	if err != nil {
+		t.Fatalf("error creating order_items table in replica: %v", err)
+	}
+	_, err = replicaDB.Exec("INSERT INTO order_items (id,order_id,name,price,qty) VALUES (1, 1, 'Replica', 1.0, 1)")
+	if err != nil {
+		t.Fatalf("error inserting into replica: %v", err)
+	}
+	replica := New(replicaDB).Dialect(Sqlite3)
+
+	var out Order
+	err = session.Get(1).Include("Items").IncludeWith(replica).Do(&out)
+	if err != nil {
+		t.Fatalf("error on Get: %v", err)
+	}
+	if len(out.Items) != 1 || out.Items[0].Name != "Replica" {
+		t.Errorf("expected items to be loaded from replica, got %v", out.Items)
+	}
+
+	var single Order
+	err = session.Find("select * from orders where id=1", nil).Include("Items").IncludeWith(replica).Single(&single)
+	if err != nil {
+		t.Fatalf("error on Single: %v", err)
+	}
+	if len(single.Items) != 1 || single.Items[0].Name != "Replica" {
+		t.Errorf("expected items to be loaded from replica, got %v", single.Items)
+	}
+
+	var all []*Order
+	err = session.Find("select * from orders where id in (1,2) order by id", nil).Include("Items").IncludeWith(replica).All(&all)
+	if err != nil {
+		t.Fatalf("error on All: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected 2 orders, got %d", len(all))
+	}
+	if len(all[0].Items) != 1 || all[0].Items[0].Name != "Replica" {
+		t.Errorf("expected items to be loaded from replica, got %v", all[0].Items)
+	}
+	if len(all[1].Items) != 0 {
+		t.Errorf("expected no items for order 2 in replica, got %v", all[1].Items)
+	}
+}
+
+type base struct {
+	Id        int64     `dapper:"id,primarykey"`
+	CreatedAt time.Time `dapper:"created_at"`
+}
+
+type post struct {
+	base
+	Title string `dapper:"title,table=posts"`
+}
+
+type comment struct {
+	base
+	Body string `dapper:"body,table=comments"`
+	// Outer fields win over embedded ones
+	CreatedAt time.Time `dapper:"created"`
+}
+
+func TestEmbeddedStructs(t *testing.T) {
+	pti, err := AddType(reflect.TypeOf(post{}))
+	if err != nil {
+		t.Fatalf("error on AddType: %v", err)
+	}
+	if pti.TableName != "posts" {
+		t.Errorf("expected table %v, got %v", "posts", pti.TableName)
+	}
+	if got := strings.Join(pti.ColumnNames, ","); got != "title,id,created_at" {
+		t.Errorf("expected columns %v, got %v", "title,id,created_at", got)
+	}
+	if pk, found := pti.GetPrimaryKey(); !found || pk.FieldName != "Id" {
+		t.Errorf("expected primary key Id, got %v", pk)
+	}
+
+	cti, err := AddType(reflect.TypeOf(comment{}))
+	if err != nil {
+		t.Fatalf("error on AddType: %v", err)
+	}
+	if got := strings.Join(cti.ColumnNames, ","); got != "body,created,id" {
+		t.Errorf("expected columns %v, got %v", "body,created,id", got)
+	}
+
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP TABLE IF EXISTS posts")
+		_, err := db.Exec("CREATE TABLE posts (id integer primary key, title varchar(100), created_at timestamp null)")
+		if err != nil {
+			t.Fatalf("error creating table posts: %v", err)
+		}
+		defer db.Exec("DROP TABLE posts")
+
+		created := time.Date(2014, 3, 1, 12, 0, 0, 0, time.UTC)
+		p := &post{base: base{Id: 1, CreatedAt: created}, Title: "Hello"}
+		if err := session.Insert(p); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		p.Title = "World"
+		if err := session.Update(p); err != nil {
+			t.Fatalf("error on Update: %v", err)
+		}
+
+		var reload post
+		if err := session.Get(1).Do(&reload); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if reload.Id != 1 || reload.Title != "World" || !reload.CreatedAt.Equal(created) {
+			t.Errorf("expected %v, got %v", p, reload)
+		}
+	}
+}
+
+type counter struct {
+	Id    int64 `dapper:"id,primarykey,table=counters"`
+	Value int32 `dapper:"value"`
+}
+
+func TestAddTypeConcurrently(t *testing.T) {
+	type draft struct {
+		base
+		Title string `dapper:"title,table=drafts"`
+	}
+
+	const n = 8
+	infos := make(chan *typeInfo, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			ti, err := AddType(reflect.TypeOf(draft{}))
+			if err != nil {
+				t.Errorf("error on AddType: %v", err)
+			}
+			infos <- ti
+		}()
+	}
+
+	// Every caller gets the same, complete type information
+	first := <-infos
+	for i := 1; i < n; i++ {
+		if ti := <-infos; ti != first {
+			t.Errorf("expected the same type information for all callers")
+		}
+	}
+	if first == nil {
+		t.Fatalf("expected type information")
+	}
+	if got := strings.Join(first.ColumnNames, ","); got != "title,id,created_at" {
+		t.Errorf("expected columns %v, got %v", "title,id,created_at", got)
+	}
+}
+
+func TestScanOverflowReturnsDescriptiveError(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP TABLE IF EXISTS counters")
+		_, err := db.Exec("CREATE TABLE counters (id integer primary key, value bigint)")
+		if err != nil {
+			t.Fatalf("error creating table counters: %v", err)
+		}
+		defer db.Exec("DROP TABLE counters")
+
+		_, err = db.Exec("INSERT INTO counters (id,value) VALUES (1, 42), (2, 3000000000)")
+		if err != nil {
+			t.Fatalf("error inserting counters: %v", err)
+		}
+
+		var c counter
+		if err := session.Get(1).Do(&c); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if c.Value != 42 {
+			t.Errorf("expected %v, got %v", 42, c.Value)
+		}
+
+		err = session.Get(2).Do(&c)
+		if err == nil {
+			t.Fatalf("expected overflow error, got %v", c.Value)
+		}
+		expected := "dapper: value 3000000000 of column value overflows field Value of type int32"
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain %q, got %q", expected, err.Error())
+		}
+
+		var all []counter
+		err = session.Find("select * from counters order by id", nil).All(&all)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain %q, got %v", expected, err)
+		}
+	}
+}
+
+type hookedUser struct {
+	Id   int64  `dapper:"id,primarykey,autoincrement,table=users"`
+	Name string `dapper:"name"`
+
+	calls       []string `dapper:"-"`
+	insertedId  int64    `dapper:"-"`
+	failOnWrite bool     `dapper:"-"`
+}
+
+func (u *hookedUser) BeforeInsert() error {
+	u.calls = append(u.calls, "BeforeInsert")
+	if u.failOnWrite {
+		return errors.New("before insert failed")
+	}
+	u.Name = strings.TrimSpace(u.Name)
+	return nil
+}
+
+func (u *hookedUser) AfterInsert() error {
+	u.calls = append(u.calls, "AfterInsert")
+	u.insertedId = u.Id
+	return nil
+}
+
+func (u *hookedUser) BeforeUpdate() error {
+	u.calls = append(u.calls, "BeforeUpdate")
+	if u.failOnWrite {
+		return errors.New("before update failed")
+	}
+	return nil
+}
+
+func (u *hookedUser) AfterUpdate() error {
+	u.calls = append(u.calls, "AfterUpdate")
+	return nil
+}
+
+func (u *hookedUser) BeforeDelete() error {
+	u.calls = append(u.calls, "BeforeDelete")
+	return nil
+}
+
+func (u *hookedUser) AfterDelete() error {
+	u.calls = append(u.calls, "AfterDelete")
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		u := &hookedUser{Name: "  George "}
+		if err := session.Insert(u); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		if u.insertedId == 0 || u.insertedId != u.Id {
+			t.Errorf("expected AfterInsert to see id %d, got %d", u.Id, u.insertedId)
+		}
+		if u.Name != "George" {
+			t.Errorf("expected BeforeInsert to set name %q, got %q", "George", u.Name)
+		}
+
+		u.Name = "Paul"
+		if err := session.Update(u); err != nil {
+			t.Fatalf("error on Update: %v", err)
+		}
+		if err := session.Delete(u); err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+		expected := "BeforeInsert,AfterInsert,BeforeUpdate,AfterUpdate,BeforeDelete,AfterDelete"
+		if got := strings.Join(u.calls, ","); got != expected {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestHooksAbortOnError(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var oldCount int64
+		db.QueryRow("select count(*) from users").Scan(&oldCount)
+
+		// Validatable
+		if err := session.Insert(&user{}); err != ErrInvalid {
+			t.Errorf("expected ErrInvalid, got %v", err)
+		}
+
+		// BeforeInsert
+		u := &hookedUser{Name: "George", failOnWrite: true}
+		if err := session.Insert(u); err == nil || err.Error() != "before insert failed" {
+			t.Errorf("expected error from BeforeInsert, got %v", err)
+		}
+		if u.Id != 0 || len(u.calls) != 1 {
+			t.Errorf("expected insert to be aborted, got id %d and calls %v", u.Id, u.calls)
+		}
+
+		var newCount int64
+		db.QueryRow("select count(*) from users").Scan(&newCount)
+		if newCount != oldCount {
+			t.Errorf("expected %d users, got %d", oldCount, newCount)
+		}
+
+		// BeforeUpdate
+		u = &hookedUser{Id: 1, Name: "Changed", failOnWrite: true}
+		if err := session.Update(u); err == nil || err.Error() != "before update failed" {
+			t.Errorf("expected error from BeforeUpdate, got %v", err)
+		}
+		var name string
+		db.QueryRow("select name from users where id=1").Scan(&name)
+		if name != "Oliver" {
+			t.Errorf("expected name %q, got %q", "Oliver", name)
+		}
+	}
+}
+
+func TestInsertAllHooks(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		users := []hookedUser{{Name: " George "}, {Name: " Paul "}}
+		if _, err := session.InsertAll(users); err != nil {
+			t.Fatalf("error on InsertAll: %v", err)
+		}
+		for _, u := range users {
+			if u.Name != strings.TrimSpace(u.Name) {
+				t.Errorf("expected BeforeInsert to trim name, got %q", u.Name)
+			}
+			if expected, got := "BeforeInsert,AfterInsert", strings.Join(u.calls, ","); got != expected {
+				t.Errorf("expected %v, got %v", expected, got)
+			}
+		}
+
+		var oldCount int64
+		db.QueryRow("select count(*) from users").Scan(&oldCount)
+
+		// One invalid entity aborts the whole insert
+		if _, err := session.InsertAll([]*user{{Name: "Ringo"}, {}}); err != ErrInvalid {
+			t.Errorf("expected ErrInvalid, got %v", err)
+		}
+		failing := []*hookedUser{{Name: "John"}, {Name: "Ringo", failOnWrite: true}}
+		if _, err := session.InsertAll(failing); err == nil || err.Error() != "before insert failed" {
+			t.Errorf("expected error from BeforeInsert, got %v", err)
+		}
+
+		var newCount int64
+		db.QueryRow("select count(*) from users").Scan(&newCount)
+		if newCount != oldCount {
+			t.Errorf("expected %d users, got %d", oldCount, newCount)
+		}
+	}
+}
+
+func TestUpsertHooks(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		u := &hookedUser{Id: 1, Name: " Oliver "}
+		if err := session.Upsert(u); err != nil {
+			t.Fatalf("error on Upsert: %v", err)
+		}
+		if u.Name != "Oliver" {
+			t.Errorf("expected BeforeInsert to set name %q, got %q", "Oliver", u.Name)
+		}
+		if expected, got := "BeforeInsert,AfterInsert", strings.Join(u.calls, ","); got != expected {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+
+		u = &hookedUser{Id: 1, Name: "Changed", failOnWrite: true}
+		if err := session.Upsert(u); err == nil || err.Error() != "before insert failed" {
+			t.Errorf("expected error from BeforeInsert, got %v", err)
+		}
+		if err := session.Upsert(&user{Id: 1}); err != ErrInvalid {
+			t.Errorf("expected ErrInvalid, got %v", err)
+		}
+		var name string
+		db.QueryRow("select name from users where id=1").Scan(&name)
+		if name != "Oliver" {
+			t.Errorf("expected name %q, got %q", "Oliver", name)
+		}
+	}
+}
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestSetLogger(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+
+	logger := &recordingLogger{}
+	session.SetLogger(logger).Debug(true)
+
+	var u user
+	if err := session.Get(1).Debug(true).Do(&u); err != nil {
+		t.Fatalf("error on Get: %v", err)
+	}
+	var users []user
+	if err := session.Find("select * from users where id=1", nil).Debug(true).All(&users); err != nil {
+		t.Fatalf("error on All: %v", err)
+	}
+	u.Name = "Olli"
+	if err := session.Update(&u); err != nil {
+		t.Fatalf("error on Update: %v", err)
+	}
+
+	if len(logger.lines) != 3 {
+		t.Fatalf("expected %d lines, got %v", 3, logger.lines)
+	}
+	expected := []string{"SELECT * FROM `users` WHERE `id`=1", "select * from users where id=1", "UPDATE `users`"}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(logger.lines[i], prefix) {
+			t.Errorf("expected line %d to start with %q, got %q", i, prefix, logger.lines[i])
+		}
+	}
+}
+
+func TestParamsByColumn(t *testing.T) {
+	type snakeUser struct {
+		Id        int64 `dapper:",primarykey,table=users"`
+		Name      string
+		Karma     *float64
+		Suspended bool
+	}
+	type byKarma struct {
+		MinKarma float64
+		UserName string
+	}
+
+	SetNamingStrategy(SnakeCaseNaming)
+	defer SetNamingStrategy(nil)
+
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+		session.ParamsByColumn(true)
+
+		// Builder
+		var built []snakeUser
+		sql := session.Q("users").Where().Gte("karma", 10.0).Ne("name", "Sandra").Order().Asc("id").Sql()
+		if err := session.Find(sql, nil).All(&built); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+
+		// Find with params by column name and by field name
+		var found []snakeUser
+		param := byKarma{MinKarma: 10.0, UserName: "Sandra"}
+		err := session.Find("select * from users where karma >= :min_karma and name <> :UserName order by id", param).All(&found)
+		if err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+
+		if len(built) == 0 {
+			t.Fatalf("expected users, got %v", built)
+		}
+		if !reflect.DeepEqual(built, found) {
+			t.Errorf("expected %v, got %v", built, found)
+		}
+	}
+}
+
+func TestLoadAssociations(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		orders := []*Order{{Id: 1}, {Id: 2}}
+		if err := session.LoadAssociations(orders, "Items.Order"); err != nil {
+			t.Fatalf("error on LoadAssociations: %v", err)
+		}
+		if len(orders[0].Items) != 2 {
+			t.Fatalf("expected order 1 to load 2 items, got %d items", len(orders[0].Items))
+		}
+		if len(orders[1].Items) != 2 {
+			t.Fatalf("expected order 2 to load 2 items, got %d items", len(orders[1].Items))
+		}
+		if orders[0].Items[0].Name != "MacBook Air 11\"" {
+			t.Errorf("expected item %q, got %q", "MacBook Air 11\"", orders[0].Items[0].Name)
+		}
+		for _, item := range orders[1].Items {
+			if item.Order == nil || item.Order.Id != 2 {
+				t.Errorf("expected item.Order.Id == %d, got %v", 2, item.Order)
+			}
+		}
+		if orders[0].Extensions != nil {
+			t.Errorf("expected extensions to not be loaded, got %v", orders[0].Extensions)
+		}
+
+		// A slice of structs works, too
+		values := []Order{{Id: 1}}
+		if err := session.LoadAssociations(&values, "Items"); err != nil {
+			t.Fatalf("error on LoadAssociations: %v", err)
+		}
+		if len(values[0].Items) != 2 {
+			t.Errorf("expected order 1 to load 2 items, got %d items", len(values[0].Items))
+		}
+
+		if err := session.LoadAssociations(Order{Id: 1}, "Items"); err == nil {
+			t.Errorf("expected error for a non-slice")
+		}
+	}
+}
+
+func TestMapRowAndMapRows(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var m map[string]interface{}
+		err := session.Find("select id, name, karma from users where id=1", nil).MapRow(&m)
+		if err != nil {
+			t.Fatalf("error on MapRow: %v", err)
+		}
+		if len(m) != 3 {
+			t.Errorf("expected %d columns, got %v", 3, m)
+		}
+		if m["id"] != int64(1) {
+			t.Errorf("expected id %v, got %#v", int64(1), m["id"])
+		}
+		if m["name"] != "Oliver" {
+			t.Errorf("expected name %v, got %#v", "Oliver", m["name"])
+		}
+		if _, ok := m["karma"].(float64); !ok {
+			t.Errorf("expected karma to be a float64, got %#v", m["karma"])
+		}
+
+		err = session.Find("select * from users where id=-1", nil).MapRow(&m)
+		if err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows, got %v", err)
+		}
+
+		var ms []map[string]interface{}
+		err = session.Find("select name, count(*) as n from users group by name order by name", nil).MapRows(&ms)
+		if err != nil {
+			t.Fatalf("error on MapRows: %v", err)
+		}
+		var count int64
+		db.QueryRow("select count(distinct name) from users").Scan(&count)
+		if int64(len(ms)) != count {
+			t.Fatalf("expected %d rows, got %d", count, len(ms))
+		}
+		for _, row := range ms {
+			if _, ok := row["name"].(string); !ok {
+				t.Errorf("expected name to be a string, got %#v", row["name"])
+			}
+			if n, ok := row["n"].(int64); !ok || n < 1 {
+				t.Errorf("expected n to be a positive int64, got %#v", row["n"])
+			}
+		}
+	}
+}
+
+func TestOrderNullsLast(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		if err := session.Insert(&user{Name: "George"}); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+
+		for _, dir := range []string{"ASC", "DESC"} {
+			var users []user
+			sql := session.Q("users").OrderNullsLast("karma", dir).Sql()
+			if err := session.Find(sql, nil).All(&users); err != nil {
+				t.Fatalf("error on All: %v", err)
+			}
+			if len(users) != 3 {
+				t.Fatalf("expected %d users, got %d", 3, len(users))
+			}
+			if users[2].Name != "George" || users[2].Karma != nil {
+				t.Errorf("%s: expected George with NULL karma last, got %v", dir, users)
+			}
+		}
+	}
+}
+
+type plainNullable struct {
+	Id    int64   `dapper:"id,primarykey,table=plain_nullables"`
+	Name  string  `dapper:"name"`
+	Count int     `dapper:"count"`
+	Score float64 `dapper:"score"`
+	Flag  bool    `dapper:"flag"`
+}
+
+func TestScanNullIntoNonPointerFields(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP TABLE IF EXISTS plain_nullables")
+		_, err := db.Exec("CREATE TABLE plain_nullables (id integer primary key, name varchar(100) null, count integer null, score float null, flag boolean null)")
+		if err != nil {
+			t.Fatalf("error creating table plain_nullables: %v", err)
+		}
+		defer db.Exec("DROP TABLE plain_nullables")
+
+		_, err = db.Exec("INSERT INTO plain_nullables (id) VALUES (1)")
+		if err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+		_, err = db.Exec("INSERT INTO plain_nullables (id,name,count,score,flag) VALUES (2, 'Oliver', 42, 1.5, true)")
+		if err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+
+		// Zero values for NULL, even if the struct was filled before
+		p := plainNullable{Name: "before", Count: 1}
+		if err := session.Get(1).Do(&p); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		expected := plainNullable{Id: 1}
+		if p != expected {
+			t.Errorf("expected %v, got %v", expected, p)
+		}
+
+		var all []plainNullable
+		if err := session.Find("select * from plain_nullables order by id", nil).All(&all); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(all) != 2 {
+			t.Fatalf("expected %d rows, got %d", 2, len(all))
+		}
+		if all[0] != expected {
+			t.Errorf("expected %v, got %v", expected, all[0])
+		}
+		expected = plainNullable{Id: 2, Name: "Oliver", Count: 42, Score: 1.5, Flag: true}
+		if all[1] != expected {
+			t.Errorf("expected %v, got %v", expected, all[1])
+		}
+	}
+}
+
+type sqlNullable struct {
+	Id      int64           `dapper:"id,primarykey,table=sql_nullables"`
+	Name    sql.NullString  `dapper:"name"`
+	Count   sql.NullInt64   `dapper:"count"`
+	Score   sql.NullFloat64 `dapper:"score"`
+	Flag    sql.NullBool    `dapper:"flag"`
+	Created sql.NullTime    `dapper:"created"`
+}
+
+func TestSqlNullTypes(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var dateTimeType string
+		switch driver {
+		case "postgres":
+			dateTimeType = "timestamp"
+		default:
+			dateTimeType = "datetime"
+		}
+		db.Exec("DROP TABLE IF EXISTS sql_nullables")
+		_, err := db.Exec("CREATE TABLE sql_nullables (id integer primary key, name varchar(100) null, count integer null, score float null, flag boolean null, created " + dateTimeType + " null)")
+		if err != nil {
+			t.Fatalf("error creating table sql_nullables: %v", err)
+		}
+		defer db.Exec("DROP TABLE sql_nullables")
+
+		created := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+		tests := []sqlNullable{
+			{Id: 1},
+			{
+				Id:      2,
+				Name:    sql.NullString{String: "Oliver", Valid: true},
+				Count:   sql.NullInt64{Int64: 42, Valid: true},
+				Score:   sql.NullFloat64{Float64: 1.5, Valid: true},
+				Flag:    sql.NullBool{Bool: true, Valid: true},
+				Created: sql.NullTime{Time: created, Valid: true},
+			},
+		}
+		for _, in := range tests {
+			if err := session.Insert(&in); err != nil {
+				t.Fatalf("driver %s: error on Insert: %v", driver, err)
+			}
+			out := sqlNullable{Name: sql.NullString{String: "before", Valid: true}}
+			if err := session.Get(in.Id).Do(&out); err != nil {
+				t.Fatalf("driver %s: error on Get: %v", driver, err)
+			}
+			if out.Name != in.Name || out.Count != in.Count || out.Score != in.Score || out.Flag != in.Flag {
+				t.Errorf("driver %s: expected %v, got %v", driver, in, out)
+			}
+			if out.Created.Valid != in.Created.Valid || !out.Created.Time.Equal(in.Created.Time) {
+				t.Errorf("driver %s: expected created %v, got %v", driver, in.Created, out.Created)
+			}
+		}
+
+		// Update back to NULL
+		u := sqlNullable{Id: 2}
+		if err := session.Update(&u); err != nil {
+			t.Fatalf("driver %s: error on Update: %v", driver, err)
+		}
+		var out sqlNullable
+		if err := session.Get(2).Do(&out); err != nil {
+			t.Fatalf("driver %s: error on Get: %v", driver, err)
+		}
+		if out != u {
+			t.Errorf("driver %s: expected %v, got %v", driver, u, out)
+		}
+	}
+}
+
+type reservedOrder struct {
+	Key   int64  `dapper:"key,primarykey,table=order"`
+	Group string `dapper:"group"`
+}
+
+func TestGetEscapesIdentifiers(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		d := session.GetDialect()
+		table, key, group := d.EscapeTableName("order"), d.EscapeColumnName("key"), d.EscapeColumnName("group")
+		db.Exec("DROP TABLE IF EXISTS " + table)
+		_, err := db.Exec("CREATE TABLE " + table + " (" + key + " integer primary key, " + group + " varchar(100))")
+		if err != nil {
+			t.Fatalf("error creating table order: %v", err)
+		}
+		defer db.Exec("DROP TABLE " + table)
+
+		if err := session.Insert(&reservedOrder{Key: 1, Group: "admins"}); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		var o reservedOrder
+		if err := session.Get(1).Do(&o); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if o.Key != 1 || o.Group != "admins" {
+			t.Errorf("expected %v, got %v", reservedOrder{Key: 1, Group: "admins"}, o)
+		}
+	}
+}
+
+func TestInsertReturningAll(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		pkCol := "integer not null primary key AUTOINCREMENT"
+		switch driver {
+		case "mysql", "mymysql":
+			pkCol = "int(11) not null primary key AUTO_INCREMENT"
+		case "postgres":
+			pkCol = "serial not null primary key"
+		}
+		db.Exec("DROP TABLE IF EXISTS defaulted_users")
+		_, err := db.Exec("CREATE TABLE defaulted_users (id " + pkCol + ", name varchar(100) not null, status varchar(20) not null default 'active', suspended bool not null default true)")
+		if err != nil {
+			t.Fatalf("error creating table defaulted_users: %v", err)
+		}
+		defer db.Exec("DROP TABLE defaulted_users")
+
+		u := &defaultedUser{Name: "George"}
+		if err := session.InsertReturningAll(u); err != nil {
+			t.Fatalf("error on InsertReturningAll: %v", err)
+		}
+		if u.Id <= 0 {
+			t.Errorf("expected Id > 0, got %d", u.Id)
+		}
+		if u.Status != "active" {
+			t.Errorf("expected %v, got %v", "active", u.Status)
+		}
+		if !u.Suspended {
+			t.Errorf("expected %v, got %v", true, u.Suspended)
+		}
+	}
+}
+
+func TestMaxSQLLength(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		session.MaxSQLLength(40)
+
+		var u user
+		err := session.Find("select * from users where id=1", nil).Single(&u)
+		if err != nil {
+			t.Fatalf("expected no error on short statement, got %v", err)
+		}
+
+		var users []user
+		err = session.Find("select * from users where id in (1,2,3,4,5,6,7,8,9,10)", nil).All(&users)
+		if err != ErrSQLTooLong {
+			t.Errorf("expected %v, got %v", ErrSQLTooLong, err)
+		}
+
+		err = session.Insert(&user{Name: "A name long enough to exceed the limit"})
+		if err != ErrSQLTooLong {
+			t.Errorf("expected %v, got %v", ErrSQLTooLong, err)
+		}
+
+		_, err = session.Exec("update users set name='Oliver' where id=1 and 1=1")
+		if err != ErrSQLTooLong {
+			t.Errorf("expected %v, got %v", ErrSQLTooLong, err)
+		}
+	}
+}
+
+func TestRewriteSQL(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var executed []string
+		session.RewriteSQL(func(sql string) string {
+			sql = "/* request_id=42 */ " + sql
+			executed = append(executed, sql)
+			return sql
+		})
+
+		var u user
+		if err := session.Get(1).Do(&u); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if u.Name != "Oliver" {
+			t.Errorf("expected %v, got %v", "Oliver", u.Name)
+		}
+		var users []user
+		if err := session.Find("select * from users where id=1", nil).All(&users); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if _, err := session.Exec("update users set name='Oliver' where id=1"); err != nil {
+			t.Fatalf("error on Exec: %v", err)
+		}
+		if err := session.Update(&u); err != nil {
+			t.Fatalf("error on Update: %v", err)
+		}
+
+		if len(executed) != 4 {
+			t.Fatalf("expected %d statements, got %v", 4, executed)
+		}
+		for _, sql := range executed {
+			if !strings.HasPrefix(sql, "/* request_id=42 */ ") {
+				t.Errorf("expected statement to start with comment, got %q", sql)
+			}
+		}
+
+		// Statements are rewritten once and logged as rewritten
+		logger := &recordingLogger{}
+		session.SetLogger(logger).Debug(true)
+		if _, err := session.InsertAll([]*user{{Name: "George"}, {Name: "Paul"}}); err != nil {
+			t.Fatalf("error on InsertAll: %v", err)
+		}
+		session.Debug(false)
+		if len(executed) != 5 {
+			t.Fatalf("expected %d statements, got %v", 5, executed)
+		}
+		if n := strings.Count(executed[4], "request_id=42"); n != 1 {
+			t.Errorf("expected statement to be rewritten once, got %q", executed[4])
+		}
+		if len(logger.lines) != 1 || logger.lines[0] != executed[4] {
+			t.Errorf("expected log %q, got %v", executed[4], logger.lines)
+		}
+
+		// Removing the rewriter leaves statements untouched
+		session.RewriteSQL(nil)
+		if err := session.Get(1).Do(&u); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if len(executed) != 5 {
+			t.Errorf("expected %d statements, got %v", 5, executed)
+		}
+	}
+}
+
+func TestCacheStatements(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var executed []string
+		session.CacheStatements(2).RewriteSQL(func(sql string) string {
+			executed = append(executed, sql)
+			return sql
+		})
+		defer session.Close()
+
+		// Inserts of the same type share one statement
+		for _, name := range []string{"George", "Paul", "Ringo"} {
+			k := float64(len(name))
+			if err := session.Insert(&user{Name: name, Karma: &k}); err != nil {
+				t.Fatalf("driver %s: error on Insert: %v", driver, err)
+			}
+		}
+		if executed[0] != executed[1] || executed[1] != executed[2] {
+			t.Errorf("driver %s: expected the same statement, got %v", driver, executed)
+		}
+		if strings.Contains(executed[0], "George") {
+			t.Errorf("driver %s: expected bound parameters, got %q", driver, executed[0])
+		}
+		size, hits, misses := session.StmtCacheStats()
+		if size != 1 || hits != 2 || misses != 1 {
+			t.Errorf("driver %s: expected size %d, %d hits, and %d misses, got %d, %d, and %d",
+				driver, 1, 2, 1, size, hits, misses)
+		}
+
+		var u user
+		if err := session.Find("select * from users where name='Paul'", nil).Single(&u); err != nil {
+			t.Fatalf("driver %s: error on Single: %v", driver, err)
+		}
+		if u.Karma == nil || *u.Karma != 4 {
+			t.Errorf("driver %s: expected karma %v, got %v", driver, 4, u.Karma)
+		}
+
+		// Update and Delete, also in a transaction
+		u.Suspended = true
+		if err := session.Update(&u); err != nil {
+			t.Fatalf("driver %s: error on Update: %v", driver, err)
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("driver %s: error on Begin: %v", driver, err)
+		}
+		if err := session.DeleteTx(tx, &u); err != nil {
+			tx.Rollback()
+			t.Fatalf("driver %s: error on DeleteTx: %v", driver, err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("driver %s: error on Commit: %v", driver, err)
+		}
+		count, err := session.Count("select count(*) from users where name='Paul'", nil)
+		if err != nil {
+			t.Fatalf("driver %s: error on Count: %v", driver, err)
+		}
+		if count != 0 {
+			t.Errorf("driver %s: expected count %d, got %d", driver, 0, count)
+		}
+
+		// The least recently used statement, the insert, is evicted
+		if n := session.stmts.len(); n != 2 {
+			t.Errorf("driver %s: expected %d cached statements, got %d", driver, 2, n)
+		}
+		session.ClearStmtCache()
+		size, hits, misses = session.StmtCacheStats()
+		if size != 0 || hits != 2 || misses != 3 {
+			t.Errorf("driver %s: expected size %d, %d hits, and %d misses, got %d, %d, and %d",
+				driver, 0, 2, 3, size, hits, misses)
+		}
+
+		// Inserting again prepares the statement again
+		if err := session.Insert(&user{Name: "John"}); err != nil {
+			t.Fatalf("driver %s: error on Insert: %v", driver, err)
+		}
+		if size, _, misses = session.StmtCacheStats(); size != 1 || misses != 4 {
+			t.Errorf("driver %s: expected size %d and %d misses, got %d and %d", driver, 1, 4, size, misses)
+		}
+		if err := session.Close(); err != nil {
+			t.Fatalf("driver %s: error on Close: %v", driver, err)
+		}
+		if n := session.stmts.len(); n != 0 {
+			t.Errorf("driver %s: expected %d cached statements, got %d", driver, 0, n)
+		}
+	}
+}
+
+func TestCacheStatementsOfSessionCopies(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		session.CacheStatements(2)
+		defer session.Close()
+		if err := session.Insert(&user{Name: "George"}); err != nil {
+			t.Fatalf("driver %s: error on Insert: %v", driver, err)
+		}
+
+		// Copies share the cache, but closing them doesn't release it
+		c := session.Unscoped()
+		if err := c.Insert(&user{Name: "Paul"}); err != nil {
+			t.Fatalf("driver %s: error on Insert: %v", driver, err)
+		}
+		if size, hits, _ := session.StmtCacheStats(); size != 1 || hits != 1 {
+			t.Errorf("driver %s: expected size %d and %d hits, got %d and %d", driver, 1, 1, size, hits)
+		}
+		for i := 0; i < 2; i++ {
+			if err := c.Close(); err != nil {
+				t.Fatalf("driver %s: error on Close: %v", driver, err)
+			}
+		}
+		if size, _, _ := session.StmtCacheStats(); size != 1 {
+			t.Errorf("driver %s: expected size %d, got %d", driver, 1, size)
+		}
+
+		// A copy can have a cache of its own
+		c.CacheStatements(1)
+		if size, _, _ := session.StmtCacheStats(); size != 1 {
+			t.Errorf("driver %s: expected size %d, got %d", driver, 1, size)
+		}
+		if size, hits, misses := c.StmtCacheStats(); size != 0 || hits != 0 || misses != 0 {
+			t.Errorf("driver %s: expected an empty cache, got size %d, %d hits, and %d misses", driver, size, hits, misses)
+		}
+		c.CacheStatements(0)
+		if size, _, _ := session.StmtCacheStats(); size != 1 {
+			t.Errorf("driver %s: expected size %d, got %d", driver, 1, size)
+		}
+		if err := session.Insert(&user{Name: "Ringo"}); err != nil {
+			t.Fatalf("driver %s: error on Insert: %v", driver, err)
+		}
+	}
+}
+
+func TestRelated(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var order Order
+		if err := session.Get(1).Do(&order); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if order.Items != nil {
+			t.Fatalf("expected items to not be loaded, got %v", order.Items)
+		}
+
+		var items []*OrderItem
+		if err := session.Related(&order, "Items").All(&items); err != nil {
+			t.Fatalf("error on Related: %v", err)
+		}
+		if len(items) != 2 {
+			t.Fatalf("expected 2 items, got %d", len(items))
+		}
+		for _, item := range items {
+			if item.OrderId != 1 {
+				t.Errorf("expected OrderId %d, got %d", 1, item.OrderId)
+			}
+		}
+
+		// 1:1 associations are loaded via the foreign key
+		var parent Order
+		if err := session.Related(items[0], "Order").Single(&parent); err != nil {
+			t.Fatalf("error on Related: %v", err)
+		}
+		if parent.Id != 1 {
+			t.Errorf("expected Id %d, got %d", 1, parent.Id)
+		}
+
+		err := session.Related(&order, "Unknown").All(&items)
+		if err == nil {
+			t.Errorf("expected error for unknown association")
+		}
+	}
+}
+
+type keywordRow struct {
+	Id    int64  `dapper:"id,primarykey,autoincrement,table=select"`
+	Group string `dapper:"group"`
+	Order int64  `dapper:"order by"`
+}
+
+func TestCRUDEscapesIdentifiers(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		pkCol := "integer not null primary key AUTOINCREMENT"
+		switch driver {
+		case "mysql", "mymysql":
+			pkCol = "int(11) not null primary key AUTO_INCREMENT"
+		case "postgres":
+			pkCol = "serial not null primary key"
+		}
+		d := session.GetDialect()
+		table := d.EscapeTableName("select")
+		db.Exec("DROP TABLE IF EXISTS " + table)
+		_, err := db.Exec("CREATE TABLE " + table + " (id " + pkCol + ", " +
+			d.EscapeColumnName("group") + " varchar(100), " +
+			d.EscapeColumnName("order by") + " int)")
+		if err != nil {
+			t.Fatalf("error creating table select: %v", err)
+		}
+		defer db.Exec("DROP TABLE " + table)
+
+		row := &keywordRow{Group: "admins", Order: 1}
+		if err := session.Insert(row); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		row.Group = "users"
+		row.Order = 2
+		if err := session.Update(row); err != nil {
+			t.Fatalf("error on Update: %v", err)
+		}
+		var got keywordRow
+		if err := session.Get(row.Id).Do(&got); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if got != *row {
+			t.Errorf("expected %v, got %v", *row, got)
+		}
+		if err := session.Delete(row); err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+		if err := session.Get(row.Id).Do(&got); err != sql.ErrNoRows {
+			t.Errorf("expected %v, got %v", sql.ErrNoRows, err)
+		}
+	}
+}
+
+type bigUser struct {
+	Id    int64    `dapper:"id,primarykey,autoincrement,table=users"`
+	Name  string   `dapper:"name"`
+	Karma *big.Rat `dapper:"karma"`
+}
+
+func TestBigRatRoundTrip(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		u := &bigUser{Name: "Rat", Karma: big.NewRat(933, 100)}
+		if err := session.Insert(u); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		var got bigUser
+		if err := session.Get(u.Id).Do(&got); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if got.Karma == nil || got.Karma.Cmp(big.NewRat(933, 100)) != 0 {
+			t.Errorf("expected %v, got %v", big.NewRat(933, 100), got.Karma)
+		}
+
+		// NULL scans into nil
+		u = &bigUser{Name: "Nil"}
+		if err := session.Insert(u); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		got = bigUser{Karma: big.NewRat(1, 1)}
+		if err := session.Get(u.Id).Do(&got); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if got.Karma != nil {
+			t.Errorf("expected nil, got %v", got.Karma)
+		}
+	}
+}
+
+func TestQuerySqlWithArgsExecutes(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+
+	sql, args := session.Q("users").Where().Eq("name", "Oliver' OR '1'='1").Query().SqlWithArgs()
+	rows, err := db.Query(sql, args...)
+	if err != nil {
+		t.Fatalf("error on Query: %v", err)
+	}
+	defer rows.Close()
+	if rows.Next() {
+		t.Errorf("expected no rows for injected name")
+	}
+
+	sql, args = session.Q("users").Project("id").Where().Eq("name", "Oliver").Query().SqlWithArgs()
+	var id int64
+	if err := db.QueryRow(sql, args...).Scan(&id); err != nil {
+		t.Fatalf("error on QueryRow: %v", err)
+	}
+	if id != 1 {
+		t.Errorf("expected %v, got %v", 1, id)
+	}
+}
+
+func TestScalarWithoutTable(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+
+	var n int64
+	err := session.Find(session.Q("").Project(SafeSqlString("1 + 1")).Sql(), nil).Scalar(&n)
+	if err != nil {
+		t.Fatalf("error on Scalar: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected %v, got %v", 2, n)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		q := session.Q("users").Where().Eq("name", "Oliver").
+			Union(session.Q("users").Where().Eq("name", "Sandra").Query()).
+			UnionAll(session.Q("users").Where().Eq("name", "Sandra").Query()).
+			Order().Asc("name")
+		var users []user
+		if err := session.Find(q.Sql(), nil).All(&users); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		names := make([]string, len(users))
+		for i, u := range users {
+			names[i] = u.Name
+		}
+		expected := []string{"Oliver", "Sandra", "Sandra"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("expected %v, got %v", expected, names)
+		}
+	}
+}
+
+type orderWithBadItems struct {
+	Id    int64     `dapper:"id,primarykey,autoincrement,table=orders"`
+	Items OrderItem `dapper:"oneToMany=OrderId"`
+}
+
+type itemWithBadOrder struct {
+	Id      int64 `dapper:"id,primarykey,autoincrement,table=order_items"`
+	OrderId int64 `dapper:"order_id"`
+	Order   Order `dapper:"oneToOne=OrderId"`
+}
+
+func TestMisdeclaredAssociations(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	defer db.Close()
+
+	var order orderWithBadItems
+	err := session.Get(1).Include("Items").Do(&order)
+	if !errors.Is(err, ErrOneToManyNotSlice) {
+		t.Errorf("expected %v, got %v", ErrOneToManyNotSlice, err)
+	}
+	var orders []*orderWithBadItems
+	err = session.Find("select * from orders where id in (1,2)", nil).Include("Items").All(&orders)
+	if !errors.Is(err, ErrOneToManyNotSlice) {
+		t.Errorf("expected %v, got %v", ErrOneToManyNotSlice, err)
+	}
+	if err != nil && !strings.Contains(err.Error(), "Items") {
+		t.Errorf("expected field name in error, got %v", err)
+	}
+
+	var item itemWithBadOrder
+	err = session.Find("select * from order_items where order_id=1", nil).Include("Order").Single(&item)
+	if !errors.Is(err, ErrOneToOneNotPointer) {
+		t.Errorf("expected %v, got %v", ErrOneToOneNotPointer, err)
+	}
+	var items []itemWithBadOrder
+	err = session.Find("select * from order_items where order_id=1", nil).Include("Order").All(&items)
+	if !errors.Is(err, ErrOneToOneNotPointer) {
+		t.Errorf("expected %v, got %v", ErrOneToOneNotPointer, err)
+	}
+	if err != nil && !strings.Contains(err.Error(), "Order") {
+		t.Errorf("expected field name in error, got %v", err)
+	}
+}
+
+func TestAggregates(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		type byOrder struct {
+			OrderId int64 `dapper:"order_id"`
+		}
+
+		tests := []struct {
+			Fn       func(string, interface{}) (float64, error)
+			Sql      string
+			OrderId  int64
+			Expected float64
+		}{
+			{session.Sum, "select sum(price) from order_items where order_id=:OrderId", 1, 1699.80},
+			{session.Sum, "select sum(price) from order_items where order_id=:OrderId", 2, 1699.80},
+			{session.Sum, "select sum(price*qty) from order_items where order_id=:OrderId", 2, 5497.90},
+			{session.Avg, "select avg(price) from order_items where order_id=:OrderId", 1, 849.90},
+			{session.Min, "select min(price) from order_items where order_id=:OrderId", 2, 199.90},
+			{session.Max, "select max(price) from order_items where order_id=:OrderId", 2, 1499.90},
+			// NULL aggregate
+			{session.Sum, "select sum(price) from order_items where order_id=:OrderId", 42, 0},
+			// No rows
+			{session.Max, "select max(price) from order_items where order_id=:OrderId group by order_id", 42, 0},
+		}
+		for _, test := range tests {
+			got, err := test.Fn(test.Sql, byOrder{OrderId: test.OrderId})
+			if err != nil {
+				t.Fatalf("error on %s: %v", test.Sql, err)
+			}
+			if math.Abs(got-test.Expected) > 0.001 {
+				t.Errorf("%s with order %d: expected %v, got %v", test.Sql, test.OrderId, test.Expected, got)
+			}
+		}
+
+		// Grouped by order, the first group is order 1
+		got, err := session.Sum("select sum(price) from order_items where order_id in (1,2) group by order_id order by order_id", nil)
+		if err != nil {
+			t.Fatalf("error on Sum: %v", err)
+		}
+		if math.Abs(got-1699.80) > 0.001 {
+			t.Errorf("expected %v, got %v", 1699.80, got)
+		}
+	}
+}
+
+func TestIncludeTop(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		sessions := []*Session{session}
+		if driver == "sqlite3" {
+			// Without window functions, there's a query per order
+			sessions = append(sessions, New(db).Dialect(MySQL))
+		}
+		for _, session := range sessions {
+			var orders []*Order
+			err := session.Find("select * from orders where id in (1,2) order by id", nil).
+				IncludeTop("Items", 1, "price DESC").
+				All(&orders)
+			if err != nil {
+				t.Fatalf("%v: error on All: %v", session.GetDialect(), err)
+			}
+			if len(orders) != 2 {
+				t.Fatalf("%v: expected 2 orders, got %d", session.GetDialect(), len(orders))
+			}
+			expected := []string{"MacBook Air 11\"", "Lenovo T430s"}
+			for i, order := range orders {
+				if len(order.Items) != 1 {
+					t.Fatalf("%v: expected 1 item for order %d, got %d", session.GetDialect(), order.Id, len(order.Items))
+				}
+				if order.Items[0].Name != expected[i] {
+					t.Errorf("%v: expected %v, got %v", session.GetDialect(), expected[i], order.Items[0].Name)
+				}
+			}
+
+			// Top 2 by the cheapest price
+			var order Order
+			if err := session.Get(2).IncludeTop("Items", 2, "price ASC").Do(&order); err != nil {
+				t.Fatalf("%v: error on Get: %v", session.GetDialect(), err)
+			}
+			if len(order.Items) != 2 || order.Items[0].Name != "BlackBox" {
+				t.Errorf("%v: expected BlackBox first, got %v", session.GetDialect(), order.Items)
+			}
+		}
+	}
+}
+
+type topPost struct {
+	Id       int64         `dapper:"id,primarykey,table=top_posts"`
+	Comments []*topComment `dapper:"oneToMany=PostId"`
+}
+
+type topComment struct {
+	Id        int64      `dapper:"id,primarykey,table=top_comments"`
+	PostId    int64      `dapper:"post_id"`
+	DeletedAt *time.Time `dapper:"deleted_at,softdelete"`
+}
+
+func TestIncludeTopSkipsSoftDeleted(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		db.Exec("DROP TABLE IF EXISTS top_posts")
+		db.Exec("DROP TABLE IF EXISTS top_comments")
+		if _, err := db.Exec("CREATE TABLE top_posts (id integer primary key)"); err != nil {
+			t.Fatalf("error creating table top_posts: %v", err)
+		}
+		defer db.Exec("DROP TABLE top_posts")
+		if _, err := db.Exec("CREATE TABLE top_comments (id integer primary key, post_id integer, deleted_at timestamp null)"); err != nil {
+			t.Fatalf("error creating table top_comments: %v", err)
+		}
+		defer db.Exec("DROP TABLE top_comments")
+
+		if err := session.Insert(&topPost{Id: 1}); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		for id := int64(1); id <= 3; id++ {
+			if err := session.Insert(&topComment{Id: id, PostId: 1}); err != nil {
+				t.Fatalf("error on Insert: %v", err)
+			}
+		}
+		if err := session.Delete(&topComment{Id: 1, PostId: 1}); err != nil {
+			t.Fatalf("error on Delete: %v", err)
+		}
+
+		sessions := []*Session{session}
+		if driver == "sqlite3" {
+			// Without window functions, there's a query per post
+			sessions = append(sessions, New(db).Dialect(MySQL))
+		}
+		for _, session := range sessions {
+			// The deleted comment must not take one of the two places
+			var post topPost
+			if err := session.Get(1).IncludeTop("Comments", 2, "id ASC").Do(&post); err != nil {
+				t.Fatalf("%v: error on Get: %v", session.GetDialect(), err)
+			}
+			if len(post.Comments) != 2 || post.Comments[0].Id != 2 || post.Comments[1].Id != 3 {
+				t.Errorf("%v: expected comments 2 and 3, got %v", session.GetDialect(), post.Comments)
+			}
+
+			var posts []*topPost
+			if err := session.Find("select * from top_posts", nil).IncludeTop("Comments", 2, "id ASC").All(&posts); err != nil {
+				t.Fatalf("%v: error on All: %v", session.GetDialect(), err)
+			}
+			if len(posts) != 1 {
+				t.Fatalf("%v: expected %d post, got %d", session.GetDialect(), 1, len(posts))
+			}
+			if c := posts[0].Comments; len(c) != 2 || c[0].Id != 2 || c[1].Id != 3 {
+				t.Errorf("%v: expected comments 2 and 3, got %v", session.GetDialect(), c)
+			}
+		}
+	}
+}
+
+func TestLoadByIdsSkipsEmptyIds(t *testing.T) {
+	db, session := setupWithSession("sqlite3", t)
+	// Any query against a closed database fails
+	db.Close()
+
+	sliceType := reflect.TypeOf([]*OrderItem{})
+	resultsv, err := session.loadByIds(db, make(identityMap), "orders", "order_items", "order_id", []interface{}{}, nil, sliceType)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resultsv.Elem().Len() != 0 {
+		t.Errorf("expected %d results, got %d", 0, resultsv.Elem().Len())
+	}
+
+	resultsv, err = session.loadTopByIds(db, make(identityMap), "orders", "order_items", "order_id", []interface{}{}, nil, sliceType, topN{n: 1, orderBy: "id"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resultsv.Elem().Len() != 0 {
+		t.Errorf("expected %d results, got %d", 0, resultsv.Elem().Len())
+	}
+}
+
+func TestFindBy(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
+
+		var users []user
+		if err := session.FindBy(user{Name: "Oliver"}).All(&users); err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(users) != 1 {
+			t.Fatalf("expected %d users, got %d", 1, len(users))
+		}
+		if users[0].Id != 1 {
+			t.Errorf("expected user.Id == %d, got %d", 1, users[0].Id)
+		}
+
+		// Set and unset fields mixed
+		var u user
+		if err := session.FindBy(&user{Name: "Sandra", Suspended: true}).Single(&u); err != nil {
+			t.Fatalf("error on Single: %v", err)
+		}
+		if u.Name != "Sandra" {
+			t.Errorf("expected user.Name == %s, got %s", "Sandra", u.Name)
+		}
+		if !u.Suspended {
+			t.Errorf("expected user.Suspended == %v, got %v", true, u.Suspended)
+		}
+
+		karma := 42.13
+		err := session.FindBy(user{Name: "Oliver", Karma: &karma, Suspended: true}).Single(&u)
+		if err != sql.ErrNoRows {
+			t.Errorf("expected %v, got %v", sql.ErrNoRows, err)
+		}
+	}
+}
+
+func TestFindBySql(t *testing.T) {
+	session := New(nil).Dialect(Sqlite3)
+
+	zero := 0.0
+	got, err := session.findBySql(user{Name: "Oliver", Karma: &zero})
+	if err != nil {
+		t.Fatalf("error on findBySql: %v", err)
+	}
+	expected := "SELECT * FROM `users` WHERE `name`='Oliver' AND `karma`=0"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	got, err = session.findBySql(user{})
+	if err != nil {
+		t.Fatalf("error on findBySql: %v", err)
+	}
+	expected = "SELECT * FROM `users`"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if _, err := session.findBySql(userWithoutTableNameTag{Name: "Oliver"}); err != ErrNoTableName {
+		t.Errorf("expected %v, got %v", ErrNoTableName, err)
+	}
+}
+
+func TestGenerateBulkSql(t *testing.T) {
+	session := New(nil)
+
+	ti, err := AddType(reflect.TypeOf(user{}))
+	if err != nil {
+		t.Fatalf("error adding type user: %v", err)
+	}
+	where := Q(Sqlite3, "users").Where().Eq("`suspended`", true)
+
+	got, err := session.generateDeleteWhereSql(ti, where, time.Now())
+	if err != nil {
+		t.Fatalf("error on generateDeleteWhereSql: %v", err)
+	}
+	expected := "DELETE FROM `users` WHERE (`suspended`=1)"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	got, err = session.generateUpdateWhereSql(ti, map[string]interface{}{"Suspended": false, "name": "Anonymous"}, where)
+	if err != nil {
+		t.Fatalf("error on generateUpdateWhereSql: %v", err)
+	}
+	expected = "UPDATE `users` SET `suspended`=0, `name`='Anonymous' WHERE (`suspended`=1)"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if _, err := session.generateUpdateWhereSql(ti, map[string]interface{}{"id": 1}, where); err == nil {
+		t.Errorf("expected error when updating the primary key")
+	}
+	if _, err := session.generateDeleteWhereSql(ti, nil, time.Now()); err == nil {
+		t.Errorf("expected error without condition")
+	}
 
-		u.Name = "Olli"
+	// Soft delete
+	ti, err = AddType(reflect.TypeOf(note{}))
+	if err != nil {
+		t.Fatalf("error adding type note: %v", err)
+	}
+	now, _ := time.Parse("2006-01-02 15:04:05", "2013-01-24 18:14:15")
+	got, err = session.generateDeleteWhereSql(ti, Q(Sqlite3, "notes").Where().Eq("`title`", "Remove"), now)
+	if err != nil {
+		t.Fatalf("error on generateDeleteWhereSql: %v", err)
+	}
+	expected = "UPDATE `notes` SET `deleted_at`='2013-01-24 18:14:15' WHERE (`title`='Remove') AND `deleted_at` IS NULL"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	got, err = session.generateDeleteWhereSql(ti, Q(Sqlite3, "notes").Where().Raw("`title`='a' OR `title`='b'"), now)
+	if err != nil {
+		t.Fatalf("error on generateDeleteWhereSql: %v", err)
+	}
+	expected = "UPDATE `notes` SET `deleted_at`='2013-01-24 18:14:15' WHERE ((`title`='a' OR `title`='b')) AND `deleted_at` IS NULL"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
 
-		err = session.Update(u)
-		if err != ErrNoPrimaryKey {
-			t.Fatalf("expected dapper.ErrNoPrimaryKey, got: %v", err)
-		}
+	// Scope
+	scoped := session.Scope("user_id", 1)
+	ti, err = AddType(reflect.TypeOf(tweet{}))
+	if err != nil {
+		t.Fatalf("error adding type tweet: %v", err)
+	}
+	where = Q(Sqlite3, "tweets").Where().Raw("`id`=1 OR `id`=3")
+	got, err = scoped.generateUpdateWhereSql(ti, map[string]interface{}{"message": "Hi"}, where)
+	if err != nil {
+		t.Fatalf("error on generateUpdateWhereSql: %v", err)
+	}
+	expected = "UPDATE `tweets` SET `message`='Hi' WHERE ((`id`=1 OR `id`=3)) AND `user_id`=1"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
 	}
 }
 
-func TestUpdateTx(t *testing.T) {
+func TestDeleteWhere(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		// Count users
-		var oldCount int64
-		row := db.QueryRow("select count(*) from users")
-		row.Scan(&oldCount)
-
-		// Retrieve user
-		var u user
-		err := session.Find("select * from users where id=1", nil).Single(&u)
-		if err != nil {
-			t.Fatalf("error on find single: %v", err)
+		var suspended int64
+		if err := session.Find("select count(*) from users where suspended=1", nil).Scalar(&suspended); err != nil {
+			t.Fatalf("error on Scalar: %v", err)
 		}
-
-		// Change user
-		u.Name = "Olli"
-
-		// Start transaction
-		tx, err := db.Begin()
-		if err != nil {
-			t.Fatalf("error on db.Begin(): %v", err)
+		if suspended == 0 {
+			t.Fatalf("expected suspended users")
 		}
 
-		// Update user
-		err = session.UpdateTx(tx, u)
+		n, err := session.DeleteWhere(user{}, session.Q("users").Where().Eq("suspended", true))
 		if err != nil {
-			t.Fatalf("error on UpdateTx: %v", err)
+			t.Fatalf("error on DeleteWhere: %v", err)
 		}
-
-		// Commit
-		err = tx.Commit()
-		if err != nil {
-			t.Fatalf("error on db.Commit(): %v", err)
+		if n != suspended {
+			t.Errorf("expected %d affected rows, got %d", suspended, n)
 		}
 
-		// Reload user
-		var u2 user
-		session.Find("select * from users where id=1", nil).Single(&u2)
-		if u2.Name != u.Name {
-			t.Errorf("expected user name to be %s, got %s", u.Name, u2.Name)
+		var left int64
+		if err := session.Find("select count(*) from users where suspended=1", nil).Scalar(&left); err != nil {
+			t.Fatalf("error on Scalar: %v", err)
 		}
-
-		// Check count again
-		var newCount int64
-		row = db.QueryRow("select count(*) from users")
-		row.Scan(&newCount)
-
-		if newCount != oldCount {
-			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		if left != 0 {
+			t.Errorf("expected %d suspended users, got %d", 0, left)
+		}
+		var u user
+		if err := session.Get(1).Do(&u); err != nil {
+			t.Errorf("expected user %d to be kept, got %v", 1, err)
 		}
 	}
 }
 
-func TestUpdateTxRollback(t *testing.T) {
+func TestUpdateWhere(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		// Count users
-		var oldCount int64
-		row := db.QueryRow("select count(*) from users")
-		row.Scan(&oldCount)
-
-		// Retrieve user
-		var u user
-		err := session.Find("select * from users where id=1", nil).Single(&u)
+		n, err := session.UpdateWhere(user{}, map[string]interface{}{"Suspended": false}, session.Q("users").Where().Eq("suspended", true))
 		if err != nil {
-			t.Fatalf("error on find single: %v", err)
+			t.Fatalf("error on UpdateWhere: %v", err)
 		}
-
-		// Start transaction
-		tx, err := db.Begin()
-		if err != nil {
-			t.Fatalf("error on db.Begin(): %v", err)
+		if n == 0 {
+			t.Errorf("expected affected rows, got %d", n)
 		}
 
-		// Change user
-		u.Name = "Olli"
-
-		// Update user
-		err = session.UpdateTx(tx, u)
-		if err != nil {
-			t.Fatalf("error on UpdateTx: %v", err)
+		var left int64
+		if err := session.Find("select count(*) from users where suspended=1", nil).Scalar(&left); err != nil {
+			t.Fatalf("error on Scalar: %v", err)
 		}
-
-		// Rollback transaction
-		err = tx.Rollback()
-		if err != nil {
-			t.Fatalf("error on Rollback: %v", err)
+		if left != 0 {
+			t.Errorf("expected %d suspended users, got %d", 0, left)
 		}
+	}
+}
 
-		// Reload user
-		var u2 user
-		session.Find("select * from users where id=1", nil).Single(&u2)
-		if u2.Name == u.Name {
-			t.Errorf("expected user name to be %s, got %s", u.Name, u2.Name)
-		}
+func TestCreateMigrationTable(t *testing.T) {
+	for _, driver := range drivers {
+		db, session := setupWithSession(driver, t)
+		defer db.Close()
 
-		// Check count again
-		var newCount int64
-		row = db.QueryRow("select count(*) from users")
-		row.Scan(&newCount)
+		const tableName = "dapper_migrations_test"
+		db.Exec("DROP TABLE IF EXISTS " + tableName)
+		if _, err := db.Exec(session.dialect.GetCreateMigrationTableSQL(tableName)); err != nil {
+			t.Fatalf("%s: error creating migration table: %v", driver, err)
+		}
+		defer db.Exec("DROP TABLE " + tableName)
 
-		if newCount != oldCount {
-			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		if _, err := db.Exec(session.dialect.InsertMigrationTableVersionSQL(tableName), 1); err != nil {
+			t.Fatalf("%s: error inserting migration version: %v", driver, err)
 		}
 	}
 }
 
-// ---- Delete --------------------------------------------------------------
+type category struct {
+	Id       int64       `dapper:"id,primarykey,autoincrement,table=categories"`
+	ParentId *int64      `dapper:"parent_id"`
+	Name     string      `dapper:"name"`
+	Parent   *category   `dapper:"oneToOne=ParentId"`
+	Children []*category `dapper:"oneToMany=ParentId"`
+}
 
-func TestDelete(t *testing.T) {
+func TestSelfReferencingAssociations(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		// Count users
-		var oldCount int64
-		row := db.QueryRow("select count(*) from users")
-		row.Scan(&oldCount)
-
-		// Retrieve user
-		var u user
-		err := session.Find("select * from users where id=1", nil).Single(&u)
+		var pkCol string
+		switch driver {
+		case "sqlite3":
+			pkCol = "integer not null primary key AUTOINCREMENT"
+		case "mysql", "mymysql":
+			pkCol = "int(11) not null primary key AUTO_INCREMENT"
+		case "postgres":
+			pkCol = "serial not null primary key"
+		}
+		db.Exec("DROP TABLE IF EXISTS categories")
+		_, err := db.Exec("CREATE TABLE categories (id " + pkCol + ", parent_id int null, name varchar(100))")
 		if err != nil {
-			t.Fatalf("error on find single: %v", err)
+			t.Fatalf("error creating table categories: %v", err)
 		}
+		defer db.Exec("DROP TABLE categories")
 
-		// Delete user
-		err = session.Delete(u)
-		if err != nil {
-			t.Fatalf("error on Delete: %v", err)
+		root := &category{Name: "Root"}
+		if err := session.Insert(root); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		child := &category{Name: "Child", ParentId: &root.Id}
+		if err := session.Insert(child); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		grandchild := &category{Name: "Grandchild", ParentId: &child.Id}
+		if err := session.Insert(grandchild); err != nil {
+			t.Fatalf("error on Insert: %v", err)
 		}
 
-		// Check count
-		var newCount int64
-		row = db.QueryRow("select count(*) from users")
-		row.Scan(&newCount)
+		var executed []string
+		session.RewriteSQL(func(sql string) string {
+			executed = append(executed, sql)
+			return sql
+		})
 
-		if newCount != oldCount-1 {
-			t.Errorf("expected users count to be %d, got %d", oldCount-1, newCount)
+		var c category
+		if err := session.Get(grandchild.Id).Alias("c").Include("Parent.Parent", "Children").Do(&c); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		d := session.GetDialect()
+		if len(executed) == 0 || !strings.Contains(executed[0], " c WHERE c."+d.EscapeColumnName("id")+"=") {
+			t.Errorf("expected Get to select from the aliased table, got %v", executed)
+		}
+		for _, sql := range executed[1:] {
+			if !strings.Contains(sql, " "+childTableAlias+" WHERE "+childTableAlias+".") {
+				t.Errorf("expected self-referencing association to alias the table, got %q", sql)
+			}
+		}
+		if c.Parent == nil || c.Parent.Name != "Child" {
+			t.Fatalf("expected parent %q, got %v", "Child", c.Parent)
+		}
+		if c.Parent.Parent == nil || c.Parent.Parent.Name != "Root" {
+			t.Fatalf("expected grandparent %q, got %v", "Root", c.Parent.Parent)
+		}
+		if len(c.Children) != 0 {
+			t.Errorf("expected %d children, got %d", 0, len(c.Children))
+		}
+
+		var roots []*category
+		err = session.Find("select * from categories where parent_id is null", nil).Include("Children.Children").All(&roots)
+		if err != nil {
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(roots) != 1 {
+			t.Fatalf("expected %d roots, got %d", 1, len(roots))
+		}
+		if len(roots[0].Children) != 1 || roots[0].Children[0].Name != "Child" {
+			t.Fatalf("expected child %q, got %v", "Child", roots[0].Children)
+		}
+		if len(roots[0].Children[0].Children) != 1 || roots[0].Children[0].Children[0].Name != "Grandchild" {
+			t.Errorf("expected grandchild %q, got %v", "Grandchild", roots[0].Children[0].Children)
 		}
 	}
 }
 
-func TestDeleteWithPtrType(t *testing.T) {
+func TestIncludeMissingOneToOne(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		// Count users
-		var oldCount int64
-		row := db.QueryRow("select count(*) from users")
-		row.Scan(&oldCount)
-
-		// Retrieve user
-		var u user
-		err := session.Find("select * from users where id=1", nil).Single(&u)
+		var pkCol string
+		switch driver {
+		case "sqlite3":
+			pkCol = "integer not null primary key AUTOINCREMENT"
+		case "mysql", "mymysql":
+			pkCol = "int(11) not null primary key AUTO_INCREMENT"
+		case "postgres":
+			pkCol = "serial not null primary key"
+		}
+		db.Exec("DROP TABLE IF EXISTS categories")
+		_, err := db.Exec("CREATE TABLE categories (id " + pkCol + ", parent_id int null, name varchar(100))")
 		if err != nil {
-			t.Fatalf("error on find single: %v", err)
+			t.Fatalf("error creating table categories: %v", err)
 		}
+		defer db.Exec("DROP TABLE categories")
 
-		// Delete user
-		err = session.Delete(&u)
-		if err != nil {
+		parent := &category{Name: "Deleted"}
+		if err := session.Insert(parent); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		orphan := &category{Name: "Orphan", ParentId: &parent.Id}
+		if err := session.Insert(orphan); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		root := &category{Name: "Root"}
+		if err := session.Insert(root); err != nil {
+			t.Fatalf("error on Insert: %v", err)
+		}
+		if err := session.Delete(parent); err != nil {
 			t.Fatalf("error on Delete: %v", err)
 		}
 
-		// Check count
-		var newCount int64
-		row = db.QueryRow("select count(*) from users")
-		row.Scan(&newCount)
+		var c category
+		if err := session.Get(orphan.Id).Include("Parent").Do(&c); err != nil {
+			t.Fatalf("expected no error on Get, got %v", err)
+		}
+		if c.Parent != nil {
+			t.Errorf("expected no parent, got %v", c.Parent)
+		}
 
-		if newCount != oldCount-1 {
-			t.Errorf("expected users count to be %d, got %d", oldCount-1, newCount)
+		var categories []*category
+		err = session.Find("select * from categories order by id", nil).Include("Parent").All(&categories)
+		if err != nil {
+			t.Fatalf("expected no error on All, got %v", err)
+		}
+		if len(categories) != 2 {
+			t.Fatalf("expected %d categories, got %d", 2, len(categories))
+		}
+		for _, c := range categories {
+			if c.Parent != nil {
+				t.Errorf("expected no parent of %s, got %v", c.Name, c.Parent)
+			}
 		}
 	}
 }
 
-func TestDeleteTx(t *testing.T) {
+func TestFinderSelect(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		// Count users
-		var oldCount int64
-		row := db.QueryRow("select count(*) from users")
-		row.Scan(&oldCount)
-
-		// Retrieve user
 		var u user
-		err := session.Find("select * from users where id=1", nil).Single(&u)
+		err := session.Find("select * from users where id=:Id", user{Id: 1}).Select("id", "name").Single(&u)
 		if err != nil {
-			t.Fatalf("error on find single: %v", err)
+			t.Fatalf("error on Single: %v", err)
 		}
-
-		// Get a transaction
-		tx, err := db.Begin()
-		if err != nil {
-			t.Fatalf("error on db.Begin(): %v", err)
+		if u.Id != 1 {
+			t.Errorf("expected user.Id == %d, got %d", 1, u.Id)
 		}
-
-		// Delete user
-		err = session.DeleteTx(tx, u)
-		if err != nil {
-			t.Fatalf("error on Delete: %v", err)
+		if u.Name != "Oliver" {
+			t.Errorf("expected user.Name == %s, got %s", "Oliver", u.Name)
+		}
+		if u.Karma != nil {
+			t.Errorf("expected user.Karma == nil, got %v", *u.Karma)
 		}
 
-		// Commit
-		err = tx.Commit()
+		var users []user
+		err = session.FindBy(user{Name: "Sandra"}).Select("name").All(&users)
 		if err != nil {
-			t.Fatalf("error on db.Commit(): %v", err)
+			t.Fatalf("error on All: %v", err)
+		}
+		if len(users) != 1 {
+			t.Fatalf("expected %d users, got %d", 1, len(users))
+		}
+		if users[0].Name != "Sandra" || users[0].Id != 0 || users[0].Suspended {
+			t.Errorf("expected only the name to be set, got %+v", users[0])
 		}
 
-		// Check count
-		var newCount int64
-		row = db.QueryRow("select count(*) from users")
-		row.Scan(&newCount)
-
-		if newCount != oldCount-1 {
-			t.Errorf("expected users count to be %d, got %d", oldCount-1, newCount)
+		err = session.Find("select * from users", nil).Select("id", "nickname").All(&users)
+		if err == nil {
+			t.Errorf("expected error for unknown column")
+		}
+		err = session.Find("select id from users", nil).Select("name").All(&users)
+		if err == nil {
+			t.Errorf("expected error for query without SELECT *")
 		}
 	}
 }
 
-func TestDeleteTxRollback(t *testing.T) {
+type jsonDocument struct {
+	Id   int64                  `dapper:"id,primarykey,autoincrement,table=json_documents"`
+	Name string                 `dapper:"name"`
+	Meta map[string]interface{} `dapper:"meta,json"`
+}
+
+func TestJSONColumn(t *testing.T) {
 	for _, driver := range drivers {
 		db, session := setupWithSession(driver, t)
 		defer db.Close()
 
-		// Count users
-		var oldCount int64
-		row := db.QueryRow("select count(*) from users")
-		row.Scan(&oldCount)
-
-		// Retrieve user
-		var u user
-		err := session.Find("select * from users where id=1", nil).Single(&u)
+		var pkCol string
+		switch driver {
+		case "sqlite3":
+			pkCol = "integer not null primary key AUTOINCREMENT"
+		case "mysql", "mymysql":
+			pkCol = "int(11) not null primary key AUTO_INCREMENT"
+		case "postgres":
+			pkCol = "serial not null primary key"
+		}
+		db.Exec("DROP TABLE IF EXISTS json_documents")
+		_, err := db.Exec("CREATE TABLE json_documents (id " + pkCol + ", name varchar(100), meta text null)")
 		if err != nil {
-			t.Fatalf("error on find single: %v", err)
+			t.Fatalf("error creating table json_documents: %v", err)
 		}
+		defer db.Exec("DROP TABLE json_documents")
 
-		// Get a transaction
-		tx, err := db.Begin()
-		if err != nil {
-			t.Fatalf("error on db.Begin(): %v", err)
+		in := &jsonDocument{
+			Name: "Oliver",
+			Meta: map[string]interface{}{
+				"tags":  []interface{}{"go", "sql"},
+				"karma": 42.5,
+				"quote": "it's",
+			},
 		}
-
-		// Delete user
-		err = session.DeleteTx(tx, u)
-		if err != nil {
-			t.Fatalf("error on Delete: %v", err)
+		if err := session.Insert(in); err != nil {
+			t.Fatalf("error on Insert: %v", err)
 		}
 
-		// Rollback
-		err = tx.Rollback()
-		if err != nil {
-			t.Fatalf("error on db.Rollback(): %v", err)
+		var out jsonDocument
+		if err := session.Get(in.Id).Do(&out); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if !reflect.DeepEqual(in.Meta, out.Meta) {
+			t.Errorf("expected %v, got %v", in.Meta, out.Meta)
 		}
 
-		// Check count
-		var newCount int64
-		row = db.QueryRow("select count(*) from users")
-		row.Scan(&newCount)
+		// Changes within the map are detected by UpdateChanged
+		if err := session.Track(&out); err != nil {
+			t.Fatalf("error on Track: %v", err)
+		}
+		out.Meta["karma"] = 57.0
+		if err := session.UpdateChanged(&out); err != nil {
+			t.Fatalf("error on UpdateChanged: %v", err)
+		}
+		var updated jsonDocument
+		if err := session.Get(in.Id).Do(&updated); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if updated.Meta["karma"] != 57.0 {
+			t.Errorf("expected karma %v, got %v", 57.0, updated.Meta["karma"])
+		}
 
-		if newCount != oldCount {
-			t.Errorf("expected users count to be %d, got %d", oldCount, newCount)
+		// A nil map is stored as NULL
+		updated.Meta = nil
+		if err := session.Update(&updated); err != nil {
+			t.Fatalf("error on Update: %v", err)
+		}
+		var isNull bool
+		if err := session.Find("select meta is null from json_documents", nil).Scalar(&isNull); err != nil {
+			t.Fatalf("error on Scalar: %v", err)
+		}
+		if !isNull {
+			t.Errorf("expected meta to be NULL")
+		}
+		if err := session.Get(in.Id).Do(&out); err != nil {
+			t.Fatalf("error on Get: %v", err)
+		}
+		if out.Meta != nil {
+			t.Errorf("expected nil map, got %v", out.Meta)
 		}
 	}
 }
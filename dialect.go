@@ -2,13 +2,22 @@ package dapper
 
 import (
 	"bytes"
+	"database/sql"
+	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
+	"strings"
+	"time"
 )
 
 const MaxInt = int(^uint(0) >> 1)
 
 // Dialect represents SQL engine specific information.
+//
+// Further capabilities are optional: a dialect implements the interfaces
+// below, e.g. UpsertDialect, to support them, and gets a fallback
+// otherwise. All built-in dialects implement all of them.
 type Dialect interface {
 	QuoteString(string) string
 	EscapeTableName(string) string
@@ -19,6 +28,96 @@ type Dialect interface {
 	InsertMigrationTableVersionSQL(string) string
 }
 
+// BytesDialect is implemented by dialects with their own literal for
+// binary values. Others write them as X'<hex>'.
+type BytesDialect interface {
+	QuoteBytes([]byte) string
+}
+
+// TimeDialect is implemented by dialects with their own literal for
+// times. Others write them as '2006-01-02 15:04:05'.
+type TimeDialect interface {
+	QuoteTime(time.Time) string
+}
+
+// WindowFunctionDialect is implemented by dialects that can report
+// whether they support window functions like ROW_NUMBER(), e.g. for
+// IncludeTop. Others are assumed not to support them.
+type WindowFunctionDialect interface {
+	SupportsWindowFunctions() bool
+}
+
+// FirstInsertIdDialect is implemented by dialects that can derive the
+// id of the first row of a multi-row INSERT from LastInsertId, e.g. for
+// InsertAll. Others leave the generated ids unset.
+type FirstInsertIdDialect interface {
+	GetFirstInsertId(lastInsertId int64, rows int) (int64, bool)
+}
+
+// UpsertDialect is implemented by dialects that support Upsert. The
+// values must be quoted already. Upsert fails for other dialects.
+type UpsertDialect interface {
+	GetUpsertSQL(tableName string, columns, values []string, pkColumn string, updates []string) (string, error)
+}
+
+// RandomDialect is implemented by dialects with their own function for
+// random order. Others use RANDOM().
+type RandomDialect interface {
+	GetRandomFunctionSQL() string
+}
+
+// NullsOrderDialect is implemented by dialects with their own syntax to
+// sort NULL values last or first. Others use NULLS LAST and NULLS FIRST
+// of standard SQL.
+type NullsOrderDialect interface {
+	GetOrderNullsLastSQL(column, dir string) string
+	GetOrderNullsFirstSQL(column, dir string) string
+}
+
+// PlaceholderDialect is implemented by dialects with numbered bind
+// parameters, e.g. $1 in PostgreSQL. Others use ?.
+type PlaceholderDialect interface {
+	GetPlaceholder(n int) string
+}
+
+// CompoundDialect is implemented by dialects with their own way to embed
+// a query into a UNION. Others wrap it in parentheses.
+type CompoundDialect interface {
+	GetCompoundMemberSQL(query string) string
+}
+
+// MigrationTableExistsDialect is implemented by dialects with their own
+// query for the existence of the migrations table. Others look it up in
+// information_schema.tables.
+type MigrationTableExistsDialect interface {
+	GetMigrationTableExistsSQL(string) string
+}
+
+// ReturningIntoDialect is implemented by dialects that don't support
+// LastInsertId and return generated ids with RETURNING ... INTO an output
+// parameter instead of a result row, e.g. Oracle. The output parameter
+// is the n-th placeholder of the statement, following the bound values.
+type ReturningIntoDialect interface {
+	GetReturningIntoSQL(column string, n int) string
+}
+
+// ExistsDialect is implemented by dialects that don't support SELECT
+// without FROM, e.g. Oracle, to wrap query into an existence check that
+// returns 1 or 0 (see Query.ExistsSql).
+type ExistsDialect interface {
+	GetExistsSQL(query string) string
+}
+
+// UTCDialect is implemented by dialects that can convert times to UTC
+// before writing them, e.g. for columns without timezone. WithUTC returns
+// a copy of the dialect, so a session can use its own setting (see
+// Session.UTC) without changing e.g. the package-level MySQL dialect.
+// Dialects embedding a built-in dialect need their own WithUTC, as the
+// embedded one returns a copy of the built-in dialect only.
+type UTCDialect interface {
+	WithUTC(utc bool) Dialect
+}
+
 var (
 	reBackslash   = regexp.MustCompile(`(\\)`)
 	reSingleQuote = regexp.MustCompile("'")
@@ -26,29 +125,64 @@ var (
 
 // -- MySQL --
 
-type MySQLDialect struct{}
+// MySQLDialect writes times for DATETIME(6) columns, i.e. with
+// microseconds but without timezone. Set UTC to convert times to UTC
+// first; otherwise they are written in their own location.
+type MySQLDialect struct {
+	UTC bool
+}
 
 func (mysql *MySQLDialect) String() string {
 	return "MySQLDialect"
 }
 
+// WithUTC returns a copy of the dialect with UTC set to utc.
+func (mysql *MySQLDialect) WithUTC(utc bool) Dialect {
+	c := *mysql
+	c.UTC = utc
+	return &c
+}
+
 func (mysql *MySQLDialect) QuoteString(s string) string {
 	q := reBackslash.ReplaceAllString(s, "\\\\")
 	return reSingleQuote.ReplaceAllString(q, "\\'")
 }
 
+func (mysql *MySQLDialect) QuoteBytes(b []byte) string {
+	return fmt.Sprintf("X'%x'", b)
+}
+
+func (mysql *MySQLDialect) QuoteTime(t time.Time) string {
+	return quoteTime(mysql, t, mysql.UTC, "2006-01-02 15:04:05.999999")
+}
+
 func (mysql *MySQLDialect) EscapeTableName(tableName string) string {
-	return fmt.Sprintf("`%s`", tableName)
+	return escapeIdentifier(tableName, "`")
 }
 
 func (mysql *MySQLDialect) EscapeColumnName(columnName string) string {
-	return fmt.Sprintf("`%s`", columnName)
+	return escapeIdentifier(columnName, "`")
 }
 
 func (mysql *MySQLDialect) SupportsLastInsertId() bool {
 	return true
 }
 
+// GetFirstInsertId returns lastInsertId, as MySQL reports the id of the
+// first row of a multi-row INSERT. The ids of the other rows follow
+// consecutively only with innodb_autoinc_lock_mode 0 or 1 and an
+// auto_increment_increment of 1; otherwise the ids derived from it
+// are wrong.
+func (mysql *MySQLDialect) GetFirstInsertId(lastInsertId int64, rows int) (int64, bool) {
+	return lastInsertId, true
+}
+
+// SupportsWindowFunctions returns false, as window functions require
+// MySQL 8.0 or later.
+func (mysql *MySQLDialect) SupportsWindowFunctions() bool {
+	return false
+}
+
 func (mysql *MySQLDialect) GetLimitString(query string, skip, take int) string {
 	if take < 0 && skip < 0 {
 		return query
@@ -68,6 +202,47 @@ func (mysql *MySQLDialect) GetLimitString(query string, skip, take int) string {
 	return b.String()
 }
 
+func (mysql *MySQLDialect) GetUpsertSQL(tableName string, columns, values []string, pkColumn string, updates []string) (string, error) {
+	insertSQL, err := upsertInsertSQL(mysql, tableName, columns, values)
+	if err != nil {
+		return "", err
+	}
+	pairs := make([]string, 0, len(updates))
+	for _, column := range upsertUpdates(pkColumn, updates) {
+		c := mysql.EscapeColumnName(column)
+		pairs = append(pairs, fmt.Sprintf("%s=VALUES(%s)", c, c))
+	}
+	if len(pairs) == 0 {
+		c := mysql.EscapeColumnName(pkColumn)
+		pairs = append(pairs, fmt.Sprintf("%s=%s", c, c))
+	}
+	return insertSQL + " ON DUPLICATE KEY UPDATE " + strings.Join(pairs, ", "), nil
+}
+
+func (mysql *MySQLDialect) GetRandomFunctionSQL() string {
+	return "RAND()"
+}
+
+// GetOrderNullsLastSQL emulates NULLS LAST, which MySQL lacks, by
+// ordering by "column IS NULL" first.
+func (mysql *MySQLDialect) GetOrderNullsLastSQL(column, dir string) string {
+	return fmt.Sprintf("%s IS NULL,%s %s", column, column, dir)
+}
+
+// GetOrderNullsFirstSQL emulates NULLS FIRST, which MySQL lacks, by
+// ordering by "column IS NOT NULL" first.
+func (mysql *MySQLDialect) GetOrderNullsFirstSQL(column, dir string) string {
+	return fmt.Sprintf("%s IS NOT NULL,%s %s", column, column, dir)
+}
+
+func (mysql *MySQLDialect) GetPlaceholder(n int) string {
+	return "?"
+}
+
+func (mysql *MySQLDialect) GetCompoundMemberSQL(query string) string {
+	return "(" + query + ")"
+}
+
 func (mysql *MySQLDialect) GetCreateMigrationTableSQL(tableName string) string {
 	return `
 CREATE TABLE IF NOT EXISTS ` + mysql.EscapeTableName(tableName) + ` (
@@ -76,6 +251,11 @@ CREATE TABLE IF NOT EXISTS ` + mysql.EscapeTableName(tableName) + ` (
 )`
 }
 
+func (mysql *MySQLDialect) GetMigrationTableExistsSQL(tableName string) string {
+	return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=DATABASE() AND table_name='" +
+		mysql.QuoteString(tableName) + "'"
+}
+
 func (mysql *MySQLDialect) InsertMigrationTableVersionSQL(tableName string) string {
 	return `
 INSERT INTO ` + mysql.EscapeTableName(tableName) + ` (version,created) VALUES (?, NOW())
@@ -85,29 +265,62 @@ INSERT INTO ` + mysql.EscapeTableName(tableName) + ` (version,created) VALUES (?
 
 // -- Sqlite3 --
 
-type Sqlite3Dialect struct{}
+// Sqlite3Dialect writes times with nanoseconds and timezone offset.
+// Set UTC to convert times to UTC first.
+type Sqlite3Dialect struct {
+	UTC bool
+}
 
 func (sqlite3 *Sqlite3Dialect) String() string {
 	return "Sqlite3Dialect"
 }
 
+// WithUTC returns a copy of the dialect with UTC set to utc.
+func (sqlite3 *Sqlite3Dialect) WithUTC(utc bool) Dialect {
+	c := *sqlite3
+	c.UTC = utc
+	return &c
+}
+
 func (sqlite3 *Sqlite3Dialect) QuoteString(s string) string {
 	q := reBackslash.ReplaceAllString(s, "\\\\")
 	return reSingleQuote.ReplaceAllString(q, "''")
 }
 
+func (sqlite3 *Sqlite3Dialect) QuoteBytes(b []byte) string {
+	return fmt.Sprintf("X'%x'", b)
+}
+
+func (sqlite3 *Sqlite3Dialect) QuoteTime(t time.Time) string {
+	return quoteTime(sqlite3, t, sqlite3.UTC, "2006-01-02 15:04:05.999999999-07:00")
+}
+
 func (sqlite3 *Sqlite3Dialect) EscapeTableName(tableName string) string {
-	return fmt.Sprintf("`%s`", tableName)
+	return escapeIdentifier(tableName, "`")
 }
 
 func (sqlite3 *Sqlite3Dialect) EscapeColumnName(columnName string) string {
-	return fmt.Sprintf("`%s`", columnName)
+	return escapeIdentifier(columnName, "`")
 }
 
 func (sqlite3 *Sqlite3Dialect) SupportsLastInsertId() bool {
 	return true
 }
 
+// GetFirstInsertId derives the id of the first row from lastInsertId,
+// as Sqlite3 reports the id of the last row of a multi-row INSERT. The
+// rows of a single statement get consecutive ids, as there is only one
+// writer at a time.
+func (sqlite3 *Sqlite3Dialect) GetFirstInsertId(lastInsertId int64, rows int) (int64, bool) {
+	return lastInsertId - int64(rows) + 1, true
+}
+
+// SupportsWindowFunctions returns true, as window functions are
+// supported as of Sqlite 3.25.
+func (sqlite3 *Sqlite3Dialect) SupportsWindowFunctions() bool {
+	return true
+}
+
 func (sqlite3 *Sqlite3Dialect) GetLimitString(query string, skip, take int) string {
 	if take < 0 && skip < 0 {
 		return query
@@ -127,6 +340,36 @@ func (sqlite3 *Sqlite3Dialect) GetLimitString(query string, skip, take int) stri
 	return b.String()
 }
 
+func (sqlite3 *Sqlite3Dialect) GetUpsertSQL(tableName string, columns, values []string, pkColumn string, updates []string) (string, error) {
+	return onConflictUpsertSQL(sqlite3, tableName, columns, values, pkColumn, updates)
+}
+
+func (sqlite3 *Sqlite3Dialect) GetRandomFunctionSQL() string {
+	return "RANDOM()"
+}
+
+// GetOrderNullsLastSQL emulates NULLS LAST, as it is only supported
+// as of Sqlite 3.30.
+func (sqlite3 *Sqlite3Dialect) GetOrderNullsLastSQL(column, dir string) string {
+	return fmt.Sprintf("%s IS NULL,%s %s", column, column, dir)
+}
+
+// GetOrderNullsFirstSQL emulates NULLS FIRST, as it is only supported
+// as of Sqlite 3.30.
+func (sqlite3 *Sqlite3Dialect) GetOrderNullsFirstSQL(column, dir string) string {
+	return fmt.Sprintf("%s IS NOT NULL,%s %s", column, column, dir)
+}
+
+func (sqlite3 *Sqlite3Dialect) GetPlaceholder(n int) string {
+	return "?"
+}
+
+// GetCompoundMemberSQL selects from a subquery, as Sqlite3 doesn't
+// allow parentheses around the members of a UNION.
+func (sqlite3 *Sqlite3Dialect) GetCompoundMemberSQL(query string) string {
+	return "SELECT * FROM (" + query + ")"
+}
+
 func (sqlite3 *Sqlite3Dialect) GetCreateMigrationTableSQL(tableName string) string {
 	return `
 CREATE TABLE IF NOT EXISTS ` + sqlite3.EscapeTableName(tableName) + ` (
@@ -135,6 +378,11 @@ CREATE TABLE IF NOT EXISTS ` + sqlite3.EscapeTableName(tableName) + ` (
 )`
 }
 
+func (sqlite3 *Sqlite3Dialect) GetMigrationTableExistsSQL(tableName string) string {
+	return "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='" +
+		sqlite3.QuoteString(tableName) + "'"
+}
+
 func (sqlite3 *Sqlite3Dialect) InsertMigrationTableVersionSQL(tableName string) string {
 	return `
 INSERT OR IGNORE INTO ` + sqlite3.EscapeTableName(tableName) + ` (version,created) VALUES (?, date('now'))
@@ -143,29 +391,59 @@ INSERT OR IGNORE INTO ` + sqlite3.EscapeTableName(tableName) + ` (version,create
 
 // -- PostgreSQL --
 
-type PostgreSQLDialect struct{}
+// PostgreSQLDialect writes times with microseconds and timezone offset,
+// as expected by TIMESTAMP WITH TIME ZONE columns. Set UTC to convert
+// times to UTC first, e.g. for TIMESTAMP WITHOUT TIME ZONE columns.
+type PostgreSQLDialect struct {
+	UTC bool
+}
 
 func (psql *PostgreSQLDialect) String() string {
 	return "PostgreSQLDialect"
 }
 
+// WithUTC returns a copy of the dialect with UTC set to utc.
+func (psql *PostgreSQLDialect) WithUTC(utc bool) Dialect {
+	c := *psql
+	c.UTC = utc
+	return &c
+}
+
 func (psql *PostgreSQLDialect) QuoteString(s string) string {
 	q := reBackslash.ReplaceAllString(s, "\\\\")
 	return reSingleQuote.ReplaceAllString(q, "\\'")
 }
 
+func (psql *PostgreSQLDialect) QuoteBytes(b []byte) string {
+	return fmt.Sprintf("'\\x%x'", b)
+}
+
+func (psql *PostgreSQLDialect) QuoteTime(t time.Time) string {
+	return quoteTime(psql, t, psql.UTC, "2006-01-02 15:04:05.999999-07:00")
+}
+
 func (psql *PostgreSQLDialect) EscapeTableName(tableName string) string {
-	return fmt.Sprintf(`"%s"`, tableName)
+	return escapeIdentifier(tableName, `"`)
 }
 
 func (psql *PostgreSQLDialect) EscapeColumnName(columnName string) string {
-	return fmt.Sprintf(`"%s"`, columnName)
+	return escapeIdentifier(columnName, `"`)
 }
 
 func (psql *PostgreSQLDialect) SupportsLastInsertId() bool {
 	return false
 }
 
+// GetFirstInsertId returns false, as generated ids are returned with
+// RETURNING instead of LastInsertId.
+func (psql *PostgreSQLDialect) GetFirstInsertId(lastInsertId int64, rows int) (int64, bool) {
+	return 0, false
+}
+
+func (psql *PostgreSQLDialect) SupportsWindowFunctions() bool {
+	return true
+}
+
 func (psql *PostgreSQLDialect) GetLimitString(query string, skip, take int) string {
 	if take < 0 && skip < 0 {
 		return query
@@ -181,20 +459,396 @@ func (psql *PostgreSQLDialect) GetLimitString(query string, skip, take int) stri
 	return b.String()
 }
 
+func (psql *PostgreSQLDialect) GetUpsertSQL(tableName string, columns, values []string, pkColumn string, updates []string) (string, error) {
+	return onConflictUpsertSQL(psql, tableName, columns, values, pkColumn, updates)
+}
+
+func (psql *PostgreSQLDialect) GetRandomFunctionSQL() string {
+	return "RANDOM()"
+}
+
+func (psql *PostgreSQLDialect) GetOrderNullsLastSQL(column, dir string) string {
+	return fmt.Sprintf("%s %s NULLS LAST", column, dir)
+}
+
+func (psql *PostgreSQLDialect) GetOrderNullsFirstSQL(column, dir string) string {
+	return fmt.Sprintf("%s %s NULLS FIRST", column, dir)
+}
+
+func (psql *PostgreSQLDialect) GetPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (psql *PostgreSQLDialect) GetCompoundMemberSQL(query string) string {
+	return "(" + query + ")"
+}
+
 func (psql *PostgreSQLDialect) GetCreateMigrationTableSQL(tableName string) string {
 	return `
 CREATE TABLE IF NOT EXISTS ` + psql.EscapeTableName(tableName) + ` (
   version integer not null primary key,
-  created datetime not null
+  created timestamp not null
 )`
 }
 
+func (psql *PostgreSQLDialect) GetMigrationTableExistsSQL(tableName string) string {
+	return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=current_schema() AND table_name='" +
+		psql.QuoteString(tableName) + "'"
+}
+
 func (psql *PostgreSQLDialect) InsertMigrationTableVersionSQL(tableName string) string {
 	return `
 INSERT INTO ` + psql.EscapeTableName(tableName) + ` (version,created) VALUES ($1, CURRENT_TIMESTAMP)
 `
 }
 
+// -- Oracle --
+
+// OracleDialect writes SQL for Oracle 12c and later, e.g. OFFSET and FETCH
+// for limits. Times are written as TIMESTAMP literals with nanoseconds and
+// timezone offset. Set UTC to convert times to UTC first.
+//
+// Oracle has no LastInsertId, so generated ids are returned with
+// RETURNING ... INTO an output parameter (see sql.Out), which must be
+// supported by the driver. InsertAll does not support autoincrement
+// columns for Oracle.
+type OracleDialect struct {
+	UTC bool
+}
+
+func (oracle *OracleDialect) String() string {
+	return "OracleDialect"
+}
+
+// WithUTC returns a copy of the dialect with UTC set to utc.
+func (oracle *OracleDialect) WithUTC(utc bool) Dialect {
+	c := *oracle
+	c.UTC = utc
+	return &c
+}
+
+// QuoteString doubles single quotes. Backslashes have no special meaning
+// in Oracle string literals.
+func (oracle *OracleDialect) QuoteString(s string) string {
+	return reSingleQuote.ReplaceAllString(s, "''")
+}
+
+// QuoteBytes writes bytes as a hex string, which Oracle converts to RAW
+// and BLOB implicitly.
+func (oracle *OracleDialect) QuoteBytes(b []byte) string {
+	return fmt.Sprintf("'%x'", b)
+}
+
+func (oracle *OracleDialect) QuoteTime(t time.Time) string {
+	return "TIMESTAMP " + quoteTime(oracle, t, oracle.UTC, "2006-01-02 15:04:05.999999999 -07:00")
+}
+
+func (oracle *OracleDialect) EscapeTableName(tableName string) string {
+	return escapeIdentifier(tableName, `"`)
+}
+
+func (oracle *OracleDialect) EscapeColumnName(columnName string) string {
+	return escapeIdentifier(columnName, `"`)
+}
+
+func (oracle *OracleDialect) SupportsLastInsertId() bool {
+	return false
+}
+
+// GetFirstInsertId returns false, as generated ids are returned with
+// RETURNING ... INTO instead of LastInsertId.
+func (oracle *OracleDialect) GetFirstInsertId(lastInsertId int64, rows int) (int64, bool) {
+	return 0, false
+}
+
+func (oracle *OracleDialect) SupportsWindowFunctions() bool {
+	return true
+}
+
+// GetReturningIntoSQL returns the clause to return the generated value of
+// column into the n-th placeholder of an INSERT statement.
+func (oracle *OracleDialect) GetReturningIntoSQL(column string, n int) string {
+	return fmt.Sprintf(" RETURNING %s INTO %s", oracle.EscapeColumnName(column), oracle.GetPlaceholder(n))
+}
+
+// GetExistsSQL returns query wrapped into an existence check, which
+// needs a FROM clause in Oracle.
+func (oracle *OracleDialect) GetExistsSQL(query string) string {
+	return fmt.Sprintf("SELECT CASE WHEN EXISTS(%s) THEN 1 ELSE 0 END FROM DUAL", query)
+}
+
+func (oracle *OracleDialect) GetLimitString(query string, skip, take int) string {
+	if take < 0 && skip < 0 {
+		return query
+	}
+	var b bytes.Buffer
+	b.WriteString(query)
+	if skip > 0 {
+		b.WriteString(fmt.Sprintf(" OFFSET %d ROWS", skip))
+	}
+	if take > 0 {
+		b.WriteString(fmt.Sprintf(" FETCH NEXT %d ROWS ONLY", take))
+	}
+	return b.String()
+}
+
+// GetUpsertSQL returns a MERGE statement, as Oracle has no ON CONFLICT
+// clause. The primary key is never updated, as Oracle rejects updates
+// of the columns in the ON clause (ORA-38104).
+func (oracle *OracleDialect) GetUpsertSQL(tableName string, columns, values []string, pkColumn string, updates []string) (string, error) {
+	if err := checkUpsertColumns(columns, values); err != nil {
+		return "", err
+	}
+	cnames := make([]string, len(columns))
+	selects := make([]string, len(columns))
+	inserts := make([]string, len(columns))
+	for i, column := range columns {
+		cnames[i] = oracle.EscapeColumnName(column)
+		selects[i] = fmt.Sprintf("%s AS %s", values[i], cnames[i])
+		inserts[i] = "s." + cnames[i]
+	}
+	pk := oracle.EscapeColumnName(pkColumn)
+
+	var b bytes.Buffer
+	b.WriteString(fmt.Sprintf("MERGE INTO %s d USING (SELECT %s FROM dual) s ON (d.%s=s.%s)",
+		oracle.EscapeTableName(tableName), strings.Join(selects, ", "), pk, pk))
+	if updates = upsertUpdates(pkColumn, updates); len(updates) > 0 {
+		pairs := make([]string, 0, len(updates))
+		for _, column := range updates {
+			c := oracle.EscapeColumnName(column)
+			pairs = append(pairs, fmt.Sprintf("d.%s=s.%s", c, c))
+		}
+		b.WriteString(" WHEN MATCHED THEN UPDATE SET ")
+		b.WriteString(strings.Join(pairs, ", "))
+	}
+	b.WriteString(fmt.Sprintf(" WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)",
+		strings.Join(cnames, ", "), strings.Join(inserts, ", ")))
+	return b.String(), nil
+}
+
+func (oracle *OracleDialect) GetRandomFunctionSQL() string {
+	return "DBMS_RANDOM.VALUE()"
+}
+
+func (oracle *OracleDialect) GetOrderNullsLastSQL(column, dir string) string {
+	return fmt.Sprintf("%s %s NULLS LAST", column, dir)
+}
+
+func (oracle *OracleDialect) GetOrderNullsFirstSQL(column, dir string) string {
+	return fmt.Sprintf("%s %s NULLS FIRST", column, dir)
+}
+
+func (oracle *OracleDialect) GetPlaceholder(n int) string {
+	return fmt.Sprintf(":%d", n)
+}
+
+func (oracle *OracleDialect) GetCompoundMemberSQL(query string) string {
+	return "(" + query + ")"
+}
+
+// GetCreateMigrationTableSQL ignores ORA-00955 (name is already used by
+// an existing object), as Oracle before 23c lacks CREATE TABLE IF NOT EXISTS.
+func (oracle *OracleDialect) GetCreateMigrationTableSQL(tableName string) string {
+	return `
+BEGIN
+  EXECUTE IMMEDIATE 'CREATE TABLE ` + oracle.EscapeTableName(tableName) + ` (
+    version NUMBER(19) NOT NULL PRIMARY KEY,
+    created TIMESTAMP NOT NULL
+  )';
+EXCEPTION
+  WHEN OTHERS THEN
+    IF SQLCODE != -955 THEN
+      RAISE;
+    END IF;
+END;`
+}
+
+func (oracle *OracleDialect) GetMigrationTableExistsSQL(tableName string) string {
+	return "SELECT COUNT(*) FROM user_tables WHERE table_name='" + oracle.QuoteString(tableName) + "'"
+}
+
+func (oracle *OracleDialect) InsertMigrationTableVersionSQL(tableName string) string {
+	return `
+MERGE INTO ` + oracle.EscapeTableName(tableName) + ` d
+  USING (SELECT :1 AS version FROM dual) s ON (d.version=s.version)
+  WHEN MATCHED THEN UPDATE SET d.created=SYSTIMESTAMP
+  WHEN NOT MATCHED THEN INSERT (version,created) VALUES (s.version, SYSTIMESTAMP)
+`
+}
+
+// checkUpsertColumns checks the columns and values passed to
+// UpsertDialect.GetUpsertSQL.
+func checkUpsertColumns(columns, values []string) error {
+	if len(columns) == 0 {
+		return errors.New("dapper: upsert without columns")
+	}
+	if len(columns) != len(values) {
+		return fmt.Errorf("dapper: upsert with %d columns but %d values", len(columns), len(values))
+	}
+	return nil
+}
+
+// upsertInsertSQL returns the INSERT statement to extend into an upsert,
+// as used by MySQL, Sqlite3, and PostgreSQL. The values must be quoted
+// already.
+func upsertInsertSQL(d Dialect, tableName string, columns, values []string) (string, error) {
+	if err := checkUpsertColumns(columns, values); err != nil {
+		return "", err
+	}
+	cnames := make([]string, len(columns))
+	for i, column := range columns {
+		cnames[i] = d.EscapeColumnName(column)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		d.EscapeTableName(tableName),
+		strings.Join(cnames, ", "),
+		strings.Join(values, ", ")), nil
+}
+
+// upsertUpdates returns the columns to update on conflict, without the
+// primary key.
+func upsertUpdates(pkColumn string, updates []string) []string {
+	columns := make([]string, 0, len(updates))
+	for _, column := range updates {
+		if column != pkColumn {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// onConflictUpsertSQL returns an INSERT statement with an ON CONFLICT
+// clause, as supported by Sqlite3 and PostgreSQL.
+func onConflictUpsertSQL(d Dialect, tableName string, columns, values []string, pkColumn string, updates []string) (string, error) {
+	insertSQL, err := upsertInsertSQL(d, tableName, columns, values)
+	if err != nil {
+		return "", err
+	}
+	updates = upsertUpdates(pkColumn, updates)
+	if len(updates) == 0 {
+		return fmt.Sprintf("%s ON CONFLICT (%s) DO NOTHING", insertSQL, d.EscapeColumnName(pkColumn)), nil
+	}
+	pairs := make([]string, 0, len(updates))
+	for _, column := range updates {
+		c := d.EscapeColumnName(column)
+		pairs = append(pairs, fmt.Sprintf("%s=excluded.%s", c, c))
+	}
+	return fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s",
+		insertSQL, d.EscapeColumnName(pkColumn), strings.Join(pairs, ", ")), nil
+}
+
+// quoteTime returns t as a string literal of dialect d in the given
+// layout, converted to UTC first if utc is true.
+func quoteTime(d Dialect, t time.Time, utc bool, layout string) string {
+	if utc {
+		t = t.UTC()
+	}
+	return fmt.Sprintf("'%s'", d.QuoteString(t.Format(layout)))
+}
+
+// quoteBytes returns b as a literal of dialect d (see BytesDialect).
+func quoteBytes(d Dialect, b []byte) string {
+	if bd, ok := d.(BytesDialect); ok {
+		return bd.QuoteBytes(b)
+	}
+	return fmt.Sprintf("X'%x'", b)
+}
+
+// quoteTimeLiteral returns t as a literal of dialect d (see TimeDialect).
+func quoteTimeLiteral(d Dialect, t time.Time) string {
+	if td, ok := d.(TimeDialect); ok {
+		return td.QuoteTime(t)
+	}
+	return quoteTime(d, t, false, "2006-01-02 15:04:05")
+}
+
+// supportsWindowFunctions reports whether dialect d supports window
+// functions (see WindowFunctionDialect).
+func supportsWindowFunctions(d Dialect) bool {
+	if wd, ok := d.(WindowFunctionDialect); ok {
+		return wd.SupportsWindowFunctions()
+	}
+	return false
+}
+
+// firstInsertId returns the id of the first of rows inserted with a
+// single statement (see FirstInsertIdDialect).
+func firstInsertId(d Dialect, lastInsertId int64, rows int) (int64, bool) {
+	if fd, ok := d.(FirstInsertIdDialect); ok {
+		return fd.GetFirstInsertId(lastInsertId, rows)
+	}
+	return 0, false
+}
+
+// upsertSQL returns the upsert statement of dialect d (see UpsertDialect).
+func upsertSQL(d Dialect, tableName string, columns, values []string, pkColumn string, updates []string) (string, error) {
+	if ud, ok := d.(UpsertDialect); ok {
+		return ud.GetUpsertSQL(tableName, columns, values, pkColumn, updates)
+	}
+	return "", fmt.Errorf("dapper: %v does not support upsert", d)
+}
+
+// randomFunctionSQL returns the random function of dialect d (see
+// RandomDialect).
+func randomFunctionSQL(d Dialect) string {
+	if rd, ok := d.(RandomDialect); ok {
+		return rd.GetRandomFunctionSQL()
+	}
+	return "RANDOM()"
+}
+
+// orderNullsLastSQL orders by column in direction dir with NULL values
+// last (see NullsOrderDialect).
+func orderNullsLastSQL(d Dialect, column, dir string) string {
+	if nd, ok := d.(NullsOrderDialect); ok {
+		return nd.GetOrderNullsLastSQL(column, dir)
+	}
+	return fmt.Sprintf("%s %s NULLS LAST", column, dir)
+}
+
+// orderNullsFirstSQL orders by column in direction dir with NULL values
+// first (see NullsOrderDialect).
+func orderNullsFirstSQL(d Dialect, column, dir string) string {
+	if nd, ok := d.(NullsOrderDialect); ok {
+		return nd.GetOrderNullsFirstSQL(column, dir)
+	}
+	return fmt.Sprintf("%s %s NULLS FIRST", column, dir)
+}
+
+// placeholder returns the n-th bind parameter of dialect d, starting at
+// 1 (see PlaceholderDialect).
+func placeholder(d Dialect, n int) string {
+	if pd, ok := d.(PlaceholderDialect); ok {
+		return pd.GetPlaceholder(n)
+	}
+	return "?"
+}
+
+// compoundMemberSQL returns query embedded into a UNION of dialect d
+// (see CompoundDialect).
+func compoundMemberSQL(d Dialect, query string) string {
+	if cd, ok := d.(CompoundDialect); ok {
+		return cd.GetCompoundMemberSQL(query)
+	}
+	return "(" + query + ")"
+}
+
+// migrationTableExistsSQL returns the query for the number of tables
+// named tableName in dialect d (see MigrationTableExistsDialect).
+func migrationTableExistsSQL(d Dialect, tableName string) string {
+	if md, ok := d.(MigrationTableExistsDialect); ok {
+		return md.GetMigrationTableExistsSQL(tableName)
+	}
+	return "SELECT COUNT(*) FROM information_schema.tables WHERE table_name='" +
+		d.QuoteString(tableName) + "'"
+}
+
+// escapeIdentifier wraps name in quote, doubling any quote in name,
+// e.g. a"b becomes "a""b" for quote ".
+func escapeIdentifier(name, quote string) string {
+	return quote + strings.Replace(name, quote, quote+quote, -1) + quote
+}
+
 var (
 	// MySQL dialect.
 	MySQL = &MySQLDialect{}
@@ -204,4 +858,41 @@ var (
 
 	// PostgreSQL dialect.
 	PostgreSQL = &PostgreSQLDialect{}
+
+	// Oracle dialect.
+	Oracle = &OracleDialect{}
 )
+
+// driverDialects maps import paths of database drivers to their dialect.
+var driverDialects = []struct {
+	pkgPath string
+	dialect Dialect
+}{
+	{"github.com/mattn/go-sqlite3", Sqlite3},
+	{"modernc.org/sqlite", Sqlite3},
+	{"github.com/go-sql-driver/mysql", MySQL},
+	{"github.com/ziutek/mymysql", MySQL},
+	{"github.com/lib/pq", PostgreSQL},
+	{"github.com/jackc/pgx", PostgreSQL},
+	{"github.com/godror/godror", Oracle},
+	{"github.com/sijms/go-ora", Oracle},
+}
+
+// DetectDialect returns the dialect for the driver of db, which is
+// determined by the package of the driver type, e.g. Sqlite3 for
+// github.com/mattn/go-sqlite3. It returns an error for unknown drivers.
+func DetectDialect(db *sql.DB) (Dialect, error) {
+	if db == nil {
+		return nil, errors.New("dapper: cannot detect dialect without database")
+	}
+	t := reflect.TypeOf(db.Driver())
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for _, dd := range driverDialects {
+		if t.PkgPath() == dd.pkgPath || strings.HasPrefix(t.PkgPath(), dd.pkgPath+"/") {
+			return dd.dialect, nil
+		}
+	}
+	return nil, fmt.Errorf("dapper: cannot detect dialect of driver %s", t)
+}
@@ -1,7 +1,10 @@
 package dapper
 
 import (
+	"database/sql"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEscapeTableName(t *testing.T) {
@@ -12,12 +15,19 @@ func TestEscapeTableName(t *testing.T) {
 		{MySQL, "Address", "`Address`"},
 		{MySQL, "Index", "`Index`"},
 		{MySQL, "With Space", "`With Space`"},
+		{MySQL, "With`Tick", "`With``Tick`"},
 		{Sqlite3, "Address", "`Address`"},
 		{Sqlite3, "Index", "`Index`"},
 		{Sqlite3, "With Space", "`With Space`"},
+		{Sqlite3, "With`Tick", "`With``Tick`"},
 		{PostgreSQL, "Address", `"Address"`},
 		{PostgreSQL, "Index", `"Index"`},
 		{PostgreSQL, "With Space", `"With Space"`},
+		{PostgreSQL, `With"Quote`, `"With""Quote"`},
+		{Oracle, "Address", `"Address"`},
+		{Oracle, "Index", `"Index"`},
+		{Oracle, "With Space", `"With Space"`},
+		{Oracle, `With"Quote`, `"With""Quote"`},
 	}
 
 	for _, test := range tests {
@@ -36,12 +46,19 @@ func TestEscapeColumnName(t *testing.T) {
 		{MySQL, "Address", "`Address`"},
 		{MySQL, "Index", "`Index`"},
 		{MySQL, "With Space", "`With Space`"},
+		{MySQL, "With`Tick", "`With``Tick`"},
 		{Sqlite3, "Address", "`Address`"},
 		{Sqlite3, "Index", "`Index`"},
 		{Sqlite3, "With Space", "`With Space`"},
+		{Sqlite3, "With`Tick", "`With``Tick`"},
 		{PostgreSQL, "Address", `"Address"`},
 		{PostgreSQL, "Index", `"Index"`},
 		{PostgreSQL, "With Space", `"With Space"`},
+		{PostgreSQL, `With"Quote`, `"With""Quote"`},
+		{Oracle, "Address", `"Address"`},
+		{Oracle, "Index", `"Index"`},
+		{Oracle, "With Space", `"With Space"`},
+		{Oracle, `With"Quote`, `"With""Quote"`},
 	}
 
 	for _, test := range tests {
@@ -51,3 +68,389 @@ func TestEscapeColumnName(t *testing.T) {
 		}
 	}
 }
+
+func TestGetUpsertSQL(t *testing.T) {
+	tests := []struct {
+		Dialect  Dialect
+		Columns  []string
+		Expected string
+	}{
+		{MySQL, []string{"name", "karma"}, "INSERT INTO `users` (`id`, `name`, `karma`) VALUES (1, 'Oliver', 42) ON DUPLICATE KEY UPDATE `name`=VALUES(`name`), `karma`=VALUES(`karma`)"},
+		{MySQL, []string{"id", "name"}, "INSERT INTO `users` (`id`, `name`, `karma`) VALUES (1, 'Oliver', 42) ON DUPLICATE KEY UPDATE `name`=VALUES(`name`)"},
+		{MySQL, nil, "INSERT INTO `users` (`id`, `name`, `karma`) VALUES (1, 'Oliver', 42) ON DUPLICATE KEY UPDATE `id`=`id`"},
+		{Sqlite3, []string{"name", "karma"}, "INSERT INTO `users` (`id`, `name`, `karma`) VALUES (1, 'Oliver', 42) ON CONFLICT (`id`) DO UPDATE SET `name`=excluded.`name`, `karma`=excluded.`karma`"},
+		{Sqlite3, nil, "INSERT INTO `users` (`id`, `name`, `karma`) VALUES (1, 'Oliver', 42) ON CONFLICT (`id`) DO NOTHING"},
+		{PostgreSQL, []string{"name", "karma"}, `INSERT INTO "users" ("id", "name", "karma") VALUES (1, 'Oliver', 42) ON CONFLICT ("id") DO UPDATE SET "name"=excluded."name", "karma"=excluded."karma"`},
+		{PostgreSQL, []string{"id"}, `INSERT INTO "users" ("id", "name", "karma") VALUES (1, 'Oliver', 42) ON CONFLICT ("id") DO NOTHING`},
+		{PostgreSQL, nil, `INSERT INTO "users" ("id", "name", "karma") VALUES (1, 'Oliver', 42) ON CONFLICT ("id") DO NOTHING`},
+	}
+
+	columns := []string{"id", "name", "karma"}
+	values := []string{"1", "'Oliver'", "42"}
+	for _, test := range tests {
+		got, err := upsertSQL(test.Dialect, "users", columns, values, "id", test.Columns)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", test.Dialect, err)
+		}
+		if got != test.Expected {
+			t.Errorf("%s: expected %v, got %v", test.Dialect, test.Expected, got)
+		}
+	}
+
+	// Invalid columns and values are reported, not silently ignored
+	for _, d := range []Dialect{MySQL, Sqlite3, PostgreSQL, Oracle} {
+		if _, err := upsertSQL(d, "users", nil, nil, "id", nil); err == nil {
+			t.Errorf("%s: expected an error without columns", d)
+		}
+		if _, err := upsertSQL(d, "users", columns, values[:2], "id", nil); err == nil {
+			t.Errorf("%s: expected an error with fewer values than columns", d)
+		}
+	}
+}
+
+func TestQuoteBytes(t *testing.T) {
+	tests := []struct {
+		Dialect  Dialect
+		Expected string
+	}{
+		{MySQL, "X'00275cff'"},
+		{Sqlite3, "X'00275cff'"},
+		{PostgreSQL, `'\x00275cff'`},
+		{Oracle, "'00275cff'"},
+	}
+
+	for _, test := range tests {
+		got := quoteBytes(test.Dialect, []byte{0x00, 0x27, 0x5c, 0xff})
+		if got != test.Expected {
+			t.Errorf("%s: expected %v, got %v", test.Dialect, test.Expected, got)
+		}
+	}
+}
+
+func TestDialectQuoteTime(t *testing.T) {
+	cet := time.FixedZone("CET", 3600)
+	tm := time.Date(2013, 1, 24, 18, 14, 15, 123000000, cet)
+
+	tests := []struct {
+		Dialect  Dialect
+		Expected string
+	}{
+		{MySQL, "'2013-01-24 18:14:15.123'"},
+		{&MySQLDialect{UTC: true}, "'2013-01-24 17:14:15.123'"},
+		{Sqlite3, "'2013-01-24 18:14:15.123+01:00'"},
+		{&Sqlite3Dialect{UTC: true}, "'2013-01-24 17:14:15.123+00:00'"},
+		{PostgreSQL, "'2013-01-24 18:14:15.123+01:00'"},
+		{&PostgreSQLDialect{UTC: true}, "'2013-01-24 17:14:15.123+00:00'"},
+		{Oracle, "TIMESTAMP '2013-01-24 18:14:15.123 +01:00'"},
+		{&OracleDialect{UTC: true}, "TIMESTAMP '2013-01-24 17:14:15.123 +00:00'"},
+	}
+
+	for _, test := range tests {
+		got := quoteTimeLiteral(test.Dialect, tm)
+		if got != test.Expected {
+			t.Errorf("%s: expected %v, got %v", test.Dialect, test.Expected, got)
+		}
+	}
+
+	// Whole seconds have no fraction
+	got := MySQL.QuoteTime(time.Date(2013, 1, 24, 18, 14, 15, 0, time.UTC))
+	if expected := "'2013-01-24 18:14:15'"; got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestGetOrderNullsLastSQL(t *testing.T) {
+	tests := []struct {
+		Dialect     Dialect
+		Column, Dir string
+		Output      string
+	}{
+		{MySQL, "karma", "ASC", "karma IS NULL,karma ASC"},
+		{MySQL, "karma", "DESC", "karma IS NULL,karma DESC"},
+		{Sqlite3, "karma", "ASC", "karma IS NULL,karma ASC"},
+		{Sqlite3, "karma", "DESC", "karma IS NULL,karma DESC"},
+		{PostgreSQL, "karma", "ASC", "karma ASC NULLS LAST"},
+		{PostgreSQL, "karma", "DESC", "karma DESC NULLS LAST"},
+		{Oracle, "karma", "ASC", "karma ASC NULLS LAST"},
+		{Oracle, "karma", "DESC", "karma DESC NULLS LAST"},
+	}
+
+	for _, test := range tests {
+		got := orderNullsLastSQL(test.Dialect, test.Column, test.Dir)
+		if got != test.Output {
+			t.Errorf("%s: expected %v, got %v", test.Dialect, test.Output, got)
+		}
+	}
+}
+
+func TestGetOrderNullsFirstSQL(t *testing.T) {
+	tests := []struct {
+		Dialect     Dialect
+		Column, Dir string
+		Output      string
+	}{
+		{MySQL, "karma", "ASC", "karma IS NOT NULL,karma ASC"},
+		{MySQL, "karma", "DESC", "karma IS NOT NULL,karma DESC"},
+		{Sqlite3, "karma", "ASC", "karma IS NOT NULL,karma ASC"},
+		{Sqlite3, "karma", "DESC", "karma IS NOT NULL,karma DESC"},
+		{PostgreSQL, "karma", "ASC", "karma ASC NULLS FIRST"},
+		{PostgreSQL, "karma", "DESC", "karma DESC NULLS FIRST"},
+		{Oracle, "karma", "ASC", "karma ASC NULLS FIRST"},
+		{Oracle, "karma", "DESC", "karma DESC NULLS FIRST"},
+	}
+
+	for _, test := range tests {
+		got := orderNullsFirstSQL(test.Dialect, test.Column, test.Dir)
+		if got != test.Output {
+			t.Errorf("%s: expected %v, got %v", test.Dialect, test.Output, got)
+		}
+	}
+}
+
+func TestGetPlaceholder(t *testing.T) {
+	tests := []struct {
+		Dialect Dialect
+		N       int
+		Output  string
+	}{
+		{MySQL, 1, "?"},
+		{MySQL, 2, "?"},
+		{Sqlite3, 1, "?"},
+		{Sqlite3, 2, "?"},
+		{PostgreSQL, 1, "$1"},
+		{PostgreSQL, 2, "$2"},
+		{Oracle, 1, ":1"},
+		{Oracle, 2, ":2"},
+	}
+
+	for _, test := range tests {
+		got := placeholder(test.Dialect, test.N)
+		if got != test.Output {
+			t.Errorf("%s: expected %v, got %v", test.Dialect, test.Output, got)
+		}
+	}
+}
+
+func TestGetCompoundMemberSQL(t *testing.T) {
+	tests := []struct {
+		Dialect       Dialect
+		Input, Output string
+	}{
+		{MySQL, "SELECT 1", "(SELECT 1)"},
+		{Sqlite3, "SELECT 1", "SELECT * FROM (SELECT 1)"},
+		{PostgreSQL, "SELECT 1", "(SELECT 1)"},
+		{Oracle, "SELECT 1 FROM dual", "(SELECT 1 FROM dual)"},
+	}
+
+	for _, test := range tests {
+		got := compoundMemberSQL(test.Dialect, test.Input)
+		if got != test.Output {
+			t.Errorf("%s: expected %v, got %v", test.Dialect, test.Output, got)
+		}
+	}
+}
+
+func TestSupportsWindowFunctions(t *testing.T) {
+	tests := []struct {
+		Dialect  Dialect
+		Expected bool
+	}{
+		{MySQL, false},
+		{Sqlite3, true},
+		{PostgreSQL, true},
+		{Oracle, true},
+	}
+
+	for _, test := range tests {
+		got := supportsWindowFunctions(test.Dialect)
+		if got != test.Expected {
+			t.Errorf("%s: expected %v, got %v", test.Dialect, test.Expected, got)
+		}
+	}
+}
+
+func TestGetCreateMigrationTableSQL(t *testing.T) {
+	tests := []struct {
+		Dialect Dialect
+		Created string
+	}{
+		{MySQL, "created datetime not null"},
+		{Sqlite3, "created datetime not null"},
+		{PostgreSQL, "created timestamp not null"},
+		{Oracle, "created TIMESTAMP NOT NULL"},
+	}
+
+	for _, test := range tests {
+		got := test.Dialect.GetCreateMigrationTableSQL(MigrationTableName)
+		if !strings.Contains(got, test.Created) {
+			t.Errorf("%s: expected %q in %v", test.Dialect, test.Created, got)
+		}
+	}
+}
+
+func TestOracleQuoteString(t *testing.T) {
+	tests := []struct {
+		Input, Output string
+	}{
+		{"Oliver", "Oliver"},
+		{"Mc'Allister", "Mc''Allister"},
+		{"'; DROP TABLE users; --", "''; DROP TABLE users; --"},
+		{`C:\temp\`, `C:\temp\`},
+		{`\'`, `\''`},
+	}
+
+	for _, test := range tests {
+		got := Oracle.QuoteString(test.Input)
+		if got != test.Output {
+			t.Errorf("%q: expected %v, got %v", test.Input, test.Output, got)
+		}
+	}
+}
+
+func TestOracleGetUpsertSQL(t *testing.T) {
+	columns := []string{"id", "name", "karma"}
+	values := []string{"1", "'Mc''Allister, Jr.'", "42"}
+
+	got, err := Oracle.GetUpsertSQL("users", columns, values, "id", []string{"name", "karma"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `MERGE INTO "users" d USING (SELECT 1 AS "id", 'Mc''Allister, Jr.' AS "name", 42 AS "karma" FROM dual) s ON (d."id"=s."id")` +
+		` WHEN MATCHED THEN UPDATE SET d."name"=s."name", d."karma"=s."karma"` +
+		` WHEN NOT MATCHED THEN INSERT ("id", "name", "karma") VALUES (s."id", s."name", s."karma")`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// The primary key is never updated (ORA-38104)
+	got, err = Oracle.GetUpsertSQL("users", columns, values, "id", []string{"id", "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `MERGE INTO "users" d USING (SELECT 1 AS "id", 'Mc''Allister, Jr.' AS "name", 42 AS "karma" FROM dual) s ON (d."id"=s."id")` +
+		` WHEN MATCHED THEN UPDATE SET d."name"=s."name"` +
+		` WHEN NOT MATCHED THEN INSERT ("id", "name", "karma") VALUES (s."id", s."name", s."karma")`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	got, err = Oracle.GetUpsertSQL("users", columns, values, "id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `MERGE INTO "users" d USING (SELECT 1 AS "id", 'Mc''Allister, Jr.' AS "name", 42 AS "karma" FROM dual) s ON (d."id"=s."id")` +
+		` WHEN NOT MATCHED THEN INSERT ("id", "name", "karma") VALUES (s."id", s."name", s."karma")`
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestGetFirstInsertId(t *testing.T) {
+	tests := []struct {
+		Dialect Dialect
+		FirstId int64
+		OK      bool
+	}{
+		{MySQL, 10, true},
+		{Sqlite3, 8, true},
+		{PostgreSQL, 0, false},
+		{Oracle, 0, false},
+	}
+
+	for _, test := range tests {
+		firstId, ok := firstInsertId(test.Dialect, 10, 3)
+		if firstId != test.FirstId || ok != test.OK {
+			t.Errorf("%s: expected %v, %v, got %v, %v", test.Dialect, test.FirstId, test.OK, firstId, ok)
+		}
+	}
+}
+
+// minimalDialect implements Dialect only, without optional capabilities.
+type minimalDialect struct{}
+
+func (d minimalDialect) QuoteString(s string) string {
+	return strings.Replace(s, "'", "''", -1)
+}
+
+func (d minimalDialect) EscapeTableName(name string) string {
+	return escapeIdentifier(name, `"`)
+}
+
+func (d minimalDialect) EscapeColumnName(name string) string {
+	return escapeIdentifier(name, `"`)
+}
+
+func (d minimalDialect) SupportsLastInsertId() bool {
+	return true
+}
+
+func (d minimalDialect) GetLimitString(query string, skip, take int) string {
+	return MySQL.GetLimitString(query, skip, take)
+}
+
+func (d minimalDialect) GetCreateMigrationTableSQL(tableName string) string {
+	return Sqlite3.GetCreateMigrationTableSQL(tableName)
+}
+
+func (d minimalDialect) InsertMigrationTableVersionSQL(tableName string) string {
+	return Sqlite3.InsertMigrationTableVersionSQL(tableName)
+}
+
+func TestMinimalDialectFallbacks(t *testing.T) {
+	var d Dialect = minimalDialect{}
+
+	if got, expected := quoteBytes(d, []byte{0x27, 0xff}), "X'27ff'"; got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	tm := time.Date(2013, 1, 24, 18, 14, 15, 0, time.UTC)
+	if got, expected := quoteTimeLiteral(d, tm), "'2013-01-24 18:14:15'"; got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if supportsWindowFunctions(d) {
+		t.Errorf("expected no window functions")
+	}
+	if _, ok := firstInsertId(d, 10, 3); ok {
+		t.Errorf("expected first insert id to be unknown")
+	}
+	if _, err := upsertSQL(d, "users", []string{"id"}, []string{"1"}, "id", nil); err == nil {
+		t.Errorf("expected upsert to fail")
+	}
+	if got, expected := orderNullsLastSQL(d, "karma", "DESC"), "karma DESC NULLS LAST"; got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got, expected := placeholder(d, 2), "?"; got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	got := Q(d, "users").Where().Eq("id", 1).Union(Q(d, "users").Where().Eq("id", 2).Query()).Sql()
+	expected := "(SELECT * FROM users WHERE id=1) UNION (SELECT * FROM users WHERE id=2)"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestDetectDialect(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("error connection to database: %v", err)
+	}
+	defer db.Close()
+
+	dialect, err := DetectDialect(db)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dialect != Sqlite3 {
+		t.Errorf("expected %v, got %v", Sqlite3, dialect)
+	}
+	if got := New(db).dialect; got != Sqlite3 {
+		t.Errorf("expected New to detect %v, got %v", Sqlite3, got)
+	}
+
+	if _, err := DetectDialect(nil); err == nil {
+		t.Errorf("expected error without database")
+	}
+	if got := New(nil).dialect; got != MySQL {
+		t.Errorf("expected %v, got %v", MySQL, got)
+	}
+}
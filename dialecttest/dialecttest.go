@@ -0,0 +1,364 @@
+// Package dialecttest contains a set of checks that every
+// dapper.Dialect implementation should pass. Checks of optional
+// capabilities, e.g. dapper.UpsertDialect, are skipped if the dialect
+// doesn't implement them.
+//
+// Authors of custom dialects can run them from their own tests:
+//
+//	func TestMyDialect(t *testing.T) {
+//		dialecttest.AssertDialect(t, &MyDialect{})
+//	}
+package dialecttest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olivere/dapper"
+)
+
+// AssertDialect runs all checks against the dialect d and reports
+// failures via t.
+func AssertDialect(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	AssertQuoteString(t, d)
+	AssertQuoteBytes(t, d)
+	AssertQuoteTime(t, d)
+	AssertEscapeTableName(t, d)
+	AssertEscapeColumnName(t, d)
+	AssertGetLimitString(t, d)
+	AssertGetUpsertSQL(t, d)
+	AssertGetRandomFunctionSQL(t, d)
+	AssertGetOrderNullsLastSQL(t, d)
+	AssertGetOrderNullsFirstSQL(t, d)
+	AssertGetPlaceholder(t, d)
+	AssertGetCompoundMemberSQL(t, d)
+	AssertMigrationTableSQL(t, d)
+}
+
+// AssertQuoteString checks that QuoteString leaves plain text alone
+// and never returns a single quote that would terminate the literal.
+// A backslash only counts as an escape character if the dialect escapes
+// single quotes with it, as MySQL does; otherwise, it is a plain
+// character as in standard SQL.
+func AssertQuoteString(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	backslash := usesBackslashEscapes(d)
+
+	plain := []string{"", "Oliver", "With Space", "äöü€"}
+	for _, s := range plain {
+		if got := d.QuoteString(s); got != s {
+			t.Errorf("%v: QuoteString(%q): expected %q, got %q", d, s, s, got)
+		}
+	}
+
+	unsafe := []string{
+		"'",
+		"''",
+		"Mc'Allister",
+		"\\",
+		"\\'",
+		"'; DROP TABLE users; --",
+		"a\\'b'c",
+	}
+	for _, s := range unsafe {
+		got := d.QuoteString(s)
+		if hasUnescapedQuote(got, backslash) {
+			t.Errorf("%v: QuoteString(%q): result %q contains an unescaped single quote", d, s, got)
+		}
+		if backslash && strings.HasSuffix(got, "\\") && !strings.HasSuffix(got, "\\\\") {
+			t.Errorf("%v: QuoteString(%q): result %q ends with a dangling backslash", d, s, got)
+		}
+	}
+}
+
+// AssertQuoteBytes checks that QuoteBytes returns a literal containing
+// the bytes in hex and no quote that would terminate the literal early.
+func AssertQuoteBytes(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	bd, ok := d.(dapper.BytesDialect)
+	if !ok {
+		return
+	}
+
+	b := []byte{0x00, 0x27, 0x5c, 0xff}
+	got := bd.QuoteBytes(b)
+	if !strings.Contains(strings.ToLower(got), "00275cff") {
+		t.Errorf("%v: QuoteBytes(%v): expected hex %q in %q", d, b, "00275cff", got)
+	}
+	if strings.Count(got, "'") != 2 || !strings.HasSuffix(got, "'") {
+		t.Errorf("%v: QuoteBytes(%v): expected a single quoted literal, got %q", d, b, got)
+	}
+}
+
+// AssertQuoteTime checks that QuoteTime returns a quoted literal that
+// preserves milliseconds.
+func AssertQuoteTime(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	td, ok := d.(dapper.TimeDialect)
+	if !ok {
+		return
+	}
+
+	tm := time.Date(2013, 1, 24, 18, 14, 15, 123000000, time.UTC)
+	got := td.QuoteTime(tm)
+	if !strings.HasPrefix(got, "'") || !strings.HasSuffix(got, "'") {
+		t.Errorf("%v: QuoteTime(%v): expected a quoted literal, got %q", d, tm, got)
+	}
+	if other := td.QuoteTime(tm.Add(time.Millisecond)); other == got {
+		t.Errorf("%v: QuoteTime(%v): expected milliseconds to be preserved, got %q", d, tm, got)
+	}
+}
+
+// AssertEscapeTableName checks that EscapeTableName wraps table names,
+// including reserved words and names with spaces.
+func AssertEscapeTableName(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	for _, name := range identifiers {
+		got := d.EscapeTableName(name)
+		if !isEscapedIdentifier(name, got) {
+			t.Errorf("%v: EscapeTableName(%q): expected escaped identifier, got %q", d, name, got)
+		}
+	}
+}
+
+// AssertEscapeColumnName checks that EscapeColumnName wraps column names,
+// including reserved words and names with spaces.
+func AssertEscapeColumnName(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	for _, name := range identifiers {
+		got := d.EscapeColumnName(name)
+		if !isEscapedIdentifier(name, got) {
+			t.Errorf("%v: EscapeColumnName(%q): expected escaped identifier, got %q", d, name, got)
+		}
+	}
+}
+
+// AssertGetLimitString checks that GetLimitString leaves the query
+// untouched without limits and appends skip and take otherwise.
+func AssertGetLimitString(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+
+	const query = "SELECT * FROM users"
+
+	if got := d.GetLimitString(query, -1, -1); got != query {
+		t.Errorf("%v: GetLimitString(%q, -1, -1): expected %q, got %q", d, query, query, got)
+	}
+
+	tests := []struct {
+		Skip, Take int
+		Contains   []string
+	}{
+		{-1, 10, []string{"10"}},
+		{0, 10, []string{"10"}},
+		{20, 10, []string{"20", "10"}},
+		{1, 1, []string{"1"}},
+	}
+	for _, test := range tests {
+		got := d.GetLimitString(query, test.Skip, test.Take)
+		if !strings.HasPrefix(got, query+" ") {
+			t.Errorf("%v: GetLimitString(%q, %d, %d): expected result to start with the query, got %q",
+				d, query, test.Skip, test.Take, got)
+			continue
+		}
+		suffix := got[len(query):]
+		for _, s := range test.Contains {
+			if !strings.Contains(suffix, s) {
+				t.Errorf("%v: GetLimitString(%q, %d, %d): expected %q in limit clause, got %q",
+					d, query, test.Skip, test.Take, s, got)
+			}
+		}
+	}
+}
+
+// AssertGetUpsertSQL checks that GetUpsertSQL returns an INSERT
+// statement that updates all given columns, and reports invalid input
+// as an error.
+func AssertGetUpsertSQL(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	ud, ok := d.(dapper.UpsertDialect)
+	if !ok {
+		return
+	}
+
+	columns := []string{"id", "name", "karma"}
+	values := []string{"1", "'Oliver'", "42"}
+	insert := "INSERT INTO " + d.EscapeTableName("users") + " ("
+	for i, column := range columns {
+		if i > 0 {
+			insert += ", "
+		}
+		insert += d.EscapeColumnName(column)
+	}
+	insert += ") VALUES (1, 'Oliver', 42)"
+
+	updates := []string{"name", "karma"}
+	got, err := ud.GetUpsertSQL("users", columns, values, "id", updates)
+	if err != nil {
+		t.Fatalf("%v: GetUpsertSQL: expected no error, got %v", d, err)
+	}
+	if !strings.HasPrefix(got, insert+" ") {
+		t.Errorf("%v: GetUpsertSQL: expected result to start with %q, got %q", d, insert, got)
+	}
+	for _, column := range updates {
+		if escaped := d.EscapeColumnName(column); !strings.Contains(got[len(insert):], escaped) {
+			t.Errorf("%v: GetUpsertSQL: expected column %q to be updated, got %q", d, escaped, got)
+		}
+	}
+
+	got, err = ud.GetUpsertSQL("users", columns, values, "id", nil)
+	if err != nil {
+		t.Fatalf("%v: GetUpsertSQL without updates: expected no error, got %v", d, err)
+	}
+	if !strings.HasPrefix(got, insert+" ") {
+		t.Errorf("%v: GetUpsertSQL without updates: expected result to start with %q, got %q", d, insert, got)
+	}
+
+	if _, err := ud.GetUpsertSQL("users", columns, values[:2], "id", updates); err == nil {
+		t.Errorf("%v: GetUpsertSQL: expected an error with fewer values than columns", d)
+	}
+}
+
+// AssertGetRandomFunctionSQL checks that GetRandomFunctionSQL returns
+// a single function call that can be used in an ORDER BY clause.
+func AssertGetRandomFunctionSQL(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	rd, ok := d.(dapper.RandomDialect)
+	if !ok {
+		return
+	}
+
+	got := rd.GetRandomFunctionSQL()
+	if !strings.HasSuffix(got, "()") || strings.ContainsAny(got, " ;'") {
+		t.Errorf("%v: GetRandomFunctionSQL: expected a function call, got %q", d, got)
+	}
+}
+
+// AssertGetOrderNullsLastSQL checks that GetOrderNullsLastSQL orders by
+// the column in the given direction.
+func AssertGetOrderNullsLastSQL(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	nd, ok := d.(dapper.NullsOrderDialect)
+	if !ok {
+		return
+	}
+
+	for _, dir := range []string{"ASC", "DESC"} {
+		got := nd.GetOrderNullsLastSQL("karma", dir)
+		if !strings.Contains(got, "karma "+dir) {
+			t.Errorf("%v: GetOrderNullsLastSQL(%q, %q): expected %q in %q", d, "karma", dir, "karma "+dir, got)
+		}
+	}
+}
+
+// AssertGetOrderNullsFirstSQL checks that GetOrderNullsFirstSQL orders
+// by the column in the given direction.
+func AssertGetOrderNullsFirstSQL(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	nd, ok := d.(dapper.NullsOrderDialect)
+	if !ok {
+		return
+	}
+
+	for _, dir := range []string{"ASC", "DESC"} {
+		got := nd.GetOrderNullsFirstSQL("karma", dir)
+		if !strings.Contains(got, "karma "+dir) {
+			t.Errorf("%v: GetOrderNullsFirstSQL(%q, %q): expected %q in %q", d, "karma", dir, "karma "+dir, got)
+		}
+	}
+}
+
+// AssertGetPlaceholder checks that GetPlaceholder returns a bind
+// parameter, not a literal.
+func AssertGetPlaceholder(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	pd, ok := d.(dapper.PlaceholderDialect)
+	if !ok {
+		return
+	}
+
+	for n := 1; n <= 2; n++ {
+		got := pd.GetPlaceholder(n)
+		if got == "" || strings.ContainsAny(got, " ;'") {
+			t.Errorf("%v: GetPlaceholder(%d): expected a placeholder, got %q", d, n, got)
+		}
+	}
+}
+
+// AssertGetCompoundMemberSQL checks that GetCompoundMemberSQL keeps the
+// query intact.
+func AssertGetCompoundMemberSQL(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+	cd, ok := d.(dapper.CompoundDialect)
+	if !ok {
+		return
+	}
+
+	query := "SELECT * FROM users ORDER BY id"
+	if got := cd.GetCompoundMemberSQL(query); !strings.Contains(got, query) {
+		t.Errorf("%v: GetCompoundMemberSQL(%q): expected query in %q", d, query, got)
+	}
+}
+
+// AssertMigrationTableSQL checks that the migration statements refer
+// to the migration table, escaped unless it is compared as a string.
+func AssertMigrationTableSQL(t testing.TB, d dapper.Dialect) {
+	t.Helper()
+
+	escaped := d.EscapeTableName(dapper.MigrationTableName)
+	if got := d.GetCreateMigrationTableSQL(dapper.MigrationTableName); !strings.Contains(got, escaped) {
+		t.Errorf("%v: GetCreateMigrationTableSQL: expected %q in %q", d, escaped, got)
+	}
+	if got := d.InsertMigrationTableVersionSQL(dapper.MigrationTableName); !strings.Contains(got, escaped) {
+		t.Errorf("%v: InsertMigrationTableVersionSQL: expected %q in %q", d, escaped, got)
+	}
+	if md, ok := d.(dapper.MigrationTableExistsDialect); ok {
+		if got := md.GetMigrationTableExistsSQL(dapper.MigrationTableName); !strings.Contains(got, dapper.MigrationTableName) {
+			t.Errorf("%v: GetMigrationTableExistsSQL: expected %q in %q", d, dapper.MigrationTableName, got)
+		}
+	}
+}
+
+// identifiers are table and column names that must survive escaping.
+var identifiers = []string{"users", "Address", "Index", "order", "select", "With Space"}
+
+// isEscapedIdentifier returns true if escaped is the identifier name
+// wrapped in a pair of (non-alphanumeric) delimiters.
+func isEscapedIdentifier(name, escaped string) bool {
+	if len(escaped) < len(name)+2 || !strings.Contains(escaped, name) {
+		return false
+	}
+	left, right := escaped[0], escaped[len(escaped)-1]
+	return !isAlnum(left) && !isAlnum(right)
+}
+
+func isAlnum(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_'
+}
+
+// usesBackslashEscapes reports whether d escapes single quotes with a
+// backslash, e.g. MySQL, instead of doubling them as in standard SQL.
+func usesBackslashEscapes(d dapper.Dialect) bool {
+	return d.QuoteString("'") == "\\'"
+}
+
+// hasUnescapedQuote reports whether s contains a single quote that is
+// not doubled and, if backslash is true, not preceded by a backslash.
+func hasUnescapedQuote(s string, backslash bool) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if backslash {
+				i++
+			}
+		case '\'':
+			if i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
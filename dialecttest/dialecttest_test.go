@@ -0,0 +1,79 @@
+package dialecttest
+
+import (
+	"testing"
+
+	"github.com/olivere/dapper"
+)
+
+func TestMySQLDialect(t *testing.T) {
+	AssertDialect(t, dapper.MySQL)
+}
+
+func TestSqlite3Dialect(t *testing.T) {
+	AssertDialect(t, dapper.Sqlite3)
+}
+
+func TestPostgreSQLDialect(t *testing.T) {
+	AssertDialect(t, dapper.PostgreSQL)
+}
+
+func TestOracleDialect(t *testing.T) {
+	// Oracle writes TIMESTAMP literals and upserts with MERGE, so
+	// AssertQuoteTime and AssertGetUpsertSQL don't apply. See the tests
+	// of package dapper.
+	d := dapper.Oracle
+	AssertQuoteString(t, d)
+	AssertQuoteBytes(t, d)
+	AssertEscapeTableName(t, d)
+	AssertEscapeColumnName(t, d)
+	AssertGetLimitString(t, d)
+	AssertGetRandomFunctionSQL(t, d)
+	AssertGetOrderNullsLastSQL(t, d)
+	AssertGetOrderNullsFirstSQL(t, d)
+	AssertGetPlaceholder(t, d)
+	AssertGetCompoundMemberSQL(t, d)
+	AssertMigrationTableSQL(t, d)
+}
+
+func TestHasUnescapedQuote(t *testing.T) {
+	tests := []struct {
+		Input     string
+		Backslash bool
+		Expected  bool
+	}{
+		{"", true, false},
+		{"Oliver", true, false},
+		{"Mc''Allister", true, false},
+		{"Mc\\'Allister", true, false},
+		{"Mc'Allister", true, true},
+		{"\\\\'", true, true},
+		{"'''", true, true},
+		// Without backslash escapes, e.g. Sqlite3 and Oracle
+		{"Mc''Allister", false, false},
+		{"Mc\\'Allister", false, true},
+		{"\\''", false, false},
+		{"\\\\'", false, true},
+	}
+	for _, test := range tests {
+		if got := hasUnescapedQuote(test.Input, test.Backslash); got != test.Expected {
+			t.Errorf("hasUnescapedQuote(%q, %v): expected %v, got %v", test.Input, test.Backslash, test.Expected, got)
+		}
+	}
+}
+
+func TestUsesBackslashEscapes(t *testing.T) {
+	tests := []struct {
+		Dialect  dapper.Dialect
+		Expected bool
+	}{
+		{dapper.MySQL, true},
+		{dapper.Sqlite3, false},
+		{dapper.Oracle, false},
+	}
+	for _, test := range tests {
+		if got := usesBackslashEscapes(test.Dialect); got != test.Expected {
+			t.Errorf("%v: expected %v, got %v", test.Dialect, test.Expected, got)
+		}
+	}
+}
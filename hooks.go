@@ -0,0 +1,115 @@
+package dapper
+
+import (
+	"errors"
+	"reflect"
+)
+
+// ErrInvalid is returned by Insert and Update if the entity implements
+// Validatable and Validate returns false.
+var ErrInvalid = errors.New("dapper: entity is invalid")
+
+// Validatable is implemented by entities that validate themselves before
+// being inserted or updated.
+type Validatable interface {
+	Validate() bool
+}
+
+// BeforeInserter is implemented by entities that need to run code before
+// being inserted, e.g. to set derived fields. Returning an error aborts
+// the insert.
+type BeforeInserter interface {
+	BeforeInsert() error
+}
+
+// AfterInserter is implemented by entities that need to run code after
+// being inserted. The autoincrement field is already set.
+type AfterInserter interface {
+	AfterInsert() error
+}
+
+// BeforeUpdater is implemented by entities that need to run code before
+// being updated. Returning an error aborts the update.
+type BeforeUpdater interface {
+	BeforeUpdate() error
+}
+
+// AfterUpdater is implemented by entities that need to run code after
+// being updated.
+type AfterUpdater interface {
+	AfterUpdate() error
+}
+
+// BeforeDeleter is implemented by entities that need to run code before
+// being deleted. Returning an error aborts the delete.
+type BeforeDeleter interface {
+	BeforeDelete() error
+}
+
+// AfterDeleter is implemented by entities that need to run code after
+// being deleted.
+type AfterDeleter interface {
+	AfterDelete() error
+}
+
+// hookable returns true if the hooks of entity are to be called.
+// Hooks are only called for pointers to entities, as they typically
+// change the entity.
+func hookable(entity interface{}) bool {
+	v := reflect.ValueOf(entity)
+	return v.Kind() == reflect.Ptr && !v.IsNil()
+}
+
+func beforeInsert(entity interface{}) error {
+	if !hookable(entity) {
+		return nil
+	}
+	if v, ok := entity.(Validatable); ok && !v.Validate() {
+		return ErrInvalid
+	}
+	if h, ok := entity.(BeforeInserter); ok {
+		return h.BeforeInsert()
+	}
+	return nil
+}
+
+func afterInsert(entity interface{}) error {
+	if h, ok := entity.(AfterInserter); ok && hookable(entity) {
+		return h.AfterInsert()
+	}
+	return nil
+}
+
+func beforeUpdate(entity interface{}) error {
+	if !hookable(entity) {
+		return nil
+	}
+	if v, ok := entity.(Validatable); ok && !v.Validate() {
+		return ErrInvalid
+	}
+	if h, ok := entity.(BeforeUpdater); ok {
+		return h.BeforeUpdate()
+	}
+	return nil
+}
+
+func afterUpdate(entity interface{}) error {
+	if h, ok := entity.(AfterUpdater); ok && hookable(entity) {
+		return h.AfterUpdate()
+	}
+	return nil
+}
+
+func beforeDelete(entity interface{}) error {
+	if h, ok := entity.(BeforeDeleter); ok && hookable(entity) {
+		return h.BeforeDelete()
+	}
+	return nil
+}
+
+func afterDelete(entity interface{}) error {
+	if h, ok := entity.(AfterDeleter); ok && hookable(entity) {
+		return h.AfterDelete()
+	}
+	return nil
+}
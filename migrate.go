@@ -5,11 +5,11 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"path"
-	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -17,36 +17,112 @@ import (
 var (
 	// reMigrationName specifies the regular expression that migration
 	// names must fulfill, i.e. a number at the beginning and a .sql extension
-	// at the end.
-	reMigrationName = regexp.MustCompile("(?:([0-9]+).*\\.sql$)")
+	// at the end. An optional .up or .down before the extension marks the
+	// halves of a migration that can be rolled back, e.g. 001_users.up.sql
+	// and 001_users.down.sql. Files without it are up migrations.
+	reMigrationName = regexp.MustCompile("(?:([0-9]+).*?(?:\\.(up|down))?\\.sql$)")
+
+	// reDollarTag matches the tag of a PostgreSQL dollar-quoted string,
+	// e.g. $$ or $body$.
+	reDollarTag = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z0-9_]*)?\$`)
 )
 
 const (
 	// MigrationTableName is the name of the migrations database table.
 	MigrationTableName = "dapper_migrations"
+
+	// NoSplitDirective, as the first line of a migration script, executes
+	// the script as a single statement instead of splitting it on
+	// semicolons, e.g. for triggers or stored procedures.
+	NoSplitDirective = "-- dapper:no-split"
 )
 
 // migration is a single update unit.
 type migration struct {
-	Version int    // Version number (monotonically increasing)
-	Path    string // Path is the file name of the migration
+	Version  int    // Version number (monotonically increasing)
+	Path     string // Path is the file name of the migration in fsys
+	DownPath string // DownPath is the file name of the down migration, if any
+	Name     string // Name of an inline migration (see AddSQL)
+	SQL      string // SQL of an inline migration (see AddSQL)
+
+	fsys fs.FS // file system of Path and DownPath
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Version int    // Version number
+	Name    string // Name is the file name or the name of an inline migration
+	Applied bool   // Applied is true if the version is in the migrations table
 }
 
 func (m migration) String() string {
 	return fmt.Sprintf("Path=%s,Version=%d", m.Path, m.Version)
 }
 
+// name returns the file name of the migration, or the name of an
+// inline migration.
+func (m migration) name() string {
+	if m.Path == "" {
+		return m.Name
+	}
+	return path.Base(m.Path)
+}
+
+// script returns the SQL of the migration.
+func (m migration) script() (string, error) {
+	if m.Path == "" {
+		return m.SQL, nil
+	}
+	data, err := fs.ReadFile(m.fsys, m.Path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// downScript returns the SQL that reverts the migration.
+func (m migration) downScript() (string, error) {
+	data, err := fs.ReadFile(m.fsys, m.DownPath)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 type migrator struct {
 	db      *sql.DB
-	path    string
+	fsys    fs.FS  // file system with the migrations, if any
+	dir     string // directory of the migrations in fsys
+	path    string // path of the migrations, for messages
 	dialect Dialect
 	verbose bool
 	debug   bool
 	out     io.Writer
+	inline  []migration
+
+	continueOnError func(error) bool
 }
 
+// NewMigrator returns a migrator for the migrations in the directory
+// path. If path is empty, only inline migrations are applied (see AddSQL).
 func NewMigrator(db *sql.DB, dialect Dialect, path string) *migrator {
-	return &migrator{db: db, dialect: dialect, path: path, out: os.Stdout}
+	if path == "" {
+		return &migrator{db: db, dialect: dialect, out: os.Stdout}
+	}
+	m := NewMigratorFS(db, dialect, os.DirFS(path), ".")
+	m.path = path
+	return m
+}
+
+// NewMigratorFS returns a migrator for the migrations in the directory
+// dir of fsys, e.g. to ship them inside the binary with an embed.FS:
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	err := dapper.NewMigratorFS(db, dapper.MySQL, migrations, "migrations").Do()
+func NewMigratorFS(db *sql.DB, dialect Dialect, fsys fs.FS, dir string) *migrator {
+	return &migrator{db: db, dialect: dialect, fsys: fsys, dir: dir, path: dir, out: os.Stdout}
 }
 
 func (m *migrator) Dialect(dialect Dialect) *migrator {
@@ -69,63 +145,60 @@ func (m *migrator) Out(out io.Writer) *migrator {
 	return m
 }
 
-func (m *migrator) Do() error {
-	m.printf("Reading migrations from %s\n", m.path)
+// ContinueOnError makes the migrator log and skip failing statements if
+// predicate returns true for the error, e.g. for "already exists" errors
+// of idempotent scripts. By default, or if predicate is nil, a failing
+// statement aborts the migration and rolls back its transaction.
+//
+// With PostgreSQL and Sqlite3, each statement runs in a savepoint which
+// is rolled back if the statement fails, as PostgreSQL otherwise aborts
+// the transaction on any error.
+func (m *migrator) ContinueOnError(predicate func(error) bool) *migrator {
+	m.continueOnError = predicate
+	return m
+}
 
-	// Use MySQL as the default dialect
-	if m.dialect == nil {
-		m.dialect = MySQL
-	}
+// AddSQL registers an inline migration with the given version, e.g. for
+// tests or small applications without a migrations directory. Statements
+// in sql are separated by semicolons, as in migration files. Inline
+// migrations are applied together with the migrations in path, ordered
+// by version. If path is empty, only inline migrations are applied.
+func (m *migrator) AddSQL(version int, name, sql string) *migrator {
+	m.inline = append(m.inline, migration{Version: version, Name: name, SQL: sql})
+	return m
+}
 
-	// Create migration table (unless it already exists)
-	_, err := m.db.Exec(m.dialect.GetCreateMigrationTableSQL(MigrationTableName))
-	if err != nil {
-		return err
+func (m *migrator) Do() error {
+	if m.path != "" {
+		m.printf("Reading migrations from %s\n", m.path)
 	}
 
-	// Determine current migration number
-	var versionN sql.NullInt64
-	err = m.db.QueryRow(`SELECT version FROM ` + MigrationTableName + ` ORDER BY version DESC LIMIT 1`).Scan(&versionN)
-	if err != nil && err != sql.ErrNoRows {
+	version, err := m.prepare()
+	if err != nil {
 		return err
 	}
-	version := int(-1)
-	if versionN.Valid {
-		version = int(versionN.Int64)
-	}
 	if version >= 0 {
 		m.printf("Schema version: %d\n", version)
 	} else {
 		m.printf("No schema version found\n")
 	}
 
-	// Retrieve the list of all migrations in the given path
-	migrations := make([]migration, 0)
-	scripts, err := filepath.Glob(path.Join(m.path, "*.sql"))
+	migrations, err := m.migrations()
 	if err != nil {
 		return err
 	}
-	for _, script := range scripts {
-		matches := reMigrationName.FindStringSubmatch(filepath.Base(script))
-		if len(matches) == 2 {
-			scriptVersion, _ := strconv.Atoi(matches[1])
-			migration := migration{Version: scriptVersion, Path: script}
-			migrations = append(migrations, migration)
-		}
-	}
 
 	// Apply or skip all migrations
 	for _, migration := range migrations {
 		if migration.Version > version {
-			m.printf("Applying %s\n", filepath.Base(migration.Path))
+			m.printf("Applying %s\n", migration.name())
 
 			// Read file
-			data, err := ioutil.ReadFile(migration.Path)
+			data, err := migration.script()
 			if err != nil {
 				return err
 			}
-			m.debugf(string(data))
-			lines := strings.Split(string(data), ";")
+			m.debugf(data)
 
 			// Begin transaction
 			tx, err := m.db.Begin()
@@ -134,27 +207,9 @@ func (m *migrator) Do() error {
 			}
 
 			// Execute SQL script
-			for _, line := range lines {
-				line = strings.TrimSpace(line)
-
-				// Split lines and remove comments
-				var sqlbuf bytes.Buffer
-				for _, line := range strings.Split(line, "\n") {
-					if !strings.HasPrefix(line, "--") && !strings.HasPrefix(line, "#") {
-						sqlbuf.WriteString(line)
-						sqlbuf.WriteString("\n")
-					}
-				}
-				sql := strings.TrimSpace(sqlbuf.String())
-				if sql != "" {
-					m.debugf("%s\n", sql)
-
-					_, err := tx.Exec(sql)
-					if err != nil {
-						tx.Rollback()
-						return err
-					}
-				}
+			if err := m.execScript(tx, migration.name(), data); err != nil {
+				tx.Rollback()
+				return err
 			}
 
 			// Update to new version
@@ -172,19 +227,395 @@ func (m *migrator) Do() error {
 
 			version = migration.Version
 		} else {
-			m.printf("Skipping %s\n", filepath.Base(migration.Path))
+			m.printf("Skipping %s\n", migration.name())
+		}
+	}
+
+	return nil
+}
+
+// Rollback reverts the latest steps applied migrations, newest first, by
+// running their down scripts (e.g. 001_users.down.sql) and removing their
+// versions from the migrations table. Each migration is reverted in a
+// transaction of its own. If one of the migrations has no down script,
+// Rollback fails before reverting anything.
+func (m *migrator) Rollback(steps int) error {
+	if _, err := m.prepare(); err != nil {
+		return err
+	}
+
+	// Determine the versions to revert
+	rows, err := m.db.Query(`SELECT version FROM ` + m.dialect.EscapeTableName(MigrationTableName) + ` ORDER BY version DESC`)
+	if err != nil {
+		return err
+	}
+	versions := make([]int, 0, steps)
+	for len(versions) < steps && rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		versions = append(versions, version)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	migrations, err := m.migrations()
+	if err != nil {
+		return err
+	}
+	byVersion := make(map[int]migration)
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+	for _, version := range versions {
+		if byVersion[version].DownPath == "" {
+			return fmt.Errorf("dapper: no down migration for version %d", version)
+		}
+	}
+
+	// Revert all migrations
+	for _, version := range versions {
+		migration := byVersion[version]
+		m.printf("Reverting %s\n", migration.name())
+
+		// Read file
+		data, err := migration.downScript()
+		if err != nil {
+			return err
+		}
+		m.debugf(data)
+
+		// Begin transaction
+		tx, err := m.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		// Execute SQL script
+		if err := m.execScript(tx, path.Base(migration.DownPath), data); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// Remove version
+		sql := `DELETE FROM ` + m.dialect.EscapeTableName(MigrationTableName) + ` WHERE version=` + placeholder(m.dialect, 1)
+		_, err = tx.Exec(sql, migration.Version)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// Commit
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Status returns all migrations, ordered by version, and whether they
+// have been applied. It doesn't change the database, i.e. it doesn't even
+// create the migrations table. If the table doesn't exist yet, no
+// migration has been applied.
+func (m *migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := m.migrations()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		statuses[i] = MigrationStatus{
+			Version: migration.Version,
+			Name:    migration.name(),
+			Applied: applied[migration.Version],
 		}
 	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that Do would apply, ordered by version,
+// without changing the database. See Status.
+func (m *migrator) Pending() ([]migration, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+	version := -1
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	migrations, err := m.migrations()
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]migration, 0)
+	for _, migration := range migrations {
+		if migration.Version > version {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// appliedVersions returns the versions in the migrations table, or no
+// versions if the table doesn't exist yet.
+func (m *migrator) appliedVersions() (map[int]bool, error) {
+	// Use MySQL as the default dialect
+	if m.dialect == nil {
+		m.dialect = MySQL
+	}
+
+	applied := make(map[int]bool)
+	var tables int
+	err := m.db.QueryRow(migrationTableExistsSQL(m.dialect, MigrationTableName)).Scan(&tables)
+	if err != nil {
+		return nil, err
+	}
+	if tables == 0 {
+		return applied, nil
+	}
+	rows, err := m.db.Query(`SELECT version FROM ` + m.dialect.EscapeTableName(MigrationTableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// prepare creates the migrations table (unless it already exists) and
+// returns the current schema version, or -1 if there is none.
+func (m *migrator) prepare() (int, error) {
+	// Use MySQL as the default dialect
+	if m.dialect == nil {
+		m.dialect = MySQL
+	}
+
+	// Create migration table (unless it already exists)
+	_, err := m.db.Exec(m.dialect.GetCreateMigrationTableSQL(MigrationTableName))
+	if err != nil {
+		return -1, err
+	}
+
+	// Determine current migration number
+	var versionN sql.NullInt64
+	err = m.db.QueryRow(`SELECT MAX(version) FROM ` + m.dialect.EscapeTableName(MigrationTableName)).Scan(&versionN)
+	if err != nil && err != sql.ErrNoRows {
+		return -1, err
+	}
+	if versionN.Valid {
+		return int(versionN.Int64), nil
+	}
+	return -1, nil
+}
+
+// migrations returns the migrations in path and the inline migrations,
+// ordered by version.
+func (m *migrator) migrations() ([]migration, error) {
+	// Retrieve the list of all migrations in the given path
+	migrations := make([]migration, 0)
+	if m.fsys != nil {
+		scripts, err := fs.Glob(m.fsys, path.Join(m.dir, "*.sql"))
+		if err != nil {
+			return nil, err
+		}
+		downs := make(map[int]string)
+		for _, script := range scripts {
+			matches := reMigrationName.FindStringSubmatch(path.Base(script))
+			if len(matches) == 3 {
+				scriptVersion, _ := strconv.Atoi(matches[1])
+				if matches[2] == "down" {
+					downs[scriptVersion] = script
+					continue
+				}
+				migration := migration{Version: scriptVersion, Path: script, fsys: m.fsys}
+				migrations = append(migrations, migration)
+			}
+		}
+		for i := range migrations {
+			migrations[i].DownPath = downs[migrations[i].Version]
+		}
+	}
+
+	// Interleave inline migrations by version
+	migrations = append(migrations, m.inline...)
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
 
+// execScript executes the statements of the migration script data,
+// separated by semicolons, in tx. See splitStatements.
+func (m *migrator) execScript(tx *sql.Tx, name, data string) error {
+	_, backslashEscapes := m.dialect.(*MySQLDialect)
+	savepoints := m.continueOnError != nil && supportsSavepoints(m.dialect)
+	for _, sql := range splitStatements(data, backslashEscapes) {
+		m.debugf("%s\n", sql)
+
+		if savepoints {
+			if _, err := tx.Exec("SAVEPOINT " + migrationSavepoint); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(sql)
+		if err != nil && m.continueOnError != nil && m.continueOnError(err) {
+			m.warnf("Ignoring error in %s: %v\n", name, err)
+			if savepoints {
+				m.debugf("ROLLBACK TO SAVEPOINT %s\n", migrationSavepoint)
+				if _, err := tx.Exec("ROLLBACK TO SAVEPOINT " + migrationSavepoint); err != nil {
+					return err
+				}
+			}
+		} else if err != nil {
+			return err
+		}
+		if savepoints {
+			if _, err := tx.Exec("RELEASE SAVEPOINT " + migrationSavepoint); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// migrationSavepoint is the name of the savepoint of ContinueOnError.
+const migrationSavepoint = "dapper_migration"
+
+// supportsSavepoints returns true if statements of a migration can be
+// rolled back with SAVEPOINT, ROLLBACK TO SAVEPOINT, and RELEASE SAVEPOINT.
+// MySQL commits DDL statements implicitly, and Oracle has no RELEASE
+// SAVEPOINT.
+func supportsSavepoints(d Dialect) bool {
+	switch d.(type) {
+	case *PostgreSQLDialect, *Sqlite3Dialect:
+		return true
+	}
+	return false
+}
+
+// splitStatements splits the migration script data into statements
+// separated by semicolons. Semicolons in quoted strings and identifiers,
+// in PostgreSQL dollar-quoted strings (e.g. $$ ... $$ or $body$ ... $body$),
+// and in comments don't end a statement. Comments starting with -- and
+// lines starting with # are removed. If backslashEscapes is true, a
+// backslash escapes the next character in quoted strings, as in MySQL.
+//
+// Scripts whose first line is NoSplitDirective are executed as a single
+// statement, e.g. for a stored procedure with BEGIN ... END; blocks.
+func splitStatements(data string, backslashEscapes bool) []string {
+	if sql := strings.TrimSpace(data); strings.HasPrefix(sql, NoSplitDirective) {
+		return []string{sql}
+	}
+
+	stmts := make([]string, 0)
+	var b bytes.Buffer
+	flush := func() {
+		if sql := strings.TrimSpace(b.String()); sql != "" {
+			stmts = append(stmts, sql)
+		}
+		b.Reset()
+	}
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '-' && strings.HasPrefix(data[i:], "--"), c == '#' && atLineStart(data, i):
+			// Skip comment up to the end of the line
+			for i+1 < len(data) && data[i+1] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(data[i:], "/*"):
+			end := strings.Index(data[i+2:], "*/")
+			if end < 0 {
+				end = len(data)
+			} else {
+				end += i + 4
+			}
+			b.WriteString(data[i:end])
+			i = end - 1
+		case c == '\'' || c == '"' || c == '`':
+			end := closingQuote(data, i, backslashEscapes && c != '`')
+			b.WriteString(data[i:end])
+			i = end - 1
+		case c == '$' && reDollarTag.MatchString(data[i:]):
+			tag := reDollarTag.FindString(data[i:])
+			end := strings.Index(data[i+len(tag):], tag)
+			if end < 0 {
+				end = len(data)
+			} else {
+				end += i + 2*len(tag)
+			}
+			b.WriteString(data[i:end])
+			i = end - 1
+		case c == ';':
+			flush()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	flush()
+	return stmts
+}
+
+// atLineStart returns true if data has only whitespace before index i on
+// the same line.
+func atLineStart(data string, i int) bool {
+	for i--; i >= 0 && data[i] != '\n'; i-- {
+		if data[i] != ' ' && data[i] != '\t' && data[i] != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// closingQuote returns the index after the quote that closes the quoted
+// string or identifier starting at index i of data. Doubled quotes are
+// part of the string.
+func closingQuote(data string, i int, backslashEscapes bool) int {
+	quote := data[i]
+	for j := i + 1; j < len(data); j++ {
+		switch {
+		case backslashEscapes && data[j] == '\\':
+			j++
+		case data[j] == quote && j+1 < len(data) && data[j+1] == quote:
+			j++
+		case data[j] == quote:
+			return j + 1
+		}
+	}
+	return len(data)
+}
+
 func (m *migrator) printf(format string, args ...interface{}) {
 	if m.verbose && m.out != nil {
 		fmt.Fprintf(m.out, format, args...)
 	}
 }
 
+// warnf writes to the output even if not verbose.
+func (m *migrator) warnf(format string, args ...interface{}) {
+	if m.out != nil {
+		fmt.Fprintf(m.out, format, args...)
+	}
+}
+
 func (m *migrator) debugf(format string, args ...interface{}) {
 	if m.debug && m.out != nil {
 		fmt.Fprintf(m.out, format, args...)
@@ -1,9 +1,12 @@
 package dapper
 
 import (
+	"bytes"
 	"database/sql"
 	"os"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -117,3 +120,416 @@ func TestMigrate(t *testing.T) {
 		t.Error("expected to not have 'members' table, but we do")
 	}
 }
+
+func TestMigrateWithInlineSQL(t *testing.T) {
+	os.Remove("./migrate_test_data.db")
+	db, err := sql.Open("sqlite3", "./migrate_test_data.db")
+	if err != nil {
+		t.Fatalf("error connection to database: %v", err)
+	}
+	defer db.Close()
+
+	session := New(db).Dialect(Sqlite3)
+
+	// Inline migrations only
+	err = NewMigrator(db, Sqlite3, "").
+		AddSQL(2, "tags", "CREATE TABLE tags (id integer not null primary key, name text)").
+		AddSQL(1, "posts", "CREATE TABLE posts (id integer not null primary key, title text);\nINSERT INTO posts (id, title) VALUES (1, 'Hello')").
+		Do()
+	if err != nil {
+		t.Fatalf("expected inline migrations to succeed, got: %v", err)
+	}
+	count, err := session.Count("SELECT COUNT(*) FROM "+MigrationTableName, nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected to have 2 schema entries, got: %v", count)
+	}
+	count, err = session.Count("SELECT COUNT(*) FROM posts", nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected to have 1 post, got: %v", count)
+	}
+	count, err = session.Count("SELECT COUNT(*) FROM sqlite_master WHERE name='tags'", nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 1 {
+		t.Error("expected to have 'tags' table, but we don't")
+	}
+
+	// Inline migrations are interleaved with files by version
+	os.Remove("./migrate_test_data.db")
+	db2, err := sql.Open("sqlite3", "./migrate_test_data.db")
+	if err != nil {
+		t.Fatalf("error connection to database: %v", err)
+	}
+	defer db2.Close()
+
+	// Version 4 would fail if applied before 003_products.sql
+	err = NewMigrator(db2, Sqlite3, "./migrate_test_data/step2/").
+		AddSQL(4, "first product", "INSERT INTO products (id, name) VALUES (1, 'Go')").
+		AddSQL(1, "tags", "CREATE TABLE tags (id integer not null primary key, name text)").
+		Do()
+	if err != nil {
+		t.Fatalf("expected migrations to succeed, got: %v", err)
+	}
+	count, err = New(db2).Dialect(Sqlite3).Count("SELECT COUNT(*) FROM "+MigrationTableName, nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected to have 3 schema entries, got: %v", count)
+	}
+}
+
+func TestMigrateContinueOnError(t *testing.T) {
+	os.Remove("./migrate_test_data.db")
+	db, err := sql.Open("sqlite3", "./migrate_test_data.db")
+	if err != nil {
+		t.Fatalf("error connection to database: %v", err)
+	}
+	defer db.Close()
+
+	session := New(db).Dialect(Sqlite3)
+	if _, err := db.Exec("CREATE TABLE tags (id integer not null primary key, name text)"); err != nil {
+		t.Fatalf("error creating table tags: %v", err)
+	}
+
+	catchUp := "CREATE TABLE tags (id integer not null primary key, name text);\nINSERT INTO tags (id, name) VALUES (1, 'go')"
+
+	// By default, the migration aborts
+	err = NewMigrator(db, Sqlite3, "").AddSQL(1, "tags", catchUp).Do()
+	if err == nil {
+		t.Fatal("expected migration to fail")
+	}
+	count, err := session.Count("SELECT COUNT(*) FROM tags", nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected to have 0 tags, got: %v", count)
+	}
+
+	// Tolerate "already exists" errors, rolling back to a savepoint
+	var out bytes.Buffer
+	err = NewMigrator(db, Sqlite3, "").
+		Out(&out).
+		Debug(true).
+		AddSQL(1, "tags", catchUp).
+		ContinueOnError(func(err error) bool {
+			return strings.Contains(err.Error(), "already exists")
+		}).
+		Do()
+	if err != nil {
+		t.Fatalf("expected migration to succeed, got: %v", err)
+	}
+	count, err = session.Count("SELECT COUNT(*) FROM tags", nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected to have 1 tag, got: %v", count)
+	}
+	count, err = session.Count("SELECT COUNT(*) FROM "+MigrationTableName, nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected to have 1 schema entry, got: %v", count)
+	}
+	if !strings.Contains(out.String(), "already exists") {
+		t.Errorf("expected ignored error to be logged, got: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "ROLLBACK TO SAVEPOINT") {
+		t.Errorf("expected failed statement to be rolled back to a savepoint, got: %q", out.String())
+	}
+}
+
+func TestMigrateRollback(t *testing.T) {
+	os.Remove("./migrate_test_data.db")
+	db, err := sql.Open("sqlite3", "./migrate_test_data.db")
+	if err != nil {
+		t.Fatalf("error connection to database: %v", err)
+	}
+	defer db.Close()
+
+	session := New(db).Dialect(Sqlite3)
+
+	// Down migrations must not be applied
+	err = NewMigrator(db, Sqlite3, "./migrate_test_data/rollback/").Do()
+	if err != nil {
+		t.Fatalf("expected migrations to succeed, got: %v", err)
+	}
+	count, err := session.Count("SELECT COUNT(*) FROM "+MigrationTableName, nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected to have 3 schema entries, got: %v", count)
+	}
+	count, err = session.Count("SELECT COUNT(*) FROM sqlite_master WHERE name IN ('users','firms','products','categories')", nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("expected to have 4 tables, got: %v", count)
+	}
+
+	// Revert 003_products
+	err = NewMigrator(db, Sqlite3, "./migrate_test_data/rollback/").Rollback(1)
+	if err != nil {
+		t.Fatalf("expected rollback to succeed, got: %v", err)
+	}
+	count, err = session.Count("SELECT COUNT(*) FROM "+MigrationTableName, nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected to have 2 schema entries, got: %v", count)
+	}
+	count, err = session.Count("SELECT COUNT(*) FROM sqlite_master WHERE name IN ('products','categories')", nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected to have no 'products' and 'categories' tables, got: %v", count)
+	}
+
+	// 002_firms has no down migration, so nothing is reverted
+	err = NewMigrator(db, Sqlite3, "./migrate_test_data/rollback/").Rollback(2)
+	if err == nil {
+		t.Error("expected rollback without down migration to fail, got no error")
+	}
+	count, err = session.Count("SELECT COUNT(*) FROM "+MigrationTableName, nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected to have 2 schema entries, got: %v", count)
+	}
+
+	// Apply 003_products again
+	err = NewMigrator(db, Sqlite3, "./migrate_test_data/rollback/").Do()
+	if err != nil {
+		t.Fatalf("expected migrations to succeed, got: %v", err)
+	}
+	count, err = session.Count("SELECT COUNT(*) FROM sqlite_master WHERE name IN ('products','categories')", nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected to have 'products' and 'categories' tables, got: %v", count)
+	}
+}
+
+func TestMigrateStatusAndPending(t *testing.T) {
+	os.Remove("./migrate_test_data.db")
+	db, err := sql.Open("sqlite3", "./migrate_test_data.db")
+	if err != nil {
+		t.Fatalf("error connection to database: %v", err)
+	}
+	defer db.Close()
+
+	session := New(db).Dialect(Sqlite3)
+	m := NewMigrator(db, Sqlite3, "./migrate_test_data/step1/")
+
+	pending, err := m.Pending()
+	if err != nil {
+		t.Fatalf("expected Pending to succeed, got: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Errorf("expected %d pending migrations, got %d", 2, len(pending))
+	}
+
+	// Status and Pending don't create the migrations table
+	count, err := session.Count("SELECT COUNT(*) FROM sqlite_master WHERE name='"+MigrationTableName+"'", nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected to not have '%s' table, but we do", MigrationTableName)
+	}
+
+	if err := m.Do(); err != nil {
+		t.Fatalf("expected migrations in step 1 to succeed, got: %v", err)
+	}
+
+	pending, err = m.Pending()
+	if err != nil {
+		t.Fatalf("expected Pending to succeed, got: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected %d pending migrations, got %d", 0, len(pending))
+	}
+
+	// Migrations of step 2 are pending now
+	m = NewMigrator(db, Sqlite3, "./migrate_test_data/step2/").AddSQL(1, "users", "")
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("expected Status to succeed, got: %v", err)
+	}
+	expected := []MigrationStatus{
+		{Version: 1, Name: "users", Applied: true},
+		{Version: 3, Name: "003_products.sql", Applied: false},
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, statuses)
+	}
+	for i := range expected {
+		if statuses[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], statuses[i])
+		}
+	}
+	pending, err = m.Pending()
+	if err != nil {
+		t.Fatalf("expected Pending to succeed, got: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Version != 3 {
+		t.Errorf("expected version %d to be pending, got %v", 3, pending)
+	}
+}
+
+func TestMigrateStatusWithUnreadableTable(t *testing.T) {
+	os.Remove("./migrate_test_data.db")
+	db, err := sql.Open("sqlite3", "./migrate_test_data.db")
+	if err != nil {
+		t.Fatalf("error connection to database: %v", err)
+	}
+	defer db.Close()
+
+	// The table exists, but cannot be read, so it's not "no migrations"
+	if _, err := db.Exec("CREATE TABLE " + MigrationTableName + " (id integer not null primary key)"); err != nil {
+		t.Fatalf("error creating table %s: %v", MigrationTableName, err)
+	}
+	m := NewMigrator(db, Sqlite3, "./migrate_test_data/step1/")
+	if _, err := m.Status(); err == nil {
+		t.Errorf("expected Status to fail")
+	}
+	if _, err := m.Pending(); err == nil {
+		t.Errorf("expected Pending to fail")
+	}
+}
+
+func TestMigrateFS(t *testing.T) {
+	os.Remove("./migrate_test_data.db")
+	db, err := sql.Open("sqlite3", "./migrate_test_data.db")
+	if err != nil {
+		t.Fatalf("error connection to database: %v", err)
+	}
+	defer db.Close()
+
+	session := New(db).Dialect(Sqlite3)
+
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql":     {Data: []byte("CREATE TABLE users (id integer not null primary key, name text)")},
+		"migrations/002_tags.up.sql":   {Data: []byte("CREATE TABLE tags (id integer not null primary key, name text)")},
+		"migrations/002_tags.down.sql": {Data: []byte("DROP TABLE tags")},
+		"migrations/README.md":         {Data: []byte("Not a migration")},
+		"other/003_ignored.sql":        {Data: []byte("ERSTELLE TABLE ignored (name text)")},
+	}
+
+	err = NewMigratorFS(db, Sqlite3, fsys, "migrations").Do()
+	if err != nil {
+		t.Fatalf("expected migrations to succeed, got: %v", err)
+	}
+	count, err := session.Count("SELECT COUNT(*) FROM "+MigrationTableName, nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected to have 2 schema entries, got: %v", count)
+	}
+	count, err = session.Count("SELECT COUNT(*) FROM sqlite_master WHERE name IN ('users','tags')", nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected to have 2 tables, got: %v", count)
+	}
+
+	err = NewMigratorFS(db, Sqlite3, fsys, "migrations").Rollback(1)
+	if err != nil {
+		t.Fatalf("expected rollback to succeed, got: %v", err)
+	}
+	count, err = session.Count("SELECT COUNT(*) FROM sqlite_master WHERE name='tags'", nil)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 0 {
+		t.Error("expected to not have 'tags' table, but we do")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		Script           string
+		BackslashEscapes bool
+		Expected         []string
+	}{
+		{"", false, []string{}},
+		{"CREATE TABLE a (id int);\nCREATE TABLE b (id int);\n", false, []string{"CREATE TABLE a (id int)", "CREATE TABLE b (id int)"}},
+		{"-- Comment; with semicolon\nINSERT INTO a VALUES (1); -- trailing\n# Hash comment;\nINSERT INTO a VALUES (2)", false, []string{"INSERT INTO a VALUES (1)", "INSERT INTO a VALUES (2)"}},
+		{"INSERT INTO a (name) VALUES ('x;y');INSERT INTO a (name) VALUES ('it''s;')", false, []string{"INSERT INTO a (name) VALUES ('x;y')", "INSERT INTO a (name) VALUES ('it''s;')"}},
+		{"INSERT INTO a (name) VALUES ('it\\'s;');SELECT 1", true, []string{"INSERT INTO a (name) VALUES ('it\\'s;')", "SELECT 1"}},
+		{"INSERT INTO a (name) VALUES ('C:\\');SELECT 1", false, []string{"INSERT INTO a (name) VALUES ('C:\\')", "SELECT 1"}},
+		{"SELECT \"a;b\", `c;d` FROM t /* x; y */;SELECT 1", false, []string{"SELECT \"a;b\", `c;d` FROM t /* x; y */", "SELECT 1"}},
+		{"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql;SELECT $1", false, []string{"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql", "SELECT $1"}},
+		{"CREATE FUNCTION f() AS $body$ SELECT 'a;b'; $body$;", false, []string{"CREATE FUNCTION f() AS $body$ SELECT 'a;b'; $body$"}},
+		{NoSplitDirective + "\nCREATE TRIGGER t AFTER INSERT ON a BEGIN UPDATE b SET n=n+1; END;\n", false, []string{NoSplitDirective + "\nCREATE TRIGGER t AFTER INSERT ON a BEGIN UPDATE b SET n=n+1; END;"}},
+	}
+
+	for _, test := range tests {
+		got := splitStatements(test.Script, test.BackslashEscapes)
+		if len(got) != len(test.Expected) {
+			t.Errorf("%q: expected %q, got %q", test.Script, test.Expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.Expected[i] {
+				t.Errorf("%q: expected %q, got %q", test.Script, test.Expected[i], got[i])
+			}
+		}
+	}
+}
+
+func TestMigrateWithSemicolonInString(t *testing.T) {
+	os.Remove("./migrate_test_data.db")
+	db, err := sql.Open("sqlite3", "./migrate_test_data.db")
+	if err != nil {
+		t.Fatalf("error connection to database: %v", err)
+	}
+	defer db.Close()
+
+	session := New(db).Dialect(Sqlite3)
+
+	fsys := fstest.MapFS{
+		"001_notes.sql":   {Data: []byte("CREATE TABLE notes (id integer not null primary key, body text);\nINSERT INTO notes (id, body) VALUES (1, 'first; second');\n")},
+		"002_trigger.sql": {Data: []byte(NoSplitDirective + "\nCREATE TRIGGER notes_upper AFTER INSERT ON notes BEGIN\n  UPDATE notes SET body=upper(body) WHERE id=new.id;\nEND;\n")},
+	}
+	err = NewMigratorFS(db, Sqlite3, fsys, ".").Do()
+	if err != nil {
+		t.Fatalf("expected migrations to succeed, got: %v", err)
+	}
+
+	var body string
+	if err := session.Find("SELECT body FROM notes WHERE id=1", nil).Scalar(&body); err != nil {
+		t.Fatalf("error on Scalar: %v", err)
+	}
+	if body != "first; second" {
+		t.Errorf("expected %q, got %q", "first; second", body)
+	}
+
+	if _, err := db.Exec("INSERT INTO notes (id, body) VALUES (2, 'third')"); err != nil {
+		t.Fatalf("error on insert: %v", err)
+	}
+	if err := session.Find("SELECT body FROM notes WHERE id=2", nil).Scalar(&body); err != nil {
+		t.Fatalf("error on Scalar: %v", err)
+	}
+	if body != "THIRD" {
+		t.Errorf("expected %q, got %q", "THIRD", body)
+	}
+}
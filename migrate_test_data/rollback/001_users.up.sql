@@ -0,0 +1,4 @@
+CREATE TABLE users (
+  id integer not null primary key autoincrement,
+  name varchar(32)
+);
@@ -0,0 +1,3 @@
+CREATE TABLE firms (
+  name varchar(32)
+);
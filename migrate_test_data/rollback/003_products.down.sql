@@ -0,0 +1,3 @@
+-- Revert in reverse order
+DROP TABLE categories;
+DROP TABLE products;
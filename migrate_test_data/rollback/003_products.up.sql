@@ -0,0 +1,8 @@
+CREATE TABLE products (
+  id integer not null primary key autoincrement,
+  name text
+);
+CREATE TABLE categories (
+  id integer not null primary key autoincrement,
+  name text
+);
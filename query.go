@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 // SafeSqlString represents an unescape SQL string
@@ -19,8 +20,21 @@ type Query struct {
 	where   *whereClause
 	limit   *limitClause
 	orders  []*orderClause
+	unions  []*union
+	args    *[]interface{} // collects bound values in SqlWithArgs
+	scoped  bool           // built by a scoped session, see Session.Q
 }
 
+// union is a query combined with UNION or UNION ALL.
+type union struct {
+	q   *Query
+	all bool
+}
+
+// Q starts a query on table in the given dialect, or MySQL if dialect
+// is nil. Table and column names are written as passed, so they can be
+// expressions, qualified names, or names escaped by the caller, e.g. with
+// Dialect.EscapeTableName.
 func Q(dialect Dialect, table string) *Query {
 	if dialect == nil {
 		dialect = MySQL
@@ -39,11 +53,13 @@ func (q *Query) Alias(alias string) *Query {
 	return q
 }
 
+// Project selects columns, which are strings, SafeSqlStrings, or
+// sub queries. Strings are written as passed, e.g. "count(*)".
 func (q *Query) Project(columns ...interface{}) *Query {
 	for _, column := range columns {
 		switch t := column.(type) {
 		default:
-			q.columns = append(q.columns, q.dialect.QuoteString(t.(string)))
+			q.columns = append(q.columns, t.(string))
 		case SafeSqlString:
 			q.columns = append(q.columns, string(t))
 		case *Query:
@@ -101,6 +117,35 @@ func (q *Query) Order() *orderClause {
 	return c
 }
 
+// orderBy orders the results by the SQL expression expr, e.g. "id DESC".
+func (q *Query) orderBy(expr string) *Query {
+	if expr != "" {
+		q.Order().By(expr)
+	}
+	return q
+}
+
+// OrderRandom orders the results randomly, e.g. to pick a random sample.
+// It uses RAND() for MySQL and RANDOM() for Sqlite3 and PostgreSQL.
+func (q *Query) OrderRandom() *Query {
+	q.Order().By(randomFunctionSQL(q.dialect))
+	return q
+}
+
+// OrderNullsLast orders the results by column in direction dir ("ASC" or
+// "DESC"), with NULL values last, consistently across dialects.
+// Dialects without NULLS LAST order by "column IS NULL" first.
+func (q *Query) OrderNullsLast(column, dir string) *Query {
+	return q.Order().NullsLast(column, dir).Query()
+}
+
+// OrderNullsFirst orders the results by column in direction dir ("ASC"
+// or "DESC"), with NULL values first, consistently across dialects.
+// Dialects without NULLS FIRST order by "column IS NOT NULL" first.
+func (q *Query) OrderNullsFirst(column, dir string) *Query {
+	return q.Order().NullsFirst(column, dir).Query()
+}
+
 func (q *Query) Take(take int) *Query {
 	if q.limit == nil {
 		q.limit = &limitClause{}
@@ -117,10 +162,123 @@ func (q *Query) Skip(skip int) *Query {
 	return q
 }
 
+// Page limits the query to page (starting at 1) of perPage results, i.e.
+// it skips (page-1)*perPage results and takes perPage. A page < 1 is
+// treated as the first page, and a perPage < 1 as a single result per
+// page.
+func (q *Query) Page(page, perPage int) *Query {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 1
+	}
+	return q.Skip((page - 1) * perPage).Take(perPage)
+}
+
+// Seek limits the query to the next n results after last, ordered by
+// column in ascending order, i.e. it adds "column > last" to the WHERE
+// clause, orders by column and takes n. A nil last starts at the first
+// page. Unlike Page, the database doesn't have to skip the previous
+// pages, so column should be unique and indexed, e.g. the primary key.
+// See Session.Seek to load the pages.
+func (q *Query) Seek(column string, last interface{}, n int) *Query {
+	if last != nil {
+		q.Where().Gt(column, last)
+	}
+	return q.Order().Asc(column).Query().Take(n)
+}
+
 func (q *Query) Query() *Query {
 	return q
 }
 
+// InjectWhere adds node to the WHERE clause of the query, e.g. to add
+// a tenant filter to every query centrally.
+func (q *Query) InjectWhere(node WhereNode) *Query {
+	wc := q.Where()
+	wc.nodes = append(wc.nodes, node)
+	return q
+}
+
+// Dialect returns the dialect of the query.
+func (q *Query) Dialect() Dialect {
+	return q.dialect
+}
+
+// TableName returns the name of the table to select from.
+func (q *Query) TableName() string {
+	return q.t.name
+}
+
+// TableAlias returns the alias of the table to select from, if any.
+func (q *Query) TableAlias() string {
+	return q.t.alias
+}
+
+// Qualify returns column prefixed with the alias of the table to select
+// from, e.g. u.id for alias u, or column as-is if there is no alias.
+// Use it to tell the columns of a table apart when joining it with
+// itself.
+func (q *Query) Qualify(column string) string {
+	if q.t.alias == "" {
+		return column
+	}
+	return q.t.alias + "." + column
+}
+
+// Columns returns the projections of the query. It is empty if all
+// columns are selected.
+func (q *Query) Columns() []string {
+	return q.columns
+}
+
+// Joins returns the joins of the query.
+func (q *Query) Joins() []*joinClause {
+	return q.joins
+}
+
+// WhereNodes returns the nodes of the WHERE clause of the query.
+func (q *Query) WhereNodes() []WhereNode {
+	if q.where == nil {
+		return nil
+	}
+	return q.where.nodes
+}
+
+// Union combines the query with other via UNION, i.e. duplicates are
+// removed. Orders and limits of the query apply to the combined result,
+// while those of other only apply to other.
+//
+// Example:
+// Q(MySQL, "users").Where().Lt("id", 10).Union(Q(MySQL, "users").Where().Gt("id", 100).Query()).Order().Asc("id")
+// => (SELECT * FROM users WHERE id<10) UNION (SELECT * FROM users WHERE id>100) ORDER BY id ASC
+func (q *Query) Union(other *Query) *Query {
+	q.unions = append(q.unions, &union{q: other})
+	return q
+}
+
+// UnionAll combines the query with other via UNION ALL, i.e. duplicates
+// are kept. See Union for details.
+func (q *Query) UnionAll(other *Query) *Query {
+	q.unions = append(q.unions, &union{q: other, all: true})
+	return q
+}
+
+// isScoped reports whether q and all queries combined with it via Union
+// or UnionAll were built by a scoped session.
+func (q *Query) isScoped() bool {
+	if !q.scoped {
+		return false
+	}
+	for _, u := range q.unions {
+		if !u.q.isScoped() {
+			return false
+		}
+	}
+	return true
+}
+
 func (q *Query) Sql() string {
 	var b bytes.Buffer
 	b.WriteString("SELECT ")
@@ -134,20 +292,9 @@ func (q *Query) Sql() string {
 			b.WriteString(column)
 		}
 	}
-	b.WriteString(" FROM ")
-	b.WriteString(q.t.SubSql())
-	if len(q.joins) > 0 {
-		b.WriteString(" ")
-		for i, join := range q.joins {
-			if i > 0 {
-				b.WriteString(" ")
-			}
-			b.WriteString(join.SubSql())
-		}
-	}
-	if q.where != nil {
-		b.WriteString(" WHERE ")
-		b.WriteString(q.where.SubSql())
+	q.writeFromSql(&b)
+	if len(q.unions) > 0 {
+		q.writeUnionSql(&b)
 	}
 	if len(q.orders) > 0 {
 		b.WriteString(" ORDER BY ")
@@ -168,10 +315,137 @@ func (q *Query) Sql() string {
 	return b.String()
 }
 
+// SqlWithArgs is like Sql, but renders the values of the WHERE clause
+// and of Field orders as placeholders of the dialect (e.g. ? for MySQL
+// and $1 for PostgreSQL) and returns them as args, in order. Use it to
+// execute queries with values from untrusted input:
+//
+//	sql, args := Q(PostgreSQL, "users").Where().Eq("name", name).SqlWithArgs()
+//	rows, err := db.Query(sql, args...)
+//
+// Values are passed to the driver as-is. SafeSqlString values and
+// subqueries are still written literally.
+func (q *Query) SqlWithArgs() (string, []interface{}) {
+	args := make([]interface{}, 0)
+	q.args = &args
+	defer func() { q.args = nil }()
+	sql := q.Sql()
+	return sql, args
+}
+
+// bind returns value as an SQL literal, or as a placeholder if the
+// query is rendered by SqlWithArgs.
+func (q *Query) bind(value interface{}) string {
+	if q.args == nil {
+		return Quote(q.dialect, value)
+	}
+	*q.args = append(*q.args, value)
+	return placeholder(q.dialect, len(*q.args))
+}
+
+// sqlWithIsNull returns the SQL of q with the condition "column IS NULL"
+// in the WHERE clause of q and of all queries in its unions, e.g. to
+// filter soft-deleted rows. The query itself is left unchanged.
+func (q *Query) sqlWithIsNull(column string) string {
+	restore := q.addIsNull(column)
+	defer restore()
+	return q.Sql()
+}
+
+// addIsNull adds "column IS NULL" to the WHERE clauses of q and its
+// unions, and returns a func that removes it again.
+func (q *Query) addIsNull(column string) func() {
+	where := q.where
+	var nodes []WhereNode
+	if where != nil {
+		nodes = where.nodes
+	}
+	q.Where().IsNull(q.Qualify(column))
+	restores := make([]func(), 0, len(q.unions))
+	for _, u := range q.unions {
+		restores = append(restores, u.q.addIsNull(column))
+	}
+	return func() {
+		q.where = where
+		if where != nil {
+			where.nodes = nodes
+		}
+		for _, restore := range restores {
+			restore()
+		}
+	}
+}
+
+// writeUnionSql combines the SELECT in b with the unions of the query.
+func (q *Query) writeUnionSql(b *bytes.Buffer) {
+	sql := b.String()
+	b.Reset()
+	b.WriteString(compoundMemberSQL(q.dialect, sql))
+	for _, u := range q.unions {
+		if u.all {
+			b.WriteString(" UNION ALL ")
+		} else {
+			b.WriteString(" UNION ")
+		}
+		// Collect bound values of other in order, too
+		u.q.args = q.args
+		b.WriteString(compoundMemberSQL(u.q.dialect, u.q.Sql()))
+		u.q.args = nil
+	}
+}
+
+// WhereSql returns the conditions of the WHERE clause, joined with AND,
+// but without the WHERE keyword, e.g. to use them in hand-written SQL.
+// It returns an empty string if the query has no conditions.
+func (q *Query) WhereSql() string {
+	if q.where == nil {
+		return ""
+	}
+	return q.where.SubSql()
+}
+
+// ExistsSql wraps the query into an existence check, i.e.
+// SELECT EXISTS(SELECT 1 FROM ... WHERE ... LIMIT 1), or the equivalent
+// of dialects implementing ExistsDialect.
+// Projections, orders, and limits of the query are ignored.
+func (q *Query) ExistsSql() string {
+	var b bytes.Buffer
+	b.WriteString("SELECT 1")
+	q.writeFromSql(&b)
+	sql := q.dialect.GetLimitString(b.String(), -1, 1)
+	if ed, ok := q.dialect.(ExistsDialect); ok {
+		return ed.GetExistsSQL(sql)
+	}
+	return fmt.Sprintf("SELECT EXISTS(%s)", sql)
+}
+
 func (q *Query) String() string {
 	return q.Sql()
 }
 
+// writeFromSql writes the FROM, JOIN, and WHERE parts of the query.
+// The FROM part is omitted if the query has no table, e.g. for
+// SELECT NOW().
+func (q *Query) writeFromSql(b *bytes.Buffer) {
+	if q.t.name != "" {
+		b.WriteString(" FROM ")
+		b.WriteString(q.t.SubSql())
+	}
+	if len(q.joins) > 0 {
+		b.WriteString(" ")
+		for i, join := range q.joins {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			b.WriteString(join.SubSql())
+		}
+	}
+	if q.where != nil {
+		b.WriteString(" WHERE ")
+		b.WriteString(q.where.SubSql())
+	}
+}
+
 // Tables
 
 type tableClause struct {
@@ -206,6 +480,18 @@ func (t *tableClause) Skip(take int) *Query {
 	return t.q.Skip(take)
 }
 
+func (t *tableClause) Page(page, perPage int) *Query {
+	return t.q.Page(page, perPage)
+}
+
+func (t *tableClause) Union(other *Query) *Query {
+	return t.q.Union(other)
+}
+
+func (t *tableClause) UnionAll(other *Query) *Query {
+	return t.q.UnionAll(other)
+}
+
 func (t *tableClause) Sql() string {
 	return t.q.Sql()
 }
@@ -216,10 +502,10 @@ func (t *tableClause) Query() *Query {
 
 func (t *tableClause) SubSql() string {
 	var b bytes.Buffer
-	b.WriteString(t.q.dialect.QuoteString(t.name))
+	b.WriteString(t.name)
 	if t.alias != "" {
 		b.WriteString(" ")
-		b.WriteString(t.q.dialect.QuoteString(t.alias))
+		b.WriteString(t.alias)
 	}
 	return b.String()
 }
@@ -253,6 +539,26 @@ func (j *joinClause) On(left, right string) *joinClause {
 	return j
 }
 
+// TableName returns the name of the joined table.
+func (j *joinClause) TableName() string {
+	return j.t.name
+}
+
+// TableAlias returns the alias of the joined table, if any.
+func (j *joinClause) TableAlias() string {
+	return j.t.alias
+}
+
+// JoinKind returns the kind of join, e.g. INNER or LEFT OUTER.
+func (j *joinClause) JoinKind() string {
+	return j.kind
+}
+
+// Condition returns the left and right side of the ON condition.
+func (j *joinClause) Condition() (string, string) {
+	return j.left, j.right
+}
+
 func (j *joinClause) Join(table string) *joinClause {
 	return j.q.Join(table)
 }
@@ -269,6 +575,18 @@ func (j *joinClause) Skip(take int) *Query {
 	return j.q.Skip(take)
 }
 
+func (j *joinClause) Page(page, perPage int) *Query {
+	return j.q.Page(page, perPage)
+}
+
+func (j *joinClause) Union(other *Query) *Query {
+	return j.q.Union(other)
+}
+
+func (j *joinClause) UnionAll(other *Query) *Query {
+	return j.q.UnionAll(other)
+}
+
 func (j *joinClause) Query() *Query {
 	return j.q
 }
@@ -296,18 +614,23 @@ func (j *joinClause) SubSql() string {
 
 type whereClause struct {
 	q     *Query
-	nodes []whereNode
+	nodes []WhereNode
 }
 
 func NewWhereClause(query *Query) *whereClause {
 	wc := &whereClause{
 		q:     query,
-		nodes: make([]whereNode, 0),
+		nodes: make([]WhereNode, 0),
 	}
 	return wc
 }
 
+// Eq adds "column = value". If value is nil, including a typed nil
+// pointer, it adds "column IS NULL" instead (see IsNull).
 func (wc *whereClause) Eq(column string, value interface{}) *whereClause {
+	if isNilValue(value) {
+		return wc.IsNull(column)
+	}
 	we := whereEqual{wc.q, column, value}
 	wc.nodes = append(wc.nodes, we)
 	return wc
@@ -319,12 +642,37 @@ func (wc *whereClause) EqCol(column string, value string) *whereClause {
 	return wc
 }
 
+// Ne adds "column <> value". If value is nil, including a typed nil
+// pointer, it adds "column IS NOT NULL" instead (see IsNotNull).
 func (wc *whereClause) Ne(column string, value interface{}) *whereClause {
+	if isNilValue(value) {
+		return wc.IsNotNull(column)
+	}
 	wne := whereNotEqual{wc.q, column, value}
 	wc.nodes = append(wc.nodes, wne)
 	return wc
 }
 
+// eqQualified is like Eq, but qualifies column with the alias of the
+// table (see Query.Qualify) when the SQL is generated, i.e. also if the
+// alias is set later.
+func (wc *whereClause) eqQualified(column string, value interface{}) *whereClause {
+	wc.nodes = append(wc.nodes, whereQualifiedEqual{wc.q, column, value})
+	return wc
+}
+
+// IsNull adds "column IS NULL".
+func (wc *whereClause) IsNull(column string) *whereClause {
+	wc.nodes = append(wc.nodes, whereIsNull{wc.q, column})
+	return wc
+}
+
+// IsNotNull adds "column IS NOT NULL".
+func (wc *whereClause) IsNotNull(column string) *whereClause {
+	wc.nodes = append(wc.nodes, whereIsNotNull{wc.q, column})
+	return wc
+}
+
 func (wc *whereClause) NeCol(column string, value string) *whereClause {
 	wne := whereNotEqualColumn{wc.q, column, value}
 	wc.nodes = append(wc.nodes, wne)
@@ -403,6 +751,17 @@ func (wc *whereClause) NotIn(column string, values ...interface{}) *whereClause
 	return wc
 }
 
+// Raw adds the SQL fragment sql verbatim, e.g. a database-specific
+// predicate like JSON_EXTRACT(data,'$.x')=1. It is wrapped in parentheses
+// and joined with the other predicates by AND, so a fragment containing
+// OR cannot widen the other predicates, e.g. the scope of a session.
+// The fragment is not escaped, so never pass user input.
+func (wc *whereClause) Raw(sql string) *whereClause {
+	c := whereRaw{wc.q, sql}
+	wc.nodes = append(wc.nodes, c)
+	return wc
+}
+
 func (wc *whereClause) Project(columns ...interface{}) *Query {
 	return wc.q.Project(columns...)
 }
@@ -415,6 +774,18 @@ func (wc *whereClause) Skip(take int) *Query {
 	return wc.q.Skip(take)
 }
 
+func (wc *whereClause) Page(page, perPage int) *Query {
+	return wc.q.Page(page, perPage)
+}
+
+func (wc *whereClause) Union(other *Query) *Query {
+	return wc.q.Union(other)
+}
+
+func (wc *whereClause) UnionAll(other *Query) *Query {
+	return wc.q.UnionAll(other)
+}
+
 func (wc *whereClause) Order() *orderClause {
 	return wc.q.Order()
 }
@@ -427,6 +798,10 @@ func (wc *whereClause) Sql() string {
 	return wc.q.Sql()
 }
 
+func (wc *whereClause) WhereSql() string {
+	return wc.q.WhereSql()
+}
+
 func (wc *whereClause) SubSql() string {
 	var b bytes.Buffer
 	for i, node := range wc.nodes {
@@ -438,8 +813,9 @@ func (wc *whereClause) SubSql() string {
 	return b.String()
 }
 
-// WhereNodes specify a node in a where clause
-type whereNode interface {
+// WhereNode specifies a node in a where clause. Nodes are joined with AND.
+// Implement it to add custom predicates via Query.InjectWhere.
+type WhereNode interface {
 	Sql() string
 	SubSql() string
 }
@@ -457,15 +833,12 @@ func (we whereEqual) Sql() string {
 }
 
 func (we whereEqual) SubSql() string {
-	if we.value != nil {
-		switch t := we.value.(type) {
-		default:
-			return fmt.Sprintf("%s%s%s", we.column, "=", Quote(we.q.dialect, t))
-		case SafeSqlString:
-			return fmt.Sprintf("%s%s%s", we.column, "=", string(t))
-		}
+	switch t := we.value.(type) {
+	default:
+		return fmt.Sprintf("%s%s%s", we.column, "=", we.q.bind(t))
+	case SafeSqlString:
+		return fmt.Sprintf("%s%s%s", we.column, "=", string(t))
 	}
-	return fmt.Sprintf("%s IS NULL", we.column)
 }
 
 // A where clause of type "column = value" and value is a column
@@ -497,15 +870,77 @@ func (wne whereNotEqual) Sql() string {
 }
 
 func (wne whereNotEqual) SubSql() string {
-	if wne.value != nil {
-		switch t := wne.value.(type) {
-		default:
-			return fmt.Sprintf("%s%s%s", wne.column, "<>", Quote(wne.q.dialect, t))
-		case SafeSqlString:
-			return fmt.Sprintf("%s%s%s", wne.column, "<>", string(t))
-		}
+	switch t := wne.value.(type) {
+	default:
+		return fmt.Sprintf("%s%s%s", wne.column, "<>", wne.q.bind(t))
+	case SafeSqlString:
+		return fmt.Sprintf("%s%s%s", wne.column, "<>", string(t))
+	}
+}
+
+// A where clause of type "column = value", with column qualified by
+// the alias of the table
+
+type whereQualifiedEqual struct {
+	q      *Query
+	column string
+	value  interface{}
+}
+
+func (w whereQualifiedEqual) Sql() string {
+	return w.q.Sql()
+}
+
+func (w whereQualifiedEqual) SubSql() string {
+	column := w.q.Qualify(w.column)
+	if isNilValue(w.value) {
+		return whereIsNull{w.q, column}.SubSql()
+	}
+	return whereEqual{w.q, column, w.value}.SubSql()
+}
+
+// A where clause of type "column IS NULL"
+
+type whereIsNull struct {
+	q      *Query
+	column string
+}
+
+func (w whereIsNull) Sql() string {
+	return w.q.Sql()
+}
+
+func (w whereIsNull) SubSql() string {
+	return fmt.Sprintf("%s IS NULL", w.column)
+}
+
+// A where clause of type "column IS NOT NULL"
+
+type whereIsNotNull struct {
+	q      *Query
+	column string
+}
+
+func (w whereIsNotNull) Sql() string {
+	return w.q.Sql()
+}
+
+func (w whereIsNotNull) SubSql() string {
+	return fmt.Sprintf("%s IS NOT NULL", w.column)
+}
+
+// isNilValue returns true if value is nil or a nil pointer, map, slice,
+// or interface, e.g. a (*int)(nil).
+func isNilValue(value interface{}) bool {
+	if value == nil {
+		return true
 	}
-	return fmt.Sprintf("%s IS NOT NULL", wne.column)
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
 }
 
 // A where clause of type "column != value" and value is a column
@@ -540,7 +975,7 @@ func (w whereLessThan) SubSql() string {
 	if w.value != nil {
 		switch t := w.value.(type) {
 		default:
-			return fmt.Sprintf("%s%s%s", w.column, "<", Quote(w.q.dialect, t))
+			return fmt.Sprintf("%s%s%s", w.column, "<", w.q.bind(t))
 		case SafeSqlString:
 			return fmt.Sprintf("%s%s%s", w.column, "<", string(t))
 		}
@@ -580,7 +1015,7 @@ func (w whereLessThanOrEqual) SubSql() string {
 	if w.value != nil {
 		switch t := w.value.(type) {
 		default:
-			return fmt.Sprintf("%s%s%s", w.column, "<=", Quote(w.q.dialect, t))
+			return fmt.Sprintf("%s%s%s", w.column, "<=", w.q.bind(t))
 		case SafeSqlString:
 			return fmt.Sprintf("%s%s%s", w.column, "<=", string(t))
 		}
@@ -620,7 +1055,7 @@ func (w whereGreaterThan) SubSql() string {
 	if w.value != nil {
 		switch t := w.value.(type) {
 		default:
-			return fmt.Sprintf("%s%s%s", w.column, ">", Quote(w.q.dialect, t))
+			return fmt.Sprintf("%s%s%s", w.column, ">", w.q.bind(t))
 		case SafeSqlString:
 			return fmt.Sprintf("%s%s%s", w.column, ">", string(t))
 		}
@@ -660,7 +1095,7 @@ func (w whereGreaterThanOrEqual) SubSql() string {
 	if w.value != nil {
 		switch t := w.value.(type) {
 		default:
-			return fmt.Sprintf("%s%s%s", w.column, ">=", Quote(w.q.dialect, t))
+			return fmt.Sprintf("%s%s%s", w.column, ">=", w.q.bind(t))
 		case SafeSqlString:
 			return fmt.Sprintf("%s%s%s", w.column, ">=", string(t))
 		}
@@ -699,7 +1134,7 @@ func (w whereLike) Sql() string {
 func (w whereLike) SubSql() string {
 	switch t := w.value.(type) {
 	default:
-		return fmt.Sprintf("%s LIKE %s", w.column, Quote(w.q.dialect, t))
+		return fmt.Sprintf("%s LIKE %s", w.column, w.q.bind(t))
 	case SafeSqlString:
 		return fmt.Sprintf("%s LIKE %s", w.column, string(t))
 	}
@@ -720,7 +1155,7 @@ func (w whereNotLike) Sql() string {
 func (w whereNotLike) SubSql() string {
 	switch t := w.value.(type) {
 	default:
-		return fmt.Sprintf("%s NOT LIKE %s", w.column, Quote(w.q.dialect, t))
+		return fmt.Sprintf("%s NOT LIKE %s", w.column, w.q.bind(t))
 	case SafeSqlString:
 		return fmt.Sprintf("%s NOT LIKE %s", w.column, string(t))
 	}
@@ -738,39 +1173,14 @@ func (w whereIn) Sql() string {
 	return w.q.Sql()
 }
 
+// SubSql returns 1=0 if there are no values, as IN () is invalid SQL
+// and no row matches an empty set.
 func (w whereIn) SubSql() string {
-	var b bytes.Buffer
-	for i, value := range w.values {
-		// The element itself could be an array or a slice
-		inv := reflect.ValueOf(value)
-		if inv.Kind() == reflect.Slice || inv.Kind() == reflect.Array {
-			invlen := inv.Len()
-			for j := 0; j < invlen; j++ {
-				if j > 0 {
-					b.WriteString(",")
-				}
-
-				switch t := inv.Index(j).Interface().(type) {
-				default:
-					b.WriteString(Quote(w.q.dialect, t))
-				case SafeSqlString:
-					b.WriteString(string(t))
-				}
-			}
-		} else {
-			if i > 0 {
-				b.WriteString(",")
-			}
-
-			switch t := value.(type) {
-			default:
-				b.WriteString(Quote(w.q.dialect, t))
-			case SafeSqlString:
-				b.WriteString(string(t))
-			}
-		}
+	list := quoteList(w.q, w.values)
+	if list == "" {
+		return "1=0"
 	}
-	return fmt.Sprintf("%s IN (%s)", w.column, b.String())
+	return fmt.Sprintf("%s IN (%s)", w.column, list)
 }
 
 // A where clause of type "column NOT IN (...)"
@@ -785,45 +1195,68 @@ func (w whereNotIn) Sql() string {
 	return w.q.Sql()
 }
 
+// SubSql returns 1=1 if there are no values, as NOT IN () is invalid
+// SQL and every row matches.
 func (w whereNotIn) SubSql() string {
-	var b bytes.Buffer
-	for i, value := range w.values {
+	list := quoteList(w.q, w.values)
+	if list == "" {
+		return "1=1"
+	}
+	return fmt.Sprintf("%s NOT IN (%s)", w.column, list)
+}
+
+// A where clause with a raw SQL fragment
+
+type whereRaw struct {
+	q   *Query
+	sql string
+}
+
+func (w whereRaw) Sql() string {
+	return w.q.Sql()
+}
+
+func (w whereRaw) SubSql() string {
+	return "(" + w.sql + ")"
+}
+
+// quoteList quotes values (see Query.bind) and joins them with commas.
+// Slices and arrays in values are flattened by one level, so
+// In("id", 1, []int{2, 3}, 4) renders as 1,2,3,4. A []byte is a single
+// (binary) value.
+func quoteList(q *Query, values []interface{}) string {
+	quoted := make([]string, 0, len(values))
+	add := func(value interface{}) {
+		switch t := value.(type) {
+		default:
+			quoted = append(quoted, q.bind(t))
+		case SafeSqlString:
+			quoted = append(quoted, string(t))
+		}
+	}
+	for _, value := range values {
 		// The element itself could be an array or a slice
 		inv := reflect.ValueOf(value)
-		if inv.Kind() == reflect.Slice || inv.Kind() == reflect.Array {
-			invlen := inv.Len()
-			for j := 0; j < invlen; j++ {
-				if j > 0 {
-					b.WriteString(",")
-				}
-
-				switch t := inv.Index(j).Interface().(type) {
-				default:
-					b.WriteString(Quote(w.q.dialect, t))
-				case SafeSqlString:
-					b.WriteString(string(t))
-				}
+		if _, isBytes := value.([]byte); !isBytes && (inv.Kind() == reflect.Slice || inv.Kind() == reflect.Array) {
+			for j := 0; j < inv.Len(); j++ {
+				add(inv.Index(j).Interface())
 			}
 		} else {
-			if i > 0 {
-				b.WriteString(",")
-			}
-
-			switch t := value.(type) {
-			default:
-				b.WriteString(Quote(w.q.dialect, t))
-			case SafeSqlString:
-				b.WriteString(string(t))
-			}
+			add(value)
 		}
 	}
-	return fmt.Sprintf("%s NOT IN (%s)", w.column, b.String())
+	return strings.Join(quoted, ",")
 }
 
 // Order clause
 
 type orderClause struct {
-	q      *Query
+	q     *Query
+	terms []orderTerm
+}
+
+// orderTerm is a single column or expression of an order clause.
+type orderTerm struct {
 	col    string
 	dir    string
 	values []interface{}
@@ -831,30 +1264,48 @@ type orderClause struct {
 
 func NewOrderClause(query *Query) *orderClause {
 	c := &orderClause{
-		q:      query,
-		col:    "",
-		dir:    "",
-		values: make([]interface{}, 0),
+		q:     query,
+		terms: make([]orderTerm, 0),
 	}
 	return c
 }
 
+// Asc orders by column in ascending order. Calling it again, or one of
+// the other methods of the clause, orders by several columns, e.g.
+// Order().Asc("a").Desc("b") renders "a ASC,b DESC".
 func (c *orderClause) Asc(column string) *orderClause {
-	c.col = column
-	c.dir = "ASC"
+	c.terms = append(c.terms, orderTerm{col: column, dir: "ASC"})
 	return c
 }
 
+// Desc orders by column in descending order.
 func (c *orderClause) Desc(column string) *orderClause {
-	c.col = column
-	c.dir = "DESC"
+	c.terms = append(c.terms, orderTerm{col: column, dir: "DESC"})
+	return c
+}
+
+// By orders by the given expressions verbatim, e.g. By("a ASC", "b DESC").
+func (c *orderClause) By(exprs ...string) *orderClause {
+	for _, expr := range exprs {
+		c.terms = append(c.terms, orderTerm{col: expr})
+	}
 	return c
 }
 
+// NullsLast orders by column in direction dir ("ASC" or "DESC"), with
+// NULL values last. See Query.OrderNullsLast.
+func (c *orderClause) NullsLast(column, dir string) *orderClause {
+	return c.By(orderNullsLastSQL(c.q.dialect, column, normalizeDir(dir)))
+}
+
+// NullsFirst orders by column in direction dir ("ASC" or "DESC"), with
+// NULL values first. See Query.OrderNullsFirst.
+func (c *orderClause) NullsFirst(column, dir string) *orderClause {
+	return c.By(orderNullsFirstSQL(c.q.dialect, column, normalizeDir(dir)))
+}
+
 func (c *orderClause) Field(column string, values ...interface{}) *orderClause {
-	c.col = column
-	c.dir = ""
-	c.values = append(c.values, values...)
+	c.terms = append(c.terms, orderTerm{col: column, values: values})
 	return c
 }
 
@@ -870,6 +1321,10 @@ func (c *orderClause) Skip(take int) *Query {
 	return c.q.Skip(take)
 }
 
+func (c *orderClause) Page(page, perPage int) *Query {
+	return c.q.Page(page, perPage)
+}
+
 func (c *orderClause) Query() *Query {
 	return c.q
 }
@@ -879,45 +1334,34 @@ func (c *orderClause) Sql() string {
 }
 
 func (c *orderClause) SubSql() string {
-	if len(c.values) == 0 {
-		return fmt.Sprintf("%s %s", c.col, c.dir)
+	subs := make([]string, len(c.terms))
+	for i, term := range c.terms {
+		subs[i] = term.subSql(c.q)
+	}
+	return strings.Join(subs, ",")
+}
+
+func (term orderTerm) subSql(q *Query) string {
+	if len(term.values) == 0 {
+		if term.dir == "" {
+			return term.col
+		}
+		return fmt.Sprintf("%s %s", term.col, term.dir)
 	}
 
 	// Special case for MySQL: Preserve ordering by a field:
 	// Example:  ORDER BY FIELD(f.id, 2, 3, 1);
 	// See also: http://stackoverflow.com/questions/1631723/maintaining-order-in-mysql-in-query
-	var b bytes.Buffer
-	for i, value := range c.values {
-		// The element itself could be an array or a slice
-		inv := reflect.ValueOf(value)
-		if inv.Kind() == reflect.Slice || inv.Kind() == reflect.Array {
-			invlen := inv.Len()
-			for j := 0; j < invlen; j++ {
-				if j > 0 {
-					b.WriteString(",")
-				}
-
-				switch t := inv.Index(j).Interface().(type) {
-				default:
-					b.WriteString(Quote(c.q.dialect, t))
-				case SafeSqlString:
-					b.WriteString(string(t))
-				}
-			}
-		} else {
-			if i > 0 {
-				b.WriteString(",")
-			}
+	return fmt.Sprintf("FIELD(%s,%s)", term.col, quoteList(q, term.values))
+}
 
-			switch t := value.(type) {
-			default:
-				b.WriteString(Quote(c.q.dialect, t))
-			case SafeSqlString:
-				b.WriteString(string(t))
-			}
-		}
+// normalizeDir returns "DESC" if dir is "desc" in any case, and "ASC"
+// otherwise.
+func normalizeDir(dir string) string {
+	if strings.ToUpper(dir) == "DESC" {
+		return "DESC"
 	}
-	return fmt.Sprintf("FIELD(%s,%s)", c.col, b.String())
+	return "ASC"
 }
 
 // Limit clause
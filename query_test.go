@@ -2,6 +2,7 @@ package dapper
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -48,6 +49,26 @@ func TestMySQLSimpleQueries(t *testing.T) {
 		t.Errorf("expected %v, got %v", "SELECT * FROM users WHERE expired IS NOT NULL", sql)
 	}
 
+	sql = Q(MySQL, "users").Where().IsNull("expired").Sql()
+	if sql != "SELECT * FROM users WHERE expired IS NULL" {
+		t.Errorf("expected %v, got %v", "SELECT * FROM users WHERE expired IS NULL", sql)
+	}
+
+	sql = Q(MySQL, "users").Where().IsNotNull("expired").Sql()
+	if sql != "SELECT * FROM users WHERE expired IS NOT NULL" {
+		t.Errorf("expected %v, got %v", "SELECT * FROM users WHERE expired IS NOT NULL", sql)
+	}
+
+	sql = Q(MySQL, "users").Where().Eq("karma", (*int)(nil)).Sql()
+	if sql != "SELECT * FROM users WHERE karma IS NULL" {
+		t.Errorf("expected %v, got %v", "SELECT * FROM users WHERE karma IS NULL", sql)
+	}
+
+	sql = Q(MySQL, "users").Where().Ne("karma", (*int)(nil)).Sql()
+	if sql != "SELECT * FROM users WHERE karma IS NOT NULL" {
+		t.Errorf("expected %v, got %v", "SELECT * FROM users WHERE karma IS NOT NULL", sql)
+	}
+
 	sql = Q(MySQL, "users").Where().NeCol("expired", "expired2").Sql()
 	if sql != "SELECT * FROM users WHERE expired<>expired2" {
 		t.Errorf("expected %v, got %v", "SELECT * FROM users WHERE expired<>expired2", sql)
@@ -63,6 +84,16 @@ func TestMySQLSimpleQueries(t *testing.T) {
 		t.Errorf("expected %v, got %v", "SELECT * FROM users WHERE id NOT IN (1,2,3,4)", sql)
 	}
 
+	sql = Q(MySQL, "users").Where().In("id", []int{}).Sql()
+	if sql != "SELECT * FROM users WHERE 1=0" {
+		t.Errorf("expected %v, got %v", "SELECT * FROM users WHERE 1=0", sql)
+	}
+
+	sql = Q(MySQL, "users").Where().NotIn("id", []int{}).Sql()
+	if sql != "SELECT * FROM users WHERE 1=1" {
+		t.Errorf("expected %v, got %v", "SELECT * FROM users WHERE 1=1", sql)
+	}
+
 	sql = Q(MySQL, "users").Where().Lt("id", 1).Sql()
 	if sql != "SELECT * FROM users WHERE id<1" {
 		t.Errorf("expected %v, got %v", "SELECT * FROM users WHERE id<1", sql)
@@ -443,6 +474,29 @@ func TestPostgreSQLQueryWithLimits(t *testing.T) {
 	}
 }
 
+func TestOracleQueryWithLimits(t *testing.T) {
+	sql := Q(Oracle, "users").Take(10).Sql()
+	if sql != "SELECT * FROM users FETCH NEXT 10 ROWS ONLY" {
+		t.Errorf("expected %v, got %v", "SELECT * FROM users FETCH NEXT 10 ROWS ONLY", sql)
+	}
+
+	sql = Q(Oracle, "users").Skip(20).Sql()
+	if sql != "SELECT * FROM users OFFSET 20 ROWS" {
+		t.Errorf("expected %v, got %v", "SELECT * FROM users OFFSET 20 ROWS", sql)
+	}
+
+	sql = Q(Oracle, "users").Skip(20).Take(10).Sql()
+	if sql != "SELECT * FROM users OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY" {
+		t.Errorf("expected %v, got %v", "SELECT * FROM users OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY", sql)
+	}
+
+	sql = Q(Oracle, "users").Where().Eq("name", "Oliver").Order().Asc("id").Skip(20).Take(10).Sql()
+	expected := "SELECT * FROM users WHERE name='Oliver' ORDER BY id ASC OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY"
+	if sql != expected {
+		t.Errorf("expected %v, got %v", expected, sql)
+	}
+}
+
 // -- Query Joins -----------------------------------------------------------
 
 func TestMySQLQueryJoins(t *testing.T) {
@@ -886,3 +940,418 @@ func TestMySQLQueryNotInClauseAsSlice(t *testing.T) {
 		t.Errorf("expected %v, got %v", expected, sql)
 	}
 }
+
+// -- Exists ----------------------------------------------------------------
+
+func TestMySQLQueryExistsSql(t *testing.T) {
+	sql := Q(MySQL, "users").
+		Project("name").
+		Where().Eq("name", "Oliver").
+		Order().Asc("name").
+		Take(10).
+		Query().
+		ExistsSql()
+
+	expected := "SELECT EXISTS(SELECT 1 FROM users WHERE name='Oliver' LIMIT 1)"
+	if sql != expected {
+		t.Errorf("expected %v, got %v", expected, sql)
+	}
+}
+
+func TestPostgreSQLQueryExistsSql(t *testing.T) {
+	sql := Q(PostgreSQL, "users").Alias("u").
+		Join("tweets").Alias("t").On("u.id", "t.user_id").
+		Query().
+		Where().Gt("t.retweets", 10).
+		Query().
+		ExistsSql()
+
+	expected := "SELECT EXISTS(SELECT 1 FROM users u JOIN tweets t ON u.id=t.user_id WHERE t.retweets>10 LIMIT 1)"
+	if sql != expected {
+		t.Errorf("expected %v, got %v", expected, sql)
+	}
+}
+
+func TestOracleQueryExistsSql(t *testing.T) {
+	sql := Q(Oracle, "users").Where().Eq("name", "Oliver").Query().ExistsSql()
+
+	expected := "SELECT CASE WHEN EXISTS(SELECT 1 FROM users WHERE name='Oliver' FETCH NEXT 1 ROWS ONLY) THEN 1 ELSE 0 END FROM DUAL"
+	if sql != expected {
+		t.Errorf("expected %v, got %v", expected, sql)
+	}
+}
+
+func TestQueryWritesNamesAsPassed(t *testing.T) {
+	sql := Q(MySQL, "`order`").Alias("o").
+		Project("JSON_EXTRACT(o.data,'$.name')").
+		Query().
+		Sql()
+
+	expected := "SELECT JSON_EXTRACT(o.data,'$.name') FROM `order` o"
+	if sql != expected {
+		t.Errorf("expected %v, got %v", expected, sql)
+	}
+}
+
+// -- Query components ------------------------------------------------------
+
+// tenantFilter is a custom WhereNode restricting a query to a tenant.
+type tenantFilter struct {
+	q        *Query
+	tenantId int64
+}
+
+func (f tenantFilter) Sql() string {
+	return f.q.Sql()
+}
+
+func (f tenantFilter) SubSql() string {
+	return fmt.Sprintf("tenant_id=%s", Quote(f.q.Dialect(), f.tenantId))
+}
+
+func TestMySQLQueryComponents(t *testing.T) {
+	q := Q(MySQL, "users").Alias("u").
+		Join("tweets").Alias("t").On("u.id", "t.user_id").
+		Project("u.name", "t.message").
+		Where().Eq("u.name", "Oliver").
+		Query()
+
+	if q.Dialect() != MySQL {
+		t.Errorf("expected dialect %v, got %v", MySQL, q.Dialect())
+	}
+	if q.TableName() != "users" || q.TableAlias() != "u" {
+		t.Errorf("expected table users u, got %s %s", q.TableName(), q.TableAlias())
+	}
+	if got := q.Qualify("name"); got != "u.name" {
+		t.Errorf("expected %v, got %v", "u.name", got)
+	}
+	if got := Q(MySQL, "users").Qualify("name"); got != "name" {
+		t.Errorf("expected %v, got %v", "name", got)
+	}
+	if len(q.Columns()) != 2 || q.Columns()[0] != "u.name" {
+		t.Errorf("expected 2 columns, got %v", q.Columns())
+	}
+	if len(q.Joins()) != 1 {
+		t.Fatalf("expected 1 join, got %d", len(q.Joins()))
+	}
+	join := q.Joins()[0]
+	left, right := join.Condition()
+	if join.TableName() != "tweets" || join.TableAlias() != "t" || join.JoinKind() != "" || left != "u.id" || right != "t.user_id" {
+		t.Errorf("unexpected join %s", join.SubSql())
+	}
+	if len(q.WhereNodes()) != 1 || q.WhereNodes()[0].SubSql() != "u.name='Oliver'" {
+		t.Errorf("expected 1 where node, got %v", q.WhereNodes())
+	}
+	if nodes := Q(MySQL, "users").WhereNodes(); len(nodes) != 0 {
+		t.Errorf("expected no where nodes, got %v", nodes)
+	}
+}
+
+func TestMySQLQueryInjectWhere(t *testing.T) {
+	queries := []*Query{
+		Q(MySQL, "users"),
+		Q(MySQL, "users").Where().Eq("name", "Oliver").Query(),
+		Q(MySQL, "users").Where().Eq("name", "Oliver").Order().Asc("name").Take(10).Query(),
+	}
+	expected := []string{
+		"SELECT * FROM users WHERE tenant_id=42",
+		"SELECT * FROM users WHERE name='Oliver' AND tenant_id=42",
+		"SELECT * FROM users WHERE name='Oliver' AND tenant_id=42 ORDER BY name ASC LIMIT 10",
+	}
+	for i, q := range queries {
+		got := q.InjectWhere(tenantFilter{q, 42}).Sql()
+		if got != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], got)
+		}
+	}
+}
+
+// -- Random order ----------------------------------------------------------
+
+func TestQueryOrderRandom(t *testing.T) {
+	tests := []struct {
+		Dialect  Dialect
+		Expected string
+	}{
+		{MySQL, "SELECT * FROM users WHERE karma>10 ORDER BY RAND() LIMIT 5"},
+		{Sqlite3, "SELECT * FROM users WHERE karma>10 ORDER BY RANDOM() LIMIT 5"},
+		{PostgreSQL, "SELECT * FROM users WHERE karma>10 ORDER BY RANDOM() LIMIT 5"},
+	}
+
+	for _, test := range tests {
+		got := Q(test.Dialect, "users").Where().Gt("karma", 10).Query().OrderRandom().Take(5).Sql()
+		if got != test.Expected {
+			t.Errorf("%s: expected %v, got %v", test.Dialect, test.Expected, got)
+		}
+	}
+
+	got := Q(MySQL, "users").Order().Desc("karma").Query().OrderRandom().Sql()
+	expected := "SELECT * FROM users ORDER BY karma DESC,RAND()"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+// -- IN with mixed values --------------------------------------------------
+
+func TestMySQLQueryInWithMixedValues(t *testing.T) {
+	tests := []struct {
+		Query    *Query
+		Expected string
+	}{
+		{Q(MySQL, "users").Where().In("id", 1, []int{2, 3}, 4).Query(), "SELECT * FROM users WHERE id IN (1,2,3,4)"},
+		{Q(MySQL, "users").Where().In("id", []int{1, 2}, []int{3}).Query(), "SELECT * FROM users WHERE id IN (1,2,3)"},
+		{Q(MySQL, "users").Where().In("id", 1, []int{}, 2).Query(), "SELECT * FROM users WHERE id IN (1,2)"},
+		{Q(MySQL, "users").Where().NotIn("id", []int{1}, 2, [2]int{3, 4}).Query(), "SELECT * FROM users WHERE id NOT IN (1,2,3,4)"},
+		{Q(MySQL, "users").Order().Field("id", 3, []int{1, 2}).Query(), "SELECT * FROM users ORDER BY FIELD(id,3,1,2)"},
+	}
+
+	for _, test := range tests {
+		got := test.Query.Sql()
+		if got != test.Expected {
+			t.Errorf("expected %v, got %v", test.Expected, got)
+		}
+	}
+}
+
+// -- WHERE fragment --------------------------------------------------------
+
+func TestMySQLQueryWhereSql(t *testing.T) {
+	got := Q(MySQL, "users").Alias("u").
+		Where().Eq("u.name", "Oliver").Gt("u.karma", 42).
+		Order().Asc("u.name").Take(10).
+		WhereSql()
+	expected := "u.name='Oliver' AND u.karma>42"
+	if got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	got = Q(MySQL, "users").WhereSql()
+	if got != "" {
+		t.Errorf("expected empty fragment, got %v", got)
+	}
+}
+
+// -- Page ------------------------------------------------------------------
+
+func TestQueryPage(t *testing.T) {
+	tests := []struct {
+		Query    *Query
+		Expected string
+	}{
+		{Q(MySQL, "users").Page(2, 10), "SELECT * FROM users LIMIT 10,10"},
+		{Q(MySQL, "users").Page(1, 10), "SELECT * FROM users LIMIT 10"},
+		{Q(MySQL, "users").Page(0, 10), "SELECT * FROM users LIMIT 10"},
+		{Q(Sqlite3, "users").Page(2, 10), "SELECT * FROM users LIMIT 10 OFFSET 10"},
+		{Q(Sqlite3, "users").Order().Asc("id").Page(3, 5), "SELECT * FROM users ORDER BY id ASC LIMIT 5 OFFSET 10"},
+		{Q(PostgreSQL, "users").Page(2, 10), "SELECT * FROM users LIMIT 10 OFFSET 10"},
+		{Q(PostgreSQL, "users").Page(-1, 10), "SELECT * FROM users LIMIT 10"},
+		{Q(MySQL, "users").Page(3, 0), "SELECT * FROM users LIMIT 2,1"},
+		{Q(Sqlite3, "users").Page(2, -5), "SELECT * FROM users LIMIT 1 OFFSET 1"},
+		{Q(PostgreSQL, "users").Page(1, 0), "SELECT * FROM users LIMIT 1"},
+	}
+
+	for _, test := range tests {
+		got := test.Query.Sql()
+		if got != test.Expected {
+			t.Errorf("expected %v, got %v", test.Expected, got)
+		}
+	}
+}
+
+// -- Seek ------------------------------------------------------------------
+
+func TestQuerySeek(t *testing.T) {
+	tests := []struct {
+		Query    *Query
+		Expected string
+	}{
+		{Q(MySQL, "users").Seek("id", nil, 10), "SELECT * FROM users ORDER BY id ASC LIMIT 10"},
+		{Q(MySQL, "users").Seek("id", 42, 10), "SELECT * FROM users WHERE id>42 ORDER BY id ASC LIMIT 10"},
+		{Q(Sqlite3, "users").Where().Eq("suspended", false).Query().Seek("id", 42, 1), "SELECT * FROM users WHERE suspended=0 AND id>42 ORDER BY id ASC LIMIT 1"},
+		{Q(PostgreSQL, "users").Seek("name", "Oliver", 5), "SELECT * FROM users WHERE name>'Oliver' ORDER BY name ASC LIMIT 5"},
+	}
+
+	for _, test := range tests {
+		got := test.Query.Sql()
+		if got != test.Expected {
+			t.Errorf("expected %v, got %v", test.Expected, got)
+		}
+	}
+}
+
+// -- ORDER BY with NULLs last ----------------------------------------------
+
+func TestQueryOrderNullsLast(t *testing.T) {
+	tests := []struct {
+		Query    *Query
+		Expected string
+	}{
+		{Q(MySQL, "users").OrderNullsLast("karma", "desc"), "SELECT * FROM users ORDER BY karma IS NULL,karma DESC"},
+		{Q(Sqlite3, "users").OrderNullsLast("karma", "ASC").Order().Asc("id").Query(), "SELECT * FROM users ORDER BY karma IS NULL,karma ASC,id ASC"},
+		{Q(PostgreSQL, "users").OrderNullsLast("karma", "DESC"), "SELECT * FROM users ORDER BY karma DESC NULLS LAST"},
+		{Q(PostgreSQL, "users").OrderNullsLast("karma", ""), "SELECT * FROM users ORDER BY karma ASC NULLS LAST"},
+	}
+
+	for _, test := range tests {
+		got := test.Query.Sql()
+		if got != test.Expected {
+			t.Errorf("expected %v, got %v", test.Expected, got)
+		}
+	}
+}
+
+// -- ORDER BY several columns in one clause --------------------------------
+
+func TestQueryOrderMultipleColumns(t *testing.T) {
+	tests := []struct {
+		Query    *Query
+		Expected string
+	}{
+		{Q(MySQL, "users").Order().Asc("name").Desc("id").Query(), "SELECT * FROM users ORDER BY name ASC,id DESC"},
+		{Q(MySQL, "users").Order().Asc("name").Asc("id").Query(), "SELECT * FROM users ORDER BY name ASC,id ASC"},
+		{Q(MySQL, "users").Order().By("name ASC", "id DESC").Query(), "SELECT * FROM users ORDER BY name ASC,id DESC"},
+		{Q(MySQL, "users").Order().Asc("name").Order().Desc("id").Query(), "SELECT * FROM users ORDER BY name ASC,id DESC"},
+		{Q(MySQL, "users").Order().Field("id", 3, 1).Asc("name").Query(), "SELECT * FROM users ORDER BY FIELD(id,3,1),name ASC"},
+		{Q(PostgreSQL, "users").Order().NullsFirst("karma", "desc").Asc("id").Query(), "SELECT * FROM users ORDER BY karma DESC NULLS FIRST,id ASC"},
+		{Q(PostgreSQL, "users").Order().Asc("name").NullsLast("karma", "ASC").Query(), "SELECT * FROM users ORDER BY name ASC,karma ASC NULLS LAST"},
+		{Q(MySQL, "users").OrderNullsFirst("karma", "ASC"), "SELECT * FROM users ORDER BY karma IS NOT NULL,karma ASC"},
+		{Q(PostgreSQL, "users").OrderNullsFirst("karma", "ASC"), "SELECT * FROM users ORDER BY karma ASC NULLS FIRST"},
+	}
+
+	for _, test := range tests {
+		got := test.Query.Sql()
+		if got != test.Expected {
+			t.Errorf("expected %v, got %v", test.Expected, got)
+		}
+	}
+}
+
+// -- Raw WHERE fragments ---------------------------------------------------
+
+func TestQueryWhereRaw(t *testing.T) {
+	tests := []struct {
+		Query    *Query
+		Expected string
+	}{
+		{
+			Q(MySQL, "events").Where().Raw("JSON_EXTRACT(data,'$.x')=1").Query(),
+			"SELECT * FROM events WHERE (JSON_EXTRACT(data,'$.x')=1)",
+		},
+		{
+			Q(MySQL, "events").Where().Eq("user_id", 1).Raw("created > NOW() - INTERVAL 1 DAY").Eq("kind", "login").
+				Order().Desc("created").Take(10),
+			"SELECT * FROM events WHERE user_id=1 AND (created > NOW() - INTERVAL 1 DAY) AND kind='login' ORDER BY created DESC LIMIT 10",
+		},
+		{
+			Q(PostgreSQL, "events").Where().Raw("a=1 OR b=2").Gt("id", 5).Order().Asc("id").Skip(20).Take(5),
+			"SELECT * FROM events WHERE (a=1 OR b=2) AND id>5 ORDER BY id ASC LIMIT 5 OFFSET 20",
+		},
+	}
+
+	for _, test := range tests {
+		got := test.Query.Sql()
+		if got != test.Expected {
+			t.Errorf("expected %v, got %v", test.Expected, got)
+		}
+	}
+}
+
+// -- Bound parameters ------------------------------------------------------
+
+func TestQuerySqlWithArgs(t *testing.T) {
+	q := Q(MySQL, "users").Where().Eq("name", "mc'alister").In("id", 1, []int{2, 3}).Eq("expired", nil).
+		Order().Desc("name").Take(10)
+	sql, args := q.SqlWithArgs()
+	expected := "SELECT * FROM users WHERE name=? AND id IN (?,?,?) AND expired IS NULL ORDER BY name DESC LIMIT 10"
+	if sql != expected {
+		t.Errorf("expected %v, got %v", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"mc'alister", 1, 2, 3}) {
+		t.Errorf("expected %v, got %v", []interface{}{"mc'alister", 1, 2, 3}, args)
+	}
+
+	// Sql still writes literals
+	expected = "SELECT * FROM users WHERE name='mc\\'alister' AND id IN (1,2,3) AND expired IS NULL ORDER BY name DESC LIMIT 10"
+	if got := q.Sql(); got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	sql, args = Q(PostgreSQL, "users").Where().Gt("karma", 42).Like("name", "O%").
+		Eq("created", SafeSqlString("NOW()")).Query().SqlWithArgs()
+	expected = "SELECT * FROM users WHERE karma>$1 AND name LIKE $2 AND created=NOW()"
+	if sql != expected {
+		t.Errorf("expected %v, got %v", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{42, "O%"}) {
+		t.Errorf("expected %v, got %v", []interface{}{42, "O%"}, args)
+	}
+}
+
+// -- Without table ---------------------------------------------------------
+
+func TestQueryWithoutTable(t *testing.T) {
+	tests := []struct {
+		Query    *Query
+		Expected string
+	}{
+		{Q(MySQL, "").Project(SafeSqlString("NOW()")), "SELECT NOW()"},
+		{Q(PostgreSQL, "").Project(SafeSqlString("1")), "SELECT 1"},
+		{Q(Sqlite3, "").Project(SafeSqlString("1 + 1"), SafeSqlString("RANDOM()")), "SELECT 1 + 1,RANDOM()"},
+	}
+
+	for _, test := range tests {
+		got := test.Query.Sql()
+		if got != test.Expected {
+			t.Errorf("expected %v, got %v", test.Expected, got)
+		}
+	}
+}
+
+// -- UNION -----------------------------------------------------------------
+
+func TestQueryUnion(t *testing.T) {
+	tests := []struct {
+		Query    *Query
+		Expected string
+	}{
+		{
+			Q(MySQL, "users").Project("id", "name").Where().Lt("karma", 10).
+				Union(Q(MySQL, "users").Project("id", "name").Where().Eq("suspended", 1).Query()),
+			"(SELECT id,name FROM users WHERE karma<10) UNION (SELECT id,name FROM users WHERE suspended=1)",
+		},
+		{
+			Q(PostgreSQL, "users").Where().Lt("karma", 10).
+				UnionAll(Q(PostgreSQL, "users").Where().Gt("karma", 100).Query()).
+				Order().Asc("name").Take(5),
+			"(SELECT * FROM users WHERE karma<10) UNION ALL (SELECT * FROM users WHERE karma>100) ORDER BY name ASC LIMIT 5",
+		},
+		{
+			Q(Sqlite3, "users").Where().Eq("id", 1).
+				Union(Q(Sqlite3, "users").Where().Eq("id", 2).Query()).
+				UnionAll(Q(Sqlite3, "users").Where().Eq("id", 2).Query()).
+				Order().Desc("id").Query(),
+			"SELECT * FROM (SELECT * FROM users WHERE id=1) UNION SELECT * FROM (SELECT * FROM users WHERE id=2) " +
+				"UNION ALL SELECT * FROM (SELECT * FROM users WHERE id=2) ORDER BY id DESC",
+		},
+	}
+
+	for _, test := range tests {
+		got := test.Query.Sql()
+		if got != test.Expected {
+			t.Errorf("expected %v, got %v", test.Expected, got)
+		}
+	}
+
+	// Bound values are collected from all queries
+	sql, args := Q(PostgreSQL, "users").Where().Eq("name", "Oliver").
+		Union(Q(PostgreSQL, "users").Where().Eq("name", "Sandra").Query()).
+		SqlWithArgs()
+	expected := `(SELECT * FROM users WHERE name=$1) UNION (SELECT * FROM users WHERE name=$2)`
+	if sql != expected {
+		t.Errorf("expected %v, got %v", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"Oliver", "Sandra"}) {
+		t.Errorf("expected %v, got %v", []interface{}{"Oliver", "Sandra"}, args)
+	}
+}
@@ -1,107 +1,309 @@
 package dapper
 
 import (
+	"database/sql/driver"
 	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/url"
 	"reflect"
+	"strconv"
 	"time"
 )
 
+// Quote returns val as a literal to be used in an SQL statement of the
+// given dialect. Strings are quoted and escaped, nil pointers become NULL.
+// Named types of integers, floats, bools, and strings, e.g. type Cents
+// int64, are written like their underlying type.
+//
+// A time.Duration is written as its number of nanoseconds, so it should
+// be stored in a BIGINT column. A net.IP and a url.URL are written as
+// strings. A []byte is written as a binary literal of the dialect.
+// A *big.Rat is written as an exact decimal, e.g. 9.33, and a *big.Float
+// with the digits of its precision.
+// Times are written with fractional seconds in the format of the dialect
+// (see e.g. MySQLDialect).
+//
+// Other types implementing driver.Valuer, e.g. custom enums or UUIDs,
+// are quoted by the value returned from their Value method.
+//
+// Quote panics if val cannot be quoted, see QuoteValue.
 func Quote(dialect Dialect, val interface{}) string {
+	quoted, err := QuoteValue(dialect, val)
+	if err != nil {
+		panic(err.Error())
+	}
+	return quoted
+}
+
+// QuoteValue is like Quote, but returns an error instead of panicking
+// if val cannot be quoted.
+func QuoteValue(dialect Dialect, val interface{}) (string, error) {
 	switch data := val.(type) {
 	case nil:
-		return "NULL"
+		return "NULL", nil
 	case string:
-		return fmt.Sprintf("'%s'", dialect.QuoteString(data))
+		return fmt.Sprintf("'%s'", dialect.QuoteString(data)), nil
 	case *string:
 		if data != nil {
-			return fmt.Sprintf("'%s'", dialect.QuoteString(*data))
+			return fmt.Sprintf("'%s'", dialect.QuoteString(*data)), nil
 		}
-		return "NULL"
-	case int, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
-		return fmt.Sprintf("%d", data)
+		return "NULL", nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", data), nil
 	case *int:
 		if data != nil {
 			v := val.(*int)
-			return fmt.Sprintf("%d", *v)
+			return fmt.Sprintf("%d", *v), nil
 		}
-		return "NULL"
+		return "NULL", nil
 	case *int16:
 		if data != nil {
 			v := val.(*int16)
-			return fmt.Sprintf("%d", *v)
+			return fmt.Sprintf("%d", *v), nil
 		}
-		return "NULL"
+		return "NULL", nil
 	case *int32:
 		if data != nil {
 			v := val.(*int32)
-			return fmt.Sprintf("%d", *v)
+			return fmt.Sprintf("%d", *v), nil
 		}
-		return "NULL"
+		return "NULL", nil
 	case *int64:
 		if data != nil {
 			v := val.(*int64)
-			return fmt.Sprintf("%d", *v)
+			return fmt.Sprintf("%d", *v), nil
 		}
-		return "NULL"
+		return "NULL", nil
 	case *uint8:
 		if data != nil {
 			v := val.(*uint8)
-			return fmt.Sprintf("%d", *v)
+			return fmt.Sprintf("%d", *v), nil
 		}
-		return "NULL"
+		return "NULL", nil
 	case *uint16:
 		if data != nil {
 			v := val.(*uint16)
-			return fmt.Sprintf("%d", *v)
+			return fmt.Sprintf("%d", *v), nil
 		}
-		return "NULL"
+		return "NULL", nil
 	case *uint32:
 		if data != nil {
 			v := val.(*uint32)
-			return fmt.Sprintf("%d", *v)
+			return fmt.Sprintf("%d", *v), nil
 		}
-		return "NULL"
+		return "NULL", nil
 	case *uint64:
 		if data != nil {
 			v := val.(*uint64)
-			return fmt.Sprintf("%d", *v)
+			return fmt.Sprintf("%d", *v), nil
 		}
-		return "NULL"
-	case float32, float64:
-		return fmt.Sprintf("%f", data)
+		return "NULL", nil
+	case float32:
+		return quoteFloat(float64(data), 32)
+	case float64:
+		return quoteFloat(data, 64)
 	case *float32:
 		if data != nil {
-			v := val.(*float32)
-			return fmt.Sprintf("%f", *v)
+			return quoteFloat(float64(*data), 32)
 		}
-		return "NULL"
+		return "NULL", nil
 	case *float64:
 		if data != nil {
-			v := val.(*float64)
-			return fmt.Sprintf("%f", *v)
+			return quoteFloat(*data, 64)
 		}
-		return "NULL"
+		return "NULL", nil
+	case *big.Rat:
+		if data != nil {
+			return quoteRat(data)
+		}
+		return "NULL", nil
+	case *big.Float:
+		if data != nil {
+			if data.IsInf() {
+				return "", fmt.Errorf("dapper: SQL quoting for float %v is not supported", data)
+			}
+			return data.Text('g', -1), nil
+		}
+		return "NULL", nil
 	case bool:
 		if data {
-			return "1"
+			return "1", nil
 		}
-		return "0"
+		return "0", nil
 	case *bool:
 		if data != nil {
 			if *data {
-				return "1"
+				return "1", nil
 			}
-			return "0"
+			return "0", nil
+		}
+		return "NULL", nil
+	case time.Duration:
+		return fmt.Sprintf("%d", int64(data)), nil
+	case *time.Duration:
+		if data != nil {
+			return fmt.Sprintf("%d", int64(*data)), nil
+		}
+		return "NULL", nil
+	case net.IP:
+		if data != nil {
+			return fmt.Sprintf("'%s'", dialect.QuoteString(data.String())), nil
+		}
+		return "NULL", nil
+	case url.URL:
+		return fmt.Sprintf("'%s'", dialect.QuoteString(data.String())), nil
+	case *url.URL:
+		if data != nil {
+			return fmt.Sprintf("'%s'", dialect.QuoteString(data.String())), nil
+		}
+		return "NULL", nil
+	case []byte:
+		if data != nil {
+			return quoteBytes(dialect, data), nil
+		}
+		return "NULL", nil
+	case *[]byte:
+		if data != nil && *data != nil {
+			return quoteBytes(dialect, *data), nil
 		}
-		return "NULL"
+		return "NULL", nil
 	case time.Time:
-		return fmt.Sprintf("'%s'", dialect.QuoteString(data.Format("2006-01-02 15:04:05")))
+		return quoteTimeLiteral(dialect, data), nil
 	case *time.Time:
 		if data != nil {
-			t := val.(*time.Time)
-			return fmt.Sprintf("'%s'", dialect.QuoteString((*t).Format("2006-01-02 15:04:05")))
+			return quoteTimeLiteral(dialect, *data), nil
+		}
+		return "NULL", nil
+	case driver.Valuer:
+		if v := reflect.ValueOf(data); v.Kind() == reflect.Ptr && v.IsNil() {
+			return "NULL", nil
+		}
+		value, err := data.Value()
+		if err != nil {
+			return "", fmt.Errorf("dapper: SQL quoting for type %s failed: %v", reflect.TypeOf(val), err)
+		}
+		return QuoteValue(dialect, value)
+	}
+	if quoted, ok, err := quoteKind(dialect, val); ok {
+		return quoted, err
+	}
+	return "", fmt.Errorf("dapper: SQL quoting for type %s is not supported", reflect.TypeOf(val))
+}
+
+// quoteKind returns val as an SQL literal by its kind if it is an integer,
+// float, bool, or string, or a pointer to one. This covers named types
+// like type Cents int64 or type Status string. A nil pointer is written
+// as NULL. The second return value is false for any other kind.
+func quoteKind(dialect Dialect, val interface{}) (string, bool, error) {
+	v := reflect.ValueOf(val)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "NULL", isBasicKind(v.Type().Elem().Kind()), nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case reflect.Float32:
+		quoted, err := quoteFloat(v.Float(), 32)
+		return quoted, true, err
+	case reflect.Float64:
+		quoted, err := quoteFloat(v.Float(), 64)
+		return quoted, true, err
+	case reflect.Bool:
+		if v.Bool() {
+			return "1", true, nil
+		}
+		return "0", true, nil
+	case reflect.String:
+		return fmt.Sprintf("'%s'", dialect.QuoteString(v.String())), true, nil
+	}
+	return "", false, nil
+}
+
+// isBasicKind returns true if k is an integer, float, bool, or string kind.
+func isBasicKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Bool, reflect.String:
+		return true
+	}
+	return false
+}
+
+// bindValue returns val as a value to pass to the driver as a bound
+// parameter. Types the database/sql package cannot convert are passed
+// the way QuoteValue writes them, e.g. *big.Rat as an exact decimal.
+func bindValue(val interface{}) (interface{}, error) {
+	switch data := val.(type) {
+	case *big.Rat:
+		if data != nil {
+			return quoteRat(data)
+		}
+		return nil, nil
+	case *big.Float:
+		if data != nil {
+			if data.IsInf() {
+				return nil, fmt.Errorf("dapper: SQL quoting for float %v is not supported", data)
+			}
+			return data.Text('g', -1), nil
+		}
+		return nil, nil
+	case net.IP:
+		if data != nil {
+			return data.String(), nil
+		}
+		return nil, nil
+	case url.URL:
+		return data.String(), nil
+	case *url.URL:
+		if data != nil {
+			return data.String(), nil
+		}
+		return nil, nil
+	}
+	return val, nil
+}
+
+// quoteRat returns r as an exact decimal literal, e.g. 9.33. Fractions
+// without a finite decimal representation, e.g. 1/3, are rejected.
+func quoteRat(r *big.Rat) (string, error) {
+	// r has a finite decimal representation if its denominator only
+	// has the prime factors 2 and 5. The number of decimal places is
+	// the larger of the two exponents.
+	denom := new(big.Int).Set(r.Denom())
+	places := 0
+	for _, p := range []*big.Int{big.NewInt(2), big.NewInt(5)} {
+		n := 0
+		for new(big.Int).Mod(denom, p).Sign() == 0 {
+			denom.Quo(denom, p)
+			n++
 		}
-		return "NULL"
+		if n > places {
+			places = n
+		}
+	}
+	if !denom.IsInt64() || denom.Int64() != 1 {
+		return "", fmt.Errorf("dapper: SQL quoting for rational %v is not supported, as it has no exact decimal representation", r)
+	}
+	return r.FloatString(places), nil
+}
+
+// quoteFloat returns f in the shortest representation that round-trips
+// for the given bitSize, e.g. 1.5 or 1e+20. NaN and infinity have no
+// SQL literal, so they are rejected. Negative zero is written as 0.
+func quoteFloat(f float64, bitSize int) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("dapper: SQL quoting for float %v is not supported", f)
+	}
+	if f == 0 {
+		return "0", nil
 	}
-	panic(fmt.Sprintf("SQL quoting for type %s is not supported", reflect.TypeOf(val)))
+	return strconv.FormatFloat(f, 'g', -1, bitSize), nil
 }
@@ -1,6 +1,12 @@
 package dapper
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"math"
+	"math/big"
+	"net"
+	"net/url"
 	"testing"
 	"time"
 )
@@ -60,12 +66,12 @@ var quotetests = []QuoteTest{
 	{MySQL, "true", true, "1"},
 	{MySQL, "&false", &bool_false, "0"},
 	{MySQL, "&true", &bool_true, "1"},
-	{MySQL, "float32(0.0)", float32_0_0, "0.000000"},
-	{MySQL, "float32(1.0)", float32_1_0, "1.000000"},
-	{MySQL, "float32(-1.5)", float32_m1_5, "-1.500000"},
-	{MySQL, "&float32(0.0)", &float32_0_0, "0.000000"},
-	{MySQL, "&float32(1.0)", &float32_1_0, "1.000000"},
-	{MySQL, "&float32(-1.5)", &float32_m1_5, "-1.500000"},
+	{MySQL, "float32(0.0)", float32_0_0, "0"},
+	{MySQL, "float32(1.0)", float32_1_0, "1"},
+	{MySQL, "float32(-1.5)", float32_m1_5, "-1.5"},
+	{MySQL, "&float32(0.0)", &float32_0_0, "0"},
+	{MySQL, "&float32(1.0)", &float32_1_0, "1"},
+	{MySQL, "&float32(-1.5)", &float32_m1_5, "-1.5"},
 	// Sqlite3
 	{Sqlite3, "NULL", nil, "NULL"},
 	{Sqlite3, "Empty string", "", "''"},
@@ -93,12 +99,12 @@ var quotetests = []QuoteTest{
 	{Sqlite3, "true", true, "1"},
 	{Sqlite3, "&false", &bool_false, "0"},
 	{Sqlite3, "&true", &bool_true, "1"},
-	{Sqlite3, "float32(0.0)", float32_0_0, "0.000000"},
-	{Sqlite3, "float32(1.0)", float32_1_0, "1.000000"},
-	{Sqlite3, "float32(-1.5)", float32_m1_5, "-1.500000"},
-	{Sqlite3, "&float32(0.0)", &float32_0_0, "0.000000"},
-	{Sqlite3, "&float32(1.0)", &float32_1_0, "1.000000"},
-	{Sqlite3, "&float32(-1.5)", &float32_m1_5, "-1.500000"},
+	{Sqlite3, "float32(0.0)", float32_0_0, "0"},
+	{Sqlite3, "float32(1.0)", float32_1_0, "1"},
+	{Sqlite3, "float32(-1.5)", float32_m1_5, "-1.5"},
+	{Sqlite3, "&float32(0.0)", &float32_0_0, "0"},
+	{Sqlite3, "&float32(1.0)", &float32_1_0, "1"},
+	{Sqlite3, "&float32(-1.5)", &float32_m1_5, "-1.5"},
 	// PostgreSQL
 	{PostgreSQL, "NULL", nil, "NULL"},
 	{PostgreSQL, "Empty string", "", "''"},
@@ -126,12 +132,12 @@ var quotetests = []QuoteTest{
 	{PostgreSQL, "true", true, "1"},
 	{PostgreSQL, "&false", &bool_false, "0"},
 	{PostgreSQL, "&true", &bool_true, "1"},
-	{PostgreSQL, "float32(0.0)", float32_0_0, "0.000000"},
-	{PostgreSQL, "float32(1.0)", float32_1_0, "1.000000"},
-	{PostgreSQL, "float32(-1.5)", float32_m1_5, "-1.500000"},
-	{PostgreSQL, "&float32(0.0)", &float32_0_0, "0.000000"},
-	{PostgreSQL, "&float32(1.0)", &float32_1_0, "1.000000"},
-	{PostgreSQL, "&float32(-1.5)", &float32_m1_5, "-1.500000"},
+	{PostgreSQL, "float32(0.0)", float32_0_0, "0"},
+	{PostgreSQL, "float32(1.0)", float32_1_0, "1"},
+	{PostgreSQL, "float32(-1.5)", float32_m1_5, "-1.5"},
+	{PostgreSQL, "&float32(0.0)", &float32_0_0, "0"},
+	{PostgreSQL, "&float32(1.0)", &float32_1_0, "1"},
+	{PostgreSQL, "&float32(-1.5)", &float32_m1_5, "-1.5"},
 }
 
 func TestQuoting(t *testing.T) {
@@ -159,3 +165,274 @@ func TestQuoteTime(t *testing.T) {
 		t.Errorf("&time.Time: expected %v, got %v", expected, got)
 	}
 }
+
+func TestQuoteDuration(t *testing.T) {
+	d := 1500 * time.Millisecond
+	expected := "1500000000"
+	if got := Quote(MySQL, d); got != expected {
+		t.Errorf("time.Duration: expected %v, got %v", expected, got)
+	}
+	if got := Quote(MySQL, &d); got != expected {
+		t.Errorf("&time.Duration: expected %v, got %v", expected, got)
+	}
+	var nilDuration *time.Duration
+	if got := Quote(MySQL, nilDuration); got != "NULL" {
+		t.Errorf("nil *time.Duration: expected %v, got %v", "NULL", got)
+	}
+}
+
+func TestQuoteIntegerKinds(t *testing.T) {
+	type status int8
+	i8, u8, u, st := int8(-8), uint8(8), uint(42), status(3)
+	var nilInt8 *int8
+	var nilUint8 *uint8
+	var nilStatus *status
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{int8(-8), "-8"},
+		{int8(math.MaxInt8), "127"},
+		{uint8(8), "8"},
+		{uint8(math.MaxUint8), "255"},
+		{&i8, "-8"},
+		{&u8, "8"},
+		{&u, "42"},
+		{nilInt8, "NULL"},
+		{nilUint8, "NULL"},
+		{st, "3"},
+		{&st, "3"},
+		{nilStatus, "NULL"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+	}
+	for _, test := range tests {
+		got, err := QuoteValue(MySQL, test.input)
+		if err != nil {
+			t.Fatalf("%T: expected no error, got %v", test.input, err)
+		}
+		if got != test.expected {
+			t.Errorf("%T: expected %v, got %v", test.input, test.expected, got)
+		}
+	}
+}
+
+func TestQuoteNamedTypes(t *testing.T) {
+	type cents int64
+	type score float64
+	type state string
+	type flag bool
+	c, sc, st := cents(1999), score(2.5), state("it's new")
+	var nilScore *score
+	var nilState *state
+	tests := []struct {
+		dialect  Dialect
+		input    interface{}
+		expected string
+	}{
+		{MySQL, cents(1999), "1999"},
+		{MySQL, cents(-5), "-5"},
+		{MySQL, &c, "1999"},
+		{MySQL, score(2.5), "2.5"},
+		{MySQL, &sc, "2.5"},
+		{MySQL, nilScore, "NULL"},
+		{MySQL, state("it's new"), "'it\\'s new'"},
+		{Sqlite3, &st, "'it''s new'"},
+		{PostgreSQL, nilState, "NULL"},
+		{MySQL, flag(true), "1"},
+		{MySQL, flag(false), "0"},
+	}
+	for _, test := range tests {
+		got, err := QuoteValue(test.dialect, test.input)
+		if err != nil {
+			t.Fatalf("%T: expected no error, got %v", test.input, err)
+		}
+		if got != test.expected {
+			t.Errorf("%T: expected %v, got %v", test.input, test.expected, got)
+		}
+	}
+	if _, err := QuoteValue(MySQL, score(math.NaN())); err == nil {
+		t.Errorf("expected error on NaN")
+	}
+}
+
+func TestQuoteBig(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{big.NewRat(933, 100), "9.33"},
+		{big.NewRat(-1, 8), "-0.125"},
+		{big.NewRat(42, 1), "42"},
+		{big.NewFloat(9.5), "9.5"},
+		{(*big.Rat)(nil), "NULL"},
+		{(*big.Float)(nil), "NULL"},
+	}
+	for _, test := range tests {
+		got, err := QuoteValue(MySQL, test.input)
+		if err != nil {
+			t.Fatalf("%v: expected no error, got %v", test.input, err)
+		}
+		if got != test.expected {
+			t.Errorf("expected %v, got %v", test.expected, got)
+		}
+	}
+
+	// 1/3 cannot be written as an exact decimal
+	if _, err := QuoteValue(MySQL, big.NewRat(1, 3)); err == nil {
+		t.Errorf("expected error for 1/3")
+	}
+}
+
+func TestQuoteIPAndURL(t *testing.T) {
+	ip := net.ParseIP("192.168.0.1")
+	expected := "'192.168.0.1'"
+	if got := Quote(MySQL, ip); got != expected {
+		t.Errorf("net.IP: expected %v, got %v", expected, got)
+	}
+	var nilIP net.IP
+	if got := Quote(MySQL, nilIP); got != "NULL" {
+		t.Errorf("nil net.IP: expected %v, got %v", "NULL", got)
+	}
+
+	u, _ := url.Parse("http://example.com/?q=it's")
+	expected = "'http://example.com/?q=it\\'s'"
+	if got := Quote(MySQL, u); got != expected {
+		t.Errorf("*url.URL: expected %v, got %v", expected, got)
+	}
+	if got := Quote(MySQL, *u); got != expected {
+		t.Errorf("url.URL: expected %v, got %v", expected, got)
+	}
+}
+
+func TestQuoteValuer(t *testing.T) {
+	if got := Quote(MySQL, green); got != "'green'" {
+		t.Errorf("color: expected %v, got %v", "'green'", got)
+	}
+	var nilColor *color
+	if got := Quote(MySQL, nilColor); got != "NULL" {
+		t.Errorf("nil *color: expected %v, got %v", "NULL", got)
+	}
+	if got := Quote(MySQL, sql.NullString{String: "it's", Valid: true}); got != "'it\\'s'" {
+		t.Errorf("sql.NullString: expected %v, got %v", "'it\\'s'", got)
+	}
+	if got := Quote(MySQL, sql.NullInt64{}); got != "NULL" {
+		t.Errorf("invalid sql.NullInt64: expected %v, got %v", "NULL", got)
+	}
+}
+
+// digest is a driver.Valuer with a binary value.
+type digest [2]byte
+
+func (d digest) Value() (driver.Value, error) {
+	return d[:], nil
+}
+
+func TestQuoteValuerWithBytes(t *testing.T) {
+	d := digest{0x27, 0x5c}
+	for _, dialect := range []Dialect{MySQL, Sqlite3, PostgreSQL, Oracle} {
+		expected := quoteBytes(dialect, d[:])
+		if got := Quote(dialect, d); got != expected {
+			t.Errorf("%v: expected %v, got %v", dialect, expected, got)
+		}
+	}
+}
+
+func TestQuoteSqlNullTypes(t *testing.T) {
+	dt := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{sql.NullString{String: "Oliver", Valid: true}, "'Oliver'"},
+		{sql.NullString{}, "NULL"},
+		{sql.NullInt64{Int64: 42, Valid: true}, "42"},
+		{sql.NullInt64{}, "NULL"},
+		{sql.NullFloat64{Float64: 1.5, Valid: true}, "1.5"},
+		{sql.NullFloat64{}, "NULL"},
+		{sql.NullBool{Bool: true, Valid: true}, "1"},
+		{sql.NullBool{}, "NULL"},
+		{sql.NullTime{Time: dt, Valid: true}, Quote(Sqlite3, dt)},
+		{sql.NullTime{}, "NULL"},
+	}
+	for _, test := range tests {
+		got, err := QuoteValue(Sqlite3, test.input)
+		if err != nil {
+			t.Fatalf("%T: expected no error, got %v", test.input, err)
+		}
+		if got != test.expected {
+			t.Errorf("%T: expected %v, got %v", test.input, test.expected, got)
+		}
+	}
+}
+
+func TestQuoteByteSlice(t *testing.T) {
+	b := []byte("it's")
+	expected := "X'69742773'"
+	if got := Quote(MySQL, b); got != expected {
+		t.Errorf("[]byte: expected %v, got %v", expected, got)
+	}
+	if got := Quote(MySQL, &b); got != expected {
+		t.Errorf("*[]byte: expected %v, got %v", expected, got)
+	}
+	var nilBytes []byte
+	if got := Quote(MySQL, nilBytes); got != "NULL" {
+		t.Errorf("nil []byte: expected %v, got %v", "NULL", got)
+	}
+	if got := Quote(MySQL, &nilBytes); got != "NULL" {
+		t.Errorf("&nil []byte: expected %v, got %v", "NULL", got)
+	}
+}
+
+func TestQuoteValueWithUnsupportedType(t *testing.T) {
+	if _, err := QuoteValue(MySQL, struct{}{}); err == nil {
+		t.Errorf("expected error on unsupported type")
+	}
+	if _, err := QuoteValue(MySQL, color(42)); err == nil {
+		t.Errorf("expected error on failing driver.Valuer")
+	}
+	got, err := QuoteValue(MySQL, "Oliver")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got != "'Oliver'" {
+		t.Errorf("expected %v, got %v", "'Oliver'", got)
+	}
+
+	defer func() {
+		if p := recover(); p == nil {
+			t.Errorf("expected Quote to panic on unsupported type")
+		}
+	}()
+	Quote(MySQL, struct{}{})
+}
+
+func TestQuoteFloat(t *testing.T) {
+	tests := []struct {
+		Input    interface{}
+		Expected string
+	}{
+		{float64(1234567.891234), "1.234567891234e+06"},
+		{float64(1e20), "1e+20"},
+		{float64(-0.000001), "-1e-06"},
+		{float32(0.1), "0.1"},
+		{float64(0.1), "0.1"},
+		{math.Copysign(0, -1), "0"},
+		{math.MaxFloat64, "1.7976931348623157e+308"},
+	}
+	for _, test := range tests {
+		got, err := QuoteValue(MySQL, test.Input)
+		if err != nil {
+			t.Fatalf("%T(%v): expected no error, got %v", test.Input, test.Input, err)
+		}
+		if got != test.Expected {
+			t.Errorf("%T(%v): expected %v, got %v", test.Input, test.Input, test.Expected, got)
+		}
+	}
+
+	invalid := []interface{}{math.NaN(), math.Inf(1), math.Inf(-1), float32(math.Inf(1))}
+	for _, f := range invalid {
+		if got, err := QuoteValue(MySQL, f); err == nil {
+			t.Errorf("%T(%v): expected error, got %v", f, f, got)
+		}
+	}
+}
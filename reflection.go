@@ -7,15 +7,72 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
 )
 
 var (
-	typeCacheMu sync.RWMutex               // guards the typeCache
-	typeCache   map[reflect.Type]*typeInfo // information about types
+	typeCacheMu    sync.RWMutex               // guards the typeCache and namingStrategy
+	typeCache      map[reflect.Type]*typeInfo // information about types
+	namingStrategy NamingStrategy             // maps untagged field names to column names
 )
 
+// NamingStrategy maps the name of a struct field to a column name.
+// It is used for fields without a column name in their dapper tag.
+type NamingStrategy func(fieldName string) string
+
+// IdentityNaming uses the field name as column name, e.g. UserId
+// maps to UserId. This is the default.
+func IdentityNaming(fieldName string) string {
+	return fieldName
+}
+
+// SnakeCaseNaming converts the field name to snake case, e.g. UserId
+// maps to user_id and HTTPServer maps to http_server.
+func SnakeCaseNaming(fieldName string) string {
+	var b strings.Builder
+	runes := []rune(fieldName)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a new word at an upper case letter that follows a lower
+			// case letter or digit, or that starts a word after an acronym
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteRune('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// SetNamingStrategy sets the strategy to derive column names from field
+// names for all types. Pass nil to restore IdentityNaming. As the mapping
+// of types is cached, call it once before using dapper.
+func SetNamingStrategy(strategy NamingStrategy) {
+	typeCacheMu.Lock()
+	defer typeCacheMu.Unlock()
+	namingStrategy = strategy
+	if namingStrategy == nil {
+		namingStrategy = IdentityNaming
+	}
+	// Clear the cache, as it contains column names of the previous strategy
+	typeCache = make(map[reflect.Type]*typeInfo)
+}
+
 func init() {
 	typeCache = make(map[reflect.Type]*typeInfo)
+	namingStrategy = IdentityNaming
+}
+
+// TableNamer is implemented by types that specify their table name via
+// a method instead of a tag, e.g. because no field is a natural place
+// for the tag. If a type implements TableNamer and has a table tag as
+// well, TableName wins. It is called on a pointer to the zero value.
+type TableNamer interface {
+	TableName() string
 }
 
 // typeInfo contains all dapper-specific information about a type.
@@ -25,6 +82,8 @@ type typeInfo struct {
 	Type reflect.Type
 	// Table name
 	TableName string
+	// Is the table read-only, e.g. a view (... `dapper:"id,primarykey,table=xxx,readonly"`)
+	ReadOnly bool
 	// Names of the type in Go
 	FieldNames []string
 	// Detailed information indexed by field name
@@ -50,12 +109,30 @@ type fieldInfo struct {
 	ColumnName string
 	// Type of the field in Go (int32, string etc.)
 	Type reflect.Type
+	// Index of the field in the struct (see reflect.Value.FieldByIndex)
+	Index []int
 	// Is this field specified as primarykey (... `dapper:"id,primarykey"`)
 	IsPrimaryKey bool
 	// Is this field specified as auto-increment (... `dapper:"id,autoincrement"`)
 	IsAutoIncrement bool
 	// Is this field specified as transient (... `dapper:"-"`)
 	IsTransient bool
+	// Is the zero value of this field written as NULL (... `dapper:"created,nullzero"`)
+	IsNullZero bool
+	// Is this field the version column for optimistic locking (... `dapper:"version,version"`)
+	IsVersion bool
+	// Is this field the timestamp of a soft delete (... `dapper:"deleted_at,softdelete"`)
+	IsSoftDelete bool
+	// Is this field set to the current time on insert (... `dapper:"created_at,autocreatetime"`)
+	IsAutoCreateTime bool
+	// Is this field set to the current time on insert and update (... `dapper:"updated_at,autoupdatetime"`)
+	IsAutoUpdateTime bool
+	// Is this column left to its database default on insert if zero (... `dapper:"status,default"`)
+	IsDefault bool
+	// Is this column managed by the database and never written (... `dapper:"total,readonly"`)
+	IsReadOnly bool
+	// Is this field stored as JSON in the column (... `dapper:"meta,json"`)
+	IsJSON bool
 }
 
 // oneToOneInfo contains information about a 1:1 reference to another table.
@@ -101,6 +178,7 @@ func AddType(gotype reflect.Type) (*typeInfo, error) {
 		typeCacheMu.RUnlock()
 		return ti, nil
 	}
+	columnName := namingStrategy
 	typeCacheMu.RUnlock()
 
 	// Inspect and add to type cache
@@ -117,25 +195,35 @@ func AddType(gotype reflect.Type) (*typeInfo, error) {
 	}
 
 	// Grab information about all the fields
+	var embedded []reflect.StructField
 	n := gotype.NumField()
 	for i := 0; i < n; i++ {
 		field := gotype.Field(i)
 
+		// Embedded structs are flattened below
+		if isEmbeddedStruct(field) {
+			embedded = append(embedded, field)
+			continue
+		}
+
 		// Only support certain types of fields
 		switch field.Type.Kind() {
 		case reflect.Chan,
 			reflect.Func,
-			reflect.Interface,
-			reflect.Map,
-			//reflect.Slice,
-			//reflect.Struct,
 			reflect.UnsafePointer:
 			continue
+		case reflect.Interface,
+			reflect.Map:
+			// Only as JSON columns
+			if !isJSONField(field) {
+				continue
+			}
 		}
 
 		fi := &fieldInfo{
 			FieldName:       field.Name,
 			Type:            field.Type,
+			Index:           field.Index,
 			IsPrimaryKey:    false,
 			IsAutoIncrement: false,
 			IsTransient:     false,
@@ -159,9 +247,12 @@ func AddType(gotype reflect.Type) (*typeInfo, error) {
 				oneToMany = &oneToManyInfo{
 					FieldName:       field.Name,
 					SliceType:       field.Type,
-					ElemType:        field.Type.Elem(),
 					ForeignKeyField: parts[1],
 				}
+				if field.Type.Kind() == reflect.Slice {
+					// Otherwise, loading fails with ErrOneToManyNotSlice
+					oneToMany.ElemType = field.Type.Elem()
+				}
 				fi = nil
 			} else if strings.HasPrefix(tag, "oneToOne") {
 				// oneToOne=<foreign-key-field-name>
@@ -184,12 +275,16 @@ func AddType(gotype reflect.Type) (*typeInfo, error) {
 						// Ignore this field/column (transient)
 						fi.ColumnName = ""
 						fi.IsTransient = true
+					} else if tags[0] == "" {
+						// No column name, e.g. `dapper:",primarykey"`
+						fi.ColumnName = columnName(field.Name)
 					} else {
 						// Normal column
 						fi.ColumnName = tags[0]
 					}
 
 					// Check for additional tags
+					readOnly, hasTable := false, false
 					for _, t := range tags[1:] {
 						if t == "primarykey" || t == "pk" {
 							fi.IsPrimaryKey = true
@@ -197,17 +292,54 @@ func AddType(gotype reflect.Type) (*typeInfo, error) {
 						if t == "autoincrement" || t == "serial" {
 							fi.IsAutoIncrement = true
 						}
+						if t == "nullzero" {
+							fi.IsNullZero = true
+						}
+						if t == "version" {
+							fi.IsVersion = true
+						}
+						if t == "softdelete" {
+							fi.IsSoftDelete = true
+						}
+						if t == "autocreatetime" {
+							fi.IsAutoCreateTime = true
+						}
+						if t == "autoupdatetime" {
+							fi.IsAutoUpdateTime = true
+						}
+						if t == "default" {
+							fi.IsDefault = true
+						}
+						if t == "readonly" {
+							readOnly = true
+						}
+						if t == "view" {
+							// Alias of readonly next to the table name
+							ti.ReadOnly = true
+						}
+						if t == "json" {
+							fi.IsJSON = true
+						}
 						if strings.HasPrefix(t, "table") {
 							// table=xxx
 							tableAndName := strings.SplitN(t, "=", 2)
 							ti.TableName = tableAndName[1]
+							hasTable = true
+						}
+					}
+					if readOnly {
+						// Next to the table name, the whole table is read-only
+						if hasTable {
+							ti.ReadOnly = true
+						} else {
+							fi.IsReadOnly = true
 						}
 					}
 				}
 			} // end of field name
 		} else {
-			// No `dapper` tag, so treat field name as column name
-			fi.ColumnName = field.Name
+			// No `dapper` tag, so derive the column name from the field name
+			fi.ColumnName = columnName(field.Name)
 		}
 
 		if fi != nil {
@@ -232,15 +364,102 @@ func AddType(gotype reflect.Type) (*typeInfo, error) {
 			ti.AssocFieldNames = append(ti.AssocFieldNames, oneToMany.FieldName)
 			ti.OneToManyInfos[oneToMany.FieldName] = oneToMany
 		}
+	}
 
-		typeCacheMu.Lock()
-		typeCache[gotype] = ti
-		typeCacheMu.Unlock()
+	// Hoist the fields of embedded structs as if they were declared
+	// directly, unless a field or column of the outer struct collides
+	for _, field := range embedded {
+		eti, err := AddType(field.Type)
+		if err != nil {
+			return nil, err
+		}
+		if ti.TableName == "" {
+			ti.TableName = eti.TableName
+		}
+		if eti.ReadOnly {
+			ti.ReadOnly = true
+		}
+		for _, name := range eti.FieldNames {
+			fi := eti.FieldInfos[name]
+			if _, found := ti.FieldInfos[name]; found {
+				continue
+			}
+			if _, found := ti.ColumnInfos[fi.ColumnName]; found && !fi.IsTransient {
+				continue
+			}
+			// The field is reached via the embedded struct
+			hoisted := *fi
+			hoisted.Index = append(append([]int{}, field.Index...), fi.Index...)
+			fi = &hoisted
+			ti.FieldNames = append(ti.FieldNames, fi.FieldName)
+			ti.FieldInfos[fi.FieldName] = fi
+			if !fi.IsTransient {
+				ti.ColumnNames = append(ti.ColumnNames, fi.ColumnName)
+				ti.ColumnInfos[fi.ColumnName] = fi
+			}
+		}
+		for _, name := range eti.AssocFieldNames {
+			if _, found := ti.FieldInfos[name]; found {
+				continue
+			}
+			if _, found := ti.OneToOneInfos[name]; found {
+				continue
+			}
+			if _, found := ti.OneToManyInfos[name]; found {
+				continue
+			}
+			if oneToOne, found := eti.OneToOneInfos[name]; found {
+				hoisted := *oneToOne
+				hoisted.SelfType = gotype
+				ti.AssocFieldNames = append(ti.AssocFieldNames, name)
+				ti.OneToOneInfos[name] = &hoisted
+			}
+			if oneToMany, found := eti.OneToManyInfos[name]; found {
+				ti.AssocFieldNames = append(ti.AssocFieldNames, name)
+				ti.OneToManyInfos[name] = oneToMany
+			}
+		}
+	}
+
+	// The TableName method wins over the table tag
+	if tn, ok := reflect.New(gotype).Interface().(TableNamer); ok {
+		ti.TableName = tn.TableName()
 	}
 
+	// Publish ti only now that it is complete. If another goroutine has
+	// added the type in the meantime, use that one.
+	typeCacheMu.Lock()
+	defer typeCacheMu.Unlock()
+	if existing, found := typeCache[gotype]; found {
+		return existing, nil
+	}
+	typeCache[gotype] = ti
+
 	return ti, nil
 }
 
+// isJSONField returns true if field is tagged to be stored as JSON, e.g.
+// `dapper:"meta,json"`.
+func isJSONField(field reflect.StructField) bool {
+	tags := strings.Split(field.Tag.Get("dapper"), ",")
+	for _, t := range tags[1:] {
+		if t == "json" {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmbeddedStruct returns true if field is an anonymous struct (not a
+// pointer to one) without a dapper tag, e.g. a Base struct shared by
+// several models. time.Time is mapped as a column as usual.
+func isEmbeddedStruct(field reflect.StructField) bool {
+	return field.Anonymous &&
+		field.Type.Kind() == reflect.Struct &&
+		field.Type != reflect.TypeOf(time.Time{}) &&
+		field.Tag.Get("dapper") == ""
+}
+
 // GetAutoIncrement returns information about the autoincrement field
 // of the specified type.
 func (ti *typeInfo) GetAutoIncrement() (*fieldInfo, bool) {
@@ -253,16 +472,142 @@ func (ti *typeInfo) GetAutoIncrement() (*fieldInfo, bool) {
 }
 
 // GetPrimaryKey returns information about the primary key field
-// of the specified type.
+// of the specified type. For composite primary keys, it returns
+// the first primary key field (see GetPrimaryKeys).
 func (ti *typeInfo) GetPrimaryKey() (*fieldInfo, bool) {
+	pks := ti.GetPrimaryKeys()
+	if len(pks) == 0 {
+		return nil, false
+	}
+	return pks[0], true
+}
+
+// GetPrimaryKeys returns information about all primary key fields
+// of the specified type, in the order of declaration.
+func (ti *typeInfo) GetPrimaryKeys() []*fieldInfo {
+	pks := make([]*fieldInfo, 0, 1)
+	for _, fname := range ti.FieldNames {
+		if fi := ti.FieldInfos[fname]; fi.IsPrimaryKey {
+			pks = append(pks, fi)
+		}
+	}
+	return pks
+}
+
+// GetVersion returns information about the version field
+// of the specified type, used for optimistic locking.
+func (ti *typeInfo) GetVersion() (*fieldInfo, bool) {
 	for _, fi := range ti.FieldInfos {
-		if fi.IsPrimaryKey {
+		if fi.IsVersion {
 			return fi, true
 		}
 	}
 	return nil, false
 }
 
+// GetSoftDelete returns information about the soft delete field
+// of the specified type.
+func (ti *typeInfo) GetSoftDelete() (*fieldInfo, bool) {
+	for _, fi := range ti.FieldInfos {
+		if fi.IsSoftDelete {
+			return fi, true
+		}
+	}
+	return nil, false
+}
+
+// isSoftDeleted returns true if the type has a soft delete field
+// and it is set in entityv.
+func (ti *typeInfo) isSoftDeleted(entityv reflect.Value) bool {
+	fi, found := ti.GetSoftDelete()
+	if !found {
+		return false
+	}
+	return !reflect.Indirect(entityv).FieldByName(fi.FieldName).IsZero()
+}
+
+// touchCreated sets all autocreatetime and autoupdatetime fields of
+// entityv that are still zero to now. It is used on insert.
+func (ti *typeInfo) touchCreated(entityv reflect.Value, now time.Time) {
+	for _, fi := range ti.FieldInfos {
+		if fi.IsAutoCreateTime || fi.IsAutoUpdateTime {
+			field := reflect.Indirect(entityv).FieldByName(fi.FieldName)
+			if field.IsZero() {
+				setTime(field, now)
+			}
+		}
+	}
+}
+
+// touchUpdated sets all autoupdatetime fields of entityv to now and
+// returns their column names. It is used on update.
+func (ti *typeInfo) touchUpdated(entityv reflect.Value, now time.Time) []string {
+	columns := make([]string, 0)
+	for _, cname := range ti.ColumnNames {
+		fi := ti.ColumnInfos[cname]
+		if fi.IsAutoUpdateTime {
+			setTime(reflect.Indirect(entityv).FieldByName(fi.FieldName), now)
+			columns = append(columns, cname)
+		}
+	}
+	return columns
+}
+
+// setTime sets field, a time.Time or *time.Time, to t if it is settable.
+func setTime(field reflect.Value, t time.Time) {
+	if !field.CanSet() {
+		return
+	}
+	switch field.Interface().(type) {
+	case time.Time:
+		field.Set(reflect.ValueOf(t))
+	case *time.Time:
+		field.Set(reflect.ValueOf(&t))
+	}
+}
+
+// resolveColumnNames maps the given names, either column names or field
+// names, to column names. It returns an error if a name matches no column
+// or refers to the primary key.
+func (ti *typeInfo) resolveColumnNames(names []string) ([]string, error) {
+	cnames := make([]string, 0, len(names))
+	for _, name := range names {
+		fi, found := ti.ColumnInfos[name]
+		if !found {
+			fi, found = ti.FieldInfos[name]
+		}
+		if !found || fi.IsTransient {
+			return nil, fmt.Errorf("dapper: type %s has no column or field %s", ti.Type, name)
+		}
+		if fi.IsPrimaryKey {
+			return nil, fmt.Errorf("dapper: cannot update primary key column %s of type %s", fi.ColumnName, ti.Type)
+		}
+		if fi.IsReadOnly {
+			return nil, fmt.Errorf("dapper: cannot update read-only column %s of type %s", fi.ColumnName, ti.Type)
+		}
+		cnames = append(cnames, fi.ColumnName)
+	}
+	return cnames, nil
+}
+
+// check returns ErrOneToOneNotPointer if the field of the association
+// in type gotype is not a pointer.
+func (info *oneToOneInfo) check(gotype reflect.Type) error {
+	if info.TargetType.Kind() != reflect.Ptr {
+		return fmt.Errorf("%w: field %s.%s", ErrOneToOneNotPointer, gotype, info.FieldName)
+	}
+	return nil
+}
+
+// check returns ErrOneToManyNotSlice if the field of the association
+// in type gotype is not a slice.
+func (info *oneToManyInfo) check(gotype reflect.Type) error {
+	if info.SliceType.Kind() != reflect.Slice {
+		return fmt.Errorf("%w: field %s.%s", ErrOneToManyNotSlice, gotype, info.FieldName)
+	}
+	return nil
+}
+
 // GetTableName returns the name of the table
 // referenced via the association.
 func (info *oneToOneInfo) GetTableName() (string, error) {
@@ -0,0 +1,121 @@
+package dapper
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+)
+
+// stmtCache is a least recently used cache of prepared statements,
+// keyed by their SQL. Statements are reference counted, so a statement
+// evicted while in use is closed only after its last use.
+type stmtCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List // of *stmtEntry, most recently used first
+	hits    int        // number of gets served from the cache
+	misses  int        // number of gets that prepared a statement
+}
+
+// stmtEntry is a prepared statement in a stmtCache.
+type stmtEntry struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int  // number of users of stmt
+	evicted bool // closes stmt after the last user
+}
+
+// newStmtCache returns a cache with at most size prepared statements.
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// get returns the prepared statement for query, preparing it on db if
+// it is not cached yet. The entry must be released after use.
+func (c *stmtCache) get(db *sql.DB, query string) (*stmtEntry, error) {
+	c.mu.Lock()
+	if elem, found := c.entries[query]; found {
+		c.lru.MoveToFront(elem)
+		e := elem.Value.(*stmtEntry)
+		e.refs++
+		c.hits++
+		c.mu.Unlock()
+		return e, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// Prepare without holding the lock, as it is a round-trip
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, found := c.entries[query]; found {
+		// Prepared concurrently by someone else
+		stmt.Close()
+		c.lru.MoveToFront(elem)
+		e := elem.Value.(*stmtEntry)
+		e.refs++
+		return e, nil
+	}
+	e := &stmtEntry{query: query, stmt: stmt, refs: 1}
+	c.entries[query] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		c.evict(c.lru.Back())
+	}
+	return e, nil
+}
+
+// release marks a use of the entry e, as returned by get, as finished.
+func (c *stmtCache) release(e *stmtEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.refs--
+	if e.evicted && e.refs == 0 {
+		e.stmt.Close()
+	}
+}
+
+// evict removes elem from the cache. Its statement is closed right away
+// unless it is in use. The caller must hold the lock.
+func (c *stmtCache) evict(elem *list.Element) {
+	e := elem.Value.(*stmtEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, e.query)
+	e.evicted = true
+	if e.refs == 0 {
+		e.stmt.Close()
+	}
+}
+
+// len returns the number of cached statements.
+func (c *stmtCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// stats returns the number of cached statements and the number of
+// cache hits and misses so far.
+func (c *stmtCache) stats() (size, hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len(), c.hits, c.misses
+}
+
+// close removes and closes all statements of the cache.
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.evict(c.lru.Back())
+	}
+}
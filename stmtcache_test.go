@@ -0,0 +1,63 @@
+package dapper
+
+import (
+	"testing"
+)
+
+func TestStmtCache(t *testing.T) {
+	for _, driver := range drivers {
+		db := setup(driver, t)
+		defer db.Close()
+
+		c := newStmtCache(2)
+		a, err := c.get(db, "select count(*) from users")
+		if err != nil {
+			t.Fatalf("driver %s: error on get: %v", driver, err)
+		}
+		b, err := c.get(db, "select count(*) from tweets")
+		if err != nil {
+			t.Fatalf("driver %s: error on get: %v", driver, err)
+		}
+		c.release(b)
+
+		// A cached statement is reused
+		again, err := c.get(db, "select count(*) from users")
+		if err != nil {
+			t.Fatalf("driver %s: error on get: %v", driver, err)
+		}
+		if again != a {
+			t.Errorf("driver %s: expected cached statement to be reused", driver)
+		}
+		c.release(again)
+
+		// The least recently used statement is evicted and closed
+		d, err := c.get(db, "select count(*) from orders")
+		if err != nil {
+			t.Fatalf("driver %s: error on get: %v", driver, err)
+		}
+		c.release(d)
+		if n := c.len(); n != 2 {
+			t.Errorf("driver %s: expected %d statements, got %d", driver, 2, n)
+		}
+		if !b.evicted {
+			t.Errorf("driver %s: expected statement to be evicted", driver)
+		}
+		if _, err := b.stmt.Exec(); err == nil {
+			t.Errorf("driver %s: expected evicted statement to be closed", driver)
+		}
+
+		// A statement in use is closed after its last use
+		c.close()
+		if n := c.len(); n != 0 {
+			t.Errorf("driver %s: expected %d statements, got %d", driver, 0, n)
+		}
+		var count int64
+		if err := a.stmt.QueryRow().Scan(&count); err != nil {
+			t.Errorf("driver %s: expected statement in use to be open, got %v", driver, err)
+		}
+		c.release(a)
+		if err := a.stmt.QueryRow().Scan(&count); err == nil {
+			t.Errorf("driver %s: expected released statement to be closed", driver)
+		}
+	}
+}